@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/hlog"
 )
 
 // A Scan is at the core of Autoscan.
@@ -16,6 +20,63 @@ type Scan struct {
 	Folder   string
 	Priority int
 	Time     time.Time
+
+	// Deep requests targets to scan the entire library
+	// the folder belongs to instead of only the folder.
+	Deep bool
+
+	// Immediate scans bypass the minimum age and the scan delay.
+	Immediate bool
+
+	// Deleted indicates that files have been deleted from the folder,
+	// so targets should also remove the stale items from their libraries.
+	Deleted bool
+
+	// Targets restricts the Scan to the targets with the given names.
+	// The Scan is sent to all targets when no names are given.
+	Targets []string
+
+	// Reason describes why the Scan was requested, e.g. "Sonarr import: Westworld S01E05".
+	// The reason is shown in the logs, the queue and the history.
+	Reason string
+
+	// Source is the name of the trigger which requested the Scan, e.g. "manual",
+	// or the configured name of the -arr or schedule, e.g. "sonarr-4k".
+	Source string
+
+	// MediaType is the kind of media of the Scan, e.g. "movie", "episode", "track" or "book".
+	// Empty when the trigger does not know the kind of media.
+	MediaType string
+
+	// Libraries are the names of the libraries of the targets the Scan is routed to,
+	// resolved when the Scan is queued. Shown in the queue and the history.
+	Libraries []string
+
+	// Files is the number of files involved in the Scan,
+	// e.g. the track files of a Lidarr import. Zero means unknown.
+	// Merged scans add up their files.
+	Files int
+
+	// ID correlates the Scan with the logs of its trigger and targets.
+	// HTTP triggers use the ID of the request, other scans are given
+	// a new ID when they are added to the processor.
+	ID string
+}
+
+// NewScanID generates a new Scan ID.
+func NewScanID() string {
+	return xid.New().String()
+}
+
+// RequestScanID returns the ID of the request, to be used as the ID of its scans.
+// An empty string is returned when the request has no ID.
+func RequestScanID(r *http.Request) string {
+	id, ok := hlog.IDFromRequest(r)
+	if !ok {
+		return ""
+	}
+
+	return id.String()
 }
 
 type ProcessorFunc func(...Scan) error
@@ -35,6 +96,97 @@ type Target interface {
 	Available() error
 }
 
+// TargetName returns a human-readable name of the Target.
+func TargetName(t Target) string {
+	if s, ok := t.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", t)
+}
+
+// An Analyzer is a Target which can analyze previously scanned folders,
+// e.g. to generate media info.
+//
+// Analyses are expensive and are therefore only processed when
+// no other scans are available.
+type Analyzer interface {
+	Analyze(Scan) error
+}
+
+// An InFlightCounter is a Target which limits the number of
+// scan requests sent at once and reports how many are in flight.
+type InFlightCounter interface {
+	ScansInFlight() int64
+}
+
+// An OrderedTarget is a Target which receives scans in order with the other ordered targets.
+//
+// Ordered targets are sent a scan from the lowest to the highest dispatch order,
+// each only once the targets before it accepted the scan.
+// Targets sharing a dispatch order receive the scan concurrently,
+// as do targets with a dispatch order of 0 alongside the ordered targets.
+type OrderedTarget interface {
+	DispatchOrder() int
+}
+
+// DispatchOrder returns the dispatch order of the Target, 0 when it is unordered.
+func DispatchOrder(t Target) int {
+	if o, ok := t.(OrderedTarget); ok {
+		return o.DispatchOrder()
+	}
+
+	return 0
+}
+
+// A Drainer is a Target which holds back scans in memory, e.g. during a cooldown.
+//
+// Drain is called on shutdown and sends the held back scans right away.
+// It returns the number of scans sent and the scans which could not be sent,
+// which are added to the queue again so they are resumed after a restart.
+type Drainer interface {
+	Drain() (int, []Scan)
+}
+
+// A Requeuer is a Target which hands scans back to the queue after it accepted them,
+// e.g. when the scans it held back during a cooldown could not be sent.
+// SetRequeue is called once the processor is initialised,
+// the requeued scans are only sent to the target again.
+type Requeuer interface {
+	SetRequeue(add ProcessorFunc)
+}
+
+// A LibraryMatcher is a Target which can tell which of its libraries a folder belongs to.
+// It scans the entire library of a Deep scan, as scans merged by library are deep scans.
+type LibraryMatcher interface {
+	// MatchLibrary returns a key identifying the library of the folder,
+	// false when the folder belongs to none of the libraries.
+	MatchLibrary(folder string) (string, bool)
+}
+
+// A LibraryNamer is a Target which can tell the names of the libraries a folder belongs to.
+type LibraryNamer interface {
+	LibraryNames(folder string) []string
+}
+
+// An ItemRefresher is a Target which can refresh a single item of its libraries by its key,
+// e.g. the rating key of a Plex item, instead of scanning a folder.
+type ItemRefresher interface {
+	RefreshItem(key int) error
+}
+
+// A Cooldown describes a library which is held back after a recent scan.
+type Cooldown struct {
+	Library   string        `json:"library"`
+	Remaining time.Duration `json:"remaining"`
+	Pending   int           `json:"pending"`
+}
+
+// A CooldownReporter is a Target which holds back scans of recently scanned libraries.
+type CooldownReporter interface {
+	Cooldowns() []Cooldown
+}
+
 var (
 	// ErrTargetUnavailable may occur when a Target goes offline
 	// or suffers from fatal errors. In this case, the processor
@@ -52,6 +204,20 @@ var (
 	// not available on the file system. Processing should halt
 	// until all anchors are available.
 	ErrAnchorUnavailable = errors.New("anchor file is unavailable")
+
+	// ErrNoLibrary indicates that a Target could not match the
+	// scan to any of its libraries. The scan is dropped and
+	// counted as a failure.
+	ErrNoLibrary = errors.New("no matching library")
+
+	// ErrScanForbidden indicates that a scan was rejected
+	// as it would affect a library which may not be scanned.
+	ErrScanForbidden = errors.New("scan forbidden")
+
+	// ErrScanDeferred is not an error. It indicates that a Target
+	// accepted the scan but holds it back, e.g. during a cooldown,
+	// so the scan is removed from the queue without counting it as processed.
+	ErrScanDeferred = errors.New("scan deferred")
 )
 
 type Rewrite struct {
@@ -61,6 +227,14 @@ type Rewrite struct {
 
 type Rewriter func(string) string
 
+// A RewriteStage is a named set of rewrite rules in a rewrite chain.
+type RewriteStage struct {
+	Name    string    `yaml:"name"`
+	Rewrite []Rewrite `yaml:"rewrite"`
+}
+
+// NewRewriter returns a Rewriter which rewrites the input with the first matching rule.
+// The rules are evaluated in config order, the input is returned as-is when no rule matches.
 func NewRewriter(rewriteRules []Rewrite) (Rewriter, error) {
 	var rewrites []regexp.Regexp
 	for _, rule := range rewriteRules {
@@ -85,6 +259,137 @@ func NewRewriter(rewriteRules []Rewrite) (Rewriter, error) {
 	return rewriter, nil
 }
 
+// NewRewriteChain returns a Rewriter which passes the input through the rewrite rules
+// and then through every stage in order, each stage rewriting the output of the one before.
+// Within the rules and within each stage only the first matching rule is applied.
+func NewRewriteChain(rewriteRules []Rewrite, stages []RewriteStage) (Rewriter, error) {
+	first, err := NewRewriter(rewriteRules)
+	if err != nil {
+		return nil, err
+	}
+
+	rewriters := []Rewriter{first}
+	for i, stage := range stages {
+		rewriter, err := NewRewriter(stage.Rewrite)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite-chain %s: %w", stageName(stage, i), err)
+		}
+
+		rewriters = append(rewriters, rewriter)
+	}
+
+	return func(input string) string {
+		for _, rewrite := range rewriters {
+			input = rewrite(input)
+		}
+
+		return input
+	}, nil
+}
+
+// TrimPrefix returns a Rewriter which removes the first of the prefixes the input starts with,
+// before passing the input on to the rewriter. The prefixes are evaluated in config order
+// and only match entire path elements, so /config/media does not match /config/media2.
+func TrimPrefix(prefixes []string, rewriter Rewriter) Rewriter {
+	if len(prefixes) == 0 {
+		return rewriter
+	}
+
+	return func(input string) string {
+		_, input = trimPrefix(prefixes, input)
+		return rewriter(input)
+	}
+}
+
+// trimPrefix removes the first of the prefixes the input starts with,
+// and returns the index of the prefix, -1 when no prefix matches.
+func trimPrefix(prefixes []string, input string) (int, string) {
+	for i, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if input == prefix {
+			return i, "/"
+		}
+
+		if strings.HasPrefix(input, prefix+"/") {
+			return i, strings.TrimPrefix(input, prefix)
+		}
+	}
+
+	return -1, input
+}
+
+// TrimPrefixTrace trims the input like TrimPrefix does,
+// and returns the result after every evaluated prefix along with the final result.
+// The prefixes after the first matching prefix are not evaluated.
+func TrimPrefixTrace(prefixes []string, input string) ([]RewriteStep, string) {
+	steps := make([]RewriteStep, 0, len(prefixes))
+	for i, prefix := range prefixes {
+		step := RewriteStep{
+			Index:  i,
+			From:   prefix,
+			Result: input,
+		}
+
+		if matched, result := trimPrefix([]string{prefix}, input); matched == 0 {
+			step.Matched = true
+			step.Result = result
+			return append(steps, step), result
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, input
+}
+
+// stageName returns the name of the stage, or its position when it has no name.
+func stageName(stage RewriteStage, i int) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// A RewriteStep describes how a single rewrite rule handled a path.
+type RewriteStep struct {
+	Index   int    `json:"index"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Matched bool   `json:"matched"`
+	Result  string `json:"result"`
+}
+
+// RewriteTrace rewrites the input like the Rewriter of the rules does,
+// and returns the result after every evaluated rule along with the final result.
+// The rules after the first matching rule are not evaluated.
+func RewriteTrace(rewriteRules []Rewrite, input string) ([]RewriteStep, string, error) {
+	steps := make([]RewriteStep, 0, len(rewriteRules))
+	for i, rule := range rewriteRules {
+		re, err := regexp.Compile(rule.From)
+		if err != nil {
+			return nil, input, err
+		}
+
+		step := RewriteStep{
+			Index:  i,
+			From:   rule.From,
+			To:     rule.To,
+			Result: input,
+		}
+
+		if re.MatchString(input) {
+			step.Matched = true
+			step.Result = re.ReplaceAllString(input, rule.To)
+			return append(steps, step), step.Result, nil
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, input, nil
+}
+
 type Filterer func(string) bool
 
 func NewFilterer(includes []string, excludes []string) (Filterer, error) {
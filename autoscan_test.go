@@ -1,6 +1,7 @@
 package autoscan
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -95,7 +96,210 @@ func TestRewriter(t *testing.T) {
 			if result != tc.Expected {
 				t.Errorf("%s does not equal %s", result, tc.Expected)
 			}
+
+			_, traced, err := RewriteTrace(tc.Rewrites, tc.Input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if traced != tc.Expected {
+				t.Errorf("Traced %s does not equal %s", traced, tc.Expected)
+			}
 		})
 	}
 
 }
+
+func TestRewriteChain(t *testing.T) {
+	type Test struct {
+		Name     string
+		Rewrites []Rewrite
+		Stages   []RewriteStage
+		Input    string
+		Expected string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Only the first matching rule is applied without stages",
+			Input:    "/mnt/unionfs/Media/TV/Westworld",
+			Expected: "/data/Media/TV/Westworld",
+			Rewrites: []Rewrite{
+				{From: "^/mnt/unionfs/", To: "/data/"},
+				{From: "^/data/Media/", To: "/data/"},
+			},
+		},
+		{
+			Name:     "Stage rewrites the output of the rules",
+			Input:    "/mnt/unionfs/Media/TV/Westworld",
+			Expected: "/data/TV/Westworld",
+			Rewrites: []Rewrite{{From: "^/mnt/unionfs/", To: "/data/"}},
+			Stages: []RewriteStage{
+				{Name: "flatten", Rewrite: []Rewrite{{From: "^/data/Media/", To: "/data/"}}},
+			},
+		},
+		{
+			Name:     "Stages are applied in order",
+			Input:    "/mnt/unionfs/Media/TV/Westworld",
+			Expected: "/data/Series/Westworld",
+			Stages: []RewriteStage{
+				{Name: "mount", Rewrite: []Rewrite{{From: "^/mnt/unionfs/Media/", To: "/data/"}}},
+				{Name: "rename", Rewrite: []Rewrite{{From: "^/data/TV/", To: "/data/Series/"}}},
+			},
+		},
+		{
+			Name:     "Stage without a match passes its input on",
+			Input:    "/mnt/unionfs/Media/TV/Westworld",
+			Expected: "/data/TV/Westworld",
+			Stages: []RewriteStage{
+				{Rewrite: []Rewrite{{From: "^/Movies/", To: "/data/Movies/"}}},
+				{Rewrite: []Rewrite{{From: "^/mnt/unionfs/Media/", To: "/data/"}}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rewriter, err := NewRewriteChain(tc.Rewrites, tc.Stages)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result := rewriter(tc.Input); result != tc.Expected {
+				t.Errorf("%s does not equal %s", result, tc.Expected)
+			}
+		})
+	}
+
+	_, err := NewRewriteChain(nil, []RewriteStage{{Name: "broken", Rewrite: []Rewrite{{From: "("}}}})
+	if err == nil {
+		t.Error("Expected an error for an invalid rule in a stage")
+	}
+}
+
+func TestRewriteTrace(t *testing.T) {
+	rules := []Rewrite{
+		{From: "^/movies/", To: "/mnt/unionfs/movies/"},
+		{From: "^/movies4k/", To: "/mnt/unionfs/movies4k/"},
+		{From: "^/", To: "/mnt/unionfs/"},
+	}
+
+	steps, result, err := RewriteTrace(rules, "/movies4k/example.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RewriteStep{
+		{Index: 0, From: "^/movies/", To: "/mnt/unionfs/movies/", Result: "/movies4k/example.mp4"},
+		{Index: 1, From: "^/movies4k/", To: "/mnt/unionfs/movies4k/", Matched: true, Result: "/mnt/unionfs/movies4k/example.mp4"},
+	}
+
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Steps do not match:\n%+v\n%+v", steps, want)
+	}
+
+	if result != "/mnt/unionfs/movies4k/example.mp4" {
+		t.Errorf("%s does not equal /mnt/unionfs/movies4k/example.mp4", result)
+	}
+
+	if _, _, err := RewriteTrace([]Rewrite{{From: "("}}, "/movies"); err == nil {
+		t.Error("Expected an error for an invalid rule")
+	}
+}
+
+func TestTrimPrefix(t *testing.T) {
+	type Test struct {
+		Name     string
+		Prefixes []string
+		Input    string
+		Expected string
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Trims the prefix",
+			Prefixes: []string{"/config/media"},
+			Input:    "/config/media/Movies/Tenet (2020)",
+			Expected: "/data/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Ignores a trailing slash of the prefix",
+			Prefixes: []string{"/config/media/"},
+			Input:    "/config/media/Movies/Tenet (2020)",
+			Expected: "/data/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Only trims entire path elements",
+			Prefixes: []string{"/config/media"},
+			Input:    "/config/media2/Movies/Tenet (2020)",
+			Expected: "/config/media2/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Trims the prefix of its root",
+			Prefixes: []string{"/config/media"},
+			Input:    "/config/media",
+			Expected: "/",
+		},
+		{
+			Name:     "Overlapping prefixes trim the first matching prefix, longest first",
+			Prefixes: []string{"/config/media", "/config"},
+			Input:    "/config/media/Movies/Tenet (2020)",
+			Expected: "/data/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Overlapping prefixes trim the first matching prefix, shortest first",
+			Prefixes: []string{"/config", "/config/media"},
+			Input:    "/config/media/Movies/Tenet (2020)",
+			Expected: "/media/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Overlapping prefixes trim only a single prefix",
+			Prefixes: []string{"/config", "/media"},
+			Input:    "/config/media/Movies/Tenet (2020)",
+			Expected: "/media/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Overlapping prefixes fall through to a shorter prefix",
+			Prefixes: []string{"/config/media", "/config"},
+			Input:    "/config/Movies/Tenet (2020)",
+			Expected: "/data/Movies/Tenet (2020)",
+		},
+		{
+			Name:     "Passes the input on without a match",
+			Prefixes: []string{"/config/media"},
+			Input:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			Expected: "/mnt/unionfs/Media/Movies/Tenet (2020)",
+		},
+	}
+
+	// the prefixes are trimmed before the rewrite rules
+	rewriter, err := NewRewriter([]Rewrite{{From: "^/Movies/", To: "/data/Movies/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if result := TrimPrefix(tc.Prefixes, rewriter)(tc.Input); result != tc.Expected {
+				t.Errorf("%s does not equal %s", result, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestTrimPrefixTrace(t *testing.T) {
+	steps, result := TrimPrefixTrace([]string{"/config/media2", "/config/media", "/config"}, "/config/media/Movies")
+
+	want := []RewriteStep{
+		{Index: 0, From: "/config/media2", Result: "/config/media/Movies"},
+		{Index: 1, From: "/config/media", Matched: true, Result: "/Movies"},
+	}
+
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Steps do not match:\n%+v\n%+v", steps, want)
+	}
+
+	if result != "/Movies" {
+		t.Errorf("%s does not equal /Movies", result)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/hlog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/processor"
+)
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func targetsAPIHandler(proc *processor.Processor, targets []autoscan.Target) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, getTargetStates(proc, targets))
+	}
+}
+
+func configAPIHandler(c config) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		raw, err := redactedConfig(c)
+		if err != nil {
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+
+		var v any
+		if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, jsonValue(v))
+	}
+}
+
+// jsonValue converts a value decoded from YAML into a value which can be encoded as JSON,
+// as YAML decodes maps with non-string keys.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type targetTestResponse struct {
+	Target  string `json:"target"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+func targetTestHandler(targets []autoscan.Target) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rlog := hlog.FromRequest(r)
+
+		index, err := strconv.Atoi(chi.URLParam(r, "index"))
+		if err != nil || index < 0 || index >= len(targets) {
+			writeJSON(rw, http.StatusNotFound, errorResponse{Error: "target not found"})
+			return
+		}
+
+		target := targets[index]
+
+		start := time.Now()
+		err = target.Available()
+		resp := targetTestResponse{
+			Target:  autoscan.TargetName(target),
+			Success: err == nil,
+			Latency: time.Since(start).String(),
+		}
+
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		rlog.Info().
+			Str("target", resp.Target).
+			Bool("success", resp.Success).
+			Str("latency", resp.Latency).
+			Msg("Tested target connectivity")
+
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+type scanRequest struct {
+	Folder    string   `json:"folder"`
+	Priority  int      `json:"priority"`
+	Deep      bool     `json:"deep"`
+	Immediate bool     `json:"immediate"`
+	Targets   []string `json:"targets"`
+	Reason    string   `json:"reason"`
+
+	// RatingKey refreshes a single item of the target instead of scanning a folder.
+	RatingKey json.Number `json:"ratingKey,omitempty"`
+	Target    string      `json:"target,omitempty"`
+}
+
+type scanResponse struct {
+	ID string `json:"id"`
+}
+
+// scanAPIHandler adds a scan to the processor.
+// The scan is sent to the targets with the given names, or to all targets when no names are given.
+// When libraries are allowed, only scans of the allowed libraries are added.
+func scanAPIHandler(add autoscan.ProcessorFunc, targets []autoscan.Target, allowed []string) http.HandlerFunc {
+	add = allowedLibraries(allowed, targets, add)
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rlog := hlog.FromRequest(r)
+
+		var req scanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(rw, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+
+		if req.RatingKey != "" {
+			// the library of an item is unknown, so items can only be refreshed when all libraries are allowed
+			if len(allowed) > 0 {
+				rlog.Warn().Msg("Requested an item refresh while the libraries are restricted")
+				writeJSON(rw, http.StatusForbidden, errorResponse{Error: fmt.Sprintf("ratingKey is not allowed with allowed-libraries: %v", autoscan.ErrScanForbidden)})
+				return
+			}
+
+			refreshItem(rw, r, req, targets)
+			return
+		}
+
+		if req.Folder == "" {
+			writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "folder is required"})
+			return
+		}
+
+		for _, name := range req.Targets {
+			if !hasTarget(targets, name) {
+				writeJSON(rw, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("unknown target: %s", name)})
+				return
+			}
+		}
+
+		reason := req.Reason
+		if reason == "" {
+			reason = "api"
+		}
+
+		scan := autoscan.Scan{
+			Folder:    path.Clean(req.Folder),
+			Priority:  req.Priority,
+			Time:      time.Now(),
+			Deep:      req.Deep,
+			Immediate: req.Immediate,
+			Targets:   req.Targets,
+			Reason:    reason,
+			Source:    "api",
+			ID:        autoscan.RequestScanID(r),
+		}
+
+		if scan.ID == "" {
+			scan.ID = autoscan.NewScanID()
+		}
+
+		err := add(scan)
+		if errors.Is(err, autoscan.ErrScanForbidden) {
+			rlog.Warn().Err(err).Msg("Requested a scan of a library which is not allowed")
+			writeJSON(rw, http.StatusForbidden, errorResponse{Error: err.Error()})
+			return
+		}
+
+		if err != nil {
+			rlog.Error().Err(err).Msg("Processor could not process scan")
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+
+		rlog.Info().
+			Str("path", scan.Folder).
+			Strs("targets", scan.Targets).
+			Msg("Scan moved to processor")
+
+		writeJSON(rw, http.StatusOK, scanResponse{ID: scan.ID})
+	}
+}
+
+// refreshItem refreshes the item with the rating key of the request right away,
+// without adding a scan to the processor.
+func refreshItem(rw http.ResponseWriter, r *http.Request, req scanRequest, targets []autoscan.Target) {
+	rlog := hlog.FromRequest(r)
+
+	ratingKey, err := strconv.Atoi(req.RatingKey.String())
+	if err != nil || ratingKey <= 0 {
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid ratingKey %q: must be a positive number", req.RatingKey)})
+		return
+	}
+
+	if req.Folder != "" {
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "either folder or ratingKey must be given"})
+		return
+	}
+
+	if req.Target == "" {
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "target is required with ratingKey"})
+		return
+	}
+
+	target, ok := findTarget(targets, req.Target)
+	if !ok {
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("unknown target: %s", req.Target)})
+		return
+	}
+
+	refresher, ok := target.(autoscan.ItemRefresher)
+	if !ok {
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("target %s cannot refresh items by ratingKey", req.Target)})
+		return
+	}
+
+	err = refresher.RefreshItem(ratingKey)
+	switch {
+	case errors.Is(err, autoscan.ErrTargetUnavailable):
+		rlog.Warn().Err(err).Str("target", req.Target).Int("rating_key", ratingKey).Msg("Target unavailable, item not refreshed")
+		writeJSON(rw, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		rlog.Error().Err(err).Str("target", req.Target).Int("rating_key", ratingKey).Msg("Failed refreshing item")
+		writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	id := autoscan.RequestScanID(r)
+	if id == "" {
+		id = autoscan.NewScanID()
+	}
+
+	rlog.Info().
+		Str("target", req.Target).
+		Int("rating_key", ratingKey).
+		Msg("Item refreshed")
+
+	writeJSON(rw, http.StatusOK, scanResponse{ID: id})
+}
+
+func hasTarget(targets []autoscan.Target, name string) bool {
+	_, ok := findTarget(targets, name)
+	return ok
+}
+
+// findTarget returns the target with the given name.
+func findTarget(targets []autoscan.Target, name string) (autoscan.Target, bool) {
+	for _, target := range targets {
+		if autoscan.TargetName(target) == name {
+			return target, true
+		}
+	}
+
+	return nil, false
+}
+
+// failedScans manages the scans which failed without being handled by the targets.
+type failedScans interface {
+	Failed() ([]processor.FailedScan, error)
+	RetryFailed(id string) (autoscan.Scan, error)
+	DiscardFailed(id string) error
+}
+
+// writeFailed responds with the failed scans.
+func writeFailed(rw http.ResponseWriter, failed failedScans) {
+	scans, err := failed.Failed()
+	if err != nil {
+		writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	if scans == nil {
+		scans = []processor.FailedScan{}
+	}
+
+	writeJSON(rw, http.StatusOK, scans)
+}
+
+func failedAPIHandler(failed failedScans) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeFailed(rw, failed)
+	}
+}
+
+// retryFailedHandler moves a failed scan back to the queue and responds with the remaining failed scans.
+func retryFailedHandler(failed failedScans) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rlog := hlog.FromRequest(r)
+		id := chi.URLParam(r, "id")
+
+		scan, err := failed.RetryFailed(id)
+		switch {
+		case errors.Is(err, processor.ErrFailedScanNotFound):
+			writeJSON(rw, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		case err != nil:
+			rlog.Error().Err(err).Str("failed_id", id).Msg("Failed retrying failed scan")
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+
+		rlog.Info().
+			Str("failed_id", id).
+			Str("scan_id", scan.ID).
+			Str("path", scan.Folder).
+			Msg("Failed scan moved to queue")
+
+		writeFailed(rw, failed)
+	}
+}
+
+// discardFailedHandler removes a failed scan and responds with the remaining failed scans.
+func discardFailedHandler(failed failedScans) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rlog := hlog.FromRequest(r)
+		id := chi.URLParam(r, "id")
+
+		err := failed.DiscardFailed(id)
+		switch {
+		case errors.Is(err, processor.ErrFailedScanNotFound):
+			writeJSON(rw, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		case err != nil:
+			rlog.Error().Err(err).Str("failed_id", id).Msg("Failed discarding failed scan")
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+
+		rlog.Info().
+			Str("failed_id", id).
+			Msg("Failed scan discarded")
+
+		writeFailed(rw, failed)
+	}
+}
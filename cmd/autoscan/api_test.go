@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/processor"
+	"github.com/cloudbox/autoscan/targets/emby"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+// itemRefresher is a target which records the refreshed rating keys.
+type itemRefresher struct {
+	*mock.Target
+	refreshed []int
+}
+
+func (t *itemRefresher) RefreshItem(key int) error {
+	t.refreshed = append(t.refreshed, key)
+	return nil
+}
+
+func TestRefreshItemAPI(t *testing.T) {
+	type Test struct {
+		Name       string
+		Body       string
+		Allowed    []string
+		WantStatus int
+		WantKeys   []int
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Number",
+			Body:       `{"ratingKey": 12345, "target": "plex"}`,
+			WantStatus: http.StatusOK,
+			WantKeys:   []int{12345},
+		},
+		{
+			Name:       "String",
+			Body:       `{"ratingKey": "12345", "target": "plex"}`,
+			WantStatus: http.StatusOK,
+			WantKeys:   []int{12345},
+		},
+		{
+			Name:       "Not numeric",
+			Body:       `{"ratingKey": "abc", "target": "plex"}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Negative",
+			Body:       `{"ratingKey": -1, "target": "plex"}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Fraction",
+			Body:       `{"ratingKey": 1.5, "target": "plex"}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Missing target",
+			Body:       `{"ratingKey": 12345}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Target without item refreshes",
+			Body:       `{"ratingKey": 12345, "target": "emby"}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Folder and rating key",
+			Body:       `{"ratingKey": 12345, "target": "plex", "folder": "/Movies"}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Allowed libraries",
+			Body:       `{"ratingKey": 12345, "target": "plex"}`,
+			Allowed:    []string{"Movies"},
+			WantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			plex, _ := mock.New(mock.Config{Name: "plex"})
+			emby, _ := mock.New(mock.Config{Name: "emby"})
+			refresher := &itemRefresher{Target: plex}
+
+			add := func(scans ...autoscan.Scan) error {
+				t.Errorf("Expected no scans to be added, got: %v", scans)
+				return nil
+			}
+
+			rec := httptest.NewRecorder()
+			scanAPIHandler(add, []autoscan.Target{refresher, emby}, tc.Allowed)(rec, httptest.NewRequest("POST", "/api/scan", strings.NewReader(tc.Body)))
+
+			if rec.Code != tc.WantStatus {
+				t.Fatalf("Status codes do not match: %d vs %d (%s)", rec.Code, tc.WantStatus, rec.Body)
+			}
+
+			if !reflect.DeepEqual(refresher.refreshed, tc.WantKeys) {
+				t.Errorf("Refreshed keys do not match: %v vs %v", refresher.refreshed, tc.WantKeys)
+			}
+		})
+	}
+}
+
+func TestConfigAPIHandler(t *testing.T) {
+	c := config{Port: 3030}
+	c.Auth.Username = "user"
+	c.Auth.Password = "s3cr3t"
+	c.Targets.Emby = []emby.Config{{URL: "http://emby:8096", Token: "s3cr3t"}}
+	c.Notify.URL = "https://discord.com/api/webhooks/1234/s3cr3t"
+
+	rec := httptest.NewRecorder()
+	configAPIHandler(c)(rec, httptest.NewRequest("GET", "/api/config", nil))
+
+	var resp struct {
+		Port int `json:"port"`
+		Auth struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"authentication"`
+		Targets struct {
+			Emby []struct {
+				URL   string `json:"url"`
+				Token string `json:"token"`
+			} `json:"emby"`
+		} `json:"targets"`
+		Notify struct {
+			URL string `json:"url"`
+		} `json:"notify"`
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Port != 3030 || resp.Auth.Username != "user" {
+		t.Errorf("Expected the config to be returned, got: %+v", resp)
+	}
+
+	if resp.Auth.Password != "REDACTED" {
+		t.Errorf("Expected the password to be redacted, got: %s", resp.Auth.Password)
+	}
+
+	if len(resp.Targets.Emby) != 1 || resp.Targets.Emby[0].Token != "REDACTED" {
+		t.Errorf("Expected the emby token to be redacted, got: %+v", resp.Targets.Emby)
+	}
+
+	if resp.Notify.URL != "REDACTED" {
+		t.Errorf("Expected the notify URL to be redacted, got: %s", resp.Notify.URL)
+	}
+}
+
+func TestScanAPIHandler(t *testing.T) {
+	type Test struct {
+		Name       string
+		Body       string
+		WantStatus int
+		WantScan   *autoscan.Scan
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "All targets",
+			Body:       `{"folder": "/mnt/unionfs/Media/Movies/Interstellar (2014)/", "priority": 2}`,
+			WantStatus: http.StatusOK,
+			WantScan:   &autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 2, Reason: "api", Source: "api"},
+		},
+		{
+			Name:       "Named targets",
+			Body:       `{"folder": "/mnt/unionfs/Media/Movies 4K/Interstellar (2014)", "immediate": true, "targets": ["plex-4k"], "reason": "4K remux added"}`,
+			WantStatus: http.StatusOK,
+			WantScan:   &autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies 4K/Interstellar (2014)", Immediate: true, Targets: []string{"plex-4k"}, Reason: "4K remux added", Source: "api"},
+		},
+		{
+			Name:       "Unknown target",
+			Body:       `{"folder": "/mnt/unionfs/Media/Movies/Interstellar (2014)", "targets": ["emby"]}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Missing folder",
+			Body:       `{"targets": ["plex"]}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{
+			Name:       "Invalid JSON",
+			Body:       `{"folder": `,
+			WantStatus: http.StatusBadRequest,
+		},
+	}
+
+	var targets []autoscan.Target
+	for _, name := range []string{"plex", "plex-4k"} {
+		target, err := mock.New(mock.Config{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var added []autoscan.Scan
+			add := func(scans ...autoscan.Scan) error {
+				added = append(added, scans...)
+				return nil
+			}
+
+			rec := httptest.NewRecorder()
+			scanAPIHandler(add, targets, nil)(rec, httptest.NewRequest("POST", "/api/scan", strings.NewReader(tc.Body)))
+
+			if rec.Code != tc.WantStatus {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+
+			if tc.WantScan == nil {
+				if len(added) != 0 {
+					t.Errorf("Expected no scans to be added, got: %v", added)
+				}
+				return
+			}
+
+			if len(added) != 1 {
+				t.Fatalf("Expected 1 scan to be added, got: %v", added)
+			}
+
+			var resp scanResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.ID == "" || resp.ID != added[0].ID {
+				t.Errorf("IDs do not match: %s vs %s", resp.ID, added[0].ID)
+			}
+
+			got := added[0]
+			got.ID = ""
+			got.Time = tc.WantScan.Time
+			if !reflect.DeepEqual(got, *tc.WantScan) {
+				t.Errorf("Scans do not match: %+v vs %+v", got, *tc.WantScan)
+			}
+		})
+	}
+}
+
+// fakeFailedScans keeps failed scans in memory.
+type fakeFailedScans struct {
+	scans []processor.FailedScan
+}
+
+func (f *fakeFailedScans) Failed() ([]processor.FailedScan, error) {
+	return f.scans, nil
+}
+
+func (f *fakeFailedScans) remove(id string) (processor.FailedScan, bool) {
+	for i, scan := range f.scans {
+		if scan.ID == id {
+			f.scans = append(f.scans[:i], f.scans[i+1:]...)
+			return scan, true
+		}
+	}
+
+	return processor.FailedScan{}, false
+}
+
+func (f *fakeFailedScans) RetryFailed(id string) (autoscan.Scan, error) {
+	scan, ok := f.remove(id)
+	if !ok {
+		return autoscan.Scan{}, processor.ErrFailedScanNotFound
+	}
+
+	return autoscan.Scan{ID: scan.ScanID, Folder: scan.Folder}, nil
+}
+
+func (f *fakeFailedScans) DiscardFailed(id string) error {
+	if _, ok := f.remove(id); !ok {
+		return processor.ErrFailedScanNotFound
+	}
+
+	return nil
+}
+
+func TestFailedAPIHandlers(t *testing.T) {
+	type Test struct {
+		Name       string
+		Method     string
+		URL        string
+		WantStatus int
+		WantIDs    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "List",
+			Method:     "GET",
+			URL:        "/api/failed",
+			WantStatus: http.StatusOK,
+			WantIDs:    []string{"a", "b", "c"},
+		},
+		{
+			Name:       "Retry",
+			Method:     "POST",
+			URL:        "/api/failed/b/retry",
+			WantStatus: http.StatusOK,
+			WantIDs:    []string{"a", "c"},
+		},
+		{
+			Name:       "Discard",
+			Method:     "DELETE",
+			URL:        "/api/failed/c",
+			WantStatus: http.StatusOK,
+			WantIDs:    []string{"a", "b"},
+		},
+		{
+			Name:       "Retry unknown",
+			Method:     "POST",
+			URL:        "/api/failed/d/retry",
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Name:       "Discard unknown",
+			Method:     "DELETE",
+			URL:        "/api/failed/d",
+			WantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			failed := &fakeFailedScans{scans: []processor.FailedScan{
+				{ID: "a", Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)"},
+				{ID: "b", Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)"},
+				{ID: "c", Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)"},
+			}}
+
+			r := chi.NewRouter()
+			r.Get("/api/failed", failedAPIHandler(failed))
+			r.Post("/api/failed/{id}/retry", retryFailedHandler(failed))
+			r.Delete("/api/failed/{id}", discardFailedHandler(failed))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.Method, tc.URL, nil))
+
+			if rec.Code != tc.WantStatus {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+
+			if tc.WantIDs == nil {
+				return
+			}
+
+			var resp []processor.FailedScan
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]string, 0, len(resp))
+			for _, scan := range resp {
+				ids = append(ids, scan.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tc.WantIDs) {
+				t.Errorf("Failed scans do not match: %v vs %v", ids, tc.WantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// roleViewer may use the pages and API of the web UI which do not change anything.
+	roleViewer = "viewer"
+
+	// roleAdmin may also add scans, through the triggers and the web UI.
+	roleAdmin = "admin"
+)
+
+// An authUser is a user of the triggers and the web UI, with the permissions of its role.
+type authUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password" autoscan:"secret"`
+	Role     string `yaml:"role"`
+}
+
+// authUsers returns the users of the authentication config.
+// The username and password of the config are an admin.
+func authUsers(c config) []authUser {
+	users := make([]authUser, 0, len(c.Auth.Users)+1)
+	if c.Auth.Username != "" && c.Auth.Password != "" {
+		users = append(users, authUser{Username: c.Auth.Username, Password: c.Auth.Password, Role: roleAdmin})
+	}
+
+	for _, user := range c.Auth.Users {
+		if user.Role == "" {
+			user.Role = roleViewer
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// authEnabled returns whether authentication is required, which is the case once any user is configured.
+func authEnabled(c config) bool {
+	return len(authUsers(c)) > 0
+}
+
+// validUsers checks the users of the authentication config.
+func validUsers(c config) error {
+	seen := map[string]bool{c.Auth.Username: c.Auth.Username != ""}
+	for _, user := range c.Auth.Users {
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("users: username and password are required")
+		}
+
+		if seen[user.Username] {
+			return fmt.Errorf("users: duplicate username %q", user.Username)
+		}
+
+		switch user.Role {
+		case "", roleViewer, roleAdmin:
+		default:
+			return fmt.Errorf("users: invalid role %q of %s: must be %s or %s", user.Role, user.Username, roleViewer, roleAdmin)
+		}
+
+		seen[user.Username] = true
+	}
+
+	return nil
+}
+
+// authenticate returns the user matching the basic authentication credentials of the request.
+func authenticate(users map[string]authUser, r *http.Request) (authUser, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return authUser{}, false
+	}
+
+	user, ok := users[username]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(user.Password)) != 1 {
+		return authUser{}, false
+	}
+
+	return user, true
+}
+
+type roleKey struct{}
+
+// withRole returns the request with the role of the authenticated client.
+func withRole(r *http.Request, role string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), roleKey{}, role))
+}
+
+// requestRole returns the role of the authenticated client, empty when the client did not authenticate.
+func requestRole(r *http.Request) string {
+	role, _ := r.Context().Value(roleKey{}).(string)
+	return role
+}
+
+// requireRole only passes on requests of clients with the role, others are rejected with 403 Forbidden.
+// Admins have every role. Clients accepting JSON receive a JSON error.
+func requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if got := requestRole(r); got == role || got == roleAdmin {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if strings.Contains(r.Header.Get("Accept"), "application/json") {
+				writeJSON(rw, http.StatusForbidden, errorResponse{Error: "forbidden"})
+				return
+			}
+
+			http.Error(rw, "forbidden", http.StatusForbidden)
+		})
+	}
+}
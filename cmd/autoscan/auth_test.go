@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	type Test struct {
+		Name       string
+		Username   string
+		Password   string
+		Method     string
+		Path       string
+		WantStatus int
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Viewers may view the status",
+			Username:   "viewer",
+			Password:   "view",
+			Method:     "GET",
+			Path:       "/api/status",
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "Viewers may not add scans",
+			Username:   "viewer",
+			Password:   "view",
+			Method:     "POST",
+			Path:       "/api/scan",
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "Users without a role are viewers",
+			Username:   "guest",
+			Password:   "guest",
+			Method:     "POST",
+			Path:       "/api/scan",
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Name:       "Admins may add scans",
+			Username:   "admin",
+			Password:   "admin",
+			Method:     "POST",
+			Path:       "/api/scan",
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "The username and password are an admin",
+			Username:   "user",
+			Password:   "pass",
+			Method:     "POST",
+			Path:       "/api/scan",
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "Requires valid credentials",
+			Username:   "viewer",
+			Password:   "wrong",
+			Method:     "GET",
+			Path:       "/api/status",
+			WantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	c := config{}
+	c.Auth.Username = "user"
+	c.Auth.Password = "pass"
+	c.Auth.Users = []authUser{
+		{Username: "viewer", Password: "view", Role: roleViewer},
+		{Username: "admin", Password: "admin", Role: roleAdmin},
+		{Username: "guest", Password: "guest"},
+	}
+
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/status", ok)
+	mux.Handle("/api/scan", requireRole(roleAdmin)(ok))
+	handler := basicAuth(c, "Autoscan UI")(mux)
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.Method, tc.Path, nil)
+			req.SetBasicAuth(tc.Username, tc.Password)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.WantStatus {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+		})
+	}
+}
+
+func TestValidUsers(t *testing.T) {
+	type Test struct {
+		Name  string
+		Users []authUser
+		Err   bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Valid users",
+			Users: []authUser{
+				{Username: "viewer", Password: "view", Role: roleViewer},
+				{Username: "admin", Password: "admin", Role: roleAdmin},
+				{Username: "guest", Password: "guest"},
+			},
+		},
+		{
+			Name:  "Missing password",
+			Users: []authUser{{Username: "viewer", Role: roleViewer}},
+			Err:   true,
+		},
+		{
+			Name:  "Invalid role",
+			Users: []authUser{{Username: "viewer", Password: "view", Role: "owner"}},
+			Err:   true,
+		},
+		{
+			Name:  "Duplicate username",
+			Users: []authUser{{Username: "user", Password: "view", Role: roleViewer}},
+			Err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := config{}
+			c.Auth.Username = "user"
+			c.Auth.Password = "pass"
+			c.Auth.Users = tc.Users
+
+			if err := validUsers(c); (err != nil) != tc.Err {
+				t.Errorf("Error does not match: %v", err)
+			}
+		})
+	}
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cloudbox/autoscan"
 )
 
+// defaultTargetTimeout is the timeout of the requests of targets without a timeout of their own,
+// unless the default-timeout is configured.
+const defaultTargetTimeout = time.Minute
+
 func defaultConfigDirectory(app string, filename string) string {
 	// binary path
 	bcd := getBinaryPath()
@@ -43,3 +54,171 @@ func getBinaryPath() string {
 
 	return dir
 }
+
+// loadConfig reads and decodes the config file or directory, on top of the default values.
+// The configs of registered targets are decoded as well, so the config is complete
+// and invalid target configs are reported before any target is initialised.
+func loadConfig(path string) (config, error) {
+	raw, err := readConfig(path)
+	if err != nil {
+		return config{}, fmt.Errorf("opening config: %w", err)
+	}
+
+	// set default values
+	c := config{
+		MinimumAge: 10 * time.Minute,
+		ScanDelay:  5 * time.Second,
+		ScanStats:  1 * time.Hour,
+		Host:       []string{""},
+		Port:       3030,
+
+		DefaultTimeout: defaultTargetTimeout,
+	}
+
+	c.WebUI.serverTimeouts = defaultServerTimeouts
+	c.Health.FailureThreshold = defaultFailureThreshold
+	c.Health.SuccessThreshold = defaultSuccessThreshold
+	c.Health.CheckInterval = defaultCheckInterval
+
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&c); err != nil {
+		return config{}, fmt.Errorf("decoding config: %w", err)
+	}
+
+	if err := c.WebUI.validate(); err != nil {
+		return config{}, fmt.Errorf("webui: %w", err)
+	}
+
+	if err := autoscan.ValidRedactMode(c.WebUI.RedactMode); err != nil {
+		return config{}, fmt.Errorf("webui: %w", err)
+	}
+
+	if err := validRoot(c.WebUI.Root); err != nil {
+		return config{}, fmt.Errorf("webui: %w", err)
+	}
+
+	if err := validUsers(c); err != nil {
+		return config{}, fmt.Errorf("authentication: %w", err)
+	}
+
+	if c.Health.FailureThreshold < 1 || c.Health.SuccessThreshold < 1 {
+		return config{}, fmt.Errorf("health: thresholds must be at least 1, got failure-threshold %d and success-threshold %d",
+			c.Health.FailureThreshold, c.Health.SuccessThreshold)
+	}
+
+	if c.DefaultTimeout < 0 {
+		return config{}, fmt.Errorf("invalid default-timeout %v: must not be negative", c.DefaultTimeout)
+	}
+
+	if err := checkTriggers(c); err != nil {
+		return config{}, fmt.Errorf("triggers: %w", err)
+	}
+
+	for _, name := range c.Targets.registeredNames() {
+		configs := c.Targets.Registered[name]
+		for i := range configs {
+			v := autoscan.TargetConfig(name)
+			if v == nil {
+				continue
+			}
+
+			if err := configs[i].Decode(v); err != nil {
+				return config{}, fmt.Errorf("decoding config: target %s: %w", name, err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// readConfig reads the config file at the given path.
+//
+// When the path is a directory, all *.yml and *.yaml files within the directory
+// are merged in lexical order. Maps are merged recursively, lists are appended
+// and other values are overridden by the files which come later.
+func readConfig(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	files := make([]string, 0)
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no config files found", path)
+	}
+
+	sort.Strings(files)
+
+	var merged any
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if err := yaml.Unmarshal(b, &value); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		merged, err = mergeConfig(merged, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return yaml.Marshal(merged)
+}
+
+// mergeConfig merges the src value into the dst value.
+func mergeConfig(dst any, src any) (any, error) {
+	if dst == nil {
+		return src, nil
+	}
+
+	if src == nil {
+		return dst, nil
+	}
+
+	switch srcValue := src.(type) {
+	case map[any]any:
+		dstValue, ok := dst.(map[any]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot merge map into %T", dst)
+		}
+
+		for key, value := range srcValue {
+			mergedValue, err := mergeConfig(dstValue[key], value)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", key, err)
+			}
+
+			dstValue[key] = mergedValue
+		}
+
+		return dstValue, nil
+	case []any:
+		dstValue, ok := dst.([]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot merge list into %T", dst)
+		}
+
+		return append(dstValue, srcValue...), nil
+	default:
+		return src, nil
+	}
+}
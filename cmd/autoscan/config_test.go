@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestReadConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"10-general.yml":   "port: 3030\nanchors:\n  - /mnt/unionfs/drive1.anchor\n",
+		"20-triggers.yaml": "triggers:\n  manual:\n    priority: 1\n  sonarr:\n    - name: sonarr-docker\n      priority: 2\n",
+		"30-override.yml":  "port: 3031\nanchors:\n  - /mnt/unionfs/drive2.anchor\ntriggers:\n  sonarr:\n    - name: sonarr4k\n      priority: 3\n",
+		"ignored.txt":      "port: 1234\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := readConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config{}
+	if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+		t.Fatalf("Merged config is not valid: %v\n%s", err, raw)
+	}
+
+	if c.Port != 3031 {
+		t.Errorf("Expected later files to override scalars, got port: %d", c.Port)
+	}
+
+	if len(c.Anchors) != 2 {
+		t.Errorf("Expected lists to be appended, got anchors: %v", c.Anchors)
+	}
+
+	if c.Triggers.Manual.Priority != 1 {
+		t.Errorf("Expected maps to be merged, got manual priority: %d", c.Triggers.Manual.Priority)
+	}
+
+	if len(c.Triggers.Sonarr) != 2 || c.Triggers.Sonarr[1].Name != "sonarr4k" {
+		t.Errorf("Expected sonarr triggers to be appended, got: %v", c.Triggers.Sonarr)
+	}
+}
+
+func TestReadConfigConflict(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"1.yml": "anchors:\n  - /mnt/unionfs/drive1.anchor\n",
+		"2.yml": "anchors:\n  drive: /mnt/unionfs/drive2.anchor\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := readConfig(dir); err == nil {
+		t.Error("Expected an error when merging a map into a list")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"10-general.yml": "port: 3031\n",
+		"20-targets.yml": "targets:\n  plex:\n    - url: http://plex:32400\n      token: s3cr3t\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := loadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Port != 3031 || c.MinimumAge != 10*time.Minute {
+		t.Errorf("Expected the config on top of the default values, got port: %d, minimum age: %v", c.Port, c.MinimumAge)
+	}
+
+	raw, err := redactedConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"minimum-age: 10m0s",
+		"  plex:\n  - name: plex\n    url: http://plex:32400\n    token: REDACTED\n",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("Config does not contain %q:\n%s", want, raw)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "30-invalid.yml"), []byte("targets:\n  plex:\n    - unknown: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadConfig(dir); err == nil {
+		t.Error("Expected an error for an invalid target config")
+	}
+}
+
+func TestLoadConfigServerTimeouts(t *testing.T) {
+	type Test struct {
+		Name    string
+		Config  string
+		Want    serverTimeouts
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Defaults",
+			Config: "port: 3030\n",
+			Want:   defaultServerTimeouts,
+		},
+		{
+			Name:   "Overrides",
+			Config: "webui:\n  write-timeout: 5m\n  idle-timeout: 0s\n",
+			Want: serverTimeouts{
+				ReadTimeout:       defaultServerTimeouts.ReadTimeout,
+				ReadHeaderTimeout: defaultServerTimeouts.ReadHeaderTimeout,
+				WriteTimeout:      5 * time.Minute,
+			},
+		},
+		{
+			Name:    "Negative",
+			Config:  "webui:\n  read-timeout: -1s\n",
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(path, []byte(tc.Config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := loadConfig(path)
+			if tc.WantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.WebUI.serverTimeouts != tc.Want {
+				t.Errorf("Timeouts do not match: %+v vs %+v", c.WebUI.serverTimeouts, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// eventsInterval is the time between checks for changed scan counts.
+const eventsInterval = time.Second
+
+// scanCounts are the numbers pushed to the status page as they change.
+type scanCounts struct {
+	Remaining int   `json:"remaining"`
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+	Expired   int64 `json:"expired"`
+	InFlight  int64 `json:"in_flight"`
+}
+
+func (s *statusReporter) Counts() scanCounts {
+	remaining, err := s.proc.ScansRemaining()
+	if err != nil {
+		remaining = -1
+	}
+
+	counts := s.proc.ScanCounts()
+	return scanCounts{
+		Remaining: remaining,
+		Processed: counts.Processed,
+		Failed:    counts.Failed,
+		Expired:   counts.Expired,
+		InFlight:  s.inFlight(),
+	}
+}
+
+// streamDuration returns how long an event stream may stay open
+// without being cut off by the write timeout of the server.
+// Browsers reconnect once the stream ends.
+func streamDuration(writeTimeout time.Duration) time.Duration {
+	if writeTimeout <= 0 {
+		return 0
+	}
+
+	return writeTimeout - writeTimeout/10
+}
+
+// eventsHandler streams the scan counts as server-sent events whenever they change.
+// The stream ends when the client disconnects or after the given duration,
+// a duration of 0 keeps the stream open until the client disconnects.
+func eventsHandler(counts func() scanCounts, interval time.Duration, duration time.Duration) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		rlog := hlog.FromRequest(r)
+
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("X-Accel-Buffering", "no")
+		rw.WriteHeader(http.StatusOK)
+
+		var deadline <-chan time.Time
+		if duration > 0 {
+			timer := time.NewTimer(duration)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last *scanCounts
+		for {
+			current := counts()
+			if last == nil || current != *last {
+				data, err := json.Marshal(current)
+				if err != nil {
+					rlog.Error().Err(err).Msg("Failed encoding event")
+					return
+				}
+
+				if _, err := fmt.Fprintf(rw, "data: %s\n\n", data); err != nil {
+					return
+				}
+
+				flusher.Flush()
+				last = &current
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-deadline:
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventsHandler(t *testing.T) {
+	var processed int64
+	counts := func() scanCounts {
+		return scanCounts{Remaining: 3, Processed: atomic.LoadInt64(&processed)}
+	}
+
+	// the counts change once during the stream
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt64(&processed, 1)
+	}()
+
+	rec := httptest.NewRecorder()
+	eventsHandler(counts, 10*time.Millisecond, 200*time.Millisecond)(rec, httptest.NewRequest("GET", "/events", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content types do not match: %s vs text/event-stream", ct)
+	}
+
+	want := "data: {\"remaining\":3,\"processed\":0,\"failed\":0,\"expired\":0,\"in_flight\":0}\n\n" +
+		"data: {\"remaining\":3,\"processed\":1,\"failed\":0,\"expired\":0,\"in_flight\":0}\n\n"
+
+	if rec.Body.String() != want {
+		t.Errorf("Events do not match:\n%s\nvs\n%s", rec.Body.String(), want)
+	}
+}
+
+func TestEventsHandlerDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		eventsHandler(func() scanCounts { return scanCounts{} }, 10*time.Millisecond, 0)(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stream to end once the client disconnects")
+	}
+}
+
+func TestStreamDuration(t *testing.T) {
+	if d := streamDuration(0); d != 0 {
+		t.Errorf("Expected no limit without write timeout, got: %v", d)
+	}
+
+	if d := streamDuration(time.Minute); d != 54*time.Second {
+		t.Errorf("Durations do not match: %v vs %v", d, 54*time.Second)
+	}
+}
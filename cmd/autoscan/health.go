@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// rootsCheck checks the access to the roots of the media,
+// to detect a dropped mount before scans of missing paths are sent to the targets.
+type rootsCheck struct {
+	roots []string
+}
+
+// Missing returns the roots which cannot be read or are empty.
+// An empty root usually is the mount point of a dropped mount.
+func (c rootsCheck) Missing() []string {
+	missing := make([]string, 0)
+	for _, root := range c.roots {
+		if err := checkRoot(root); err != nil {
+			missing = append(missing, root)
+		}
+	}
+
+	return missing
+}
+
+var errEmptyRoot = errors.New("root is empty")
+
+func checkRoot(root string) error {
+	f, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if _, err := f.Readdirnames(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errEmptyRoot
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// The default number of consecutive checks which flip the readiness of a target.
+const (
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 2
+)
+
+// defaultCheckInterval is the default time during which the targets are checked once,
+// however often the readiness is probed.
+const defaultCheckInterval = 10 * time.Second
+
+// targetHealth checks the availability of the targets with hysteresis,
+// so a brief hiccup of a target does not flip the readiness.
+//
+// A target becomes unhealthy after failureThreshold consecutive failed checks,
+// and healthy again after successThreshold consecutive successful checks.
+// The targets are checked at most once per interval, probes within the interval
+// and probes waiting for a check in progress share the outcome of the last check.
+type targetHealth struct {
+	mu               sync.Mutex
+	targets          []autoscan.Target
+	streaks          []targetStreak
+	failureThreshold int
+	successThreshold int
+	interval         time.Duration
+
+	checked time.Time
+	last    []targetReadiness
+}
+
+type targetStreak struct {
+	failures  int
+	successes int
+	unhealthy bool
+}
+
+// targetReadiness is the readiness of a target.
+type targetReadiness struct {
+	Name          string `json:"name"`
+	Healthy       bool   `json:"healthy"`
+	FailureStreak int    `json:"failure_streak"`
+	Error         string `json:"error,omitempty"`
+}
+
+func newTargetHealth(targets []autoscan.Target, failureThreshold int, successThreshold int, interval time.Duration) *targetHealth {
+	return &targetHealth{
+		targets:          targets,
+		streaks:          make([]targetStreak, len(targets)),
+		failureThreshold: failureThreshold,
+		successThreshold: successThreshold,
+		interval:         interval,
+	}
+}
+
+// Check checks the availability of all targets concurrently,
+// and returns the readiness of every target after the check.
+// Within the interval of the last check, the readiness of the last check is returned instead.
+func (h *targetHealth) Check() []targetReadiness {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.last != nil && time.Since(h.checked) < h.interval {
+		return append([]targetReadiness(nil), h.last...)
+	}
+
+	errs := make([]error, len(h.targets))
+
+	var wg sync.WaitGroup
+	for i, target := range h.targets {
+		wg.Add(1)
+		go func(i int, target autoscan.Target) {
+			defer wg.Done()
+			errs[i] = target.Available()
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	readiness := make([]targetReadiness, 0, len(h.targets))
+	for i, target := range h.targets {
+		streak := h.record(i, errs[i])
+
+		tr := targetReadiness{
+			Name:          autoscan.TargetName(target),
+			Healthy:       !streak.unhealthy,
+			FailureStreak: streak.failures,
+		}
+
+		if errs[i] != nil {
+			tr.Error = errs[i].Error()
+		}
+
+		readiness = append(readiness, tr)
+	}
+
+	h.checked = time.Now()
+	h.last = readiness
+	return append([]targetReadiness(nil), readiness...)
+}
+
+// record adds the outcome of a check to the streak of the target at index i.
+func (h *targetHealth) record(i int, err error) targetStreak {
+	s := &h.streaks[i]
+	if err != nil {
+		s.failures++
+		s.successes = 0
+		if s.failures >= h.failureThreshold {
+			s.unhealthy = true
+		}
+	} else {
+		s.successes++
+		s.failures = 0
+		if s.successes >= h.successThreshold {
+			s.unhealthy = false
+		}
+	}
+
+	return *s
+}
+
+type readiness struct {
+	Ready        bool              `json:"ready"`
+	MissingRoots []string          `json:"missing_roots"`
+	Targets      []targetReadiness `json:"targets"`
+}
+
+// readyHandler responds with 503 Service Unavailable when a root is missing or a target is unhealthy.
+func readyHandler(check rootsCheck, health *targetHealth) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		resp := readiness{
+			MissingRoots: check.Missing(),
+			Targets:      health.Check(),
+		}
+
+		resp.Ready = len(resp.MissingRoots) == 0
+		for _, t := range resp.Targets {
+			resp.Ready = resp.Ready && t.Healthy
+		}
+
+		if !resp.Ready {
+			writeJSON(rw, http.StatusServiceUnavailable, resp)
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestReadyHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	mounted := filepath.Join(dir, "mounted")
+	if err := os.MkdirAll(filepath.Join(mounted, "Movies"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := filepath.Join(dir, "dropped")
+	if err := os.Mkdir(dropped, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := filepath.Join(dir, "missing")
+
+	type Test struct {
+		Name       string
+		Roots      []string
+		StatusCode int
+		Missing    []string
+	}
+
+	var testCases = []Test{
+		{"No roots", nil, http.StatusOK, []string{}},
+		{"Mounted", []string{mounted}, http.StatusOK, []string{}},
+		{"Dropped and missing", []string{mounted, dropped, missing}, http.StatusServiceUnavailable, []string{dropped, missing}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			check := rootsCheck{roots: tc.Roots}
+			if got := check.Missing(); !reflect.DeepEqual(got, tc.Missing) {
+				t.Errorf("Missing roots do not match: %v vs %v", got, tc.Missing)
+			}
+
+			rec := httptest.NewRecorder()
+			readyHandler(check, newTargetHealth(nil, 1, 1, 0))(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+			if rec.Code != tc.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+		})
+	}
+}
+
+type checkedTarget struct {
+	name string
+	err  error
+}
+
+func (t *checkedTarget) Scan(autoscan.Scan) error { return nil }
+func (t *checkedTarget) Available() error         { return t.err }
+func (t *checkedTarget) String() string           { return t.name }
+
+func TestTargetHealth(t *testing.T) {
+	target := &checkedTarget{name: "plex"}
+	health := newTargetHealth([]autoscan.Target{target}, 3, 2, 0)
+	handler := readyHandler(rootsCheck{}, health)
+
+	errUnavailable := errors.New("connection refused")
+
+	type Test struct {
+		Err        error
+		StatusCode int
+		Streak     int
+	}
+
+	// unhealthy after 3 consecutive failures, healthy again after 2 consecutive successes
+	var testCases = []Test{
+		{nil, http.StatusOK, 0},
+		{errUnavailable, http.StatusOK, 1},
+		{errUnavailable, http.StatusOK, 2},
+		{nil, http.StatusOK, 0},
+		{errUnavailable, http.StatusOK, 1},
+		{errUnavailable, http.StatusOK, 2},
+		{errUnavailable, http.StatusServiceUnavailable, 3},
+		{nil, http.StatusServiceUnavailable, 0},
+		{errUnavailable, http.StatusServiceUnavailable, 1},
+		{nil, http.StatusServiceUnavailable, 0},
+		{nil, http.StatusOK, 0},
+	}
+
+	for i, tc := range testCases {
+		target.err = tc.Err
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		if rec.Code != tc.StatusCode {
+			t.Errorf("Check %d: Status codes do not match: %d vs %d", i, rec.Code, tc.StatusCode)
+		}
+
+		var resp readiness
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Targets) != 1 || resp.Targets[0].FailureStreak != tc.Streak {
+			t.Errorf("Check %d: Failure streaks do not match: %+v vs %d", i, resp.Targets, tc.Streak)
+		}
+	}
+}
+
+func TestTargetHealthInterval(t *testing.T) {
+	target := &checkedTarget{name: "plex", err: errors.New("connection refused")}
+	health := newTargetHealth([]autoscan.Target{target}, 3, 2, time.Hour)
+
+	// concurrent probes within the interval share a single check
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health.Check()
+		}()
+	}
+
+	wg.Wait()
+
+	readiness := health.Check()
+	if len(readiness) != 1 || readiness[0].FailureStreak != 1 {
+		t.Errorf("Failure streaks do not match: %+v vs %d", readiness, 1)
+	}
+
+	// the next check once the interval has elapsed
+	health.checked = time.Now().Add(-time.Hour)
+	readiness = health.Check()
+	if len(readiness) != 1 || readiness[0].FailureStreak != 2 {
+		t.Errorf("Failure streaks do not match: %+v vs %d", readiness, 2)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// allowedLibraries only passes the scans on when every library they affect is allowed.
+// Otherwise all scans are rejected with autoscan.ErrScanForbidden.
+//
+// The libraries of a scan are those of the targets it is sent to,
+// folders which belong to no library of any target are allowed.
+// Scans without a folder refresh the default libraries and are always rejected.
+func allowedLibraries(allowed []string, targets []autoscan.Target, add autoscan.ProcessorFunc) autoscan.ProcessorFunc {
+	if len(allowed) == 0 {
+		return add
+	}
+
+	return func(scans ...autoscan.Scan) error {
+		for _, scan := range scans {
+			if err := checkLibraries(allowed, targets, scan); err != nil {
+				return err
+			}
+		}
+
+		return add(scans...)
+	}
+}
+
+func checkLibraries(allowed []string, targets []autoscan.Target, scan autoscan.Scan) error {
+	if scan.Folder == "" {
+		return fmt.Errorf("scans without a folder are not allowed: %w", autoscan.ErrScanForbidden)
+	}
+
+	for _, target := range targets {
+		namer, ok := target.(autoscan.LibraryNamer)
+		if !ok {
+			continue
+		}
+
+		name := autoscan.TargetName(target)
+		if len(scan.Targets) > 0 && !containsString(scan.Targets, name) {
+			continue
+		}
+
+		for _, library := range namer.LibraryNames(scan.Folder) {
+			if !containsString(allowed, library) {
+				return fmt.Errorf("%s: library %s of target %s is not allowed: %w", scan.Folder, library, name, autoscan.ErrScanForbidden)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
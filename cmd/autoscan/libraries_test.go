@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// namedLibraries names the library of a folder after its first path element.
+type namedLibraries struct {
+	name string
+}
+
+func (t namedLibraries) Scan(autoscan.Scan) error { return nil }
+func (t namedLibraries) Available() error         { return nil }
+func (t namedLibraries) String() string           { return t.name }
+
+func (t namedLibraries) LibraryNames(folder string) []string {
+	library, _, ok := strings.Cut(strings.TrimPrefix(folder, "/"), "/")
+	if !ok {
+		return nil
+	}
+
+	return []string{library}
+}
+
+func TestAllowedLibraries(t *testing.T) {
+	targets := []autoscan.Target{namedLibraries{name: "plex"}, plainTarget{}}
+
+	type Test struct {
+		Name      string
+		Allowed   []string
+		Scans     []autoscan.Scan
+		Forbidden bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:  "Any library without an allow-list",
+			Scans: []autoscan.Scan{{Folder: "/Private/Home Videos"}, {}},
+		},
+		{
+			Name:    "Allowed library",
+			Allowed: []string{"Movies", "TV"},
+			Scans:   []autoscan.Scan{{Folder: "/Movies/Tenet (2020)"}, {Folder: "/TV/Westworld"}},
+		},
+		{
+			Name:    "Folder without a library",
+			Allowed: []string{"Movies"},
+			Scans:   []autoscan.Scan{{Folder: "unmatched"}},
+		},
+		{
+			Name:      "Library which is not allowed",
+			Allowed:   []string{"Movies"},
+			Scans:     []autoscan.Scan{{Folder: "/Movies/Tenet (2020)"}, {Folder: "/Private/Home Videos"}},
+			Forbidden: true,
+		},
+		{
+			Name:    "Library of another target",
+			Allowed: []string{"Movies"},
+			Scans:   []autoscan.Scan{{Folder: "/Private/Home Videos", Targets: []string{"emby"}}},
+		},
+		{
+			Name:      "Scan without a folder",
+			Allowed:   []string{"Movies"},
+			Scans:     []autoscan.Scan{{}},
+			Forbidden: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			added := 0
+			add := func(scans ...autoscan.Scan) error {
+				added += len(scans)
+				return nil
+			}
+
+			err := allowedLibraries(tc.Allowed, targets, add)(tc.Scans...)
+			if errors.Is(err, autoscan.ErrScanForbidden) != tc.Forbidden {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tc.Forbidden && added != 0 {
+				t.Errorf("Expected no scans to be added, got: %d", added)
+			}
+
+			if !tc.Forbidden && added != len(tc.Scans) {
+				t.Errorf("Added scans do not match: %d vs %d", added, len(tc.Scans))
+			}
+		})
+	}
+}
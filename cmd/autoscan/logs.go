@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// logBufferSize is the number of recent log lines kept in memory.
+	logBufferSize = 1000
+
+	// defaultLogLines is the number of log lines returned by the logs endpoint by default.
+	defaultLogLines = 100
+)
+
+// recentLogs keeps the most recent log lines for the logs endpoint of the web UI.
+var recentLogs = newLogBuffer(logBufferSize)
+
+// logBuffer is a writer which keeps the most recent lines written to it.
+// Once full, the oldest lines are overwritten.
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+	rest  []byte
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{lines: make([]string, size)}
+}
+
+// Write adds the complete lines in p to the buffer.
+// An incomplete line is kept until the rest of the line is written.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.rest, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		b.lines[b.next] = string(data[:i])
+		b.next = (b.next + 1) % len(b.lines)
+		b.full = b.full || b.next == 0
+		data = data[i+1:]
+	}
+
+	b.rest = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Lines returns at most the n most recent lines, oldest first.
+func (b *logBuffer) Lines(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := b.next
+	if b.full {
+		size = len(b.lines)
+	}
+
+	if n > size {
+		n = size
+	}
+
+	lines := make([]string, 0, n)
+	for i := b.next - n; i < b.next; i++ {
+		lines = append(lines, b.lines[(i+len(b.lines))%len(b.lines)])
+	}
+
+	return lines
+}
+
+// logsHandler returns the most recent log lines as plain text.
+// The number of lines defaults to defaultLogLines and is set with the lines query parameter.
+func logsHandler(buf *logBuffer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		n := defaultLogLines
+		if v := r.URL.Query().Get("lines"); v != "" {
+			lines, err := strconv.Atoi(v)
+			if err != nil || lines < 1 {
+				http.Error(rw, fmt.Sprintf("invalid lines: %q", v), http.StatusBadRequest)
+				return
+			}
+
+			n = lines
+		}
+
+		lines := buf.Lines(n)
+
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		if len(lines) == 0 {
+			return
+		}
+
+		_, _ = fmt.Fprintln(rw, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestLogBuffer(t *testing.T) {
+	buf := newLogBuffer(3)
+
+	if lines := buf.Lines(10); len(lines) != 0 {
+		t.Errorf("Expected no lines, got: %v", lines)
+	}
+
+	_, _ = buf.Write([]byte("one\ntwo\n"))
+	if lines := buf.Lines(10); !reflect.DeepEqual(lines, []string{"one", "two"}) {
+		t.Errorf("Lines do not match: %v", lines)
+	}
+
+	// incomplete lines are kept until the line is complete
+	_, _ = buf.Write([]byte("thr"))
+	_, _ = buf.Write([]byte("ee\nfour\n"))
+
+	type Test struct {
+		N    int
+		Want []string
+	}
+
+	var testData = []Test{
+		{N: 10, Want: []string{"two", "three", "four"}},
+		{N: 3, Want: []string{"two", "three", "four"}},
+		{N: 2, Want: []string{"three", "four"}},
+		{N: 0, Want: []string{}},
+	}
+
+	for _, tc := range testData {
+		t.Run(fmt.Sprint(tc.N), func(t *testing.T) {
+			if lines := buf.Lines(tc.N); !reflect.DeepEqual(lines, tc.Want) {
+				t.Errorf("Lines do not match: %v vs %v", lines, tc.Want)
+			}
+		})
+	}
+}
+
+func TestLogsHandler(t *testing.T) {
+	buf := newLogBuffer(10)
+	_, _ = buf.Write([]byte("one\ntwo\nthree\n"))
+
+	type Test struct {
+		Name   string
+		Query  string
+		Status int
+		Body   string
+	}
+
+	var testData = []Test{
+		{Name: "Default", Query: "", Status: http.StatusOK, Body: "one\ntwo\nthree\n"},
+		{Name: "Lines", Query: "?lines=2", Status: http.StatusOK, Body: "two\nthree\n"},
+		{Name: "Invalid", Query: "?lines=zero", Status: http.StatusBadRequest},
+		{Name: "Negative", Query: "?lines=-1", Status: http.StatusBadRequest},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			logsHandler(buf)(rec, httptest.NewRequest("GET", "/logs"+tc.Query, nil))
+
+			if rec.Code != tc.Status {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.Status)
+			}
+
+			if tc.Status == http.StatusOK && rec.Body.String() != tc.Body {
+				t.Errorf("Bodies do not match: %q vs %q", rec.Body.String(), tc.Body)
+			}
+		})
+	}
+}
@@ -5,34 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/natefinch/lumberjack"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v2"
 
 	"github.com/cloudbox/autoscan"
 	"github.com/cloudbox/autoscan/migrate"
 	"github.com/cloudbox/autoscan/processor"
-	ast "github.com/cloudbox/autoscan/targets/autoscan"
-	"github.com/cloudbox/autoscan/targets/emby"
-	"github.com/cloudbox/autoscan/targets/jellyfin"
-	"github.com/cloudbox/autoscan/targets/plex"
 	"github.com/cloudbox/autoscan/triggers/a_train"
 	"github.com/cloudbox/autoscan/triggers/bernard"
 	"github.com/cloudbox/autoscan/triggers/inotify"
 	"github.com/cloudbox/autoscan/triggers/lidarr"
 	"github.com/cloudbox/autoscan/triggers/manual"
+	"github.com/cloudbox/autoscan/triggers/poll"
 	"github.com/cloudbox/autoscan/triggers/radarr"
 	"github.com/cloudbox/autoscan/triggers/readarr"
+	"github.com/cloudbox/autoscan/triggers/schedule"
 	"github.com/cloudbox/autoscan/triggers/sonarr"
 
+	// self-registering targets
+	_ "github.com/cloudbox/autoscan/targets/plex"
+
 	// sqlite3 driver
 	_ "modernc.org/sqlite"
 )
@@ -42,35 +40,89 @@ type config struct {
 	Host       []string      `yaml:"host"`
 	Port       int           `yaml:"port"`
 	MinimumAge time.Duration `yaml:"minimum-age"`
+	ScanTTL    time.Duration `yaml:"scan-ttl"`
 	ScanDelay  time.Duration `yaml:"scan-delay"`
 	ScanStats  time.Duration `yaml:"scan-stats"`
 	Anchors    []string      `yaml:"anchors"`
+	Analyze    bool          `yaml:"analyze"`
+	QueueOrder string        `yaml:"queue-order"`
+
+	// Give every target a queue of its own, so a slow target does not hold up the others
+	TargetQueues bool `yaml:"target-queues"`
+
+	// Timeout of the requests of targets without a timeout of their own, 0s for none
+	DefaultTimeout time.Duration `yaml:"default-timeout"`
+
+	// Roots of the media which must be accessible for autoscan to be ready,
+	// and the consecutive target checks which flip the readiness of a target,
+	// checked at most once per check interval
+	Health struct {
+		Roots            []string      `yaml:"roots"`
+		FailureThreshold int           `yaml:"failure-threshold"`
+		SuccessThreshold int           `yaml:"success-threshold"`
+		CheckInterval    time.Duration `yaml:"check-interval"`
+	} `yaml:"health"`
+
+	// Rewrites folders into the key used for deduplication
+	Dedup []autoscan.Rewrite `yaml:"dedup"`
+
+	// Deduplicate scans by folder or by library
+	DedupScope string `yaml:"dedup-scope"`
+
+	// Scan result notifications
+	Notify processor.NotifyConfig `yaml:"notify"`
+
+	// Machine-readable scan events, written as JSON lines
+	EventLog processor.EventLogConfig `yaml:"event-log"`
+
+	// Web UI
+	WebUI struct {
+		TemplateDir string `yaml:"template-dir"`
+
+		// How secrets are redacted in the shown config: full or partial
+		RedactMode string `yaml:"redact-mode"`
+
+		// Page served at the root: redirect to the status page or a landing page
+		Root string `yaml:"root"`
+
+		// Timeouts of both the trigger and the web UI servers
+		serverTimeouts `yaml:",inline"`
+	} `yaml:"webui"`
+
+	// Reverse proxies allowed to set X-Forwarded-* headers
+	TrustedProxies []string `yaml:"trusted-proxies"`
 
 	// Authentication for autoscan.HTTPTrigger
 	Auth struct {
 		Username string `yaml:"username"`
-		Password string `yaml:"password"`
+		Password string `yaml:"password" autoscan:"secret"`
+
+		// Respond with JSON instead of a browser prompt to API clients
+		JSONUnauthorized bool `yaml:"json-unauthorized"`
+
+		// Networks allowed to use the web UI without credentials
+		TrustedNetworks []string `yaml:"trusted-networks"`
+
+		// Additional users, viewers may not add scans
+		Users []authUser `yaml:"users"`
 	} `yaml:"authentication"`
 
 	// autoscan.HTTPTrigger
 	Triggers struct {
-		Manual  manual.Config    `yaml:"manual"`
-		ATrain  a_train.Config   `yaml:"a-train"`
-		Bernard []bernard.Config `yaml:"bernard"`
-		Inotify []inotify.Config `yaml:"inotify"`
-		Lidarr  []lidarr.Config  `yaml:"lidarr"`
-		Radarr  []radarr.Config  `yaml:"radarr"`
-		Readarr []readarr.Config `yaml:"readarr"`
-		Sonarr  []sonarr.Config  `yaml:"sonarr"`
+		Manual   manual.Config     `yaml:"manual"`
+		ATrain   a_train.Config    `yaml:"a-train"`
+		Bernard  []bernard.Config  `yaml:"bernard"`
+		Inotify  []inotify.Config  `yaml:"inotify"`
+		Lidarr   []lidarr.Config   `yaml:"lidarr"`
+		Poll     []poll.Config     `yaml:"poll"`
+		Radarr   []radarr.Config   `yaml:"radarr"`
+		Readarr  []readarr.Config  `yaml:"readarr"`
+		Schedule []schedule.Config `yaml:"schedule"`
+		Sonarr   []sonarr.Config   `yaml:"sonarr"`
 	} `yaml:"triggers"`
 
 	// autoscan.Target
-	Targets struct {
-		Autoscan []ast.Config      `yaml:"autoscan"`
-		Emby     []emby.Config     `yaml:"emby"`
-		Jellyfin []jellyfin.Config `yaml:"jellyfin"`
-		Plex     []plex.Config     `yaml:"plex"`
-	} `yaml:"targets"`
+	Targets targetsConfig `yaml:"targets"`
 }
 
 var (
@@ -84,10 +136,17 @@ var (
 		globals
 
 		// flags
-		Config    string `type:"path" default:"${config_file}" env:"AUTOSCAN_CONFIG" help:"Config file path"`
+		Config    string `type:"path" default:"${config_file}" env:"AUTOSCAN_CONFIG" help:"Config file or directory path"`
 		Database  string `type:"path" default:"${database_file}" env:"AUTOSCAN_DATABASE" help:"Database file path"`
 		Log       string `type:"path" default:"${log_file}" env:"AUTOSCAN_LOG" help:"Log file path"`
 		Verbosity int    `type:"counter" default:"0" short:"v" env:"AUTOSCAN_VERBOSITY" help:"Log level verbosity"`
+
+		PrintConfig bool `name:"print-config" help:"Print the loaded config with sensitive fields redacted and quit"`
+
+		// commands
+		Run          struct{} `cmd:"" default:"1" help:"Run autoscan"`
+		ConfigSchema struct{} `cmd:"" name:"config-schema" help:"Print an example config with all available options"`
+		Scan         scanCmd  `cmd:"" help:"Scan folders once and exit, with a running instance or the targets of the config"`
 	}
 )
 
@@ -128,6 +187,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	if cli.PrintConfig {
+		c, err := loadConfig(cli.Config)
+		if err != nil {
+			fmt.Println("Failed loading config:", err)
+			os.Exit(1)
+		}
+
+		raw, err := redactedConfig(c)
+		if err != nil {
+			fmt.Println("Failed printing config:", err)
+			os.Exit(1)
+		}
+
+		fmt.Print(raw)
+		return
+	}
+
+	if ctx.Command() == "config-schema" {
+		if err := writeConfigSchema(os.Stdout); err != nil {
+			fmt.Println("Failed writing config schema:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if ctx.Command() == "scan <folder>" {
+		if err := runScan(cli.Scan); err != nil {
+			fmt.Println("Failed scanning:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	// logger
 	logger := log.Output(io.MultiWriter(zerolog.ConsoleWriter{
 		TimeFormat: time.Stamp,
@@ -141,6 +235,10 @@ func main() {
 			MaxBackups: 5,
 		},
 		NoColor: true,
+	}, zerolog.ConsoleWriter{
+		TimeFormat: time.Stamp,
+		Out:        recentLogs,
+		NoColor:    true,
 	}))
 
 	switch {
@@ -162,31 +260,17 @@ func main() {
 	db.SetMaxOpenConns(1)
 
 	// config
-	file, err := os.Open(cli.Config)
+	c, err := loadConfig(cli.Config)
 	if err != nil {
 		log.Fatal().
 			Err(err).
-			Msg("Failed opening config")
-	}
-	defer file.Close()
-
-	// set default values
-	c := config{
-		MinimumAge: 10 * time.Minute,
-		ScanDelay:  5 * time.Second,
-		ScanStats:  1 * time.Hour,
-		Host:       []string{""},
-		Port:       3030,
+			Msg("Failed loading config")
 	}
 
-	decoder := yaml.NewDecoder(file)
-	decoder.SetStrict(true)
-	err = decoder.Decode(&c)
-	if err != nil {
-		log.Fatal().
-			Err(err).
-			Msg("Failed decoding config")
-	}
+	log.Info().
+		Str("version", fmt.Sprintf("%s (%s@%s)", Version, GitCommit, Timestamp)).
+		Fields(effectiveSettings(c)).
+		Msg("Effective settings")
 
 	// migrator
 	mg, err := migrate.New(db, "migrations")
@@ -200,8 +284,18 @@ func main() {
 	proc, err := processor.New(processor.Config{
 		Anchors:    c.Anchors,
 		MinimumAge: c.MinimumAge,
-		Db:         db,
-		Mg:         mg,
+		ScanTTL:    c.ScanTTL,
+		Analyze:    c.Analyze,
+		QueueOrder: c.QueueOrder,
+		Notify:     c.Notify,
+		EventLog:   c.EventLog,
+		Dedup:      c.Dedup,
+		DedupScope: c.DedupScope,
+
+		TargetQueues: c.TargetQueues,
+
+		Db: db,
+		Mg: mg,
 	})
 
 	if err != nil {
@@ -212,11 +306,13 @@ func main() {
 
 	log.Info().
 		Stringer("min_age", c.MinimumAge).
+		Stringer("scan_ttl", c.ScanTTL).
 		Strs("anchors", c.Anchors).
+		Bool("analyze", c.Analyze).
 		Msg("Initialised processor")
 
 	// Check authentication. If no auth -> warn user.
-	if c.Auth.Username == "" || c.Auth.Password == "" {
+	if !authEnabled(c) {
 		log.Warn().Msg("Webhooks running without authentication")
 	}
 
@@ -245,19 +341,67 @@ func main() {
 		go trigger(proc.Add)
 	}
 
+	for _, t := range c.Triggers.Poll {
+		trigger, err := poll.New(t, db, mg)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("trigger", "poll").
+				Msg("Failed initialising trigger")
+		}
+
+		go trigger(proc.Add)
+	}
+
+	scheduler, err := schedule.New(c.Triggers.Schedule)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("trigger", "schedule").
+			Msg("Failed initialising trigger")
+	}
+
+	scheduler.Start(proc.Add)
+
+	// targets, persisting their state next to the datastore
+	targets := initTargets(c, filepath.Dir(cli.Database))
+
+	targetsEvent := log.Info().
+		Int("autoscan", len(c.Targets.Autoscan)).
+		Int("emby", len(c.Targets.Emby)).
+		Int("jellyfin", len(c.Targets.Jellyfin))
+
+	for _, name := range c.Targets.registeredNames() {
+		targetsEvent = targetsEvent.Int(name, len(c.Targets.Registered[name]))
+	}
+
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, autoscan.TargetName(target))
+	}
+
+	targetsEvent.
+		Strs("names", names).
+		Msg("Initialised targets")
+
+	// scans are deduplicated by the libraries of the targets
+	proc.SetTargets(targets)
+
+	// deferred scans which could not be sent are queued again, and drained on shutdown
+	// along with the pending notifications
+	requeueTargets(targets, proc.Add)
+	shutdownOnSignal(targets, proc.Add, proc.Close)
+
 	// http triggers
-	router := getRouter(c, proc)
-	webRouter := getWebRouter(c, proc)
+	router := getRouter(c, proc, targets)
+	webRouter := getWebRouter(c, proc, targets, scheduler)
 
 	for _, h := range c.Host {
 		go func(host string) {
-			addr := host
-			if !strings.Contains(addr, ":") {
-				addr = fmt.Sprintf("%s:%d", host, c.Port)
-			}
+			addr := serverAddr(host, c.Port)
 
 			log.Info().Msgf("Starting server on %s", addr)
-			if err := http.ListenAndServe(addr, router); err != nil {
+			if err := newServer(addr, router, c.WebUI.serverTimeouts).ListenAndServe(); err != nil {
 				log.Fatal().
 					Str("addr", addr).
 					Err(err).
@@ -269,7 +413,7 @@ func main() {
 			addr := webUIAddr(host)
 
 			log.Info().Msgf("Starting web UI on %s", addr)
-			if err := http.ListenAndServe(addr, webRouter); err != nil {
+			if err := newServer(addr, webRouter, c.WebUI.serverTimeouts).ListenAndServe(); err != nil {
 				log.Fatal().
 					Str("addr", addr).
 					Err(err).
@@ -283,73 +427,13 @@ func main() {
 		Int("bernard", len(c.Triggers.Bernard)).
 		Int("inotify", len(c.Triggers.Inotify)).
 		Int("lidarr", len(c.Triggers.Lidarr)).
+		Int("poll", len(c.Triggers.Poll)).
 		Int("radarr", len(c.Triggers.Radarr)).
 		Int("readarr", len(c.Triggers.Readarr)).
+		Int("schedule", len(c.Triggers.Schedule)).
 		Int("sonarr", len(c.Triggers.Sonarr)).
 		Msg("Initialised triggers")
 
-	// targets
-	targets := make([]autoscan.Target, 0)
-
-	for _, t := range c.Targets.Autoscan {
-		tp, err := ast.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "autoscan").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
-	}
-
-	for _, t := range c.Targets.Plex {
-		tp, err := plex.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "plex").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
-	}
-
-	for _, t := range c.Targets.Emby {
-		tp, err := emby.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "emby").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
-	}
-
-	for _, t := range c.Targets.Jellyfin {
-		tp, err := jellyfin.New(t)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Str("target", "jellyfin").
-				Str("target_url", t.URL).
-				Msg("Failed initialising target")
-		}
-
-		targets = append(targets, tp)
-	}
-
-	log.Info().
-		Int("autoscan", len(c.Targets.Autoscan)).
-		Int("plex", len(c.Targets.Plex)).
-		Int("emby", len(c.Targets.Emby)).
-		Int("jellyfin", len(c.Targets.Jellyfin)).
-		Msg("Initialised targets")
-
 	// scan stats
 	if c.ScanStats.Seconds() > 0 {
 		go scanStats(proc, c.ScanStats)
@@ -363,6 +447,12 @@ func main() {
 	// processor
 	log.Info().Msg("Processor started")
 
+	if proc.TargetQueues() {
+		for _, target := range targets {
+			go processTargetQueue(proc, target, c.ScanDelay)
+		}
+	}
+
 	targetsAvailable := false
 	targetsSize := len(targets)
 	for {
@@ -400,14 +490,45 @@ func main() {
 		switch {
 		case err == nil:
 			// Sleep scan-delay between successful requests to reduce the load on targets.
-			time.Sleep(c.ScanDelay)
+			proc.Sleep(c.ScanDelay)
 
 		case errors.Is(err, autoscan.ErrNoScans):
-			// No scans currently available, let's wait a couple of seconds
-			log.Trace().
-				Msg("No scans are available, retrying in 15 seconds...")
+			// No scans currently available, use the idle time for a deferred analysis
+			err = proc.Analyze(targets)
+			switch {
+			case err == nil:
+				proc.Sleep(c.ScanDelay)
 
-			time.Sleep(15 * time.Second)
+			case errors.Is(err, autoscan.ErrNoScans):
+				// No analyses available either, let's wait a couple of seconds
+				log.Trace().
+					Msg("No scans are available, retrying in 15 seconds...")
+
+				proc.Sleep(15 * time.Second)
+
+			case errors.Is(err, autoscan.ErrTargetUnavailable):
+				targetsAvailable = false
+				log.Error().
+					Err(err).
+					Msg("Not all targets are available, retrying in 15 seconds...")
+
+				time.Sleep(15 * time.Second)
+
+			default:
+				log.Error().
+					Err(err).
+					Msg("Failed processing analysis, retrying in 15 seconds...")
+
+				time.Sleep(15 * time.Second)
+			}
+
+		case errors.Is(err, autoscan.ErrNoLibrary):
+			// the scan has been moved to the failed scans, continue with the next scan
+			log.Error().
+				Err(err).
+				Msg("Scan failed, no matching library")
+
+			time.Sleep(c.ScanDelay)
 
 		case errors.Is(err, autoscan.ErrAnchorUnavailable):
 			log.Error().
@@ -441,3 +562,42 @@ func main() {
 		}
 	}
 }
+
+// processTargetQueue sends the scans in the queue of the target to the target,
+// independently of the queues of the other targets.
+func processTargetQueue(proc *processor.Processor, target autoscan.Target, scanDelay time.Duration) {
+	l := log.With().Str("target", autoscan.TargetName(target)).Logger()
+
+	for {
+		err := proc.ProcessTarget(target)
+		switch {
+		case err == nil:
+			time.Sleep(scanDelay)
+
+		case errors.Is(err, autoscan.ErrNoScans):
+			proc.SleepTarget(target, 15*time.Second)
+
+		case errors.Is(err, autoscan.ErrNoLibrary):
+			l.Error().
+				Err(err).
+				Msg("Scan failed, no matching library")
+
+			time.Sleep(scanDelay)
+
+		case errors.Is(err, autoscan.ErrFatal):
+			l.Error().
+				Err(err).
+				Msg("Fatal error occurred while processing the target queue, target queue stopped")
+
+			return
+
+		default:
+			// unavailable targets, missing anchors and unexpected errors are retried
+			l.Error().
+				Err(err).
+				Msg("Failed processing the target queue, retrying in 15 seconds...")
+
+			time.Sleep(15 * time.Second)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/processor"
+)
+
+// metricsHandler exposes the processor statistics in the Prometheus text format.
+func metricsHandler(reporter *statusReporter, proc *processor.Processor, targets []autoscan.Target) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		st := reporter.Status()
+		buf := new(bytes.Buffer)
+
+		writeMetric(buf, "autoscan_scans_remaining", "gauge", "Number of scans waiting in the queue.", float64(st.Remaining))
+		writeMetric(buf, "autoscan_scans_processed_total", "counter", "Number of scans sent to the targets.", float64(st.Processed))
+		writeMetric(buf, "autoscan_scans_failed_total", "counter", "Number of scans which failed.", float64(st.Failed))
+		writeMetric(buf, "autoscan_scans_expired_total", "counter", "Number of scans dropped from the queue after the scan TTL.", float64(st.Expired))
+		writeMetric(buf, "autoscan_scans_in_flight", "gauge", "Number of scan requests currently sent to the targets.", float64(st.InFlight))
+		writeMetric(buf, "autoscan_uptime_seconds", "gauge", "Time since Autoscan started.", st.UptimeSeconds)
+
+		writeHistogram(buf, "autoscan_scan_queue_seconds", "Time scans spent in the queue before being sent to the targets.", proc.QueueLatency())
+
+		const scanDuration = "autoscan_target_scan_duration_seconds"
+		writeHeader(buf, scanDuration, "histogram", "Time the target took to handle a scan.")
+		for _, target := range targets {
+			labels := fmt.Sprintf("target=%q", autoscan.TargetName(target))
+			writeHistogramSeries(buf, scanDuration, labels, proc.ScanDuration(target))
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = buf.WriteTo(rw)
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+func writeMetric(buf *bytes.Buffer, name string, kind string, help string, value float64) {
+	writeHeader(buf, name, kind, help)
+	fmt.Fprintf(buf, "%s %s\n", name, formatFloat(value))
+}
+
+func writeHistogram(buf *bytes.Buffer, name string, help string, snapshot processor.LatencySnapshot) {
+	writeHeader(buf, name, "histogram", help)
+	writeHistogramSeries(buf, name, "", snapshot)
+}
+
+// writeHistogramSeries writes the series of a histogram with the given labels,
+// e.g. target="plex".
+func writeHistogramSeries(buf *bytes.Buffer, name string, labels string, snapshot processor.LatencySnapshot) {
+	prefix := ""
+	suffix := ""
+	if labels != "" {
+		prefix = labels + ","
+		suffix = "{" + labels + "}"
+	}
+
+	for i, bound := range snapshot.Buckets {
+		fmt.Fprintf(buf, "%s_bucket{%sle=%q} %d\n", name, prefix, formatFloat(bound), snapshot.Counts[i])
+	}
+
+	fmt.Fprintf(buf, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, snapshot.Count)
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, suffix, formatFloat(snapshot.Sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, suffix, snapshot.Count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudbox/autoscan/processor"
+)
+
+func TestWriteHistogramSeries(t *testing.T) {
+	snapshot := processor.LatencySnapshot{
+		Buckets: []float64{0.5, 1},
+		Counts:  []uint64{1, 2},
+		Count:   3,
+		Sum:     2.25,
+	}
+
+	buf := new(bytes.Buffer)
+	writeHistogramSeries(buf, "autoscan_target_scan_duration_seconds", `target="plex"`, snapshot)
+
+	want := `autoscan_target_scan_duration_seconds_bucket{target="plex",le="0.5"} 1
+autoscan_target_scan_duration_seconds_bucket{target="plex",le="1"} 2
+autoscan_target_scan_duration_seconds_bucket{target="plex",le="+Inf"} 3
+autoscan_target_scan_duration_seconds_sum{target="plex"} 2.25
+autoscan_target_scan_duration_seconds_count{target="plex"} 3
+`
+
+	if buf.String() != want {
+		t.Errorf("Series do not match:\n%s\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// parseCIDRs parses a list of CIDR ranges.
+// Plain IP addresses are treated as a range containing a single address.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address: %q", cidr)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr range: %q: %w", cidr, err)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP address of the direct peer of the request.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
+// fromTrustedProxy returns whether the request was sent by one of the trusted proxies.
+func fromTrustedProxy(r *http.Request, proxies []*net.IPNet) bool {
+	return containsIP(proxies, remoteIP(r))
+}
+
+// clientIP returns the IP address of the client.
+// The X-Forwarded-For header is only honoured when the request
+// was sent by one of the trusted proxies.
+func clientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	ip := remoteIP(r)
+	if !containsIP(proxies, ip) {
+		return ip
+	}
+
+	// walk the chain from right to left, skipping trusted proxies
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !containsIP(proxies, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// ipFilter only allows requests from clients within the allowed ranges.
+// All requests are allowed when no ranges are given.
+func ipFilter(allowed []*net.IPNet, proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r, proxies)
+			if !containsIP(allowed, ip) {
+				hlog.FromRequest(r).Warn().
+					Stringer("ip", ip).
+					Msg("Request from disallowed ip address")
+
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// defaultPageLimit is the number of entries of a page when no limit is requested.
+	defaultPageLimit = 50
+
+	// maxPageLimit is the highest number of entries of a page, larger limits are capped.
+	maxPageLimit = 500
+
+	// totalCountHeader holds the total number of entries of a paginated response.
+	totalCountHeader = "X-Total-Count"
+)
+
+// A pagination is a page of entries requested with the page and limit query parameters.
+type pagination struct {
+	Page  int
+	Limit int
+}
+
+// parsePagination returns the requested page, which defaults to the first page
+// of defaultPageLimit entries.
+func parsePagination(r *http.Request) (pagination, error) {
+	p := pagination{Page: 1, Limit: defaultPageLimit}
+
+	query := r.URL.Query()
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return p, fmt.Errorf("invalid page: %q", v)
+		}
+
+		p.Page = page
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return p, fmt.Errorf("invalid limit: %q", v)
+		}
+
+		p.Limit = limit
+	}
+
+	if p.Limit > maxPageLimit {
+		p.Limit = maxPageLimit
+	}
+
+	// the offset of the page must not overflow
+	if p.Page > math.MaxInt/p.Limit {
+		return p, fmt.Errorf("invalid page: %q", query.Get("page"))
+	}
+
+	return p, nil
+}
+
+// Offset returns the number of entries before the page.
+func (p pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Pages returns the number of pages of total entries, at least one.
+func (p pagination) Pages(total int) int {
+	if total <= p.Limit {
+		return 1
+	}
+
+	return (total + p.Limit - 1) / p.Limit
+}
+
+// links returns the template data of the links to the previous and next page,
+// keeping the other query parameters of the request.
+func (p pagination) links(r *http.Request, total int) map[string]any {
+	link := func(page int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		if p.Limit != defaultPageLimit {
+			query.Set("limit", strconv.Itoa(p.Limit))
+		}
+
+		return (&url.URL{RawQuery: query.Encode()}).String()
+	}
+
+	data := map[string]any{
+		"page":  p.Page,
+		"pages": p.Pages(total),
+		"total": total,
+	}
+
+	if p.Page > 1 {
+		data["prev"] = link(p.Page - 1)
+	}
+
+	if p.Page < p.Pages(total) {
+		data["next"] = link(p.Page + 1)
+	}
+
+	return data
+}
+
+func setTotalCount(rw http.ResponseWriter, total int) {
+	rw.Header().Set(totalCountHeader, strconv.Itoa(total))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	type Test struct {
+		Name   string
+		Query  string
+		Page   pagination
+		Offset int
+		Err    bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Defaults",
+			Page: pagination{Page: 1, Limit: defaultPageLimit},
+		},
+		{
+			Name:   "Page and limit",
+			Query:  "page=3&limit=10",
+			Page:   pagination{Page: 3, Limit: 10},
+			Offset: 20,
+		},
+		{
+			Name:  "Limit is capped",
+			Query: "limit=100000",
+			Page:  pagination{Page: 1, Limit: maxPageLimit},
+		},
+		{
+			Name:  "Invalid page",
+			Query: "page=0",
+			Err:   true,
+		},
+		{
+			Name:  "Invalid limit",
+			Query: "limit=all",
+			Err:   true,
+		},
+		{
+			Name:  "Offset overflows",
+			Query: "page=18446744073709553&limit=500",
+			Err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/history?"+tc.Query, nil)
+
+			page, err := parsePagination(r)
+			if (err != nil) != tc.Err {
+				t.Fatalf("Error does not match: %v", err)
+			}
+
+			if tc.Err {
+				return
+			}
+
+			if page != tc.Page {
+				t.Errorf("Page does not match: %+v vs %+v", page, tc.Page)
+			}
+
+			if page.Offset() != tc.Offset {
+				t.Errorf("Offset does not match: %d vs %d", page.Offset(), tc.Offset)
+			}
+		})
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/history?expand=true&page=2&limit=10", nil)
+
+	page, err := parsePagination(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"page":  2,
+		"pages": 3,
+		"total": 25,
+		"prev":  "?expand=true&limit=10&page=1",
+		"next":  "?expand=true&limit=10&page=3",
+	}
+
+	if links := page.links(r, 25); !reflect.DeepEqual(links, want) {
+		t.Errorf("Links do not match: %v vs %v", links, want)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// rewriteRules are the rewrite rules of a trigger, target or the deduplication,
+// along with the trimmed prefixes and the rewrite chain of a target.
+type rewriteRules struct {
+	Kind       string
+	Name       string
+	TrimPrefix []string
+	Rules      []autoscan.Rewrite
+	Chain      []autoscan.RewriteStage
+}
+
+// rewriteTrace describes how the rewrite rules of a trigger or target handle a path.
+type rewriteTrace struct {
+	Kind    string                 `json:"kind"`
+	Name    string                 `json:"name"`
+	Steps   []autoscan.RewriteStep `json:"steps"`
+	Matched bool                   `json:"matched"`
+	Result  string                 `json:"result"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// configRewrites returns the rewrite rules of all triggers and targets in the config,
+// in the order in which they are combined by the triggers and targets themselves.
+func configRewrites(c config) []rewriteRules {
+	var sets []rewriteRules
+	add := func(kind string, name string, rules []autoscan.Rewrite) {
+		if len(rules) > 0 {
+			sets = append(sets, rewriteRules{Kind: kind, Name: name, Rules: rules})
+		}
+	}
+
+	addTarget := func(name string, trim []string, rules []autoscan.Rewrite, chain []autoscan.RewriteStage) {
+		if len(trim) > 0 || len(rules) > 0 || len(chain) > 0 {
+			sets = append(sets, rewriteRules{Kind: "target", Name: name, TrimPrefix: trim, Rules: rules, Chain: chain})
+		}
+	}
+
+	t := c.Triggers
+	add("trigger", "manual", t.Manual.Rewrite)
+
+	add("trigger", "a-train", t.ATrain.Rewrite)
+	for _, d := range t.ATrain.Drives {
+		add("trigger", "a-train drive "+d.ID, append(d.Rewrite, t.ATrain.Rewrite...))
+	}
+
+	for _, b := range t.Bernard {
+		for _, d := range b.Drives {
+			add("trigger", "bernard drive "+d.ID, append(d.Rewrite, b.Rewrite...))
+		}
+	}
+
+	for _, i := range t.Inotify {
+		for _, p := range i.Paths {
+			add("trigger", "inotify "+p.Path, append(p.Rewrite, i.Rewrite...))
+		}
+	}
+
+	for _, p := range t.Poll {
+		for _, pp := range p.Paths {
+			add("trigger", "poll "+pp.Path, append(pp.Rewrite, p.Rewrite...))
+		}
+	}
+
+	for _, l := range t.Lidarr {
+		add("trigger", l.Name, l.Rewrite)
+	}
+
+	for _, r := range t.Radarr {
+		add("trigger", r.Name, r.Rewrite)
+	}
+
+	for _, r := range t.Readarr {
+		add("trigger", r.Name, r.Rewrite)
+	}
+
+	for _, s := range t.Sonarr {
+		add("trigger", s.Name, s.Rewrite)
+	}
+
+	for _, a := range c.Targets.Autoscan {
+		addTarget(a.Name, a.TrimPrefix, a.Rewrite, a.RewriteChain)
+	}
+
+	for _, e := range c.Targets.Emby {
+		addTarget(e.Name, e.TrimPrefix, e.Rewrite, e.RewriteChain)
+	}
+
+	for _, j := range c.Targets.Jellyfin {
+		addTarget(j.Name, j.TrimPrefix, j.Rewrite, j.RewriteChain)
+	}
+
+	types := make([]string, 0, len(c.Targets.Registered))
+	for name := range c.Targets.Registered {
+		types = append(types, name)
+	}
+
+	sort.Strings(types)
+	for _, name := range types {
+		for _, raw := range c.Targets.Registered[name] {
+			trim, rules, chain := registeredRewrites(raw)
+			addTarget(raw.Name(), trim, rules, chain)
+		}
+	}
+
+	add("dedup", "dedup", c.Dedup)
+	return sets
+}
+
+// registeredRewrites returns the trimmed prefixes, rewrite rules and chain in the config of a registered target.
+func registeredRewrites(raw autoscan.RawConfig) ([]string, []autoscan.Rewrite, []autoscan.RewriteStage) {
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	var rc struct {
+		TrimPrefix   []string                `yaml:"trim-prefix"`
+		Rewrite      []autoscan.Rewrite      `yaml:"rewrite"`
+		RewriteChain []autoscan.RewriteStage `yaml:"rewrite-chain"`
+	}
+
+	if err := yaml.Unmarshal(b, &rc); err != nil {
+		return nil, nil, nil
+	}
+
+	return rc.TrimPrefix, rc.Rewrite, rc.RewriteChain
+}
+
+// traceRewrites traces the path through every set of rewrite rules.
+// The rules are traced with the path without the trimmed prefix,
+// and every stage of a rewrite chain is traced with the result of the rules before it.
+func traceRewrites(sets []rewriteRules, path string) []rewriteTrace {
+	traces := make([]rewriteTrace, 0, len(sets))
+	for _, set := range sets {
+		result := path
+		if len(set.TrimPrefix) > 0 {
+			trace := rewriteTrace{Kind: set.Kind, Name: set.Name + " trim-prefix"}
+			trace.Steps, result = autoscan.TrimPrefixTrace(set.TrimPrefix, result)
+			trace.Result = result
+			for _, step := range trace.Steps {
+				trace.Matched = trace.Matched || step.Matched
+			}
+
+			traces = append(traces, trace)
+		}
+
+		if len(set.Rules) > 0 {
+			var trace rewriteTrace
+			trace, result = traceRules(set.Kind, set.Name, set.Rules, result)
+			traces = append(traces, trace)
+		}
+
+		for i, stage := range set.Chain {
+			name := stage.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+
+			var trace rewriteTrace
+			trace, result = traceRules(set.Kind, set.Name+" rewrite-chain "+name, stage.Rewrite, result)
+			traces = append(traces, trace)
+		}
+	}
+
+	return traces
+}
+
+// traceRules traces the path through the rewrite rules, and returns the trace along with the result.
+func traceRules(kind string, name string, rules []autoscan.Rewrite, path string) (rewriteTrace, string) {
+	trace := rewriteTrace{
+		Kind: kind,
+		Name: name,
+	}
+
+	steps, result, err := autoscan.RewriteTrace(rules, path)
+	if err != nil {
+		trace.Error = err.Error()
+	}
+
+	trace.Steps = steps
+	trace.Result = result
+	for _, step := range steps {
+		trace.Matched = trace.Matched || step.Matched
+	}
+
+	return trace, result
+}
+
+func rewriteAPIHandler(c config) http.HandlerFunc {
+	sets := configRewrites(c)
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "path is required"})
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, traceRewrites(sets, path))
+	}
+}
+
+func rewriteHandler(c config, tmpl *template.Template) http.HandlerFunc {
+	sets := configRewrites(c)
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		data := map[string]any{
+			"title": "Autoscan Rewrites",
+			"path":  path,
+		}
+
+		if path != "" {
+			data["traces"] = traceRewrites(sets, path)
+		}
+
+		renderTemplate(rw, tmpl, data)
+	}
+}
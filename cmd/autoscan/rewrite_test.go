@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/emby"
+	"github.com/cloudbox/autoscan/triggers/sonarr"
+)
+
+func TestRewriteAPIHandler(t *testing.T) {
+	c := config{}
+	c.Triggers.Sonarr = []sonarr.Config{{
+		Name: "sonarr",
+		Rewrite: []autoscan.Rewrite{
+			{From: "^/Movies/", To: "/mnt/unionfs/Media/Movies/"},
+			{From: "^/TV/", To: "/mnt/unionfs/Media/TV/"},
+		},
+	}}
+	c.Targets.Emby = []emby.Config{{
+		Name:    "emby",
+		Rewrite: []autoscan.Rewrite{{From: "^/mnt/unionfs/Media/", To: "/data/"}},
+	}}
+
+	rec := httptest.NewRecorder()
+	rewriteAPIHandler(c)(rec, httptest.NewRequest("GET", "/api/rewrite?path=/TV/Westworld", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status codes do not match: %d vs %d", rec.Code, http.StatusOK)
+	}
+
+	var traces []rewriteTrace
+	if err := json.NewDecoder(rec.Body).Decode(&traces); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rewriteTrace{
+		{
+			Kind: "trigger",
+			Name: "sonarr",
+			Steps: []autoscan.RewriteStep{
+				{Index: 0, From: "^/Movies/", To: "/mnt/unionfs/Media/Movies/", Result: "/TV/Westworld"},
+				{Index: 1, From: "^/TV/", To: "/mnt/unionfs/Media/TV/", Matched: true, Result: "/mnt/unionfs/Media/TV/Westworld"},
+			},
+			Matched: true,
+			Result:  "/mnt/unionfs/Media/TV/Westworld",
+		},
+		{
+			Kind: "target",
+			Name: "emby",
+			Steps: []autoscan.RewriteStep{
+				{Index: 0, From: "^/mnt/unionfs/Media/", To: "/data/", Result: "/TV/Westworld"},
+			},
+			Result: "/TV/Westworld",
+		},
+	}
+
+	if !reflect.DeepEqual(traces, want) {
+		t.Errorf("Traces do not match\n%+v\nvs\n%+v", traces, want)
+	}
+
+	rec = httptest.NewRecorder()
+	rewriteAPIHandler(c)(rec, httptest.NewRequest("GET", "/api/rewrite", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a missing path to be rejected, got: %d", rec.Code)
+	}
+}
+
+func TestTraceRewriteChain(t *testing.T) {
+	sets := []rewriteRules{{
+		Kind:  "target",
+		Name:  "plex",
+		Rules: []autoscan.Rewrite{{From: "^/mnt/unionfs/", To: "/data/"}},
+		Chain: []autoscan.RewriteStage{
+			{Name: "flatten", Rewrite: []autoscan.Rewrite{{From: "^/data/Media/", To: "/data/"}}},
+			{Rewrite: []autoscan.Rewrite{{From: "^/Movies/", To: "/data/Movies/"}}},
+		},
+	}}
+
+	traces := traceRewrites(sets, "/mnt/unionfs/Media/TV/Westworld")
+
+	want := []rewriteTrace{
+		{
+			Kind: "target",
+			Name: "plex",
+			Steps: []autoscan.RewriteStep{
+				{Index: 0, From: "^/mnt/unionfs/", To: "/data/", Matched: true, Result: "/data/Media/TV/Westworld"},
+			},
+			Matched: true,
+			Result:  "/data/Media/TV/Westworld",
+		},
+		{
+			Kind: "target",
+			Name: "plex rewrite-chain flatten",
+			Steps: []autoscan.RewriteStep{
+				{Index: 0, From: "^/data/Media/", To: "/data/", Matched: true, Result: "/data/TV/Westworld"},
+			},
+			Matched: true,
+			Result:  "/data/TV/Westworld",
+		},
+		{
+			Kind: "target",
+			Name: "plex rewrite-chain #2",
+			Steps: []autoscan.RewriteStep{
+				{Index: 0, From: "^/Movies/", To: "/data/Movies/", Result: "/data/TV/Westworld"},
+			},
+			Result: "/data/TV/Westworld",
+		},
+	}
+
+	if !reflect.DeepEqual(traces, want) {
+		t.Errorf("Traces do not match\n%+v\nvs\n%+v", traces, want)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/hlog"
@@ -11,6 +13,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/cloudbox/autoscan"
 	"github.com/cloudbox/autoscan/processor"
 	"github.com/cloudbox/autoscan/triggers/a_train"
 	"github.com/cloudbox/autoscan/triggers/lidarr"
@@ -20,17 +23,68 @@ import (
 	"github.com/cloudbox/autoscan/triggers/sonarr"
 )
 
-func pattern(name string) string {
-	return fmt.Sprintf("/%s", name)
+// pattern returns the route of a trigger, e.g. /sonarr or /sonarr/tv-4k.
+func pattern(elems ...string) string {
+	return "/" + strings.Join(elems, "/")
 }
 
-func createCredentials(c config) map[string]string {
-	creds := make(map[string]string)
-	creds[c.Auth.Username] = c.Auth.Password
+func createCredentials(c config) map[string]authUser {
+	creds := make(map[string]authUser)
+	for _, user := range authUsers(c) {
+		creds[user.Username] = user
+	}
+
 	return creds
 }
 
-func getRouter(c config, proc *processor.Processor) chi.Router {
+// basicAuth returns the basic authentication middleware,
+// which passes the role of the authenticated user on to the next handlers.
+// When enabled, API clients accepting JSON receive a JSON error
+// instead of the browser prompt of the WWW-Authenticate header.
+func basicAuth(c config, realm string) func(http.Handler) http.Handler {
+	creds := createCredentials(c)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			user, ok := authenticate(creds, r)
+			if ok {
+				next.ServeHTTP(rw, withRole(r, user.Role))
+				return
+			}
+
+			if c.Auth.JSONUnauthorized && strings.Contains(r.Header.Get("Accept"), "application/json") {
+				writeJSON(rw, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+				return
+			}
+
+			rw.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
+			rw.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+}
+
+// trustedNetworks skips the authentication of requests from clients within the trusted networks,
+// which are given the admin role.
+// The client is determined with clientIP, so X-Forwarded-For is only honoured for trusted proxies.
+func trustedNetworks(trusted []*net.IPNet, proxies []*net.IPNet, auth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authNext := auth(next)
+		if len(trusted) == 0 {
+			return authNext
+		}
+
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if containsIP(trusted, clientIP(r, proxies)) {
+				next.ServeHTTP(rw, withRole(r, roleAdmin))
+				return
+			}
+
+			authNext.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func getRouter(c config, proc *processor.Processor, targets []autoscan.Target) chi.Router {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -50,12 +104,29 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 
 	// Health check
 	r.Get("/health", healthHandler)
+	health := newTargetHealth(targets, c.Health.FailureThreshold, c.Health.SuccessThreshold, c.Health.CheckInterval)
+	r.Get("/readyz", readyHandler(rootsCheck{roots: c.Health.Roots}, health))
+
+	proxies, err := parseCIDRs(c.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing trusted proxies")
+	}
+
+	allowedIPs := func(trigger string, cidrs []string) func(http.Handler) http.Handler {
+		allowed, err := parseCIDRs(cidrs)
+		if err != nil {
+			log.Fatal().Err(err).Str("trigger", trigger).Msg("Failed parsing allowed ips")
+		}
+
+		return ipFilter(allowed, proxies)
+	}
 
 	// HTTP-Triggers
 	r.Route("/triggers", func(r chi.Router) {
-		// Use Basic Auth middleware if username and password are set.
-		if c.Auth.Username != "" && c.Auth.Password != "" {
-			r.Use(middleware.BasicAuth("Autoscan 1.x", createCredentials(c)))
+		// Use Basic Auth middleware if any user is set, only admins may add scans.
+		if authEnabled(c) {
+			r.Use(basicAuth(c, "Autoscan 1.x"))
+			r.Use(requireRole(roleAdmin))
 		}
 
 		// A-Train HTTP-trigger
@@ -65,6 +136,7 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", "a-train").Msg("Failed initialising trigger")
 			}
 
+			r.Use(allowedIPs("a-train", c.Triggers.ATrain.AllowedIPs))
 			r.Post("/{drive}", trigger(proc.Add).ServeHTTP)
 		})
 
@@ -75,17 +147,26 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", "manual").Msg("Failed initialising trigger")
 			}
 
-			r.HandleFunc("/", trigger(proc.Add).ServeHTTP)
+			r.Use(allowedIPs("manual", c.Triggers.Manual.AllowedIPs))
+			r.HandleFunc("/", trigger(allowedLibraries(c.Triggers.Manual.AllowedLibraries, targets, proc.Add)).ServeHTTP)
 		})
 
 		// OLD-style HTTP-triggers. Can be converted to the /{trigger}/{id} format in a 2.0 release.
+		// Until then, every instance is served at both /{id} and /{trigger}/{id}.
 		for _, t := range c.Triggers.Lidarr {
 			trigger, err := lidarr.New(t)
 			if err != nil {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			add, err := boundTargets(t.Targets, targets, proc.Add)
+			if err != nil {
+				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
+			}
+
+			tr := r.With(allowedIPs(t.Name, t.AllowedIPs))
+			tr.Post(pattern(t.Name), trigger(add).ServeHTTP)
+			tr.Post(pattern("lidarr", t.Name), trigger(add).ServeHTTP)
 		}
 
 		for _, t := range c.Triggers.Radarr {
@@ -94,7 +175,14 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			add, err := boundTargets(t.Targets, targets, proc.Add)
+			if err != nil {
+				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
+			}
+
+			tr := r.With(allowedIPs(t.Name, t.AllowedIPs))
+			tr.Post(pattern(t.Name), trigger(add).ServeHTTP)
+			tr.Post(pattern("radarr", t.Name), trigger(add).ServeHTTP)
 		}
 
 		for _, t := range c.Triggers.Readarr {
@@ -103,7 +191,14 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			add, err := boundTargets(t.Targets, targets, proc.Add)
+			if err != nil {
+				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
+			}
+
+			tr := r.With(allowedIPs(t.Name, t.AllowedIPs))
+			tr.Post(pattern(t.Name), trigger(add).ServeHTTP)
+			tr.Post(pattern("readarr", t.Name), trigger(add).ServeHTTP)
 		}
 
 		for _, t := range c.Triggers.Sonarr {
@@ -112,7 +207,14 @@ func getRouter(c config, proc *processor.Processor) chi.Router {
 				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
 			}
 
-			r.Post(pattern(t.Name), trigger(proc.Add).ServeHTTP)
+			add, err := boundTargets(t.Targets, targets, proc.Add)
+			if err != nil {
+				log.Fatal().Err(err).Str("trigger", t.Name).Msg("Failed initialising trigger")
+			}
+
+			tr := r.With(allowedIPs(t.Name, t.AllowedIPs))
+			tr.Post(pattern(t.Name), trigger(add).ServeHTTP)
+			tr.Post(pattern("sonarr", t.Name), trigger(add).ServeHTTP)
 		}
 	})
 
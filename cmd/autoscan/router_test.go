@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	type Test struct {
+		Name             string
+		JSONUnauthorized bool
+		Accept           string
+		Username         string
+		Password         string
+		WantStatus       int
+		WantPrompt       bool
+		WantContentType  string
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Prompts browsers by default",
+			Accept:     "application/json",
+			WantStatus: http.StatusUnauthorized,
+			WantPrompt: true,
+		},
+		{
+			Name:             "Prompts HTML clients",
+			JSONUnauthorized: true,
+			Accept:           "text/html",
+			WantStatus:       http.StatusUnauthorized,
+			WantPrompt:       true,
+		},
+		{
+			Name:             "Responds with JSON to API clients",
+			JSONUnauthorized: true,
+			Accept:           "application/json",
+			Username:         "user",
+			Password:         "wrong",
+			WantStatus:       http.StatusUnauthorized,
+			WantContentType:  "application/json",
+		},
+		{
+			Name:             "Allows valid credentials",
+			JSONUnauthorized: true,
+			Accept:           "application/json",
+			Username:         "user",
+			Password:         "pass",
+			WantStatus:       http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := config{}
+			c.Auth.Username = "user"
+			c.Auth.Password = "pass"
+			c.Auth.JSONUnauthorized = tc.JSONUnauthorized
+
+			handler := basicAuth(c, "Autoscan")(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/status", nil)
+			req.Header.Set("Accept", tc.Accept)
+			if tc.Username != "" {
+				req.SetBasicAuth(tc.Username, tc.Password)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.WantStatus {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+
+			if prompt := rec.Header().Get("WWW-Authenticate") != ""; prompt != tc.WantPrompt {
+				t.Errorf("Expected prompt: %v, got: %v", tc.WantPrompt, prompt)
+			}
+
+			if tc.WantContentType != "" && rec.Header().Get("Content-Type") != tc.WantContentType {
+				t.Errorf("Content types do not match: %s vs %s", rec.Header().Get("Content-Type"), tc.WantContentType)
+			}
+		})
+	}
+}
+
+func TestTrustedNetworks(t *testing.T) {
+	type Test struct {
+		Name          string
+		RemoteAddr    string
+		XForwardedFor string
+		WantStatus    int
+	}
+
+	trusted, err := parseCIDRs([]string{"192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxies, err := parseCIDRs([]string{"172.19.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Skips authentication within trusted networks",
+			RemoteAddr: "192.168.1.5:51234",
+			WantStatus: http.StatusOK,
+		},
+		{
+			Name:       "Requires authentication outside of trusted networks",
+			RemoteAddr: "203.0.113.7:51234",
+			WantStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:          "Honours X-Forwarded-For from trusted proxies",
+			RemoteAddr:    "172.19.0.2:51234",
+			XForwardedFor: "192.168.1.5",
+			WantStatus:    http.StatusOK,
+		},
+		{
+			Name:          "Ignores X-Forwarded-For from untrusted clients",
+			RemoteAddr:    "203.0.113.7:51234",
+			XForwardedFor: "192.168.1.5",
+			WantStatus:    http.StatusUnauthorized,
+		},
+		{
+			Name:          "Requires authentication for remote clients behind trusted proxies",
+			RemoteAddr:    "172.19.0.2:51234",
+			XForwardedFor: "203.0.113.7",
+			WantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := config{}
+			c.Auth.Username = "user"
+			c.Auth.Password = "pass"
+
+			handler := trustedNetworks(trusted, proxies, basicAuth(c, "Autoscan UI"))(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			if tc.XForwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.XForwardedFor)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.WantStatus {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+		})
+	}
+}
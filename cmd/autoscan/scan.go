@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// scanCmd scans folders once, either through the API of a running instance
+// or with the targets of the config.
+type scanCmd struct {
+	Folders []string `arg:"" name:"folder" help:"Folders to scan"`
+
+	Local    bool   `help:"Scan with the targets of the config instead of a running instance"`
+	URL      string `name:"url" default:"http://localhost:4040" env:"AUTOSCAN_URL" help:"URL of the web UI of the running instance"`
+	Username string `env:"AUTOSCAN_USERNAME" help:"Username of the web UI of the running instance"`
+	Password string `env:"AUTOSCAN_PASSWORD" help:"Password of the web UI of the running instance"`
+
+	Targets   []string `name:"target" help:"Only scan with the targets with the given names"`
+	Priority  int      `help:"Priority of the scans, only used by a running instance"`
+	Deep      bool     `help:"Scan the entire libraries of the folders"`
+	Immediate bool     `help:"Scan right away, bypassing the minimum age of a running instance"`
+	Reason    string   `default:"cli" help:"Reason of the scans"`
+}
+
+// scanTimeout is the timeout of the requests to a running instance.
+const scanTimeout = 30 * time.Second
+
+// runScan scans the folders and returns an error when any of the scans failed.
+func runScan(cmd scanCmd) error {
+	if !cmd.Local {
+		return remoteScan(cmd, &http.Client{Timeout: scanTimeout}, os.Stdout)
+	}
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		TimeFormat: time.Stamp,
+		Out:        os.Stderr,
+	}).Level(zerolog.InfoLevel)
+
+	if cli.Verbosity > 0 {
+		log.Logger = log.Logger.Level(zerolog.DebugLevel)
+	}
+
+	c, err := loadConfig(cli.Config)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	return localScan(cmd, initTargets(c, filepath.Dir(cli.Database)))
+}
+
+// remoteScan adds the scans to the queue of a running instance with its scan API,
+// and writes the IDs of the scans to out.
+func remoteScan(cmd scanCmd, client *http.Client, out io.Writer) error {
+	url := strings.TrimSuffix(cmd.URL, "/") + "/api/scan"
+
+	for _, folder := range cmd.Folders {
+		body, err := json.Marshal(scanRequest{
+			Folder:    folder,
+			Priority:  cmd.Priority,
+			Deep:      cmd.Deep,
+			Immediate: cmd.Immediate,
+			Targets:   cmd.Targets,
+			Reason:    cmd.Reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if cmd.Username != "" || cmd.Password != "" {
+			req.SetBasicAuth(cmd.Username, cmd.Password)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", folder, err)
+		}
+
+		var resp struct {
+			scanResponse
+			errorResponse
+		}
+
+		err = json.NewDecoder(res.Body).Decode(&resp)
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode != http.StatusOK && resp.Error != "":
+			return fmt.Errorf("%s: %s: %s", folder, res.Status, resp.Error)
+		case res.StatusCode != http.StatusOK:
+			return fmt.Errorf("%s: %s", folder, res.Status)
+		case err != nil:
+			return fmt.Errorf("%s: invalid response: %w", folder, err)
+		}
+
+		fmt.Fprintf(out, "%s\t%s\n", resp.ID, folder)
+	}
+
+	return nil
+}
+
+// localScan sends the scans to the targets right away.
+// Scans held back by a target are sent before returning.
+func localScan(cmd scanCmd, targets []autoscan.Target) error {
+	for _, name := range cmd.Targets {
+		if !hasTarget(targets, name) {
+			return fmt.Errorf("unknown target: %s", name)
+		}
+	}
+
+	failed := 0
+	for _, folder := range cmd.Folders {
+		scan := autoscan.Scan{
+			Folder:    path.Clean(folder),
+			Time:      time.Now(),
+			Deep:      cmd.Deep,
+			Immediate: cmd.Immediate,
+			Targets:   cmd.Targets,
+			Reason:    cmd.Reason,
+			ID:        autoscan.NewScanID(),
+		}
+
+		for _, target := range scanTargetsOf(targets, scan) {
+			// held back scans are sent when the targets are drained
+			if err := target.Scan(scan); err != nil && !errors.Is(err, autoscan.ErrScanDeferred) {
+				log.Error().
+					Err(err).
+					Str("path", scan.Folder).
+					Str("target", autoscan.TargetName(target)).
+					Msg("Scan failed")
+
+				failed++
+			}
+		}
+	}
+
+	for _, target := range targets {
+		drainer, ok := target.(autoscan.Drainer)
+		if !ok {
+			continue
+		}
+
+		if _, unsent := drainer.Drain(); len(unsent) > 0 {
+			log.Error().
+				Str("target", autoscan.TargetName(target)).
+				Int("scans", len(unsent)).
+				Msg("Failed sending held back scans")
+
+			failed += len(unsent)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d scans failed", failed)
+	}
+
+	return nil
+}
+
+// scanTargetsOf returns the targets the scan should be sent to.
+func scanTargetsOf(targets []autoscan.Target, scan autoscan.Scan) []autoscan.Target {
+	if len(scan.Targets) == 0 {
+		return targets
+	}
+
+	matching := make([]autoscan.Target, 0, len(scan.Targets))
+	for _, target := range targets {
+		if containsString(scan.Targets, autoscan.TargetName(target)) {
+			matching = append(matching, target)
+		}
+	}
+
+	return matching
+}
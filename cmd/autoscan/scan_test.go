@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+func TestRemoteScan(t *testing.T) {
+	targets := []autoscan.Target{namedLibraries{name: "plex"}}
+
+	var added []autoscan.Scan
+	add := func(scans ...autoscan.Scan) error {
+		added = append(added, scans...)
+		return nil
+	}
+
+	server := httptest.NewServer(scanAPIHandler(add, targets, nil))
+	defer server.Close()
+
+	out := new(bytes.Buffer)
+	cmd := scanCmd{
+		Folders:   []string{"/Movies/Tenet (2020)", "/TV/Westworld"},
+		URL:       server.URL,
+		Targets:   []string{"plex"},
+		Immediate: true,
+		Reason:    "cli",
+	}
+
+	if err := remoteScan(cmd, server.Client(), out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 2 || added[0].Folder != "/Movies/Tenet (2020)" || !added[1].Immediate || added[1].Reason != "cli" {
+		t.Errorf("Unexpected scans: %+v", added)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[1], "\t/TV/Westworld") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	cmd.Targets = []string{"emby"}
+	if err := remoteScan(cmd, server.Client(), out); err == nil || !strings.Contains(err.Error(), "unknown target: emby") {
+		t.Errorf("Expected the error of the API, got: %v", err)
+	}
+}
+
+func TestLocalScan(t *testing.T) {
+	plex, _ := mock.New(mock.Config{Name: "plex"})
+	emby, _ := mock.New(mock.Config{Name: "emby"})
+	failing, _ := mock.New(mock.Config{Name: "failing", ScanError: errors.New("unavailable")})
+
+	type Test struct {
+		Name    string
+		Targets []string
+		Want    map[string]int
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Restricted to targets",
+			Targets: []string{"plex", "emby"},
+			Want:    map[string]int{"plex": 1, "emby": 1, "failing": 0},
+		},
+		{
+			Name:    "Failing target",
+			Want:    map[string]int{"plex": 2, "emby": 2, "failing": 1},
+			WantErr: true,
+		},
+		{
+			Name:    "Unknown target",
+			Targets: []string{"jellyfin"},
+			Want:    map[string]int{"plex": 2, "emby": 2, "failing": 1},
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cmd := scanCmd{Folders: []string{"/Movies/Tenet (2020)/"}, Targets: tc.Targets}
+
+			err := localScan(cmd, []autoscan.Target{plex, emby, failing})
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := map[string]int{"plex": len(plex.Recorded()), "emby": len(emby.Recorded()), "failing": len(failing.Recorded())}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("Scans do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+
+	if folder := plex.Recorded()[0].Folder; folder != "/Movies/Tenet (2020)" {
+		t.Errorf("Folders do not match: %s vs %s", folder, "/Movies/Tenet (2020)")
+	}
+}
+
+func TestLocalScanDrain(t *testing.T) {
+	targets := []autoscan.Target{drainingTarget{name: "plex", unsent: []autoscan.Scan{{Folder: "/Movies"}}}}
+
+	if err := localScan(scanCmd{Folders: []string{"/Movies/Tenet (2020)"}}, targets); err == nil {
+		t.Error("Expected an error for held back scans which could not be sent")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	targetsConfigType = reflect.TypeOf(targetsConfig{})
+)
+
+// writeConfigSchema writes an example config containing every available option.
+// The example is generated from the yaml tags of the config structs,
+// each option is commented with its type.
+func writeConfigSchema(w io.Writer) error {
+	lines := []string{
+		"# Autoscan config options",
+		"# Generated from the config structs of this build, values are zero values.",
+	}
+
+	lines = append(lines, schemaLines(reflect.TypeOf(config{}))...)
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// schemaLines returns the example config lines of the struct type.
+func schemaLines(t reflect.Type) []string {
+	lines := make([]string, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		lines = append(lines, fieldLines(name, field.Type)...)
+	}
+
+	// registered targets are not part of the struct
+	if t == targetsConfigType {
+		for _, name := range autoscan.RegisteredTargets() {
+			c := autoscan.TargetConfig(name)
+			if c == nil {
+				continue
+			}
+
+			lines = append(lines, fieldLines(name, reflect.SliceOf(reflect.TypeOf(c).Elem()))...)
+		}
+	}
+
+	return lines
+}
+
+// fieldLines returns the example config lines of a single option.
+func fieldLines(name string, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == durationType:
+		return []string{fmt.Sprintf("%s: 0s # duration", name)}
+	case t.Kind() == reflect.Struct:
+		return append([]string{name + ":"}, indentLines(schemaLines(t), "  ", "  ")...)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+		return append([]string{name + ":"}, indentLines(schemaLines(t.Elem()), "  - ", "    ")...)
+	case t.Kind() == reflect.Slice:
+		return []string{fmt.Sprintf("%s: [] # list of %s", name, typeName(t.Elem()))}
+	case t.Kind() == reflect.Map:
+		return []string{fmt.Sprintf("%s: {} # map of %s to %s", name, typeName(t.Key()), typeName(t.Elem()))}
+	case t.Kind() == reflect.Interface:
+		return nil
+	default:
+		return []string{fmt.Sprintf("%s: %s # %s", name, zeroValue(t), typeName(t))}
+	}
+}
+
+// indentLines prefixes the first line with first and all other lines with rest.
+func indentLines(lines []string, first string, rest string) []string {
+	indented := make([]string, len(lines))
+	for i, line := range lines {
+		if i == 0 {
+			indented[i] = first + line
+			continue
+		}
+
+		indented[i] = rest + line
+	}
+
+	return indented
+}
+
+func typeName(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+
+	return t.Kind().String()
+}
+
+func zeroValue(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return `""`
+	case reflect.Bool:
+		return "false"
+	default:
+		return "0"
+	}
+}
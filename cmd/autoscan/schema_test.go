@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestWriteConfigSchema(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeConfigSchema(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := buf.String()
+
+	// the example must be a valid config
+	c := config{}
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &c); err != nil {
+		t.Fatalf("Schema is not a valid config: %v\n%s", err, schema)
+	}
+
+	for _, want := range []string{
+		"minimum-age: 0s # duration",
+		"  manual:\n    rewrite:\n      - from: \"\" # string",
+		"  plex:\n    - name: \"\" # string\n      url: \"\" # string",
+		"      rewrite:\n        - from: \"\" # string",
+		"      cookies: {} # map of string to string",
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("Schema does not contain %q:\n%s", want, schema)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serverTimeouts limits the time the HTTP servers spend on a single connection,
+// so slow or idle clients cannot hold on to connections indefinitely.
+// A timeout of 0 disables the timeout.
+type serverTimeouts struct {
+	ReadTimeout       time.Duration `yaml:"read-timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read-header-timeout"`
+	WriteTimeout      time.Duration `yaml:"write-timeout"`
+	IdleTimeout       time.Duration `yaml:"idle-timeout"`
+}
+
+var defaultServerTimeouts = serverTimeouts{
+	ReadTimeout:       30 * time.Second,
+	ReadHeaderTimeout: 10 * time.Second,
+	WriteTimeout:      1 * time.Minute,
+	IdleTimeout:       2 * time.Minute,
+}
+
+func (t serverTimeouts) validate() error {
+	for name, timeout := range map[string]time.Duration{
+		"read-timeout":        t.ReadTimeout,
+		"read-header-timeout": t.ReadHeaderTimeout,
+		"write-timeout":       t.WriteTimeout,
+		"idle-timeout":        t.IdleTimeout,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("invalid %s %s: must not be negative", name, timeout)
+		}
+	}
+
+	return nil
+}
+
+// newServer returns a HTTP server for the handler with the given timeouts.
+//
+// Handlers which stream their response must finish within the write timeout,
+// as the connection is closed once the write timeout has passed.
+func newServer(addr string, handler http.Handler, t serverTimeouts) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       t.ReadTimeout,
+		ReadHeaderTimeout: t.ReadHeaderTimeout,
+		WriteTimeout:      t.WriteTimeout,
+		IdleTimeout:       t.IdleTimeout,
+	}
+}
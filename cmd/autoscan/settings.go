@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudbox/autoscan/processor"
+)
+
+// serverAddr returns the address of the trigger server on the host.
+// A host without a port listens on the configured port.
+func serverAddr(host string, port int) string {
+	if strings.Contains(host, ":") {
+		return host
+	}
+
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// effectiveSettings summarises the effective config in a single set of log fields.
+// Only the names of triggers and targets are included, never their secrets.
+func effectiveSettings(c config) map[string]any {
+	names := func(name string, fallback string) string {
+		if name == "" {
+			return fallback
+		}
+
+		return name
+	}
+
+	targets := make(map[string][]string)
+	for _, t := range c.Targets.Autoscan {
+		targets["autoscan"] = append(targets["autoscan"], names(t.Name, "autoscan"))
+	}
+
+	for _, t := range c.Targets.Emby {
+		targets["emby"] = append(targets["emby"], names(t.Name, "emby"))
+	}
+
+	for _, t := range c.Targets.Jellyfin {
+		targets["jellyfin"] = append(targets["jellyfin"], names(t.Name, "jellyfin"))
+	}
+
+	for _, name := range c.Targets.registeredNames() {
+		for _, raw := range c.Targets.Registered[name] {
+			targets[name] = append(targets[name], names(raw.Name(), name))
+		}
+	}
+
+	triggers := map[string][]string{
+		"manual": {"manual"},
+	}
+
+	if len(c.Triggers.ATrain.Drives) > 0 {
+		triggers["a-train"] = []string{"a-train"}
+	}
+
+	for _, t := range c.Triggers.Bernard {
+		for _, d := range t.Drives {
+			triggers["bernard"] = append(triggers["bernard"], d.ID)
+		}
+	}
+
+	for _, t := range c.Triggers.Inotify {
+		for _, p := range t.Paths {
+			triggers["inotify"] = append(triggers["inotify"], p.Path)
+		}
+	}
+
+	for _, t := range c.Triggers.Poll {
+		for _, p := range t.Paths {
+			triggers["poll"] = append(triggers["poll"], p.Path)
+		}
+	}
+
+	for _, t := range c.Triggers.Lidarr {
+		triggers["lidarr"] = append(triggers["lidarr"], t.Name)
+	}
+
+	for _, t := range c.Triggers.Radarr {
+		triggers["radarr"] = append(triggers["radarr"], t.Name)
+	}
+
+	for _, t := range c.Triggers.Readarr {
+		triggers["readarr"] = append(triggers["readarr"], t.Name)
+	}
+
+	for _, t := range c.Triggers.Schedule {
+		triggers["schedule"] = append(triggers["schedule"], t.Name)
+	}
+
+	for _, t := range c.Triggers.Sonarr {
+		triggers["sonarr"] = append(triggers["sonarr"], t.Name)
+	}
+
+	servers := make([]string, 0, len(c.Host))
+	webUIs := make([]string, 0, len(c.Host))
+	for _, host := range c.Host {
+		servers = append(servers, serverAddr(host, c.Port))
+		webUIs = append(webUIs, webUIAddr(host))
+	}
+
+	queueOrder := c.QueueOrder
+	if queueOrder == "" {
+		queueOrder = processor.QueueOrderFIFO
+	}
+
+	dedupScope := c.DedupScope
+	if dedupScope == "" {
+		dedupScope = processor.DedupScopeFolder
+	}
+
+	return map[string]any{
+		"targets":         targets,
+		"triggers":        triggers,
+		"servers":         servers,
+		"webui":           webUIs,
+		"authentication":  authEnabled(c),
+		"min_age":         c.MinimumAge.String(),
+		"scan_delay":      c.ScanDelay.String(),
+		"scan_ttl":        c.ScanTTL.String(),
+		"default_timeout": c.DefaultTimeout.String(),
+		"queue_order":     queueOrder,
+		"dedup_scope":     dedupScope,
+		"target_queues":   c.TargetQueues,
+		"anchors":         len(c.Anchors),
+		"analyze":         c.Analyze,
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan/targets/emby"
+	"github.com/cloudbox/autoscan/triggers/sonarr"
+)
+
+func TestEffectiveSettings(t *testing.T) {
+	c := config{
+		MinimumAge: 10 * time.Minute,
+		ScanDelay:  5 * time.Second,
+		Host:       []string{"", "127.0.0.1:3031"},
+		Port:       3030,
+
+		DefaultTimeout: time.Minute,
+	}
+	c.Auth.Username = "hello there"
+	c.Auth.Password = "general kenobi"
+	c.Triggers.Sonarr = []sonarr.Config{{Name: "sonarr"}, {Name: "sonarr4k"}}
+	c.Targets.Emby = []emby.Config{{URL: "http://emby:8096", Token: "t0k3n"}}
+
+	settings := effectiveSettings(c)
+
+	want := map[string]any{
+		"targets":         map[string][]string{"emby": {"emby"}},
+		"triggers":        map[string][]string{"manual": {"manual"}, "sonarr": {"sonarr", "sonarr4k"}},
+		"servers":         []string{":3030", "127.0.0.1:3031"},
+		"webui":           []string{":4040", "127.0.0.1:4040"},
+		"authentication":  true,
+		"min_age":         "10m0s",
+		"scan_delay":      "5s",
+		"scan_ttl":        "0s",
+		"default_timeout": "1m0s",
+		"queue_order":     "fifo",
+		"dedup_scope":     "folder",
+		"target_queues":   false,
+		"anchors":         0,
+		"analyze":         false,
+	}
+
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("Settings do not match\n%+v\nvs\n%+v", settings, want)
+	}
+}
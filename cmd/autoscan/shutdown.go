@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// drainTargets sends the scans held back in memory by the targets right away.
+// The scans which could not be sent are added to the queue again,
+// restricted to their target, so they are resumed after a restart.
+func drainTargets(targets []autoscan.Target, add autoscan.ProcessorFunc) (int, int) {
+	flushed, persisted := 0, 0
+	for _, target := range targets {
+		drainer, ok := target.(autoscan.Drainer)
+		if !ok {
+			continue
+		}
+
+		sent, unsent := drainer.Drain()
+		flushed += sent
+		if len(unsent) == 0 {
+			continue
+		}
+
+		name := autoscan.TargetName(target)
+		if err := targetAdd(name, add)(unsent...); err != nil {
+			log.Error().
+				Err(err).
+				Str("target", name).
+				Int("scans", len(unsent)).
+				Msg("Failed persisting held back scans, they are lost")
+
+			continue
+		}
+
+		persisted += len(unsent)
+	}
+
+	return flushed, persisted
+}
+
+// requeueTargets lets the targets add the scans they accepted but could not send to the queue again,
+// restricted to their target.
+func requeueTargets(targets []autoscan.Target, add autoscan.ProcessorFunc) {
+	for _, target := range targets {
+		if requeuer, ok := target.(autoscan.Requeuer); ok {
+			requeuer.SetRequeue(targetAdd(autoscan.TargetName(target), add))
+		}
+	}
+}
+
+// targetAdd returns the function adding scans to the queue which are only sent to the named target.
+func targetAdd(name string, add autoscan.ProcessorFunc) autoscan.ProcessorFunc {
+	return func(scans ...autoscan.Scan) error {
+		for i := range scans {
+			scans[i].Targets = []string{name}
+		}
+
+		return add(scans...)
+	}
+}
+
+// shutdownOnSignal drains the targets and exits once autoscan is interrupted or terminated.
+// The onShutdown function is called after the targets are drained, e.g. to send the pending notifications.
+func shutdownOnSignal(targets []autoscan.Target, add autoscan.ProcessorFunc, onShutdown func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		log.Info().
+			Stringer("signal", sig).
+			Msg("Shutting down")
+
+		flushed, persisted := drainTargets(targets, add)
+		log.Info().
+			Int("flushed", flushed).
+			Int("persisted", persisted).
+			Msg("Drained deferred scans")
+
+		onShutdown()
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type drainingTarget struct {
+	name   string
+	sent   int
+	unsent []autoscan.Scan
+}
+
+func (t drainingTarget) Scan(autoscan.Scan) error { return nil }
+func (t drainingTarget) Available() error         { return nil }
+func (t drainingTarget) String() string           { return t.name }
+
+func (t drainingTarget) Drain() (int, []autoscan.Scan) {
+	return t.sent, t.unsent
+}
+
+type plainTarget struct{}
+
+func (plainTarget) Scan(autoscan.Scan) error { return nil }
+func (plainTarget) Available() error         { return nil }
+
+func TestDrainTargets(t *testing.T) {
+	targets := []autoscan.Target{
+		plainTarget{},
+		drainingTarget{name: "plex", sent: 3},
+		drainingTarget{name: "plex-4k", sent: 1, unsent: []autoscan.Scan{
+			{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", ID: "1"},
+			{Folder: "/mnt/unionfs/Media/Movies/Dune (2021)", ID: "2"},
+		}},
+	}
+
+	var added []autoscan.Scan
+	add := func(scans ...autoscan.Scan) error {
+		added = append(added, scans...)
+		return nil
+	}
+
+	flushed, persisted := drainTargets(targets, add)
+	if flushed != 4 || persisted != 2 {
+		t.Errorf("Counts do not match: %d, %d vs 4, 2", flushed, persisted)
+	}
+
+	want := []autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", ID: "1", Targets: []string{"plex-4k"}},
+		{Folder: "/mnt/unionfs/Media/Movies/Dune (2021)", ID: "2", Targets: []string{"plex-4k"}},
+	}
+
+	if !reflect.DeepEqual(added, want) {
+		t.Errorf("Persisted scans do not match\n%+v\nvs\n%+v", added, want)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// staticFiles are the favicon and the shared stylesheet of the web UI pages.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// staticCacheControl lets browsers cache the static assets, which only change with a new release.
+const staticCacheControl = "public, max-age=86400"
+
+// staticHandler serves the static assets under /static/.
+func staticHandler() http.Handler {
+	sub, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Cache-Control", staticCacheControl)
+		files.ServeHTTP(rw, r)
+	})
+}
+
+// faviconHandler serves the favicon browsers request at /favicon.ico.
+func faviconHandler(rw http.ResponseWriter, r *http.Request) {
+	b, err := staticFiles.ReadFile("static/favicon.ico")
+	if err != nil {
+		http.NotFound(rw, r)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "image/x-icon")
+	rw.Header().Set("Cache-Control", staticCacheControl)
+	_, _ = rw.Write(b)
+}
@@ -19,9 +19,12 @@ func scanStats(proc *processor.Processor, interval time.Duration) {
 			sm, err := proc.ScansRemaining()
 			switch {
 			case err == nil:
+				counts := proc.ScanCounts()
 				log.Info().
 					Int("remaining", sm).
-					Int64("processed", proc.ScansProcessed()).
+					Int64("processed", counts.Processed).
+					Int64("failed", counts.Failed).
+					Int64("expired", counts.Expired).
 					Msg("Scan stats")
 			case errors.Is(err, autoscan.ErrFatal):
 				log.Error().
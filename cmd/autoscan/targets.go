@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cloudbox/autoscan"
+	ast "github.com/cloudbox/autoscan/targets/autoscan"
+	"github.com/cloudbox/autoscan/targets/emby"
+	"github.com/cloudbox/autoscan/targets/jellyfin"
+)
+
+// targetsConfig holds the config of all targets.
+//
+// Targets which register themselves with autoscan.RegisterTarget
+// are kept undecoded until they are initialised.
+type targetsConfig struct {
+	Autoscan []ast.Config      `yaml:"autoscan"`
+	Emby     []emby.Config     `yaml:"emby"`
+	Jellyfin []jellyfin.Config `yaml:"jellyfin"`
+
+	Registered map[string][]autoscan.RawConfig `yaml:"-"`
+}
+
+func (t *targetsConfig) UnmarshalYAML(unmarshal func(any) error) error {
+	raw := make(map[string]any)
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	t.Registered = make(map[string][]autoscan.RawConfig)
+	for name, value := range raw {
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		var dst any
+		switch {
+		case name == "autoscan":
+			dst = &t.Autoscan
+		case name == "emby":
+			dst = &t.Emby
+		case name == "jellyfin":
+			dst = &t.Jellyfin
+		case autoscan.IsRegisteredTarget(name):
+			configs := make([]autoscan.RawConfig, 0)
+			if err := yaml.Unmarshal(b, &configs); err != nil {
+				return fmt.Errorf("target %s: %w", name, err)
+			}
+
+			t.Registered[name] = configs
+			continue
+		default:
+			return fmt.Errorf("unknown target: %s", name)
+		}
+
+		if err := yaml.UnmarshalStrict(b, dst); err != nil {
+			return fmt.Errorf("target %s: %w", name, err)
+		}
+	}
+
+	return t.setNames()
+}
+
+// setNames names every target without a name after its type,
+// numbered when there are several targets of the same type,
+// and validates that all names are unique.
+func (t *targetsConfig) setNames() error {
+	for i := range t.Autoscan {
+		if t.Autoscan[i].Name == "" {
+			t.Autoscan[i].Name = defaultTargetName("autoscan", i, len(t.Autoscan))
+		}
+	}
+
+	for _, kind := range t.registeredNames() {
+		configs := t.Registered[kind]
+		for i := range configs {
+			if configs[i].Name() == "" {
+				configs[i].SetName(defaultTargetName(kind, i, len(configs)))
+			}
+		}
+	}
+
+	for i := range t.Emby {
+		if t.Emby[i].Name == "" {
+			t.Emby[i].Name = defaultTargetName("emby", i, len(t.Emby))
+		}
+	}
+
+	for i := range t.Jellyfin {
+		if t.Jellyfin[i].Name == "" {
+			t.Jellyfin[i].Name = defaultTargetName("jellyfin", i, len(t.Jellyfin))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range t.names() {
+		if seen[name] {
+			return fmt.Errorf("duplicate target name: %s", name)
+		}
+
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// names returns the names of all targets.
+func (t targetsConfig) names() []string {
+	names := make([]string, 0)
+
+	for _, c := range t.Autoscan {
+		names = append(names, c.Name)
+	}
+
+	for _, kind := range t.registeredNames() {
+		for _, raw := range t.Registered[kind] {
+			names = append(names, raw.Name())
+		}
+	}
+
+	for _, c := range t.Emby {
+		names = append(names, c.Name)
+	}
+
+	for _, c := range t.Jellyfin {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// defaultTargetName returns the name of the i-th of n targets of a type,
+// e.g. plex for a single target and plex-1, plex-2 for multiple targets.
+func defaultTargetName(kind string, i int, n int) string {
+	if n == 1 {
+		return kind
+	}
+
+	return fmt.Sprintf("%s-%d", kind, i+1)
+}
+
+func (t targetsConfig) MarshalYAML() (any, error) {
+	out := yaml.MapSlice{
+		{Key: "autoscan", Value: t.Autoscan},
+		{Key: "emby", Value: t.Emby},
+		{Key: "jellyfin", Value: t.Jellyfin},
+	}
+
+	for _, name := range t.registeredNames() {
+		out = append(out, yaml.MapItem{Key: name, Value: t.Registered[name]})
+	}
+
+	return out, nil
+}
+
+// registeredNames returns the sorted names of the configured registered targets.
+func (t targetsConfig) registeredNames() []string {
+	names := make([]string, 0, len(t.Registered))
+	for name := range t.Registered {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// boundTargets returns a processor which restricts the scans of a trigger to the named targets.
+// Scans which already name their targets are left untouched.
+func boundTargets(names []string, targets []autoscan.Target, add autoscan.ProcessorFunc) (autoscan.ProcessorFunc, error) {
+	if len(names) == 0 {
+		return add, nil
+	}
+
+	for _, name := range names {
+		found := false
+		for _, target := range targets {
+			if autoscan.TargetName(target) == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown target: %s", name)
+		}
+	}
+
+	return func(scans ...autoscan.Scan) error {
+		bound := make([]autoscan.Scan, len(scans))
+		for i, scan := range scans {
+			if len(scan.Targets) == 0 {
+				scan.Targets = names
+			}
+
+			bound[i] = scan
+		}
+
+		return add(bound...)
+	}, nil
+}
+
+// initTargets initialises all targets of the config, which persist their state in the state directory.
+// Autoscan exits when a target cannot be initialised.
+func initTargets(c config, stateDir string) []autoscan.Target {
+	targets := make([]autoscan.Target, 0)
+
+	defaults := autoscan.TargetDefaults{Timeout: c.DefaultTimeout, StateDir: stateDir}
+
+	for _, t := range c.Targets.Autoscan {
+		t.DefaultTimeout = defaults.Timeout
+		tp, err := ast.New(t)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("target", t.Name).
+				Str("target_url", t.URL).
+				Msg("Failed initialising target")
+		}
+
+		targets = append(targets, tp)
+	}
+
+	for _, name := range c.Targets.registeredNames() {
+		configs := c.Targets.Registered[name]
+		for i := range configs {
+			tp, err := autoscan.NewTarget(name, configs[i].Decode, defaults)
+			if err != nil {
+				log.Fatal().
+					Err(err).
+					Str("target", configs[i].Name()).
+					Msg("Failed initialising target")
+			}
+
+			targets = append(targets, tp)
+		}
+	}
+
+	for _, t := range c.Targets.Emby {
+		t.DefaultTimeout = defaults.Timeout
+		tp, err := emby.New(t)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("target", t.Name).
+				Str("target_url", t.URL).
+				Msg("Failed initialising target")
+		}
+
+		targets = append(targets, tp)
+	}
+
+	for _, t := range c.Targets.Jellyfin {
+		t.DefaultTimeout = defaults.Timeout
+		tp, err := jellyfin.New(t)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("target", t.Name).
+				Str("target_url", t.URL).
+				Msg("Failed initialising target")
+		}
+
+		targets = append(targets, tp)
+	}
+
+	return targets
+}
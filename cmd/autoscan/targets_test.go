@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestTargetNames(t *testing.T) {
+	type Test struct {
+		Name      string
+		Config    string
+		WantNames []string
+		WantErr   bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Defaults to the type of a single target",
+			Config:    "targets:\n  plex:\n    - url: http://plex:32400\n  emby:\n    - url: http://emby:8096\n",
+			WantNames: []string{"plex", "emby"},
+		},
+		{
+			Name:      "Numbers multiple targets of a type",
+			Config:    "targets:\n  jellyfin:\n    - url: http://jellyfin1:8096\n    - url: http://jellyfin2:8096\n",
+			WantNames: []string{"jellyfin-1", "jellyfin-2"},
+		},
+		{
+			Name:      "Keeps configured names",
+			Config:    "targets:\n  plex:\n    - url: http://plex:32400\n    - name: plex-4k\n      url: http://plex4k:32400\n",
+			WantNames: []string{"plex-1", "plex-4k"},
+		},
+		{
+			Name:    "Rejects duplicate names",
+			Config:  "targets:\n  plex:\n    - name: media\n      url: http://plex:32400\n  emby:\n    - name: media\n      url: http://emby:8096\n",
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := config{}
+			err := yaml.UnmarshalStrict([]byte(tc.Config), &c)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tc.WantErr {
+				return
+			}
+
+			names := make([]string, 0)
+			for _, kind := range c.Targets.registeredNames() {
+				for _, raw := range c.Targets.Registered[kind] {
+					names = append(names, raw.Name())
+				}
+			}
+
+			for _, e := range c.Targets.Emby {
+				names = append(names, e.Name)
+			}
+
+			for _, j := range c.Targets.Jellyfin {
+				names = append(names, j.Name)
+			}
+
+			if !reflect.DeepEqual(names, tc.WantNames) {
+				t.Errorf("Names do not match: %v vs %v", names, tc.WantNames)
+			}
+		})
+	}
+}
+
+func TestBoundTargets(t *testing.T) {
+	targets := []autoscan.Target{namedLibraries{name: "plex"}, namedLibraries{name: "plex-4k"}}
+
+	type Test struct {
+		Name    string
+		Names   []string
+		Scan    autoscan.Scan
+		Want    []string
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "All targets when unbound",
+			Scan: autoscan.Scan{Folder: "/Movies/Tenet (2020)"},
+		},
+		{
+			Name:  "Bound targets",
+			Names: []string{"plex-4k"},
+			Scan:  autoscan.Scan{Folder: "/Movies/Tenet (2020)"},
+			Want:  []string{"plex-4k"},
+		},
+		{
+			Name:  "Targets of the scan are kept",
+			Names: []string{"plex-4k"},
+			Scan:  autoscan.Scan{Folder: "/Movies/Tenet (2020)", Targets: []string{"plex"}},
+			Want:  []string{"plex"},
+		},
+		{
+			Name:    "Unknown target",
+			Names:   []string{"emby"},
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var added []autoscan.Scan
+			add := func(scans ...autoscan.Scan) error {
+				added = append(added, scans...)
+				return nil
+			}
+
+			bound, err := boundTargets(tc.Names, targets, add)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tc.WantErr {
+				return
+			}
+
+			if err := bound(tc.Scan); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(added) != 1 || !reflect.DeepEqual(added[0].Targets, tc.Want) {
+				t.Errorf("Targets do not match: %v vs %v", added, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// builtinTemplates are the built-in templates of the web UI pages.
+var builtinTemplates = map[string]string{
+	"index":   indexTemplate,
+	"status":  statusTemplate,
+	"queue":   queueTemplate,
+	"history": historyTemplate,
+	"config":  configTemplate,
+	"trigger": triggerTemplate,
+	"rewrite": rewriteTemplate,
+}
+
+// loadTemplates parses the templates of the web UI pages.
+//
+// When a template directory is given, the template of a page is loaded
+// from <page>.html within the directory, e.g. status.html.
+// Pages without a template file use the built-in template.
+func loadTemplates(dir string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(builtinTemplates))
+
+	for name, builtin := range builtinTemplates {
+		source := builtin
+
+		if dir != "" {
+			file := filepath.Join(dir, name+".html")
+
+			b, err := os.ReadFile(file)
+			switch {
+			case err == nil:
+				source = string(b)
+			case !errors.Is(err, fs.ErrNotExist):
+				return nil, fmt.Errorf("reading template %s: %w", file, err)
+			}
+		}
+
+		t, err := template.New(name).Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %s: %w", name, err)
+		}
+
+		templates[name] = t
+	}
+
+	return templates, nil
+}
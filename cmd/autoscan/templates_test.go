@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "status.html"), []byte("custom {{.Version}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := loadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := templates["status"].Execute(buf, map[string]any{"Version": "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "custom 1.0" {
+		t.Errorf("Expected the status template to be loaded from disk, got: %q", buf.String())
+	}
+
+	for name := range builtinTemplates {
+		if templates[name] == nil {
+			t.Errorf("Expected the %s template to fall back to the built-in template", name)
+		}
+	}
+}
+
+func TestLoadTemplatesInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "trigger.html"), []byte("{{.Port"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadTemplates(dir); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
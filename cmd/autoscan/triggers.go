@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// arrTrigger is an instance of one of the -arr triggers.
+type arrTrigger struct {
+	kind    string
+	name    string
+	targets []string
+}
+
+// arrTriggers returns the instances of all -arr triggers.
+func (c config) arrTriggers() []arrTrigger {
+	triggers := make([]arrTrigger, 0)
+
+	for _, t := range c.Triggers.Lidarr {
+		triggers = append(triggers, arrTrigger{kind: "lidarr", name: t.Name, targets: t.Targets})
+	}
+
+	for _, t := range c.Triggers.Radarr {
+		triggers = append(triggers, arrTrigger{kind: "radarr", name: t.Name, targets: t.Targets})
+	}
+
+	for _, t := range c.Triggers.Readarr {
+		triggers = append(triggers, arrTrigger{kind: "readarr", name: t.Name, targets: t.Targets})
+	}
+
+	for _, t := range c.Triggers.Sonarr {
+		triggers = append(triggers, arrTrigger{kind: "sonarr", name: t.Name, targets: t.Targets})
+	}
+
+	return triggers
+}
+
+// checkTriggers validates that every -arr has a unique name, usable as its route,
+// and only binds to existing targets.
+func checkTriggers(c config) error {
+	// routes of the other HTTP triggers
+	seen := map[string]bool{
+		"a-train": true,
+		"manual":  true,
+	}
+
+	targets := c.Targets.names()
+
+	for _, t := range c.arrTriggers() {
+		switch {
+		case t.name == "":
+			return fmt.Errorf("%s: name is required", t.kind)
+		case strings.ContainsAny(t.name, "/{}*"):
+			return fmt.Errorf("%s %s: name must not contain any of /{}*", t.kind, t.name)
+		case seen[t.name]:
+			return fmt.Errorf("%s %s: duplicate trigger name", t.kind, t.name)
+		}
+
+		seen[t.name] = true
+
+		for _, target := range t.targets {
+			if !containsString(targets, target) {
+				return fmt.Errorf("%s %s: unknown target: %s", t.kind, t.name, target)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCheckTriggers(t *testing.T) {
+	const targets = "targets:\n  plex:\n    - url: http://plex:32400\n    - name: plex-4k\n      url: http://plex4k:32400\n"
+
+	type Test struct {
+		Name    string
+		Config  string
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Multiple instances of a trigger",
+			Config: "triggers:\n  sonarr:\n    - name: sonarr\n      targets: [plex-1]\n    - name: tv-4k\n      targets: [plex-4k]\n",
+		},
+		{
+			Name:    "Missing name",
+			Config:  "triggers:\n  sonarr:\n    - priority: 1\n",
+			WantErr: true,
+		},
+		{
+			Name:    "Duplicate names across trigger types",
+			Config:  "triggers:\n  sonarr:\n    - name: arr\n  radarr:\n    - name: arr\n",
+			WantErr: true,
+		},
+		{
+			Name:    "Name of another trigger",
+			Config:  "triggers:\n  radarr:\n    - name: manual\n",
+			WantErr: true,
+		},
+		{
+			Name:    "Name which is not a single route segment",
+			Config:  "triggers:\n  radarr:\n    - name: movies/4k\n",
+			WantErr: true,
+		},
+		{
+			Name:    "Unknown target",
+			Config:  "triggers:\n  lidarr:\n    - name: lidarr\n      targets: [emby]\n",
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := config{}
+			if err := yaml.UnmarshalStrict([]byte(targets+tc.Config), &c); err != nil {
+				t.Fatal(err)
+			}
+
+			err := checkTriggers(c)
+			if (err != nil) != tc.WantErr {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
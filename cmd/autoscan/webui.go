@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
+	"io"
 	"net"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,11 +19,16 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/cloudbox/autoscan"
 	"github.com/cloudbox/autoscan/processor"
+	"github.com/cloudbox/autoscan/triggers/schedule"
 )
 
 const webUIPort = 4040
 
+// webUIAddr returns the address the web UI listens on for the host.
+// It is determined at startup, without a request whose X-Forwarded-* headers could be honoured,
+// so it is the internal address. The address of the web UI as reached by a request is given by webUIURL.
 func webUIAddr(host string) string {
 	baseHost := host
 	if strings.Contains(host, ":") {
@@ -35,55 +44,568 @@ func webUIAddr(host string) string {
 	return fmt.Sprintf("%s:%d", baseHost, webUIPort)
 }
 
-func getWebRouter(c config, proc *processor.Processor) chi.Router {
+func getWebRouter(c config, proc *processor.Processor, targets []autoscan.Target, scheduler *schedule.Scheduler) chi.Router {
 	r := chi.NewRouter()
 
+	proxies, err := parseCIDRs(c.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing trusted proxies")
+	}
+
+	trusted, err := parseCIDRs(c.Auth.TrustedNetworks)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed parsing trusted networks")
+	}
+
+	templates, err := loadTemplates(c.WebUI.TemplateDir)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed loading web UI templates")
+	}
+
 	r.Use(middleware.Recoverer)
 	r.Use(hlog.NewHandler(log.Logger))
 	r.Use(hlog.RequestIDHandler("id", "request-id"))
 	r.Use(hlog.URLHandler("url"))
 	r.Use(hlog.MethodHandler("method"))
 
-	if c.Auth.Username != "" && c.Auth.Password != "" {
-		r.Use(middleware.BasicAuth("Autoscan UI", createCredentials(c)))
+	// viewers may use the pages and API which do not change anything, only admins may add scans
+	admin := func(next http.Handler) http.Handler { return next }
+	if authEnabled(c) {
+		r.Use(trustedNetworks(trusted, proxies, basicAuth(c, "Autoscan UI")))
+		admin = requireRole(roleAdmin)
 	}
 
-	r.Get("/", func(rw http.ResponseWriter, r *http.Request) {
-		http.Redirect(rw, r, "/status", http.StatusFound)
-	})
+	r.Get("/", rootHandler(c.WebUI.Root, proxies, templates["index"]))
+	r.Get("/favicon.ico", faviconHandler)
+	r.Handle("/static/*", staticHandler())
+
+	reporter := newStatusReporter(proc, targets, scheduler, rootsCheck{roots: c.Health.Roots})
 
-	r.Get("/status", statusHandler(proc))
-	r.Get("/config", configHandler(c))
-	r.Get("/trigger", triggerHandler(c.Port))
+	r.Get("/status", statusHandler(reporter, templates["status"]))
+	r.Get("/queue", queueHandler(proc, targets, templates["queue"]))
+	r.Get("/history", historyHandler(proc, templates["history"]))
+	r.Get("/config", configHandler(c, templates["config"]))
+	r.With(admin).Get("/trigger", triggerHandler(c.Port, proxies, templates["trigger"]))
+	r.Get("/rewrite", rewriteHandler(c, templates["rewrite"]))
+	r.Get("/metrics", metricsHandler(reporter, proc, targets))
+	r.Get("/events", eventsHandler(reporter.Counts, eventsInterval, streamDuration(c.WebUI.WriteTimeout)))
+	r.Get("/logs", logsHandler(recentLogs))
+
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/status", statusAPIHandler(reporter))
+		r.Get("/queue", queueAPIHandler(proc, targets))
+		r.Get("/history", historyAPIHandler(proc))
+		r.Get("/config", configAPIHandler(c))
+		r.Get("/targets", targetsAPIHandler(proc, targets))
+		r.Get("/rewrite", rewriteAPIHandler(c))
+		r.With(admin).Post("/scan", scanAPIHandler(proc.Add, targets, c.Triggers.Manual.AllowedLibraries))
+		r.Get("/failed", failedAPIHandler(proc))
+		r.With(admin).Post("/failed/{id}/retry", retryFailedHandler(proc))
+		r.With(admin).Delete("/failed/{id}", discardFailedHandler(proc))
+		r.With(admin).Post("/targets/{index}/test", targetTestHandler(targets))
+	})
 
 	return r
 }
 
-func statusHandler(proc *processor.Processor) http.HandlerFunc {
-	startedAt := time.Now()
+// The pages served at the root of the web UI.
+const (
+	// rootRedirect redirects to the status page.
+	rootRedirect = "redirect"
+
+	// rootLanding renders a landing page linking to the other pages.
+	rootLanding = "landing"
+)
+
+func validRoot(root string) error {
+	switch root {
+	case "", rootRedirect, rootLanding:
+		return nil
+	default:
+		return fmt.Errorf("invalid root %q: must be %s or %s", root, rootRedirect, rootLanding)
+	}
+}
+
+// rootHandler redirects to the status page, or renders the landing page.
+//
+// The redirect only sets the path of the status page, so the browser keeps the scheme and host
+// it used, and is prefixed by the X-Forwarded-Prefix of trusted proxies serving the web UI under a path.
+func rootHandler(root string, proxies []*net.IPNet, tmpl *template.Template) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		remaining, err := proc.ScansRemaining()
-		if err != nil {
-			remaining = -1
+		prefix := forwardedPrefix(r, proxies)
+
+		if root != rootLanding {
+			http.Redirect(rw, r, prefix+"/status", http.StatusFound)
+			return
+		}
+
+		data := map[string]any{
+			"title":  "Autoscan",
+			"prefix": prefix,
+		}
+
+		renderTemplate(rw, tmpl, data)
+	}
+}
+
+// forwardedPrefix returns the path under which a trusted proxy serves the web UI,
+// as given by its X-Forwarded-Prefix header, e.g. /autoscan. It is empty otherwise.
+func forwardedPrefix(r *http.Request, proxies []*net.IPNet) string {
+	if !fromTrustedProxy(r, proxies) {
+		return ""
+	}
+
+	prefix := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Prefix"), ",")[0])
+	if !strings.HasPrefix(prefix, "/") {
+		return ""
+	}
+
+	// a cleaned path never starts with //, which browsers would follow to another host
+	prefix = path.Clean(prefix)
+	if prefix == "/" {
+		return ""
+	}
+
+	return prefix
+}
+
+// uptimePrecision is the precision of the uptime shown on the status page.
+const uptimePrecision = time.Second
+
+// status is a snapshot of the processor statistics.
+// It is shared by the status page and the status API to keep both consistent.
+type status struct {
+	Remaining       int            `json:"remaining"`
+	Analyses        int            `json:"analyses"`
+	Processed       int64          `json:"processed"`
+	Failed          int64          `json:"failed"`
+	Expired         int64          `json:"expired"`
+	InFlight        int64          `json:"in_flight"`
+	QueueOrder      string         `json:"queue_order"`
+	QueueP50        time.Duration  `json:"-"`
+	QueueP95        time.Duration  `json:"-"`
+	QueueP50Seconds float64        `json:"queue_p50_seconds"`
+	QueueP95Seconds float64        `json:"queue_p95_seconds"`
+	Uptime          time.Duration  `json:"-"`
+	UptimeSeconds   float64        `json:"uptime_seconds"`
+	Version         string         `json:"version"`
+	GitCommit       string         `json:"git_commit"`
+	BuildTimestamp  string         `json:"build_timestamp"`
+	Targets         []targetState  `json:"targets"`
+	Schedules       []schedule.Run `json:"schedules"`
+	MissingRoots    []string       `json:"missing_roots"`
+}
+
+// targetState describes a target along with its most recent error
+// and the average time it took to handle a scan.
+type targetState struct {
+	Index          int           `json:"index"`
+	Name           string        `json:"name"`
+	DispatchOrder  int           `json:"dispatch_order"`
+	Queued         *int          `json:"queued,omitempty"`
+	LastError      string        `json:"last_error,omitempty"`
+	LastErrorTime  *time.Time    `json:"last_error_time,omitempty"`
+	ScanAvg        time.Duration `json:"-"`
+	ScanAvgSeconds float64       `json:"scan_avg_seconds"`
+}
+
+func getTargetStates(proc *processor.Processor, targets []autoscan.Target) []targetState {
+	// the depth of the queue of every target, when the targets have a queue of their own
+	var queued map[string]int
+	if proc.TargetQueues() {
+		var err error
+		if queued, err = proc.TargetQueued(); err != nil {
+			log.Error().Err(err).Msg("Failed retrieving target queues")
+		}
+	}
+
+	states := make([]targetState, 0, len(targets))
+	for i, target := range targets {
+		state := targetState{
+			Index:         i,
+			Name:          autoscan.TargetName(target),
+			DispatchOrder: autoscan.DispatchOrder(target),
+		}
+
+		if queued != nil {
+			n := queued[state.Name]
+			state.Queued = &n
+		}
+
+		scanAvg := proc.ScanDuration(target).Mean
+		state.ScanAvg = scanAvg.Round(time.Millisecond)
+		state.ScanAvgSeconds = scanAvg.Seconds()
+
+		if lastErr, ok := proc.LastError(target); ok {
+			state.LastError = lastErr.Error
+			state.LastErrorTime = &lastErr.Time
+		}
+
+		states = append(states, state)
+	}
+
+	return states
+}
+
+type statusReporter struct {
+	proc      *processor.Processor
+	targets   []autoscan.Target
+	scheduler *schedule.Scheduler
+	roots     rootsCheck
+	startedAt time.Time
+}
+
+func newStatusReporter(proc *processor.Processor, targets []autoscan.Target, scheduler *schedule.Scheduler, roots rootsCheck) *statusReporter {
+	return &statusReporter{
+		proc:      proc,
+		targets:   targets,
+		scheduler: scheduler,
+		roots:     roots,
+		startedAt: time.Now(),
+	}
+}
+
+func (s *statusReporter) Status() status {
+	remaining, err := s.proc.ScansRemaining()
+	if err != nil {
+		remaining = -1
+	}
+
+	analyses, err := s.proc.AnalysesRemaining()
+	if err != nil {
+		analyses = -1
+	}
+
+	latency := s.proc.QueueLatency()
+	counts := s.proc.ScanCounts()
+
+	uptime := time.Since(s.startedAt)
+	return status{
+		Remaining:       remaining,
+		Analyses:        analyses,
+		Processed:       counts.Processed,
+		Failed:          counts.Failed,
+		Expired:         counts.Expired,
+		InFlight:        s.inFlight(),
+		QueueOrder:      s.proc.QueueOrder(),
+		QueueP50:        latency.P50,
+		QueueP95:        latency.P95,
+		QueueP50Seconds: latency.P50.Seconds(),
+		QueueP95Seconds: latency.P95.Seconds(),
+		Uptime:          uptime,
+		UptimeSeconds:   uptime.Seconds(),
+		Version:         Version,
+		GitCommit:       GitCommit,
+		BuildTimestamp:  Timestamp,
+		Targets:         getTargetStates(s.proc, s.targets),
+		Schedules:       s.scheduler.Runs(),
+		MissingRoots:    s.roots.Missing(),
+	}
+}
+
+// inFlight returns the number of scans which are being handled by the targets.
+func (s *statusReporter) inFlight() int64 {
+	var inFlight int64
+	for _, target := range s.targets {
+		if counter, ok := target.(autoscan.InFlightCounter); ok {
+			inFlight += counter.ScansInFlight()
+		}
+	}
+
+	return inFlight
+}
+
+func statusHandler(reporter *statusReporter, tmpl *template.Template) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		st := reporter.Status()
+
+		if acceptsPlainText(r) {
+			rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeStatusText(rw, st)
+			return
 		}
 
 		data := map[string]any{
 			"title":          "Autoscan Status",
-			"remaining":      remaining,
-			"processed":      proc.ScansProcessed(),
-			"uptime":         time.Since(startedAt).Round(time.Second),
-			"version":        Version,
-			"gitCommit":      GitCommit,
-			"buildTimestamp": Timestamp,
+			"remaining":      st.Remaining,
+			"analyses":       st.Analyses,
+			"processed":      st.Processed,
+			"failed":         st.Failed,
+			"expired":        st.Expired,
+			"inFlight":       st.InFlight,
+			"queueOrder":     st.QueueOrder,
+			"queueP50":       st.QueueP50.Round(uptimePrecision),
+			"queueP95":       st.QueueP95.Round(uptimePrecision),
+			"uptime":         st.Uptime.Round(uptimePrecision),
+			"version":        st.Version,
+			"gitCommit":      st.GitCommit,
+			"buildTimestamp": st.BuildTimestamp,
+			"targets":        st.Targets,
+			"schedules":      st.Schedules,
+			"missingRoots":   st.MissingRoots,
+		}
+
+		renderTemplate(rw, tmpl, data)
+	}
+}
+
+// acceptsPlainText returns whether the client asks for plain text instead of HTML,
+// e.g. curl -H "Accept: text/plain". Browsers always accept HTML.
+func acceptsPlainText(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "text/html")
+}
+
+// writeStatusText writes the status as key=value lines.
+// Spaces in keys are replaced by underscores, values which contain spaces or quotes are quoted.
+func writeStatusText(w io.Writer, st status) {
+	line := func(key string, value any) {
+		key = strings.ReplaceAll(key, " ", "_")
+
+		v := fmt.Sprint(value)
+		if v == "" || strings.ContainsAny(v, " \t\"=") {
+			v = strconv.Quote(v)
+		}
+
+		fmt.Fprintf(w, "%s=%s\n", key, v)
+	}
+
+	line("remaining", st.Remaining)
+	line("analyses", st.Analyses)
+	line("processed", st.Processed)
+	line("failed", st.Failed)
+	line("expired", st.Expired)
+	line("in_flight", st.InFlight)
+	line("queue_order", st.QueueOrder)
+	line("queue_p50", st.QueueP50.Round(uptimePrecision))
+	line("queue_p95", st.QueueP95.Round(uptimePrecision))
+	line("uptime", st.Uptime.Round(uptimePrecision))
+	line("version", st.Version)
+	line("git_commit", st.GitCommit)
+	line("build_timestamp", st.BuildTimestamp)
+
+	for _, target := range st.Targets {
+		prefix := "target." + target.Name + "."
+		line(prefix+"dispatch_order", target.DispatchOrder)
+		if target.Queued != nil {
+			line(prefix+"queued", *target.Queued)
+		}
+		line(prefix+"scan_avg", target.ScanAvg)
+		if target.LastErrorTime != nil {
+			line(prefix+"last_error", target.LastError)
+			line(prefix+"last_error_time", target.LastErrorTime.Format(time.RFC3339))
+		}
+	}
+
+	for _, run := range st.Schedules {
+		if !run.Next.IsZero() {
+			line("schedule."+run.Name+".next", run.Next.Format(time.RFC3339))
+		}
+	}
+
+	for _, root := range st.MissingRoots {
+		line("missing_root", root)
+	}
+}
+
+func statusAPIHandler(reporter *statusReporter) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, reporter.Status())
+	}
+}
+
+// queue is a snapshot of the queued scans and the cooling down libraries.
+type queue struct {
+	Scans     []queuedScan     `json:"scans"`
+	Cooldowns []targetCooldown `json:"cooldowns"`
+}
+
+type queuedScan struct {
+	ID        string    `json:"id"`
+	Folder    string    `json:"folder"`
+	Reason    string    `json:"reason,omitempty"`
+	Priority  int       `json:"priority"`
+	Time      time.Time `json:"time"`
+	Deep      bool      `json:"deep"`
+	Immediate bool      `json:"immediate"`
+	Targets   []string  `json:"targets,omitempty"`
+	Libraries []string  `json:"libraries,omitempty"`
+}
+
+type targetCooldown struct {
+	Target           string        `json:"target"`
+	Library          string        `json:"library"`
+	Remaining        time.Duration `json:"-"`
+	RemainingSeconds float64       `json:"remaining_seconds"`
+	Pending          int           `json:"pending"`
+}
+
+// getQueue returns the requested page of the queued scans, along with the total number of queued scans.
+// When a library is given, only the scans and cooldowns of that library are returned.
+func getQueue(proc *processor.Processor, targets []autoscan.Target, page pagination, library string) (queue, int, error) {
+	scans, total, err := proc.QueuePage(page.Offset(), page.Limit, library)
+	if err != nil {
+		return queue{}, 0, err
+	}
+
+	q := queue{
+		Scans:     make([]queuedScan, 0, len(scans)),
+		Cooldowns: make([]targetCooldown, 0),
+	}
+
+	for _, scan := range scans {
+		q.Scans = append(q.Scans, queuedScan{
+			ID:        scan.ID,
+			Folder:    scan.Folder,
+			Reason:    scan.Reason,
+			Priority:  scan.Priority,
+			Time:      scan.Time,
+			Deep:      scan.Deep,
+			Immediate: scan.Immediate,
+			Targets:   scan.Targets,
+			Libraries: scan.Libraries,
+		})
+	}
+
+	for _, target := range targets {
+		reporter, ok := target.(autoscan.CooldownReporter)
+		if !ok {
+			continue
 		}
 
-		renderTemplate(rw, statusTemplate, data)
+		for _, cooldown := range reporter.Cooldowns() {
+			if library != "" && cooldown.Library != library {
+				continue
+			}
+
+			q.Cooldowns = append(q.Cooldowns, targetCooldown{
+				Target:           autoscan.TargetName(target),
+				Library:          cooldown.Library,
+				Remaining:        cooldown.Remaining.Round(uptimePrecision),
+				RemainingSeconds: cooldown.Remaining.Seconds(),
+				Pending:          cooldown.Pending,
+			})
+		}
 	}
+
+	return q, total, nil
 }
 
-func configHandler(c config) http.HandlerFunc {
+func queueHandler(proc *processor.Processor, targets []autoscan.Target, tmpl *template.Template) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		raw, err := yaml.Marshal(c)
+		page, err := parsePagination(r)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q, total, err := getQueue(proc, targets, page, libraryFilter(r))
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Msg("Failed retrieving queue")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		data := map[string]any{
+			"title":      "Autoscan Queue",
+			"scans":      q.Scans,
+			"cooldowns":  q.Cooldowns,
+			"library":    libraryFilter(r),
+			"pagination": page.links(r, total),
+		}
+
+		setTotalCount(rw, total)
+		renderTemplate(rw, tmpl, data)
+	}
+}
+
+func queueAPIHandler(proc *processor.Processor, targets []autoscan.Target) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		page, err := parsePagination(r)
+		if err != nil {
+			writeJSON(rw, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		q, total, err := getQueue(proc, targets, page, libraryFilter(r))
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Msg("Failed retrieving queue")
+			writeJSON(rw, http.StatusInternalServerError, errorResponse{Error: "failed retrieving queue"})
+			return
+		}
+
+		setTotalCount(rw, total)
+		writeJSON(rw, http.StatusOK, q)
+	}
+}
+
+func historyHandler(proc *processor.Processor, tmpl *template.Template) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		page, err := parsePagination(r)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		expand := expandHistory(r)
+		entries, total := historyEntries(proc, expand, page, libraryFilter(r))
+
+		data := map[string]any{
+			"title":      "Autoscan History",
+			"entries":    entries,
+			"expanded":   expand,
+			"library":    libraryFilter(r),
+			"pagination": page.links(r, total),
+		}
+
+		setTotalCount(rw, total)
+		renderTemplate(rw, tmpl, data)
+	}
+}
+
+func historyAPIHandler(proc *processor.Processor) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		page, err := parsePagination(r)
+		if err != nil {
+			writeJSON(rw, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		entries, total := historyEntries(proc, expandHistory(r), page, libraryFilter(r))
+
+		setTotalCount(rw, total)
+		writeJSON(rw, http.StatusOK, entries)
+	}
+}
+
+// expandHistory returns whether every scan of the history is requested with ?expand=true,
+// instead of collapsing consecutive scans of the same folder.
+func expandHistory(r *http.Request) bool {
+	expand, _ := strconv.ParseBool(r.URL.Query().Get("expand"))
+	return expand
+}
+
+// historyEntries returns the requested page of the history, along with the total number of entries.
+// Consecutive scans of the same folder are collapsed before the history is paginated.
+// When a library is given, only the scans routed to that library are returned.
+func historyEntries(proc *processor.Processor, expand bool, page pagination, library string) ([]processor.HistoryEntry, int) {
+	if expand {
+		return proc.HistoryPage(page.Offset(), page.Limit, library)
+	}
+
+	entries := processor.CollapseHistory(processor.FilterHistory(proc.History(), library))
+	return processor.PageHistory(entries, page.Offset(), page.Limit)
+}
+
+// libraryFilter returns the name of the library requested with ?library=,
+// empty when the scans of all libraries are requested.
+func libraryFilter(r *http.Request) string {
+	return r.URL.Query().Get("library")
+}
+
+func configHandler(c config, tmpl *template.Template) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		raw, err := redactedConfig(c)
 		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
@@ -91,28 +613,54 @@ func configHandler(c config) http.HandlerFunc {
 
 		data := map[string]any{
 			"title":       "Autoscan Config",
-			"configYaml":  redactConfig(string(raw)),
+			"configYaml":  raw,
 			"description": "Sensitive fields are redacted.",
 		}
 
-		renderTemplate(rw, configTemplate, data)
+		renderTemplate(rw, tmpl, data)
 	}
 }
 
-func triggerHandler(port int) http.HandlerFunc {
+func triggerHandler(port int, proxies []*net.IPNet, tmpl *template.Template) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		baseURL := triggerBaseURL(r, port)
+		baseURL := triggerBaseURL(r, port, proxies)
 		data := map[string]any{
 			"title":     "Autoscan Triggers",
 			"baseURL":   baseURL,
 			"manualURL": fmt.Sprintf("%s/triggers/manual", baseURL),
+			"scanURL":   fmt.Sprintf("%s/api/scan", webUIURL(r, proxies)),
 		}
 
-		renderTemplate(rw, triggerTemplate, data)
+		renderTemplate(rw, tmpl, data)
 	}
 }
 
-func triggerBaseURL(r *http.Request, port int) string {
+func triggerBaseURL(r *http.Request, port int, proxies []*net.IPNet) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	// honour the forwarded headers of trusted proxies
+	if fromTrustedProxy(r, proxies) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+
+		if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+			host := strings.TrimSpace(strings.Split(forwardedHost, ",")[0])
+			if forwardedPort := r.Header.Get("X-Forwarded-Port"); forwardedPort != "" {
+				if parsed, _, err := net.SplitHostPort(host); err == nil {
+					host = parsed
+				}
+
+				host = net.JoinHostPort(strings.Trim(host, "[]"), forwardedPort)
+			}
+
+			return fmt.Sprintf("%s://%s", scheme, host)
+		}
+	}
+
 	host := r.Host
 	if parsed, _, err := net.SplitHostPort(host); err == nil {
 		host = parsed
@@ -122,47 +670,35 @@ func triggerBaseURL(r *http.Request, port int) string {
 		host = "[" + host + "]"
 	}
 
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
-
 	return fmt.Sprintf("%s://%s:%d", scheme, host, port)
 }
 
-func redactConfig(raw string) string {
-	lines := strings.Split(raw, "\n")
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		switch {
-		case strings.HasPrefix(trimmed, "token:"):
-			lines[i] = redactLine(line, "token")
-		case strings.HasPrefix(trimmed, "password:"):
-			lines[i] = redactLine(line, "password")
-		case strings.HasPrefix(trimmed, "apiKey:"):
-			lines[i] = redactLine(line, "apiKey")
-		}
-	}
-
-	return strings.Join(lines, "\n")
+// webUIURL returns the URL of the web UI as reached by the request,
+// honouring the X-Forwarded-* headers of trusted proxies like the trigger base URL does,
+// including the X-Forwarded-Prefix under which the proxy serves the web UI.
+func webUIURL(r *http.Request, proxies []*net.IPNet) string {
+	return triggerBaseURL(r, webUIPort, proxies) + forwardedPrefix(r, proxies)
 }
 
-func redactLine(line string, key string) string {
-	indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
-	return fmt.Sprintf("%s%s: \"REDACTED\"", indent, key)
+// redactedConfig returns the config as YAML, with secret fields redacted in the redact mode of the web UI.
+func redactedConfig(c config) (string, error) {
+	raw, err := yaml.Marshal(autoscan.RedactWith(c, c.WebUI.RedactMode))
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
 }
 
-func renderTemplate(rw http.ResponseWriter, tmpl string, data map[string]any) {
-	t, err := template.New("page").Parse(tmpl)
-	if err != nil {
+func renderTemplate(rw http.ResponseWriter, tmpl *template.Template, data map[string]any) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := t.Execute(rw, data); err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-	}
+	_, _ = buf.WriteTo(rw)
 }
 
 const statusTemplate = `<!doctype html>
@@ -170,50 +706,239 @@ const statusTemplate = `<!doctype html>
   <head>
     <meta charset="utf-8">
     <title>{{.title}}</title>
-    <style>
-      body { font-family: sans-serif; margin: 2rem; color: #222; }
-      nav a { margin-right: 1rem; }
-      .card { padding: 1rem; border: 1px solid #ddd; border-radius: 6px; max-width: 520px; }
-      .grid { display: grid; grid-template-columns: 180px 1fr; gap: 0.5rem; }
-      code { background: #f3f3f3; padding: 0.1rem 0.3rem; border-radius: 4px; }
-    </style>
+    <link rel="stylesheet" href="/static/style.css">
   </head>
   <body>
     <nav>
       <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
       <a href="/config">Config</a>
       <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
     </nav>
     <h1>{{.title}}</h1>
+    {{if .missingRoots}}
+    <div class="error">
+      <p>The following roots are inaccessible, check the mounts of your media:</p>
+      <ul>
+        {{range .missingRoots}}<li><code>{{.}}</code></li>{{end}}
+      </ul>
+    </div>
+    {{end}}
     <div class="card">
       <div class="grid">
-        <div>Scans remaining</div><div>{{.remaining}}</div>
-        <div>Scans processed</div><div>{{.processed}}</div>
+        <div>Scans remaining</div><div id="remaining">{{.remaining}}</div>
+        <div>Scans processed</div><div id="processed">{{.processed}}</div>
+        <div>Scans failed</div><div id="failed">{{.failed}}</div>
+        <div>Scans expired</div><div id="expired">{{.expired}}</div>
+        <div>Scans in flight</div><div id="in_flight">{{.inFlight}}</div>
+        <div>Queue order</div><div>{{.queueOrder}}</div>
+        <div>Queue time (p50)</div><div>{{.queueP50}}</div>
+        <div>Queue time (p95)</div><div>{{.queueP95}}</div>
+        <div>Analyses remaining</div><div>{{.analyses}}</div>
         <div>Uptime</div><div>{{.uptime}}</div>
         <div>Version</div><div><code>{{.version}}</code></div>
         <div>Commit</div><div><code>{{.gitCommit}}</code></div>
         <div>Build time</div><div><code>{{.buildTimestamp}}</code></div>
       </div>
     </div>
+    <h2>Targets</h2>
+    <table>
+      <tr><th>Target</th><th>Dispatch order</th><th>Queued</th><th>Avg scan time</th><th>Last error</th><th>Since</th></tr>
+      {{range .targets}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td>{{if .DispatchOrder}}{{.DispatchOrder}}{{else}}parallel{{end}}</td>
+        <td>{{with .Queued}}{{.}}{{else}}-{{end}}</td>
+        <td>{{.ScanAvg}}</td>
+        {{if .LastErrorTime}}
+        <td class="error">{{.LastError}}</td><td>{{.LastErrorTime.Format "2006-01-02 15:04:05"}}</td>
+        {{else}}
+        <td>-</td><td>-</td>
+        {{end}}
+      </tr>
+      {{end}}
+    </table>
+    {{if .schedules}}
+    <h2>Schedules</h2>
+    <table>
+      <tr><th>Schedule</th><th>Cron</th><th>Next run</th></tr>
+      {{range .schedules}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td><code>{{.Cron}}</code></td>
+        <td>{{if .Next.IsZero}}-{{else}}{{.Next.Format "2006-01-02 15:04:05"}}{{end}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{end}}
+    <script>
+      // update the scan counts as they change
+      const events = new EventSource("/events");
+      events.onmessage = (event) => {
+        const counts = JSON.parse(event.data);
+        for (const [key, value] of Object.entries(counts)) {
+          const el = document.getElementById(key);
+          if (el) {
+            el.textContent = value;
+          }
+        }
+      };
+    </script>
   </body>
 </html>`
 
-const configTemplate = `<!doctype html>
+const queueTemplate = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>{{.title}}</title>
+    <link rel="stylesheet" href="/static/style.css">
+  </head>
+  <body>
+    <nav>
+      <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
+      <a href="/config">Config</a>
+      <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
+    </nav>
+    <h1>{{.title}}</h1>
+    {{if .library}}<p>Showing the scans of library <strong>{{.library}}</strong>. <a href="?">Show all libraries</a></p>{{end}}
+    {{if .scans}}
+    <table>
+      <tr><th>Time</th><th>ID</th><th>Folder</th><th>Reason</th><th>Priority</th><th>Deep</th><th>Immediate</th><th>Targets</th><th>Libraries</th></tr>
+      {{range .scans}}
+      <tr>
+        <td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+        <td><code>{{.ID}}</code></td>
+        <td>{{.Folder}}</td>
+        <td>{{.Reason}}</td>
+        <td>{{.Priority}}</td>
+        <td>{{.Deep}}</td>
+        <td>{{.Immediate}}</td>
+        <td>{{range $i, $target := .Targets}}{{if $i}}, {{end}}{{$target}}{{else}}all{{end}}</td>
+        <td>{{range $i, $library := .Libraries}}{{if $i}}, {{end}}<a href="?library={{$library}}">{{$library}}</a>{{else}}-{{end}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{with .pagination}}{{if gt .pages 1}}
+    <p>
+      {{if .prev}}<a href="{{.prev}}">Previous</a>{{end}}
+      Page {{.page}} of {{.pages}} ({{.total}} in total)
+      {{if .next}}<a href="{{.next}}">Next</a>{{end}}
+    </p>
+    {{end}}{{end}}
+    {{else}}
+    <p>No scans are queued.</p>
+    {{end}}
+    {{if .cooldowns}}
+    <h2>Cooling down libraries</h2>
+    <table>
+      <tr><th>Target</th><th>Library</th><th>Remaining</th><th>Held back scans</th></tr>
+      {{range .cooldowns}}
+      <tr>
+        <td>{{.Target}}</td>
+        <td>{{.Library}}</td>
+        <td>{{.Remaining}}</td>
+        <td>{{.Pending}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{end}}
+  </body>
+</html>`
+
+const historyTemplate = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>{{.title}}</title>
+    <link rel="stylesheet" href="/static/style.css">
+  </head>
+  <body>
+    <nav>
+      <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
+      <a href="/config">Config</a>
+      <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
+    </nav>
+    <h1>{{.title}}</h1>
+    {{if .library}}<p>Showing the scans of library <strong>{{.library}}</strong>. <a href="?">Show all libraries</a></p>{{end}}
+    {{if .entries}}
+    <p>{{if .expanded}}<a href="?{{with .library}}library={{.}}{{end}}">Collapse repeated scans</a>{{else}}<a href="?expand=true{{with .library}}&library={{.}}{{end}}">Show every scan</a>{{end}}</p>
+    <table>
+      <tr><th>Time</th><th>ID</th><th>Folder</th><th>Targets</th><th>Reason</th><th>Files</th><th>Libraries</th><th>Status</th><th>Duration</th><th>Error</th></tr>
+      {{range .entries}}
+      <tr>
+        <td>{{if .First}}{{.First.Format "2006-01-02 15:04:05"}} to {{end}}{{.Time.Format "2006-01-02 15:04:05"}}</td>
+        <td><code>{{.ID}}</code></td>
+        <td>{{.Folder}}</td>
+        <td>{{with .Target}}{{.}}{{else}}All{{end}}</td>
+        <td>{{.Reason}}</td>
+        <td>{{if .Files}}{{.Files}}{{else}}-{{end}}</td>
+        <td>{{range $i, $library := .Libraries}}{{if $i}}, {{end}}<a href="?library={{$library}}">{{$library}}</a>{{else}}-{{end}}</td>
+        <td>{{.StatusText}}{{if .Count}} ({{.Count}} scans){{end}}</td>
+        <td>{{.Duration}}</td>
+        <td>{{.Error}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{with .pagination}}{{if gt .pages 1}}
+    <p>
+      {{if .prev}}<a href="{{.prev}}">Previous</a>{{end}}
+      Page {{.page}} of {{.pages}} ({{.total}} in total)
+      {{if .next}}<a href="{{.next}}">Next</a>{{end}}
+    </p>
+    {{end}}{{end}}
+    {{else}}
+    <p>No scans have been processed yet.</p>
+    {{end}}
+  </body>
+</html>`
+
+const indexTemplate = `<!doctype html>
 <html lang="en">
   <head>
     <meta charset="utf-8">
     <title>{{.title}}</title>
+    <link rel="stylesheet" href="{{.prefix}}/static/style.css">
     <style>
-      body { font-family: sans-serif; margin: 2rem; color: #222; }
-      nav a { margin-right: 1rem; }
-      pre { background: #f7f7f7; padding: 1rem; border-radius: 6px; overflow-x: auto; }
+      li { margin: 0.3rem 0; }
     </style>
   </head>
+  <body>
+    <h1>{{.title}}</h1>
+    <ul>
+      <li><a href="{{.prefix}}/status">Status</a></li>
+      <li><a href="{{.prefix}}/queue">Queue</a></li>
+      <li><a href="{{.prefix}}/history">History</a></li>
+      <li><a href="{{.prefix}}/config">Config</a></li>
+      <li><a href="{{.prefix}}/trigger">Trigger</a></li>
+      <li><a href="{{.prefix}}/rewrite">Rewrite</a></li>
+    </ul>
+  </body>
+</html>`
+
+const configTemplate = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>{{.title}}</title>
+    <link rel="stylesheet" href="/static/style.css">
+  </head>
   <body>
     <nav>
       <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
       <a href="/config">Config</a>
       <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
     </nav>
     <h1>{{.title}}</h1>
     <p>{{.description}}</p>
@@ -226,24 +951,21 @@ const triggerTemplate = `<!doctype html>
   <head>
     <meta charset="utf-8">
     <title>{{.title}}</title>
-    <style>
-      body { font-family: sans-serif; margin: 2rem; color: #222; }
-      nav a { margin-right: 1rem; }
-      code { background: #f3f3f3; padding: 0.1rem 0.3rem; border-radius: 4px; }
-      label { display: block; margin-bottom: 0.5rem; }
-      input[type="text"] { width: 100%; max-width: 480px; padding: 0.5rem; }
-      button { margin-top: 0.75rem; padding: 0.5rem 1rem; }
-    </style>
+    <link rel="stylesheet" href="/static/style.css">
   </head>
   <body>
     <nav>
       <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
       <a href="/config">Config</a>
       <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
     </nav>
     <h1>{{.title}}</h1>
     <p>Trigger base URL: <code>{{.baseURL}}</code></p>
     <p>Manual trigger endpoint: <code>{{.manualURL}}</code></p>
+    <p>Scan API endpoint: <code>{{.scanURL}}</code></p>
     <form method="post" action="{{.manualURL}}">
       <label>
         Directory to scan
@@ -254,3 +976,54 @@ const triggerTemplate = `<!doctype html>
     <p>You can add multiple <code>dir</code> query parameters by editing the URL manually.</p>
   </body>
 </html>`
+
+const rewriteTemplate = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>{{.title}}</title>
+    <link rel="stylesheet" href="/static/style.css">
+    <style>
+      table { margin-bottom: 1.5rem; }
+    </style>
+  </head>
+  <body>
+    <nav>
+      <a href="/status">Status</a>
+      <a href="/queue">Queue</a>
+      <a href="/history">History</a>
+      <a href="/config">Config</a>
+      <a href="/trigger">Trigger</a>
+      <a href="/rewrite">Rewrite</a>
+    </nav>
+    <h1>{{.title}}</h1>
+    <form method="get" action="/rewrite">
+      <label>
+        Path to rewrite
+        <input type="text" name="path" value="{{.path}}" placeholder="/path/to/media">
+      </label>
+      <button type="submit">Test rewrite rules</button>
+    </form>
+    {{if .path}}
+    {{range .traces}}
+    <h2>{{.Kind}} {{.Name}}</h2>
+    <table>
+      <tr><th>Rule</th><th>From</th><th>To</th><th>Matched</th><th>Result</th></tr>
+      {{range .Steps}}
+      <tr>
+        <td>{{.Index}}</td>
+        <td><code>{{.From}}</code></td>
+        <td><code>{{.To}}</code></td>
+        <td>{{if .Matched}}yes{{else}}no{{end}}</td>
+        <td>{{.Result}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{if .Error}}<p>Error: {{.Error}}</p>{{end}}
+    <p>Result: <code>{{.Result}}</code></p>
+    {{else}}
+    <p>No rewrite rules are configured.</p>
+    {{end}}
+    {{end}}
+  </body>
+</html>`
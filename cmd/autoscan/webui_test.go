@@ -0,0 +1,420 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan/triggers/schedule"
+)
+
+func TestTriggerBaseURL(t *testing.T) {
+	type Test struct {
+		Name       string
+		RemoteAddr string
+		Host       string
+		Headers    map[string]string
+		Expected   string
+	}
+
+	proxies, err := parseCIDRs([]string{"10.0.0.0/8", "172.19.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Uses request host without forwarded headers",
+			RemoteAddr: "192.168.1.5:51234",
+			Host:       "192.168.1.2:4040",
+			Expected:   "http://192.168.1.2:3030",
+		},
+		{
+			Name:       "Ignores forwarded headers from untrusted clients",
+			RemoteAddr: "192.168.1.5:51234",
+			Host:       "192.168.1.2:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "evil.tld",
+			},
+			Expected: "http://192.168.1.2:3030",
+		},
+		{
+			Name:       "Honours forwarded headers from trusted proxies",
+			RemoteAddr: "172.19.0.2:51234",
+			Host:       "autoscan:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "autoscan.domain.tld",
+			},
+			Expected: "https://autoscan.domain.tld",
+		},
+		{
+			Name:       "Honours forwarded port from trusted proxies",
+			RemoteAddr: "10.1.2.3:51234",
+			Host:       "autoscan:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "autoscan.domain.tld:443",
+				"X-Forwarded-Port":  "8443",
+			},
+			Expected: "https://autoscan.domain.tld:8443",
+		},
+		{
+			Name:       "Ignores invalid forwarded proto",
+			RemoteAddr: "10.1.2.3:51234",
+			Host:       "autoscan:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto": "javascript",
+				"X-Forwarded-Host":  "autoscan.domain.tld",
+			},
+			Expected: "http://autoscan.domain.tld",
+		},
+		{
+			Name:       "Brackets IPv6 hosts",
+			RemoteAddr: "[::1]:51234",
+			Host:       "[::1]:4040",
+			Expected:   "http://[::1]:3030",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/trigger", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			req.Host = tc.Host
+			for k, v := range tc.Headers {
+				req.Header.Set(k, v)
+			}
+
+			got := triggerBaseURL(req, 3030, proxies)
+			if got != tc.Expected {
+				t.Errorf("Base URLs do not match: %s vs %s", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestWebUIURL(t *testing.T) {
+	type Test struct {
+		Name       string
+		RemoteAddr string
+		Host       string
+		Headers    map[string]string
+		Expected   string
+	}
+
+	proxies, err := parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:       "Uses request host without forwarded headers",
+			RemoteAddr: "10.1.2.3:51234",
+			Host:       "autoscan:4040",
+			Expected:   "http://autoscan:4040",
+		},
+		{
+			Name:       "Uses forwarded headers from trusted proxy",
+			RemoteAddr: "10.1.2.3:51234",
+			Host:       "autoscan:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Host":   "domain.tld",
+				"X-Forwarded-Prefix": "/autoscan",
+			},
+			Expected: "https://domain.tld/autoscan",
+		},
+		{
+			Name:       "Ignores forwarded headers from untrusted client",
+			RemoteAddr: "192.168.1.5:51234",
+			Host:       "autoscan:4040",
+			Headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Host":   "domain.tld",
+				"X-Forwarded-Prefix": "/autoscan",
+			},
+			Expected: "http://autoscan:4040",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/trigger", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			req.Host = tc.Host
+			for k, v := range tc.Headers {
+				req.Header.Set(k, v)
+			}
+
+			got := webUIURL(req, proxies)
+			if got != tc.Expected {
+				t.Errorf("Web UI URLs do not match: %s vs %s", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	type Test struct {
+		Name          string
+		RemoteAddr    string
+		XForwardedFor string
+		Expected      string
+	}
+
+	proxies, err := parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:          "Ignores X-Forwarded-For from untrusted clients",
+			RemoteAddr:    "192.168.1.5:51234",
+			XForwardedFor: "1.2.3.4",
+			Expected:      "192.168.1.5",
+		},
+		{
+			Name:          "Honours X-Forwarded-For from trusted proxies",
+			RemoteAddr:    "10.0.0.2:51234",
+			XForwardedFor: "1.2.3.4",
+			Expected:      "1.2.3.4",
+		},
+		{
+			Name:          "Skips trusted proxies in the chain",
+			RemoteAddr:    "10.0.0.2:51234",
+			XForwardedFor: "6.6.6.6, 1.2.3.4, 10.0.0.3",
+			Expected:      "1.2.3.4",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/triggers/manual", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			req.Header.Set("X-Forwarded-For", tc.XForwardedFor)
+
+			got := clientIP(req, proxies).String()
+			if got != tc.Expected {
+				t.Errorf("Client IPs do not match: %s vs %s", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestWriteStatusText(t *testing.T) {
+	errTime := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+	st := status{
+		Remaining:  3,
+		Processed:  10,
+		QueueOrder: "fifo",
+		QueueP50:   90 * time.Second,
+		Uptime:     time.Hour,
+		Version:    "1.4.0",
+		Targets: []targetState{
+			{Name: "plex", DispatchOrder: 1, ScanAvg: 250 * time.Millisecond},
+			{Name: "emby", LastError: "target unavailable: connection refused", LastErrorTime: &errTime},
+		},
+		Schedules: []schedule.Run{
+			{Name: "0 3 * * *", Next: time.Date(2021, 3, 15, 3, 0, 0, 0, time.UTC)},
+		},
+		MissingRoots: []string{"/mnt/unionfs/Media/TV"},
+	}
+
+	var b strings.Builder
+	writeStatusText(&b, st)
+
+	want := `remaining=3
+analyses=0
+processed=10
+failed=0
+expired=0
+in_flight=0
+queue_order=fifo
+queue_p50=1m30s
+queue_p95=0s
+uptime=1h0m0s
+version=1.4.0
+git_commit=""
+build_timestamp=""
+target.plex.dispatch_order=1
+target.plex.scan_avg=250ms
+target.emby.dispatch_order=0
+target.emby.scan_avg=0s
+target.emby.last_error="target unavailable: connection refused"
+target.emby.last_error_time=2021-03-14T15:09:26Z
+schedule.0_3_*_*_*.next=2021-03-15T03:00:00Z
+missing_root=/mnt/unionfs/Media/TV
+`
+
+	if b.String() != want {
+		t.Errorf("Status texts do not match:\n%s\nvs\n%s", b.String(), want)
+	}
+}
+
+func TestAcceptsPlainText(t *testing.T) {
+	type Test struct {
+		Accept   string
+		Expected bool
+	}
+
+	var testCases = []Test{
+		{"text/plain", true},
+		{"*/*", false},
+		{"text/html,application/xhtml+xml,text/plain;q=0.8,*/*;q=0.5", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Accept, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/status", nil)
+			r.Header.Set("Accept", tc.Accept)
+
+			if got := acceptsPlainText(r); got != tc.Expected {
+				t.Errorf("Plain text acceptance does not match: %v vs %v", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestRootHandler(t *testing.T) {
+	type Test struct {
+		Name         string
+		Root         string
+		RemoteAddr   string
+		Prefix       string
+		WantStatus   int
+		WantLocation string
+		WantBody     string
+	}
+
+	proxies, err := parseCIDRs([]string{"172.19.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:         "Redirect",
+			RemoteAddr:   "192.168.1.5:51234",
+			WantStatus:   http.StatusFound,
+			WantLocation: "/status",
+		},
+		{
+			Name:         "Redirect under the prefix of a trusted proxy",
+			Root:         "redirect",
+			RemoteAddr:   "172.19.0.2:51234",
+			Prefix:       "/autoscan/",
+			WantStatus:   http.StatusFound,
+			WantLocation: "/autoscan/status",
+		},
+		{
+			Name:         "Ignores the prefix of untrusted clients",
+			RemoteAddr:   "192.168.1.5:51234",
+			Prefix:       "/autoscan",
+			WantStatus:   http.StatusFound,
+			WantLocation: "/status",
+		},
+		{
+			Name:         "Cleans a prefix pointing to another host",
+			RemoteAddr:   "172.19.0.2:51234",
+			Prefix:       "//evil.tld",
+			WantStatus:   http.StatusFound,
+			WantLocation: "/evil.tld/status",
+		},
+		{
+			Name:       "Landing page",
+			Root:       "landing",
+			RemoteAddr: "172.19.0.2:51234",
+			Prefix:     "/autoscan",
+			WantStatus: http.StatusOK,
+			WantBody:   `<a href="/autoscan/status">Status</a>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			if tc.Prefix != "" {
+				req.Header.Set("X-Forwarded-Prefix", tc.Prefix)
+			}
+
+			rec := httptest.NewRecorder()
+			rootHandler(tc.Root, proxies, templates["index"])(rec, req)
+
+			if rec.Code != tc.WantStatus {
+				t.Fatalf("Status codes do not match: %d vs %d", rec.Code, tc.WantStatus)
+			}
+
+			if location := rec.Header().Get("Location"); location != tc.WantLocation {
+				t.Errorf("Locations do not match: %s vs %s", location, tc.WantLocation)
+			}
+
+			if !strings.Contains(rec.Body.String(), tc.WantBody) {
+				t.Errorf("Expected the body to contain %s, got: %s", tc.WantBody, rec.Body)
+			}
+		})
+	}
+
+	if err := validRoot("index"); err == nil {
+		t.Error("Expected an error for an unknown root")
+	}
+}
+
+func TestStaticAssets(t *testing.T) {
+	type Test struct {
+		Name        string
+		Path        string
+		StatusCode  int
+		ContentType string
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "Favicon",
+			Path:        "/favicon.ico",
+			StatusCode:  http.StatusOK,
+			ContentType: "image/x-icon",
+		},
+		{
+			Name:        "Stylesheet",
+			Path:        "/static/style.css",
+			StatusCode:  http.StatusOK,
+			ContentType: "text/css; charset=utf-8",
+		},
+		{
+			Name:       "Unknown asset",
+			Path:       "/static/missing.js",
+			StatusCode: http.StatusNotFound,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/favicon.ico", faviconHandler)
+	mux.Handle("/static/", staticHandler())
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", tc.Path, nil))
+
+			if rec.Code != tc.StatusCode {
+				t.Errorf("Status codes do not match: %d vs %d", rec.Code, tc.StatusCode)
+			}
+
+			if tc.ContentType != "" && rec.Header().Get("Content-Type") != tc.ContentType {
+				t.Errorf("Content types do not match: %s vs %s", rec.Header().Get("Content-Type"), tc.ContentType)
+			}
+		})
+	}
+}
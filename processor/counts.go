@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"sync"
+)
+
+// ScanCounts are the numbers of scans which were processed, failed and expired.
+type ScanCounts struct {
+	Processed int64
+	Failed    int64
+	Expired   int64
+}
+
+// scanCounters counts the outcome of the scans.
+// The counts are guarded by a mutex instead of being separate atomic counters,
+// so the counts read together are always a consistent snapshot.
+type scanCounters struct {
+	mu     sync.Mutex
+	counts ScanCounts
+}
+
+// add adds the delta to the counts.
+func (c *scanCounters) add(delta ScanCounts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts.Processed += delta.Processed
+	c.counts.Failed += delta.Failed
+	c.counts.Expired += delta.Expired
+}
+
+func (c *scanCounters) snapshot() ScanCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts
+}
+
+// ScanCounts returns the numbers of scans which were processed, failed and expired, read at once.
+func (p *Processor) ScanCounts() ScanCounts {
+	return p.counts.snapshot()
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestScanCounters counts concurrently, run with -race to detect data races.
+func TestScanCounters(t *testing.T) {
+	const writers = 8
+	const increments = 1000
+
+	p := &Processor{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				p.counts.add(ScanCounts{Processed: 1})
+				p.counts.add(ScanCounts{Failed: 1, Expired: 1})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	readErrs := make(chan string, 1)
+	go func() {
+		defer close(readErrs)
+
+		var last ScanCounts
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			counts := p.ScanCounts()
+			switch {
+			case counts.Failed != counts.Expired:
+				readErrs <- "failed and expired scans are counted together, but were read apart"
+				return
+			case counts.Processed < last.Processed || counts.Failed < last.Failed:
+				readErrs <- "counts decreased"
+				return
+			}
+
+			last = counts
+			_ = p.ScansProcessed()
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+
+	for err := range readErrs {
+		t.Error(err)
+	}
+
+	want := ScanCounts{Processed: writers * increments, Failed: writers * increments, Expired: writers * increments}
+	if counts := p.ScanCounts(); counts != want {
+		t.Errorf("Counts do not match: %+v vs %+v", counts, want)
+	}
+}
@@ -3,8 +3,12 @@ package processor
 import (
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudbox/autoscan"
@@ -16,6 +20,27 @@ import (
 
 type datastore struct {
 	*sql.DB
+
+	// dedupKey derives the deduplication key of a folder,
+	// scans with the same key are merged into a single scan.
+	dedupKey autoscan.Rewriter
+
+	// matchersMu guards matchers, which are set once the targets are initialised.
+	matchersMu sync.RWMutex
+
+	// matchers derive the deduplication key of a folder from its libraries by target name,
+	// when scans are deduplicated by library. Targets which cannot match libraries are nil,
+	// the scans sent to such a target are not merged by library.
+	matchers map[string]autoscan.LibraryMatcher
+
+	// namersMu guards namers, which are set once the targets are initialised.
+	namersMu sync.RWMutex
+
+	// namers resolve the names of the libraries a scan is routed to, by target name.
+	namers map[string]autoscan.LibraryNamer
+
+	// lifo dispatches the most recent scans first.
+	lifo bool
 }
 
 var (
@@ -29,22 +54,194 @@ func newDatastore(db *sql.DB, mg *migrate.Migrator) (*datastore, error) {
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 
-	return &datastore{db}, nil
+	return &datastore{DB: db}, nil
+}
+
+// key returns the deduplication key of the scan, and whether the key is the key of its libraries.
+// Folders which belong to none of the libraries of the matchers are keyed by the folder.
+func (store *datastore) key(scan autoscan.Scan) (string, bool) {
+	if libraries := store.libraryKeys(scan); len(libraries) > 0 {
+		return "library:" + strings.Join(libraries, ","), true
+	}
+
+	if store.dedupKey == nil {
+		return scan.Folder, false
+	}
+
+	return store.dedupKey(scan.Folder), false
+}
+
+// libraryKeys returns the keys of the libraries the folder of the scan belongs to.
+// A merged scan becomes a deep scan of the library, which only library matchers scan in full,
+// so no keys are returned when the scan is sent to any target which cannot match libraries.
+func (store *datastore) libraryKeys(scan autoscan.Scan) []string {
+	store.matchersMu.RLock()
+	defer store.matchersMu.RUnlock()
+
+	targets := append([]string{}, scan.Targets...)
+	if len(targets) == 0 {
+		for name := range store.matchers {
+			targets = append(targets, name)
+		}
+	}
+
+	sort.Strings(targets)
+	keys := make([]string, 0)
+	for _, name := range targets {
+		m := store.matchers[name]
+		if m == nil {
+			return nil
+		}
+
+		if key, ok := m.MatchLibrary(scan.Folder); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (store *datastore) setMatchers(matchers map[string]autoscan.LibraryMatcher) {
+	store.matchersMu.Lock()
+	defer store.matchersMu.Unlock()
+
+	store.matchers = matchers
+}
+
+func (store *datastore) setNamers(namers map[string]autoscan.LibraryNamer) {
+	store.namersMu.Lock()
+	defer store.namersMu.Unlock()
+
+	store.namers = namers
+}
+
+// libraryNames returns the names of the libraries of the targets the scan is sent to,
+// which the folder of the scan belongs to.
+func (store *datastore) libraryNames(scan autoscan.Scan) []string {
+	store.namersMu.RLock()
+	defer store.namersMu.RUnlock()
+
+	names := make([]string, 0)
+	for target, namer := range store.namers {
+		if len(scan.Targets) > 0 && !containsString(scan.Targets, target) {
+			continue
+		}
+
+		for _, name := range namer.LibraryNames(scan.Folder) {
+			if !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
 }
 
+const sqlGetFolderByKey = `
+SELECT folder, targets FROM scan
+WHERE key = ?
+LIMIT 1
+`
+
 const sqlUpsert = `
-INSERT INTO scan (folder, priority, time)
-VALUES (?, ?, ?)
+INSERT INTO scan (folder, priority, time, deep, immediate, deleted, id, key, enqueued, targets, reason, source, media_type, files, libraries)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT (folder) DO UPDATE SET
 	priority = MAX(excluded.priority, scan.priority),
-	time = excluded.time
+	time = excluded.time,
+	deep = MAX(excluded.deep, scan.deep),
+	immediate = MAX(excluded.immediate, scan.immediate),
+	deleted = MAX(excluded.deleted, scan.deleted),
+	targets = excluded.targets,
+	reason = CASE WHEN excluded.reason = '' THEN scan.reason ELSE excluded.reason END,
+	source = CASE WHEN excluded.source = '' THEN scan.source ELSE excluded.source END,
+	media_type = CASE WHEN excluded.media_type = '' THEN scan.media_type ELSE excluded.media_type END,
+	files = scan.files + excluded.files,
+	libraries = excluded.libraries
 `
 
 func (store *datastore) upsert(tx *sql.Tx, scan autoscan.Scan) error {
-	_, err := tx.Exec(sqlUpsert, scan.Folder, scan.Priority, scan.Time)
+	// merge the scan into a queued scan with the same key
+	key, byLibrary := store.key(scan)
+	folder := scan.Folder
+	var queuedTargets string
+	err := tx.QueryRow(sqlGetFolderByKey, key).Scan(&scan.Folder, &queuedTargets)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	default:
+		scan.Targets = mergeTargets(decodeNames(queuedTargets), scan.Targets)
+
+		// scans of different folders within a library are merged into a scan of the entire library
+		if byLibrary && folder != scan.Folder {
+			scan.Deep = true
+		}
+	}
+
+	libraries := encodeNames(store.libraryNames(scan))
+	_, err = tx.Exec(sqlUpsert, scan.Folder, scan.Priority, scan.Time, scan.Deep, scan.Immediate, scan.Deleted, scan.ID, key, now(), encodeNames(scan.Targets), scan.Reason, scan.Source, scan.MediaType, scan.Files, libraries)
 	return err
 }
 
+// mergeTargets returns the targets of two merged scans.
+// A scan without targets is sent to all targets, and so is the merged scan.
+func mergeTargets(a []string, b []string) []string {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+
+	merged := append([]string{}, a...)
+	for _, target := range b {
+		if !containsString(merged, target) {
+			merged = append(merged, target)
+		}
+	}
+
+	return merged
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeNames encodes the names of targets or libraries as a JSON array,
+// an empty string without names, e.g. when the scan is sent to all targets.
+func encodeNames(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(names)
+	return string(b)
+}
+
+// encodeLibrary encodes the name of a library as it appears in the encoded libraries of a scan.
+func encodeLibrary(name string) string {
+	b, _ := json.Marshal(name)
+	return string(b)
+}
+
+func decodeNames(encoded string) []string {
+	if encoded == "" {
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(encoded), &names); err != nil || len(names) == 0 {
+		return nil
+	}
+
+	return names
+}
+
 func (store *datastore) Upsert(scans []autoscan.Scan) error {
 	tx, err := store.Begin()
 	if err != nil {
@@ -64,7 +261,53 @@ func (store *datastore) Upsert(scans []autoscan.Scan) error {
 	return tx.Commit()
 }
 
-const sqlGetScansRemaining = `SELECT COUNT(folder) FROM scan`
+const sqlGetEnqueued = `
+SELECT enqueued FROM scan
+WHERE folder = ?
+`
+
+// GetEnqueued returns the time the scan was first added to the queue.
+func (store *datastore) GetEnqueued(scan autoscan.Scan) (time.Time, error) {
+	var enqueued time.Time
+	err := store.QueryRow(sqlGetEnqueued, scan.Folder).Scan(&enqueued)
+	if err != nil {
+		return enqueued, fmt.Errorf("get enqueued: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return enqueued, nil
+}
+
+const sqlGetRetries = `
+SELECT retries FROM scan
+WHERE folder = ?
+`
+
+// GetRetries returns the number of times the scan has been retried.
+func (store *datastore) GetRetries(scan autoscan.Scan) (int, error) {
+	var retries int
+	err := store.QueryRow(sqlGetRetries, scan.Folder).Scan(&retries)
+	if err != nil {
+		return retries, fmt.Errorf("get retries: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return retries, nil
+}
+
+const sqlIncrementRetries = `
+UPDATE scan SET retries = retries + 1
+WHERE folder = ?
+`
+
+// IncrementRetries counts a failed attempt of the scan, which is retried later.
+func (store *datastore) IncrementRetries(scan autoscan.Scan) error {
+	if _, err := store.Exec(sqlIncrementRetries, scan.Folder); err != nil {
+		return fmt.Errorf("increment retries: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlGetScansRemaining = `SELECT (SELECT COUNT(folder) FROM scan) + (SELECT COUNT(folder) FROM target_scan)`
 
 func (store *datastore) GetScansRemaining() (int, error) {
 	row := store.QueryRow(sqlGetScansRemaining)
@@ -82,17 +325,30 @@ func (store *datastore) GetScansRemaining() (int, error) {
 }
 
 const sqlGetAvailableScan = `
-SELECT folder, priority, time FROM scan
-WHERE time < ?
-ORDER BY priority DESC, time ASC
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
+WHERE time < ? OR immediate
+ORDER BY immediate DESC, priority DESC, time ASC
+LIMIT 1
+`
+
+const sqlGetAvailableScanLIFO = `
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
+WHERE time < ? OR immediate
+ORDER BY immediate DESC, priority DESC, time DESC
 LIMIT 1
 `
 
 func (store *datastore) GetAvailableScan(minAge time.Duration) (autoscan.Scan, error) {
-	row := store.QueryRow(sqlGetAvailableScan, now().Add(-1*minAge))
+	query := sqlGetAvailableScan
+	if store.lifo {
+		query = sqlGetAvailableScanLIFO
+	}
+
+	row := store.QueryRow(query, now().Add(-1*minAge))
 
 	scan := autoscan.Scan{}
-	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time)
+	var targets, libraries string
+	err := row.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted, &scan.ID, &targets, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return scan, autoscan.ErrNoScans
@@ -100,11 +356,41 @@ func (store *datastore) GetAvailableScan(minAge time.Duration) (autoscan.Scan, e
 		return scan, fmt.Errorf("get matching: %s: %w", err, autoscan.ErrFatal)
 	}
 
+	scan.Targets = decodeNames(targets)
+	scan.Libraries = decodeNames(libraries)
 	return scan, nil
 }
 
+const sqlGetExpired = `
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
+WHERE time < ?
+`
+
+func (store *datastore) GetExpired(ttl time.Duration) (scans []autoscan.Scan, err error) {
+	rows, err := store.Query(sqlGetExpired, now().Add(-1*ttl))
+	if err != nil {
+		return scans, fmt.Errorf("get expired: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		scan := autoscan.Scan{}
+		var targets, libraries string
+		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted, &scan.ID, &targets, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries)
+		if err != nil {
+			return scans, fmt.Errorf("get expired: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		scan.Targets = decodeNames(targets)
+		scan.Libraries = decodeNames(libraries)
+		scans = append(scans, scan)
+	}
+
+	return scans, rows.Err()
+}
+
 const sqlGetAll = `
-SELECT folder, priority, time FROM scan
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
 `
 
 func (store *datastore) GetAll() (scans []autoscan.Scan, err error) {
@@ -116,17 +402,78 @@ func (store *datastore) GetAll() (scans []autoscan.Scan, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		scan := autoscan.Scan{}
-		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time)
+		var targets, libraries string
+		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted, &scan.ID, &targets, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries)
 		if err != nil {
 			return scans, err
 		}
 
+		scan.Targets = decodeNames(targets)
+		scan.Libraries = decodeNames(libraries)
+		scans = append(scans, scan)
+	}
+
+	return scans, rows.Err()
+}
+
+// The libraries of a scan are encoded as a JSON array,
+// which contains a library when it contains the encoded name of the library.
+const sqlGetQueue = `
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
+WHERE ? = '' OR instr(libraries, ?) > 0
+ORDER BY immediate DESC, priority DESC, time ASC
+LIMIT ? OFFSET ?
+`
+
+const sqlGetQueueLIFO = `
+SELECT folder, priority, time, deep, immediate, deleted, id, targets, reason, source, media_type, files, libraries FROM scan
+WHERE ? = '' OR instr(libraries, ?) > 0
+ORDER BY immediate DESC, priority DESC, time DESC
+LIMIT ? OFFSET ?
+`
+
+// GetQueue returns at most limit scans in the order they are processed,
+// skipping the first offset scans. A negative limit returns all scans.
+// Only the scans routed to the library are returned, unless the library is empty.
+func (store *datastore) GetQueue(offset, limit int, library string) (scans []autoscan.Scan, err error) {
+	query := sqlGetQueue
+	if store.lifo {
+		query = sqlGetQueueLIFO
+	}
+
+	rows, err := store.Query(query, library, encodeLibrary(library), limit, offset)
+	if err != nil {
+		return scans, fmt.Errorf("get queue: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		scan := autoscan.Scan{}
+		var targets, libraries string
+		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted, &scan.ID, &targets, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries)
+		if err != nil {
+			return scans, fmt.Errorf("get queue: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		scan.Targets = decodeNames(targets)
+		scan.Libraries = decodeNames(libraries)
 		scans = append(scans, scan)
 	}
 
 	return scans, rows.Err()
 }
 
+const sqlGetQueueSize = `SELECT COUNT(folder) FROM scan WHERE ? = '' OR instr(libraries, ?) > 0`
+
+func (store *datastore) GetQueueSize(library string) (int, error) {
+	size := 0
+	if err := store.QueryRow(sqlGetQueueSize, library, encodeLibrary(library)).Scan(&size); err != nil {
+		return size, fmt.Errorf("get queue size: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return size, nil
+}
+
 const sqlDelete = `
 DELETE FROM scan WHERE folder=?
 `
@@ -140,4 +487,197 @@ func (store *datastore) Delete(scan autoscan.Scan) error {
 	return nil
 }
 
+const sqlUpsertAnalysis = `
+INSERT INTO analysis (folder, time)
+VALUES (?, ?)
+ON CONFLICT (folder) DO UPDATE SET
+	time = excluded.time
+`
+
+func (store *datastore) UpsertAnalysis(scan autoscan.Scan) error {
+	_, err := store.Exec(sqlUpsertAnalysis, scan.Folder, now())
+	if err != nil {
+		return fmt.Errorf("upsert analysis: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlGetAnalysesRemaining = `SELECT COUNT(folder) FROM analysis`
+
+func (store *datastore) GetAnalysesRemaining() (int, error) {
+	row := store.QueryRow(sqlGetAnalysesRemaining)
+
+	remaining := 0
+	err := row.Scan(&remaining)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return remaining, nil
+	case err != nil:
+		return remaining, fmt.Errorf("get remaining analyses: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	return remaining, nil
+}
+
+const sqlGetAvailableAnalysis = `
+SELECT folder, time FROM analysis
+ORDER BY time ASC
+LIMIT 1
+`
+
+func (store *datastore) GetAvailableAnalysis() (autoscan.Scan, error) {
+	row := store.QueryRow(sqlGetAvailableAnalysis)
+
+	scan := autoscan.Scan{}
+	err := row.Scan(&scan.Folder, &scan.Time)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return scan, autoscan.ErrNoScans
+	case err != nil:
+		return scan, fmt.Errorf("get analysis: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return scan, nil
+}
+
+const sqlDeleteAnalysis = `
+DELETE FROM analysis WHERE folder=?
+`
+
+func (store *datastore) DeleteAnalysis(scan autoscan.Scan) error {
+	_, err := store.Exec(sqlDeleteAnalysis, scan.Folder)
+	if err != nil {
+		return fmt.Errorf("delete analysis: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlInsertFailed = `
+INSERT INTO failed (id, scan_id, folder, priority, deep, immediate, deleted, targets, reason, source, media_type, files, error, time)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// maxFailedScans is the number of failed scans which are kept,
+// older failed scans are discarded once another scan fails.
+var maxFailedScans = 1000
+
+const sqlPruneFailed = `
+DELETE FROM failed WHERE id NOT IN (
+	SELECT id FROM failed
+	ORDER BY time DESC
+	LIMIT ?
+)
+`
+
+// Fail moves the scan from the queue to the failed scans.
+func (store *datastore) Fail(scan autoscan.Scan, id string, scanErr error) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return fmt.Errorf("fail: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	if _, err = tx.Exec(sqlDelete, scan.Folder); err == nil {
+		_, err = tx.Exec(sqlInsertFailed, id, scan.ID, scan.Folder, scan.Priority, scan.Deep, scan.Immediate, scan.Deleted,
+			encodeNames(scan.Targets), scan.Reason, scan.Source, scan.MediaType, scan.Files, scanErr.Error(), now())
+	}
+
+	if err == nil {
+		_, err = tx.Exec(sqlPruneFailed, maxFailedScans)
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		return fmt.Errorf("fail: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return tx.Commit()
+}
+
+const sqlGetFailed = `
+SELECT id, scan_id, folder, priority, deep, immediate, deleted, targets, reason, source, media_type, files, error, time FROM failed
+ORDER BY time DESC
+`
+
+func (store *datastore) GetFailed() (failed []FailedScan, err error) {
+	rows, err := store.Query(sqlGetFailed)
+	if err != nil {
+		return failed, fmt.Errorf("get failed: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		f := FailedScan{}
+		var targets string
+		err = rows.Scan(&f.ID, &f.ScanID, &f.Folder, &f.Priority, &f.Deep, &f.Immediate, &f.Deleted, &targets, &f.Reason, &f.Source, &f.MediaType, &f.Files, &f.Error, &f.Time)
+		if err != nil {
+			return failed, fmt.Errorf("get failed: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		f.Targets = decodeNames(targets)
+		failed = append(failed, f)
+	}
+
+	return failed, rows.Err()
+}
+
+const sqlGetFailedByID = `
+SELECT scan_id, folder, priority, deep, immediate, deleted, targets, reason, source, media_type, files FROM failed
+WHERE id = ?
+`
+
+const sqlDeleteFailed = `
+DELETE FROM failed WHERE id=?
+`
+
+// RetryFailed moves the failed scan with the given id back to the queue.
+func (store *datastore) RetryFailed(id string) (autoscan.Scan, error) {
+	tx, err := store.Begin()
+	if err != nil {
+		return autoscan.Scan{}, fmt.Errorf("retry failed: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	scan := autoscan.Scan{Time: now()}
+	var targets string
+	err = tx.QueryRow(sqlGetFailedByID, id).Scan(&scan.ID, &scan.Folder, &scan.Priority, &scan.Deep, &scan.Immediate, &scan.Deleted, &targets, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files)
+	if err == nil {
+		scan.Targets = decodeNames(targets)
+		if err = store.upsert(tx, scan); err == nil {
+			_, err = tx.Exec(sqlDeleteFailed, id)
+		}
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return scan, ErrFailedScanNotFound
+		}
+
+		return scan, fmt.Errorf("retry failed: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return scan, tx.Commit()
+}
+
+// DeleteFailed discards the failed scan with the given id.
+func (store *datastore) DeleteFailed(id string) error {
+	res, err := store.Exec(sqlDeleteFailed, id)
+	if err != nil {
+		return fmt.Errorf("delete failed: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrFailedScanNotFound
+	}
+
+	return nil
+}
+
 var now = time.Now
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -242,3 +243,573 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalysis(t *testing.T) {
+	store := getDatastore(t)
+
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	if _, err := store.GetAvailableAnalysis(); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatalf("Expected no analyses, got: %v", err)
+	}
+
+	for _, folder := range []string{"1", "2", "1"} {
+		if err := store.UpsertAnalysis(autoscan.Scan{Folder: folder}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remaining, err := store.GetAnalysesRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 2 {
+		t.Errorf("Remaining analyses do not match: %d vs %d", remaining, 2)
+	}
+
+	scan, err := store.GetAvailableAnalysis()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteAnalysis(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, err = store.GetAnalysesRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 1 {
+		t.Errorf("Remaining analyses do not match: %d vs %d", remaining, 1)
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	store := getDatastore(t)
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "old", Time: testTime.Add(-2 * time.Hour)},
+		{Folder: "new", Time: testTime.Add(-30 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetExpired(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []autoscan.Scan{{Folder: "old", Time: testTime.Add(-2 * time.Hour)}}
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestUpsertDedupKey(t *testing.T) {
+	store := getDatastore(t)
+
+	dedupKey, err := autoscan.NewRewriter([]autoscan.Rewrite{{
+		From: "^/mnt/unionfs/Media/Movies-4K/",
+		To:   "/mnt/unionfs/Media/Movies/",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.dedupKey = dedupKey
+
+	testTime := time.Now().UTC()
+	err = store.Upsert([]autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 1, Time: testTime.Add(-2 * time.Minute)},
+		{Folder: "/mnt/unionfs/Media/Movies-4K/Interstellar (2014)", Priority: 5, Time: testTime},
+		{Folder: "/mnt/unionfs/Media/Movies-4K/Parasite (2019)", Priority: 1, Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 5, Time: testTime},
+		{Folder: "/mnt/unionfs/Media/Movies-4K/Parasite (2019)", Priority: 1, Time: testTime},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestGetAvailableScanImmediate(t *testing.T) {
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	store := getDatastore(t)
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "old", Priority: 5, Time: testTime.Add(-2 * time.Hour)},
+		{Folder: "immediate", Time: testTime, Immediate: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan, err := store.GetAvailableScan(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := autoscan.Scan{Folder: "immediate", Time: testTime, Immediate: true}
+	if !reflect.DeepEqual(scan, want) {
+		t.Log(scan)
+		t.Errorf("Scan does not match")
+	}
+}
+
+func TestGetAvailableScanLIFO(t *testing.T) {
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	store := getDatastore(t)
+	store.lifo = true
+
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "oldest", Time: testTime.Add(-3 * time.Hour)},
+		{Folder: "newest", Time: testTime.Add(-90 * time.Minute)},
+		{Folder: "debouncing", Time: testTime.Add(-30 * time.Minute)},
+		{Folder: "priority", Priority: 1, Time: testTime.Add(-4 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var folders []string
+	for {
+		scan, err := store.GetAvailableScan(time.Hour)
+		if errors.Is(err, autoscan.ErrNoScans) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		folders = append(folders, scan.Folder)
+		if err := store.Delete(scan); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// scans within the minimum age are not available
+	want := []string{"priority", "newest", "oldest"}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("Order does not match: %v vs %v", folders, want)
+	}
+}
+
+func TestGetQueue(t *testing.T) {
+	testTime := time.Now().UTC()
+	now = func() time.Time {
+		return testTime
+	}
+
+	store := getDatastore(t)
+
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "oldest", Time: testTime.Add(-3 * time.Hour)},
+		{Folder: "newest", Time: testTime.Add(-90 * time.Minute)},
+		{Folder: "debouncing", Time: testTime.Add(-30 * time.Minute)},
+		{Folder: "priority", Priority: 1, Time: testTime.Add(-4 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name    string
+		Offset  int
+		Limit   int
+		Folders []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "All scans",
+			Limit:   -1,
+			Folders: []string{"priority", "oldest", "newest", "debouncing"},
+		},
+		{
+			Name:    "First page",
+			Limit:   2,
+			Folders: []string{"priority", "oldest"},
+		},
+		{
+			Name:    "Second page",
+			Offset:  2,
+			Limit:   2,
+			Folders: []string{"newest", "debouncing"},
+		},
+		{
+			Name:    "Past the end",
+			Offset:  4,
+			Limit:   2,
+			Folders: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			scans, err := store.GetQueue(tc.Offset, tc.Limit, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var folders []string
+			for _, scan := range scans {
+				folders = append(folders, scan.Folder)
+			}
+
+			if !reflect.DeepEqual(folders, tc.Folders) {
+				t.Errorf("Folders do not match: %v vs %v", folders, tc.Folders)
+			}
+		})
+	}
+
+	size, err := store.GetQueueSize("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != 4 {
+		t.Errorf("Queue size does not match: %d vs %d", size, 4)
+	}
+}
+
+func TestUpsertTargets(t *testing.T) {
+	store := getDatastore(t)
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "targeted", Time: testTime, Targets: []string{"plex"}},
+		{Folder: "targeted", Time: testTime, Targets: []string{"plex-4k", "plex"}},
+		{Folder: "all", Time: testTime, Targets: []string{"plex"}},
+		{Folder: "all", Time: testTime},
+		{Folder: "untargeted", Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []autoscan.Scan{
+		{Folder: "targeted", Time: testTime, Targets: []string{"plex", "plex-4k"}},
+		{Folder: "all", Time: testTime},
+		{Folder: "untargeted", Time: testTime},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestUpsertReason(t *testing.T) {
+	store := getDatastore(t)
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "replaced", Time: testTime, Reason: "Sonarr import: Westworld S01E01"},
+		{Folder: "replaced", Time: testTime, Reason: "Sonarr import: Westworld S01E02"},
+		{Folder: "kept", Time: testTime, Reason: "manual"},
+		{Folder: "kept", Time: testTime},
+		{Folder: "none", Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []autoscan.Scan{
+		{Folder: "replaced", Time: testTime, Reason: "Sonarr import: Westworld S01E02"},
+		{Folder: "kept", Time: testTime, Reason: "manual"},
+		{Folder: "none", Time: testTime},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestUpsertFiles(t *testing.T) {
+	store := getDatastore(t)
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "merged", Time: testTime, Files: 2},
+		{Folder: "merged", Time: testTime, Files: 3},
+		{Folder: "unknown", Time: testTime},
+		{Folder: "unknown", Time: testTime, Files: 1},
+		{Folder: "none", Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []autoscan.Scan{
+		{Folder: "merged", Time: testTime, Files: 5},
+		{Folder: "unknown", Time: testTime, Files: 1},
+		{Folder: "none", Time: testTime},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+// folderLibraries matches folders to the library of their first path element.
+type folderLibraries struct{}
+
+func (folderLibraries) MatchLibrary(folder string) (string, bool) {
+	library, _, ok := strings.Cut(strings.TrimPrefix(folder, "/"), "/")
+	return library, ok
+}
+
+func (l folderLibraries) LibraryNames(folder string) []string {
+	if library, ok := l.MatchLibrary(folder); ok {
+		return []string{library}
+	}
+
+	return nil
+}
+
+func TestUpsertDedupLibrary(t *testing.T) {
+	store := getDatastore(t)
+	store.setMatchers(map[string]autoscan.LibraryMatcher{"plex": folderLibraries{}})
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "/Movies/Interstellar (2014)", Time: testTime},
+		{Folder: "/Movies/Tenet (2020)", Time: testTime},
+		{Folder: "/TV/Westworld", Time: testTime},
+		{Folder: "/TV/Westworld", Time: testTime},
+		{Folder: "unmatched", Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scans of different folders within a library become a deep scan of the library
+	want := []autoscan.Scan{
+		{Folder: "/Movies/Interstellar (2014)", Time: testTime, Deep: true},
+		{Folder: "/TV/Westworld", Time: testTime},
+		{Folder: "unmatched", Time: testTime},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestUpsertDedupLibraryMixedTargets(t *testing.T) {
+	store := getDatastore(t)
+	store.setMatchers(map[string]autoscan.LibraryMatcher{
+		"plex": folderLibraries{},
+		"emby": nil,
+	})
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "/Movies/Interstellar (2014)", Time: testTime},
+		{Folder: "/Movies/Tenet (2020)", Time: testTime},
+		{Folder: "/TV/Westworld", Time: testTime, Targets: []string{"plex"}},
+		{Folder: "/TV/Chernobyl", Time: testTime, Targets: []string{"plex"}},
+		{Folder: "/TV/Dark", Time: testTime, Targets: []string{"emby"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans, err := store.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// emby does not scan the entire library of a deep scan,
+	// so only the scans sent to plex alone are merged
+	want := []autoscan.Scan{
+		{Folder: "/Movies/Interstellar (2014)", Time: testTime},
+		{Folder: "/Movies/Tenet (2020)", Time: testTime},
+		{Folder: "/TV/Westworld", Time: testTime, Deep: true, Targets: []string{"plex"}},
+		{Folder: "/TV/Dark", Time: testTime, Targets: []string{"emby"}},
+	}
+
+	if !reflect.DeepEqual(scans, want) {
+		t.Log(scans)
+		t.Errorf("Scans do not match")
+	}
+}
+
+func TestUpsertLibraries(t *testing.T) {
+	store := getDatastore(t)
+	store.setNamers(map[string]autoscan.LibraryNamer{
+		"plex":    folderLibraries{},
+		"plex-4k": folderLibraries{},
+	})
+
+	testTime := time.Now().UTC()
+	err := store.Upsert([]autoscan.Scan{
+		{Folder: "/Movies/Interstellar (2014)", Time: testTime.Add(-3 * time.Minute)},
+		{Folder: "/Movies 4K/Tenet (2020)", Time: testTime.Add(-2 * time.Minute), Targets: []string{"plex-4k"}},
+		{Folder: "/TV/Westworld", Time: testTime.Add(-1 * time.Minute), Targets: []string{"emby"}},
+		{Folder: "unmatched", Time: testTime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name    string
+		Library string
+		Folders []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "All libraries",
+			Folders: []string{"/Movies/Interstellar (2014)", "/Movies 4K/Tenet (2020)", "/TV/Westworld", "unmatched"},
+		},
+		{
+			Name:    "Library",
+			Library: "Movies",
+			Folders: []string{"/Movies/Interstellar (2014)"},
+		},
+		{
+			Name:    "Library of a single target",
+			Library: "Movies 4K",
+			Folders: []string{"/Movies 4K/Tenet (2020)"},
+		},
+		{
+			Name:    "Library of another target",
+			Library: "TV",
+			Folders: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			scans, err := store.GetQueue(0, -1, tc.Library)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var folders []string
+			for _, scan := range scans {
+				folders = append(folders, scan.Folder)
+
+				if tc.Library != "" && !reflect.DeepEqual(scan.Libraries, []string{tc.Library}) {
+					t.Errorf("Libraries do not match: %v vs %v", scan.Libraries, []string{tc.Library})
+				}
+			}
+
+			if !reflect.DeepEqual(folders, tc.Folders) {
+				t.Errorf("Folders do not match: %v vs %v", folders, tc.Folders)
+			}
+
+			size, err := store.GetQueueSize(tc.Library)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != len(tc.Folders) {
+				t.Errorf("Queue size does not match: %d vs %d", size, len(tc.Folders))
+			}
+		})
+	}
+}
+
+func TestFailRetention(t *testing.T) {
+	store := getDatastore(t)
+
+	defaultMax := maxFailedScans
+	t.Cleanup(func() {
+		maxFailedScans = defaultMax
+		now = time.Now
+	})
+
+	maxFailedScans = 3
+
+	testTime := time.Now().UTC()
+	for i, folder := range []string{"1", "2", "3", "4", "5"} {
+		now = func() time.Time {
+			return testTime.Add(time.Duration(i) * time.Minute)
+		}
+
+		if err := store.Upsert([]autoscan.Scan{{Folder: folder, Time: testTime}}); err != nil {
+			t.Fatal(err)
+		}
+
+		fail := store.Fail
+		if i%2 == 1 {
+			fail = func(scan autoscan.Scan, id string, scanErr error) error {
+				return store.FailTarget("plex", scan, id, scanErr)
+			}
+		}
+
+		if err := fail(autoscan.Scan{Folder: folder}, folder, errors.New("scan failed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := store.GetFailed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folders := make([]string, 0)
+	for _, f := range failed {
+		folders = append(folders, f.Folder)
+	}
+
+	if want := []string{"5", "4", "3"}; !reflect.DeepEqual(folders, want) {
+		t.Errorf("Failed scans do not match: %v vs %v", folders, want)
+	}
+}
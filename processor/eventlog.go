@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+const (
+	// default maximum size of the event log in MiB
+	eventLogMaxSize = 10
+	// default amount of rotated event logs which are kept
+	eventLogMaxBackups = 5
+)
+
+type EventLogConfig struct {
+	Path string `yaml:"path"`
+
+	// MaxSize is the size in MiB after which the event log is rotated.
+	MaxSize int `yaml:"max-size"`
+
+	// MaxBackups is the amount of rotated event logs which are kept.
+	MaxBackups int `yaml:"max-backups"`
+}
+
+// The events written to the event log.
+const (
+	eventEnqueued   = "enqueued"
+	eventDispatched = "dispatched"
+	eventSucceeded  = "succeeded"
+	eventFailed     = "failed"
+	eventExpired    = "expired"
+	eventDeferred   = "deferred"
+)
+
+type event struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	ID       string    `json:"id"`
+	Folder   string    `json:"folder"`
+	Reason   string    `json:"reason,omitempty"`
+	Files    int       `json:"files,omitempty"`
+	Targets  []string  `json:"targets,omitempty"`
+	Retries  int       `json:"retries,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// eventLog writes scan events as JSON lines to a file, which is rotated by size.
+type eventLog struct {
+	out *lumberjack.Logger
+}
+
+func newEventLog(c EventLogConfig) (*eventLog, error) {
+	if c.Path == "" {
+		return nil, nil
+	}
+
+	if c.MaxSize < 0 || c.MaxBackups < 0 {
+		return nil, fmt.Errorf("invalid event-log max-size %d and max-backups %d: must not be negative", c.MaxSize, c.MaxBackups)
+	}
+
+	maxSize := c.MaxSize
+	if maxSize == 0 {
+		maxSize = eventLogMaxSize
+	}
+
+	maxBackups := c.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = eventLogMaxBackups
+	}
+
+	return &eventLog{
+		out: &lumberjack.Logger{
+			Filename:   c.Path,
+			MaxSize:    maxSize,
+			MaxBackups: maxBackups,
+		},
+	}, nil
+}
+
+// Write appends the event to the event log.
+// Failures are logged, as the event log must never hold up the processor.
+func (l *eventLog) Write(e event) {
+	if l == nil {
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed encoding event")
+		return
+	}
+
+	if _, err := l.out.Write(append(b, '\n')); err != nil {
+		log.Error().Err(err).Msg("Failed writing event")
+	}
+}
+
+// event writes an event of the scan to the event log.
+func (p *Processor) event(name string, scan autoscan.Scan, retries int, duration time.Duration, err error) {
+	if p.events == nil {
+		return
+	}
+
+	e := event{
+		Time:    now(),
+		Event:   name,
+		ID:      scan.ID,
+		Folder:  scan.Folder,
+		Reason:  scan.Reason,
+		Files:   scan.Files,
+		Targets: scan.Targets,
+		Retries: retries,
+	}
+
+	if duration > 0 {
+		e.Duration = duration.String()
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	p.events.Write(e)
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+func readEvents(t *testing.T, path string) []event {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	events := make([]event, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid event %q: %v", scanner.Text(), err)
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestEventLog(t *testing.T) {
+	now = time.Now
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	events, err := newEventLog(EventLogConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &Processor{store: getDatastore(t), events: events}
+	target := getMockTarget(t, mock.Config{Name: "plex"})
+
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Reason: "manual", Time: time.Now().UTC().Add(-time.Minute)}
+	if err := proc.Add(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Event struct {
+		Event   string
+		Folder  string
+		Targets []string
+	}
+
+	got := make([]Event, 0)
+	for _, e := range readEvents(t, path) {
+		if e.ID == "" || e.Time.IsZero() {
+			t.Errorf("Expected the event to have an ID and a time: %+v", e)
+		}
+
+		got = append(got, Event{Event: e.Event, Folder: e.Folder, Targets: e.Targets})
+	}
+
+	want := []Event{
+		{Event: eventEnqueued, Folder: scan.Folder},
+		{Event: eventDispatched, Folder: scan.Folder, Targets: []string{"plex"}},
+		{Event: eventSucceeded, Folder: scan.Folder},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Events do not match\n%+v\nvs\n%+v", got, want)
+	}
+}
+
+func TestNewEventLog(t *testing.T) {
+	if events, err := newEventLog(EventLogConfig{}); events != nil || err != nil {
+		t.Errorf("Expected no event log without a path, got: %v, %v", events, err)
+	}
+
+	if _, err := newEventLog(EventLogConfig{Path: "events.jsonl", MaxSize: -1}); err == nil {
+		t.Error("Expected an error for a negative max-size")
+	}
+}
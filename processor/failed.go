@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// ErrFailedScanNotFound indicates that no failed scan has the given ID.
+var ErrFailedScanNotFound = errors.New("failed scan not found")
+
+var errScanExpired = errors.New("scan expired")
+
+// A FailedScan is a scan which was dropped from the queue without being handled by the targets,
+// because no library or target matched, or because it expired.
+// Failed scans are kept until they are retried or discarded.
+type FailedScan struct {
+	// ID identifies the failed scan, ScanID is the ID of the scan itself.
+	ID        string    `json:"id"`
+	ScanID    string    `json:"scan_id"`
+	Folder    string    `json:"folder"`
+	Priority  int       `json:"priority"`
+	Deep      bool      `json:"deep"`
+	Immediate bool      `json:"immediate"`
+	Deleted   bool      `json:"deleted"`
+	Targets   []string  `json:"targets,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	MediaType string    `json:"media_type,omitempty"`
+	Files     int       `json:"files,omitempty"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+}
+
+// fail moves the scan from the queue to the failed scans.
+func (p *Processor) fail(scan autoscan.Scan, err error) error {
+	return p.store.Fail(scan, autoscan.NewScanID(), err)
+}
+
+// Failed returns the failed scans, most recent first.
+func (p *Processor) Failed() ([]FailedScan, error) {
+	return p.store.GetFailed()
+}
+
+// RetryFailed moves the failed scan with the given ID back to the queue.
+func (p *Processor) RetryFailed(id string) (autoscan.Scan, error) {
+	scan, err := p.store.RetryFailed(id)
+	if err != nil {
+		return scan, err
+	}
+
+	if scan.Immediate {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return scan, nil
+}
+
+// DiscardFailed removes the failed scan with the given ID.
+func (p *Processor) DiscardFailed(id string) error {
+	return p.store.DeleteFailed(id)
+}
@@ -0,0 +1,256 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// historySize is the number of scans kept in the history.
+const historySize = 100
+
+// A HistoryEntry describes the outcome of a processed scan.
+// The Target names the targets the scan was sent to, with a queue per target
+// every target has entries of its own.
+type HistoryEntry struct {
+	ID        string        `json:"id"`
+	Folder    string        `json:"folder"`
+	Target    string        `json:"target,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	Files     int           `json:"files,omitempty"`
+	Libraries []string      `json:"libraries,omitempty"`
+	Status    string        `json:"status"`
+	Retries   int           `json:"retries"`
+	Error     string        `json:"error,omitempty"`
+	Time      time.Time     `json:"time"`
+	Duration  time.Duration `json:"duration"`
+
+	// Count is the number of consecutive scans collapsed into the entry,
+	// along with the time of the first of these scans. Zero for a single scan.
+	Count int        `json:"count,omitempty"`
+	First *time.Time `json:"first,omitempty"`
+}
+
+// history is a ring buffer of the most recently processed scans.
+type history struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+}
+
+func newHistory(size int) *history {
+	return &history{
+		entries: make([]HistoryEntry, 0, size),
+	}
+}
+
+func (h *history) add(entry HistoryEntry) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, entry)
+		return
+	}
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// list returns the entries, newest first.
+func (h *history) list() []HistoryEntry {
+	if h == nil {
+		return []HistoryEntry{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]HistoryEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entries = append(entries, h.entries[(h.next+i)%len(h.entries)])
+	}
+
+	return entries
+}
+
+// page returns at most limit entries of the library, newest first, skipping the first
+// offset entries, along with the total number of entries of the library.
+// A negative limit returns all entries after the offset, an empty library all entries.
+func (h *history) page(offset, limit int, library string) ([]HistoryEntry, int) {
+	if h == nil {
+		return []HistoryEntry{}, 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries := make([]HistoryEntry, 0)
+	total := 0
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[(h.next+i)%len(h.entries)]
+		if !entry.InLibrary(library) {
+			continue
+		}
+
+		if total >= offset && (limit < 0 || total < offset+limit) {
+			entries = append(entries, entry)
+		}
+
+		total++
+	}
+
+	return entries, total
+}
+
+// record adds the outcome of the scan to the history,
+// retries is the number of failed attempts before this attempt.
+func (p *Processor) record(scan autoscan.Scan, target string, status string, retries int, duration time.Duration, err error) {
+	entry := HistoryEntry{
+		ID:        scan.ID,
+		Folder:    scan.Folder,
+		Target:    target,
+		Reason:    scan.Reason,
+		Files:     scan.Files,
+		Libraries: scan.Libraries,
+		Status:    status,
+		Retries:   retries,
+		Time:      time.Now(),
+		Duration:  duration,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	p.history.add(entry)
+
+	switch status {
+	case "success":
+		p.event(eventSucceeded, scan, retries, duration, err)
+	case "expired":
+		p.event(eventExpired, scan, retries, duration, err)
+	case "deferred":
+		p.event(eventDeferred, scan, retries, duration, err)
+	default:
+		p.event(eventFailed, scan, retries, duration, err)
+	}
+}
+
+// InLibrary returns whether the scan was routed to the library,
+// every scan is in the empty library.
+func (e HistoryEntry) InLibrary(library string) bool {
+	if library == "" {
+		return true
+	}
+
+	for _, name := range e.Libraries {
+		if name == library {
+			return true
+		}
+	}
+
+	return false
+}
+
+// repeats returns whether the entry is a repeated scan of the same folder by the same targets,
+// with the same outcome.
+func (e HistoryEntry) repeats(other HistoryEntry) bool {
+	return e.Folder == other.Folder && e.Target == other.Target && e.Status == other.Status
+}
+
+// StatusText describes the outcome of the scan, e.g. "success after 2 retries".
+func (e HistoryEntry) StatusText() string {
+	if e.Retries == 0 {
+		return e.Status
+	}
+
+	return fmt.Sprintf("%s after %s", e.Status, formatRetries(e.Retries))
+}
+
+func formatRetries(retries int) string {
+	if retries == 1 {
+		return "1 retry"
+	}
+
+	return fmt.Sprintf("%d retries", retries)
+}
+
+// History returns the most recently processed scans, newest first.
+func (p *Processor) History() []HistoryEntry {
+	return p.history.list()
+}
+
+// HistoryPage returns at most limit of the most recently processed scans,
+// newest first, skipping the first offset scans, along with the total number
+// of scans in the history. When a library is given, only the scans routed to
+// that library are returned.
+func (p *Processor) HistoryPage(offset, limit int, library string) ([]HistoryEntry, int) {
+	return p.history.page(offset, limit, library)
+}
+
+// FilterHistory returns the entries of the scans routed to the library.
+func FilterHistory(entries []HistoryEntry, library string) []HistoryEntry {
+	filtered := make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.InLibrary(library) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered
+}
+
+// PageHistory returns at most limit of the entries, skipping the first offset
+// entries, along with the total number of entries.
+func PageHistory(entries []HistoryEntry, offset, limit int) ([]HistoryEntry, int) {
+	total := len(entries)
+	switch {
+	case offset < 0:
+		offset = 0
+	case offset > total:
+		offset = total
+	}
+
+	end := total
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	return entries[offset:end], total
+}
+
+// CollapseHistory collapses consecutive entries of the same folder, target and status
+// into the most recent of these entries, which counts the collapsed scans.
+func CollapseHistory(entries []HistoryEntry) []HistoryEntry {
+	collapsed := make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		n := len(collapsed)
+		if n == 0 || !collapsed[n-1].repeats(entry) {
+			collapsed = append(collapsed, entry)
+			continue
+		}
+
+		// the entries are ordered newest first, so the entry is older than the collapsed entry
+		last := &collapsed[n-1]
+		if last.Count == 0 {
+			last.Count = 1
+		}
+
+		first := entry.Time
+		last.Count++
+		last.First = &first
+	}
+
+	return collapsed
+}
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+
+	if len(h.list()) != 0 {
+		t.Fatalf("Expected an empty history, got: %v", h.list())
+	}
+
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		h.add(HistoryEntry{ID: id})
+	}
+
+	ids := make([]string, 0)
+	for _, entry := range h.list() {
+		ids = append(ids, entry.ID)
+	}
+
+	if want := []string{"5", "4", "3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("History does not match: %v vs %v", ids, want)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	h := newHistory(5)
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+		h.add(HistoryEntry{ID: id})
+	}
+
+	type Test struct {
+		Name   string
+		Offset int
+		Limit  int
+		IDs    []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:  "All entries",
+			Limit: -1,
+			IDs:   []string{"7", "6", "5", "4", "3"},
+		},
+		{
+			Name:  "First page",
+			Limit: 2,
+			IDs:   []string{"7", "6"},
+		},
+		{
+			Name:   "Last page",
+			Offset: 4,
+			Limit:  2,
+			IDs:    []string{"3"},
+		},
+		{
+			Name:   "Past the end",
+			Offset: 6,
+			Limit:  2,
+			IDs:    []string{},
+		},
+		{
+			Name:   "Negative offset",
+			Offset: -500,
+			Limit:  2,
+			IDs:    []string{"7", "6"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			entries, total := h.page(tc.Offset, tc.Limit, "")
+			if total != 5 {
+				t.Errorf("Total does not match: %d vs %d", total, 5)
+			}
+
+			ids := make([]string, 0)
+			for _, entry := range entries {
+				ids = append(ids, entry.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tc.IDs) {
+				t.Errorf("History does not match: %v vs %v", ids, tc.IDs)
+			}
+
+			paged, _ := PageHistory(h.list(), tc.Offset, tc.Limit)
+			if !reflect.DeepEqual(paged, entries) {
+				t.Errorf("Paged history does not match: %v vs %v", paged, entries)
+			}
+		})
+	}
+}
+
+func TestCollapseHistory(t *testing.T) {
+	now := time.Now()
+	at := func(minutes int) time.Time {
+		return now.Add(-time.Duration(minutes) * time.Minute)
+	}
+
+	entries := []HistoryEntry{
+		{ID: "6", Folder: "/TV/Westworld/Season 1", Status: "success", Time: at(0)},
+		{ID: "5", Folder: "/TV/Westworld/Season 1", Status: "success", Time: at(1)},
+		{ID: "4", Folder: "/TV/Westworld/Season 1", Status: "success", Time: at(2)},
+		{ID: "3", Folder: "/TV/Westworld/Season 1", Status: "failed", Time: at(3)},
+		{ID: "2", Folder: "/Movies/Tenet (2020)", Status: "success", Time: at(4)},
+		{ID: "1", Folder: "/TV/Westworld/Season 1", Status: "success", Time: at(5)},
+	}
+
+	type Entry struct {
+		ID    string
+		Count int
+		First time.Time
+	}
+
+	got := make([]Entry, 0)
+	for _, entry := range CollapseHistory(entries) {
+		e := Entry{ID: entry.ID, Count: entry.Count}
+		if entry.First != nil {
+			e.First = *entry.First
+		}
+
+		got = append(got, e)
+	}
+
+	want := []Entry{
+		{ID: "6", Count: 3, First: at(2)},
+		{ID: "3"},
+		{ID: "2"},
+		{ID: "1"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries do not match:\n%+v\n%+v", got, want)
+	}
+
+	if entries[0].Count != 0 || entries[0].First != nil {
+		t.Errorf("Expected the history to be left untouched, got: %+v", entries[0])
+	}
+}
+
+func TestCollapseHistoryTargets(t *testing.T) {
+	entries := []HistoryEntry{
+		{ID: "6", Folder: "/TV/Westworld/Season 1", Target: "plex", Status: "success"},
+		{ID: "5", Folder: "/TV/Westworld/Season 1", Target: "emby", Status: "success"},
+		{ID: "4", Folder: "/TV/Westworld/Season 1", Target: "emby", Status: "success"},
+		{ID: "3", Folder: "/TV/Westworld/Season 1", Target: "plex", Status: "success"},
+		{ID: "2", Folder: "/TV/Westworld/Season 1", Target: "plex", Status: "success"},
+		{ID: "1", Folder: "/TV/Westworld/Season 1", Target: "emby", Status: "success"},
+	}
+
+	type Entry struct {
+		ID     string
+		Target string
+		Count  int
+	}
+
+	got := make([]Entry, 0)
+	for _, entry := range CollapseHistory(entries) {
+		got = append(got, Entry{ID: entry.ID, Target: entry.Target, Count: entry.Count})
+	}
+
+	want := []Entry{
+		{ID: "6", Target: "plex"},
+		{ID: "5", Target: "emby", Count: 2},
+		{ID: "3", Target: "plex", Count: 2},
+		{ID: "1", Target: "emby"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries do not match:\n%+v\n%+v", got, want)
+	}
+}
+
+func TestHistoryLibrary(t *testing.T) {
+	h := newHistory(5)
+	h.add(HistoryEntry{ID: "1", Libraries: []string{"Movies"}})
+	h.add(HistoryEntry{ID: "2", Libraries: []string{"Movies 4K"}})
+	h.add(HistoryEntry{ID: "3", Libraries: []string{"Movies", "Movies 4K"}})
+	h.add(HistoryEntry{ID: "4"})
+
+	type Test struct {
+		Name    string
+		Library string
+		IDs     []string
+	}
+
+	var testCases = []Test{
+		{
+			Name: "All libraries",
+			IDs:  []string{"4", "3", "2", "1"},
+		},
+		{
+			Name:    "Library",
+			Library: "Movies",
+			IDs:     []string{"3", "1"},
+		},
+		{
+			Name:    "Unknown library",
+			Library: "TV",
+			IDs:     []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			entries, total := h.page(0, -1, tc.Library)
+			if total != len(tc.IDs) {
+				t.Errorf("Total does not match: %d vs %d", total, len(tc.IDs))
+			}
+
+			ids := make([]string, 0)
+			for _, entry := range entries {
+				ids = append(ids, entry.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tc.IDs) {
+				t.Errorf("History does not match: %v vs %v", ids, tc.IDs)
+			}
+
+			filtered := FilterHistory(h.list(), tc.Library)
+			if !reflect.DeepEqual(filtered, entries) {
+				t.Errorf("Filtered history does not match: %v vs %v", filtered, entries)
+			}
+		})
+	}
+}
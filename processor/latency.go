@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the queue latency histogram.
+var latencyBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 900, 1800, 3600, 7200, 21600}
+
+// scanDurationBuckets are the upper bounds, in seconds, of the scan duration histograms.
+var scanDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// latencySamples is the number of recent latencies used to calculate percentiles.
+const latencySamples = 1000
+
+// A LatencySnapshot summarises observed durations, such as the time scans
+// spent in the queue or the time targets took to handle a scan.
+type LatencySnapshot struct {
+	// Buckets holds the upper bounds in seconds, Counts the cumulative number of
+	// observations less than or equal to the upper bound of the bucket.
+	Buckets []float64
+	Counts  []uint64
+
+	Count uint64
+	Sum   float64
+
+	// Percentiles and mean of the most recent observations.
+	P50  time.Duration
+	P95  time.Duration
+	Mean time.Duration
+}
+
+type latency struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+	samples []time.Duration
+	next    int
+}
+
+func newLatency(buckets []float64) *latency {
+	return &latency{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+		samples: make([]time.Duration, 0, latencySamples),
+	}
+}
+
+func (l *latency) observe(d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seconds := d.Seconds()
+	for i, bound := range l.buckets {
+		if seconds <= bound {
+			l.counts[i]++
+		}
+	}
+
+	l.count++
+	l.sum += seconds
+
+	if len(l.samples) < cap(l.samples) {
+		l.samples = append(l.samples, d)
+		return
+	}
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % len(l.samples)
+}
+
+func (l *latency) snapshot() LatencySnapshot {
+	if l == nil {
+		return LatencySnapshot{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshot := LatencySnapshot{
+		Buckets: l.buckets,
+		Counts:  make([]uint64, len(l.buckets)),
+	}
+
+	copy(snapshot.Counts, l.counts)
+	snapshot.Count = l.count
+	snapshot.Sum = l.sum
+
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	snapshot.P50 = percentile(sorted, 0.50)
+	snapshot.P95 = percentile(sorted, 0.95)
+	snapshot.Mean = mean(sorted)
+	return snapshot
+}
+
+func mean(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+
+	return sum / time.Duration(len(durations))
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// QueueLatency returns a summary of the time scans spent in the queue.
+func (p *Processor) QueueLatency() LatencySnapshot {
+	return p.latency.snapshot()
+}
+
+// scanDurations keeps the time every target took to handle a scan, by name.
+type scanDurations struct {
+	mu      sync.Mutex
+	targets map[string]*latency
+}
+
+func newScanDurations() *scanDurations {
+	return &scanDurations{
+		targets: make(map[string]*latency),
+	}
+}
+
+func (d *scanDurations) observe(target autoscan.Target, duration time.Duration) {
+	if d == nil {
+		return
+	}
+
+	name := autoscan.TargetName(target)
+
+	d.mu.Lock()
+	l, ok := d.targets[name]
+	if !ok {
+		l = newLatency(scanDurationBuckets)
+		d.targets[name] = l
+	}
+	d.mu.Unlock()
+
+	l.observe(duration)
+}
+
+func (d *scanDurations) snapshot(target autoscan.Target) LatencySnapshot {
+	if d == nil {
+		return LatencySnapshot{}
+	}
+
+	d.mu.Lock()
+	l, ok := d.targets[autoscan.TargetName(target)]
+	d.mu.Unlock()
+
+	if !ok {
+		return LatencySnapshot{
+			Buckets: scanDurationBuckets,
+			Counts:  make([]uint64, len(scanDurationBuckets)),
+		}
+	}
+
+	return l.snapshot()
+}
+
+// ScanDuration returns a summary of the time the target took to handle a scan.
+// For targets such as Plex, this includes the HTTP round trip.
+func (p *Processor) ScanDuration(target autoscan.Target) LatencySnapshot {
+	return p.scanDurations.snapshot(target)
+}
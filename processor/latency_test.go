@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+func TestLatency(t *testing.T) {
+	l := newLatency(latencyBuckets)
+	for i := 1; i <= 100; i++ {
+		l.observe(time.Duration(i) * time.Second)
+	}
+
+	snapshot := l.snapshot()
+	if snapshot.Count != 100 {
+		t.Errorf("Expected 100 observations, got: %d", snapshot.Count)
+	}
+
+	if snapshot.Sum != 5050 {
+		t.Errorf("Expected a sum of 5050, got: %v", snapshot.Sum)
+	}
+
+	if snapshot.P50 != 50*time.Second || snapshot.P95 != 95*time.Second {
+		t.Errorf("Percentiles do not match: %v, %v", snapshot.P50, snapshot.P95)
+	}
+
+	if snapshot.Mean != 50500*time.Millisecond {
+		t.Errorf("Expected a mean of 50.5s, got: %v", snapshot.Mean)
+	}
+
+	// cumulative counts of the 1, 5, 15, 30, 60 and 120 second buckets
+	want := []uint64{1, 5, 15, 30, 60, 100}
+	if !reflect.DeepEqual(snapshot.Counts[:len(want)], want) {
+		t.Errorf("Bucket counts do not match: %v vs %v", snapshot.Counts[:len(want)], want)
+	}
+}
+
+func TestScanDurations(t *testing.T) {
+	d := newScanDurations()
+
+	fast := getMockTarget(t, mock.Config{Name: "fast"})
+	slow := getMockTarget(t, mock.Config{Name: "slow"})
+
+	d.observe(fast, 100*time.Millisecond)
+	d.observe(slow, 2*time.Second)
+	d.observe(slow, 4*time.Second)
+
+	if snapshot := d.snapshot(fast); snapshot.Count != 1 || snapshot.Mean != 100*time.Millisecond {
+		t.Errorf("Unexpected snapshot of the fast target: %+v", snapshot)
+	}
+
+	if snapshot := d.snapshot(slow); snapshot.Count != 2 || snapshot.Mean != 3*time.Second {
+		t.Errorf("Unexpected snapshot of the slow target: %+v", snapshot)
+	}
+
+	unknown := getMockTarget(t, mock.Config{Name: "unknown"})
+	if snapshot := d.snapshot(unknown); snapshot.Count != 0 || len(snapshot.Counts) != len(scanDurationBuckets) {
+		t.Errorf("Unexpected snapshot of an unknown target: %+v", snapshot)
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "retries" INTEGER NOT NULL DEFAULT 0
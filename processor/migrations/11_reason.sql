@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "reason" TEXT NOT NULL DEFAULT ""
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS failed (
+    "id" TEXT NOT NULL,
+    "scan_id" TEXT NOT NULL,
+    "folder" TEXT NOT NULL,
+    "priority" INTEGER NOT NULL,
+    "deep" BOOLEAN NOT NULL,
+    "immediate" BOOLEAN NOT NULL,
+    "deleted" BOOLEAN NOT NULL,
+    "targets" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "error" TEXT NOT NULL,
+    "time" DATETIME NOT NULL,
+    PRIMARY KEY(id)
+)
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE failed ADD COLUMN "files" INTEGER NOT NULL DEFAULT 0
\ No newline at end of file
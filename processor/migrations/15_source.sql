@@ -0,0 +1,4 @@
+ALTER TABLE scan ADD COLUMN "source" TEXT NOT NULL DEFAULT "";
+ALTER TABLE scan ADD COLUMN "media_type" TEXT NOT NULL DEFAULT "";
+ALTER TABLE failed ADD COLUMN "source" TEXT NOT NULL DEFAULT "";
+ALTER TABLE failed ADD COLUMN "media_type" TEXT NOT NULL DEFAULT ""
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS target_scan (
+    "target" TEXT NOT NULL,
+    "folder" TEXT NOT NULL,
+    "priority" INTEGER NOT NULL,
+    "time" DATETIME NOT NULL,
+    "deep" BOOLEAN NOT NULL,
+    "immediate" BOOLEAN NOT NULL,
+    "deleted" BOOLEAN NOT NULL,
+    "id" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "source" TEXT NOT NULL DEFAULT "",
+    "media_type" TEXT NOT NULL DEFAULT "",
+    "files" INTEGER NOT NULL,
+    "enqueued" DATETIME NOT NULL,
+    "retries" INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY(target, folder)
+)
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE scan ADD COLUMN "libraries" TEXT NOT NULL DEFAULT "";
+ALTER TABLE target_scan ADD COLUMN "libraries" TEXT NOT NULL DEFAULT ""
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "deep" BOOLEAN NOT NULL DEFAULT FALSE
@@ -0,0 +1,3 @@
+ALTER TABLE scan ADD COLUMN "key" TEXT NOT NULL DEFAULT '';
+UPDATE scan SET "key" = folder;
+CREATE INDEX IF NOT EXISTS scan_key ON scan ("key")
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "immediate" BOOLEAN NOT NULL DEFAULT FALSE
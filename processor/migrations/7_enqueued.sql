@@ -0,0 +1,2 @@
+ALTER TABLE scan ADD COLUMN "enqueued" DATETIME;
+UPDATE scan SET "enqueued" = time
@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "deleted" BOOLEAN NOT NULL DEFAULT FALSE
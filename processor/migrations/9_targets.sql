@@ -0,0 +1 @@
+ALTER TABLE scan ADD COLUMN "targets" TEXT NOT NULL DEFAULT ""
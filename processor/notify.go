@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// notifyVersion is the version of the notification payload,
+	// it is only raised for changes which break the existing fields.
+	notifyVersion = 1
+
+	// default amount of notifications which may be sent per minute
+	notifyLimit = 30
+	// amount of notifications which may be waiting to be sent
+	notifyQueueSize = 100
+)
+
+type NotifyConfig struct {
+	// URL of the webhook, e.g. of a Discord relay, which usually contains a secret token.
+	URL     string        `yaml:"url" autoscan:"secret"`
+	Limit   int           `yaml:"limit"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type notification struct {
+	Version   int    `json:"version"`
+	ID        string `json:"id"`
+	Folder    string `json:"folder"`
+	Target    string `json:"target"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration"`
+	Source    string `json:"source"`
+	Reason    string `json:"reason"`
+	MediaType string `json:"media_type"`
+	Files     int    `json:"files"`
+}
+
+type notifier struct {
+	url     string
+	client  *http.Client
+	limiter *rate.Limiter
+	queue   chan notification
+
+	// mu guards closed, the queue is closed once the notifier is closed.
+	mu     sync.RWMutex
+	closed bool
+
+	// done is closed once the worker has sent the queued notifications.
+	done chan struct{}
+}
+
+func newNotifier(c NotifyConfig) *notifier {
+	if c.URL == "" {
+		return nil
+	}
+
+	limit := c.Limit
+	if limit <= 0 {
+		limit = notifyLimit
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	n := &notifier{
+		url:     c.URL,
+		client:  &http.Client{Timeout: timeout},
+		limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(limit)), limit),
+		queue:   make(chan notification, notifyQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	go n.worker()
+
+	return n
+}
+
+// Notify queues a notification without blocking the caller.
+// Notifications exceeding the rate limit are dropped.
+func (n *notifier) Notify(msg notification) {
+	if n == nil {
+		return
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return
+	}
+
+	if !n.limiter.Allow() {
+		log.Debug().
+			Str("folder", msg.Folder).
+			Str("target", msg.Target).
+			Msg("Notification dropped due to rate limit")
+		return
+	}
+
+	select {
+	case n.queue <- msg:
+	default:
+		log.Debug().
+			Str("folder", msg.Folder).
+			Str("target", msg.Target).
+			Msg("Notification dropped due to full queue")
+	}
+}
+
+// Close stops accepting notifications and waits until the queued notifications have been sent.
+func (n *notifier) Close() {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	<-n.done
+}
+
+func (n *notifier) worker() {
+	defer close(n.done)
+
+	for msg := range n.queue {
+		if err := n.send(msg); err != nil {
+			log.Warn().
+				Err(err).
+				Str("folder", msg.Folder).
+				Str("target", msg.Target).
+				Msg("Failed sending notification")
+		}
+	}
+}
+
+func (n *notifier) send(msg notification) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encoding notification: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", n.url, bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("creating notification request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("notification request failed: %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+// notifyServer records the notifications it receives, responding with the status.
+type notifyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	received []notification
+}
+
+func newNotifyServer(t *testing.T, status int) *notifyServer {
+	s := &notifyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var msg notification
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("Failed decoding notification: %v", err)
+		}
+
+		s.mu.Lock()
+		s.received = append(s.received, msg)
+		s.mu.Unlock()
+
+		rw.WriteHeader(status)
+	}))
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *notifyServer) notifications() []notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]notification{}, s.received...)
+}
+
+func TestNotifier(t *testing.T) {
+	type Test struct {
+		Name   string
+		Status int
+		Limit  int
+		Sent   int
+		Want   int
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Sends the notifications",
+			Status: http.StatusNoContent,
+			Sent:   3,
+			Want:   3,
+		},
+		{
+			Name:   "Drops notifications exceeding the rate limit",
+			Status: http.StatusNoContent,
+			Limit:  2,
+			Sent:   5,
+			Want:   2,
+		},
+		{
+			Name:   "Failed notifications do not stop the notifier",
+			Status: http.StatusInternalServerError,
+			Sent:   3,
+			Want:   3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := newNotifyServer(t, tc.Status)
+			n := newNotifier(NotifyConfig{URL: server.URL, Limit: tc.Limit})
+
+			for i := 0; i < tc.Sent; i++ {
+				n.Notify(notification{ID: "id", Folder: "/Movies/Tenet (2020)", Target: "plex", Status: "success", Duration: "1s"})
+			}
+
+			// the queued notifications are sent before Close returns
+			n.Close()
+
+			received := server.notifications()
+			if len(received) != tc.Want {
+				t.Fatalf("Notifications do not match: %d vs %d", len(received), tc.Want)
+			}
+
+			want := notification{ID: "id", Folder: "/Movies/Tenet (2020)", Target: "plex", Status: "success", Duration: "1s"}
+			if !reflect.DeepEqual(received[0], want) {
+				t.Errorf("Payloads do not match\n%+v\nvs\n%+v", received[0], want)
+			}
+
+			// notifications after closing are dropped
+			n.Notify(want)
+			if received := server.notifications(); len(received) != tc.Want {
+				t.Errorf("Expected no notifications after closing, got: %d", len(received)-tc.Want)
+			}
+		})
+	}
+}
+
+func TestNotifierDisabled(t *testing.T) {
+	n := newNotifier(NotifyConfig{})
+	if n != nil {
+		t.Fatalf("Expected no notifier without a URL, got: %v", n)
+	}
+
+	n.Notify(notification{Folder: "/Movies/Tenet (2020)"})
+	n.Close()
+}
+
+func TestNotifyPayload(t *testing.T) {
+	now = time.Now
+	server := newNotifyServer(t, http.StatusNoContent)
+	proc := &Processor{store: getDatastore(t), notifier: newNotifier(NotifyConfig{URL: server.URL})}
+	target := getMockTarget(t, mock.Config{Name: "plex"})
+
+	scan := autoscan.Scan{
+		Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 1",
+		Time:      time.Now().UTC().Add(-1 * time.Minute),
+		ID:        "scan-id",
+		Reason:    "Sonarr import: Westworld S01E01",
+		Source:    "sonarr",
+		MediaType: "episode",
+		Files:     2,
+	}
+
+	if err := proc.Add(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	proc.Close()
+
+	received := server.notifications()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 notification, got: %v", received)
+	}
+
+	// the duration varies
+	received[0].Duration = ""
+
+	want := notification{
+		Version:   notifyVersion,
+		ID:        "scan-id",
+		Folder:    scan.Folder,
+		Target:    "plex",
+		Status:    "success",
+		Source:    "sonarr",
+		Reason:    "Sonarr import: Westworld S01E01",
+		MediaType: "episode",
+		Files:     2,
+	}
+
+	if !reflect.DeepEqual(received[0], want) {
+		t.Errorf("Payloads do not match\n%+v\nvs\n%+v", received[0], want)
+	}
+}
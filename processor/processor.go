@@ -2,48 +2,232 @@ package processor
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"sync/atomic"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+
 	"github.com/cloudbox/autoscan"
 	"github.com/cloudbox/autoscan/migrate"
-
-	"golang.org/x/sync/errgroup"
 )
 
 type Config struct {
 	Anchors    []string
 	MinimumAge time.Duration
+	ScanTTL    time.Duration
+	Analyze    bool
+
+	// QueueOrder is either QueueOrderFIFO (the default) or QueueOrderLIFO.
+	QueueOrder string
+	Notify     NotifyConfig
+	EventLog   EventLogConfig
+
+	// Dedup rewrites folders into the key used for deduplication.
+	Dedup []autoscan.Rewrite
+
+	// DedupScope is either DedupScopeFolder (the default) or DedupScopeLibrary.
+	DedupScope string
+
+	// TargetQueues gives every target a queue of its own, processed with ProcessTarget.
+	TargetQueues bool
 
 	Db *sql.DB
 	Mg *migrate.Migrator
 }
 
+// The queue orders in which scans of the same priority are dispatched.
+const (
+	// QueueOrderFIFO dispatches the oldest scans first.
+	QueueOrderFIFO = "fifo"
+
+	// QueueOrderLIFO dispatches the most recent scans first.
+	QueueOrderLIFO = "lifo"
+)
+
+// The scopes in which queued scans are deduplicated.
+const (
+	// DedupScopeFolder merges the scans of the same folder.
+	DedupScopeFolder = "folder"
+
+	// DedupScopeLibrary merges the scans of folders within the same libraries of the targets.
+	DedupScopeLibrary = "library"
+)
+
 func New(c Config) (*Processor, error) {
 	store, err := newDatastore(c.Db, c.Mg)
 	if err != nil {
 		return nil, err
 	}
 
+	store.dedupKey, err = autoscan.NewRewriter(c.Dedup)
+	if err != nil {
+		return nil, fmt.Errorf("dedup: %w", err)
+	}
+
+	switch c.QueueOrder {
+	case "", QueueOrderFIFO:
+	case QueueOrderLIFO:
+		store.lifo = true
+	default:
+		return nil, fmt.Errorf("invalid queue-order %q: must be %s or %s", c.QueueOrder, QueueOrderFIFO, QueueOrderLIFO)
+	}
+
+	switch c.DedupScope {
+	case "", DedupScopeFolder, DedupScopeLibrary:
+	default:
+		return nil, fmt.Errorf("invalid dedup-scope %q: must be %s or %s", c.DedupScope, DedupScopeFolder, DedupScopeLibrary)
+	}
+
+	events, err := newEventLog(c.EventLog)
+	if err != nil {
+		return nil, err
+	}
+
 	proc := &Processor{
-		anchors:    c.Anchors,
-		minimumAge: c.MinimumAge,
-		store:      store,
+		dedupScope:    c.DedupScope,
+		targetQueues:  c.TargetQueues,
+		anchors:       c.Anchors,
+		minimumAge:    c.MinimumAge,
+		scanTTL:       c.ScanTTL,
+		analyze:       c.Analyze,
+		store:         store,
+		notifier:      newNotifier(c.Notify),
+		events:        events,
+		history:       newHistory(historySize),
+		latency:       newLatency(latencyBuckets),
+		scanDurations: newScanDurations(),
+		targetErrors:  newTargetErrors(),
+		wake:          make(chan struct{}, 1),
 	}
 	return proc, nil
 }
 
 type Processor struct {
-	anchors    []string
-	minimumAge time.Duration
-	store      *datastore
-	processed  int64
+	dedupScope    string
+	targetQueues  bool
+	targetWake    targetWake
+	anchors       []string
+	minimumAge    time.Duration
+	scanTTL       time.Duration
+	analyze       bool
+	store         *datastore
+	notifier      *notifier
+	events        *eventLog
+	history       *history
+	latency       *latency
+	scanDurations *scanDurations
+	targetErrors  *targetErrors
+	wake          chan struct{}
+	counts        scanCounters
 }
 
 func (p *Processor) Add(scans ...autoscan.Scan) error {
-	return p.store.Upsert(scans)
+	immediate := false
+	for i := range scans {
+		if scans[i].ID == "" {
+			scans[i].ID = autoscan.NewScanID()
+		}
+
+		immediate = immediate || scans[i].Immediate
+	}
+
+	if err := p.store.Upsert(scans); err != nil {
+		return err
+	}
+
+	for _, scan := range scans {
+		p.event(eventEnqueued, scan, 0, 0, nil)
+	}
+
+	if immediate {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// SetTargets sets the targets whose libraries are recorded on the queued scans,
+// and used for the deduplication when scans are deduplicated by library.
+// Only targets which implement autoscan.LibraryNamer are used for the libraries.
+// Scans sent to any target which does not implement autoscan.LibraryMatcher are not merged by library.
+func (p *Processor) SetTargets(targets []autoscan.Target) {
+	namers := make(map[string]autoscan.LibraryNamer)
+	for _, target := range targets {
+		if n, ok := target.(autoscan.LibraryNamer); ok {
+			namers[autoscan.TargetName(target)] = n
+		}
+	}
+
+	p.store.setNamers(namers)
+
+	if p.dedupScope != DedupScopeLibrary {
+		return
+	}
+
+	matchers := make(map[string]autoscan.LibraryMatcher)
+	for _, target := range targets {
+		m, _ := target.(autoscan.LibraryMatcher)
+		matchers[autoscan.TargetName(target)] = m
+	}
+
+	p.store.setMatchers(matchers)
+}
+
+// Close sends the pending notifications, it should be called on shutdown.
+func (p *Processor) Close() {
+	p.notifier.Close()
+}
+
+// Sleep pauses for the given duration, or until an immediate scan is added.
+func (p *Processor) Sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-p.wake:
+	}
+}
+
+// Queue returns the queued scans in the order they are processed,
+// ignoring the minimum age.
+func (p *Processor) Queue() ([]autoscan.Scan, error) {
+	return p.store.GetQueue(0, -1, "")
+}
+
+// QueuePage returns at most limit queued scans in the order they are processed,
+// skipping the first offset scans, along with the total number of queued scans.
+// When a library is given, only the scans routed to that library are returned.
+func (p *Processor) QueuePage(offset, limit int, library string) ([]autoscan.Scan, int, error) {
+	total, err := p.store.GetQueueSize(library)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scans, err := p.store.GetQueue(offset, limit, library)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return scans, total, nil
+}
+
+// QueueOrder returns the order in which scans of the same priority are dispatched.
+func (p *Processor) QueueOrder() string {
+	if p.store.lifo {
+		return QueueOrderLIFO
+	}
+
+	return QueueOrderFIFO
 }
 
 // ScansRemaining returns the amount of scans remaining
@@ -51,9 +235,26 @@ func (p *Processor) ScansRemaining() (int, error) {
 	return p.store.GetScansRemaining()
 }
 
+// AnalysesRemaining returns the amount of deferred analyses remaining
+func (p *Processor) AnalysesRemaining() (int, error) {
+	return p.store.GetAnalysesRemaining()
+}
+
 // ScansProcessed returns the amount of scans processed
 func (p *Processor) ScansProcessed() int64 {
-	return atomic.LoadInt64(&p.processed)
+	return p.counts.snapshot().Processed
+}
+
+// ScansFailed returns the amount of scans which were dropped
+// as they could not be routed to a library
+func (p *Processor) ScansFailed() int64 {
+	return p.counts.snapshot().Failed
+}
+
+// ScansExpired returns the amount of scans which were dropped
+// as they exceeded the scan TTL
+func (p *Processor) ScansExpired() int64 {
+	return p.counts.snapshot().Expired
 }
 
 // CheckAvailability checks whether all targets are available.
@@ -64,27 +265,252 @@ func (p *Processor) CheckAvailability(targets []autoscan.Target) error {
 	for _, target := range targets {
 		target := target
 		g.Go(func() error {
-			return target.Available()
+			err := target.Available()
+			p.targetErrors.set(target, err)
+			return err
 		})
 	}
 
 	return g.Wait()
 }
 
+var errNoMatchingTargets = errors.New("no matching targets")
+
+// scanTargets returns the targets the scan should be sent to.
+func scanTargets(targets []autoscan.Target, scan autoscan.Scan) []autoscan.Target {
+	if len(scan.Targets) == 0 {
+		return targets
+	}
+
+	matching := make([]autoscan.Target, 0, len(scan.Targets))
+	for _, target := range targets {
+		name := autoscan.TargetName(target)
+		for _, want := range scan.Targets {
+			if name == want {
+				matching = append(matching, target)
+				break
+			}
+		}
+	}
+
+	return matching
+}
+
+func targetNames(targets []autoscan.Target) []string {
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, autoscan.TargetName(target))
+	}
+
+	return names
+}
+
+// dispatchGroups splits the targets into the unordered targets
+// and the groups of ordered targets sharing a dispatch order, lowest order first.
+func dispatchGroups(targets []autoscan.Target) ([]autoscan.Target, [][]autoscan.Target) {
+	unordered := make([]autoscan.Target, 0, len(targets))
+	byOrder := make(map[int][]autoscan.Target)
+	orders := make([]int, 0)
+
+	for _, target := range targets {
+		order := autoscan.DispatchOrder(target)
+		if order <= 0 {
+			unordered = append(unordered, target)
+			continue
+		}
+
+		if _, ok := byOrder[order]; !ok {
+			orders = append(orders, order)
+		}
+
+		byOrder[order] = append(byOrder[order], target)
+	}
+
+	sort.Ints(orders)
+	ordered := make([][]autoscan.Target, 0, len(orders))
+	for _, order := range orders {
+		ordered = append(ordered, byOrder[order])
+	}
+
+	return unordered, ordered
+}
+
+// callTargets sends the scan to the unordered targets concurrently,
+// while the ordered targets receive the scan one group after another.
+// The next group only receives the scan once the previous group accepted it.
 func (p *Processor) callTargets(targets []autoscan.Target, scan autoscan.Scan) error {
-	g := new(errgroup.Group)
+	unordered, ordered := dispatchGroups(targets)
+	errs := new(targetErrs)
+	wg := new(sync.WaitGroup)
+
+	if len(ordered) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, group := range ordered {
+				if err := p.callGroup(group, scan); err != nil {
+					errs.add(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for _, target := range unordered {
+		target := target
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.add(p.callTarget(target, scan))
+		}()
+	}
+
+	wg.Wait()
+	return errs.err()
+}
+
+// callGroup sends the scan to the targets concurrently.
+func (p *Processor) callGroup(targets []autoscan.Target, scan autoscan.Scan) error {
+	errs := new(targetErrs)
+	wg := new(sync.WaitGroup)
 
 	for _, target := range targets {
 		target := target
-		g.Go(func() error {
-			return target.Scan(scan)
-		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.add(p.callTarget(target, scan))
+		}()
 	}
 
-	return g.Wait()
+	wg.Wait()
+	return errs.err()
+}
+
+// targetErrs collects the errors of the targets a scan is sent to.
+type targetErrs struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (e *targetErrs) add(err error) {
+	if err == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errs = append(e.errs, err)
+}
+
+// err returns the error deciding what happens to the scan.
+// An unavailable target comes first, and a missing library comes last,
+// so the scan is only dropped for a missing library when it is not retried for another target.
+func (e *targetErrs) err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, err := range e.errs {
+		if errors.Is(err, autoscan.ErrTargetUnavailable) {
+			return err
+		}
+	}
+
+	var noLibrary, deferred error
+	for _, err := range e.errs {
+		switch {
+		case errors.Is(err, autoscan.ErrScanDeferred):
+			deferred = err
+		case !errors.Is(err, autoscan.ErrNoLibrary):
+			return err
+		case noLibrary == nil:
+			noLibrary = err
+		}
+	}
+
+	if noLibrary != nil {
+		return noLibrary
+	}
+
+	return deferred
+}
+
+func (p *Processor) callTarget(target autoscan.Target, scan autoscan.Scan) error {
+	start := time.Now()
+	err := target.Scan(scan)
+	duration := time.Since(start)
+
+	p.scanDurations.observe(target, duration)
+	if errors.Is(err, autoscan.ErrScanDeferred) {
+		p.targetErrors.set(target, nil)
+	} else {
+		p.targetErrors.set(target, err)
+	}
+
+	p.notify(target, scan, duration, err)
+	return err
+}
+
+func (p *Processor) notify(target autoscan.Target, scan autoscan.Scan, duration time.Duration, err error) {
+	msg := notification{
+		Version:   notifyVersion,
+		ID:        scan.ID,
+		Folder:    scan.Folder,
+		Target:    autoscan.TargetName(target),
+		Status:    "success",
+		Duration:  duration.String(),
+		Source:    scan.Source,
+		Reason:    scan.Reason,
+		MediaType: scan.MediaType,
+		Files:     scan.Files,
+	}
+
+	switch {
+	case errors.Is(err, autoscan.ErrScanDeferred):
+		msg.Status = "deferred"
+	case err != nil:
+		msg.Status = "failed"
+		msg.Error = err.Error()
+	}
+
+	p.notifier.Notify(msg)
+}
+
+// expire drops all scans which have been in the queue for longer than the scan TTL.
+func (p *Processor) expire() error {
+	if p.scanTTL <= 0 {
+		return nil
+	}
+
+	scans, err := p.store.GetExpired(p.scanTTL)
+	if err != nil {
+		return err
+	}
+
+	for _, scan := range scans {
+		if err := p.fail(scan, errScanExpired); err != nil {
+			return err
+		}
+
+		p.counts.add(ScanCounts{Expired: 1})
+		p.record(scan, strings.Join(scan.Targets, ", "), "expired", 0, 0, nil)
+		log.Warn().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Time("time", scan.Time).
+			Stringer("ttl", p.scanTTL).
+			Msg("Scan expired, moved to failed scans")
+	}
+
+	return nil
 }
 
 func (p *Processor) Process(targets []autoscan.Target) error {
+	if err := p.expire(); err != nil {
+		return err
+	}
+
 	scan, err := p.store.GetAvailableScan(p.minimumAge)
 	if err != nil {
 		return err
@@ -97,9 +523,90 @@ func (p *Processor) Process(targets []autoscan.Target) error {
 		}
 	}
 
+	// Time spent in the queue
+	enqueued, err := p.store.GetEnqueued(scan)
+	if err != nil {
+		return err
+	}
+
+	queued := now().Sub(enqueued)
+
+	// Failed attempts of the scan so far
+	retries, err := p.store.GetRetries(scan)
+	if err != nil {
+		return err
+	}
+
+	// Only send the scan to the targets it was requested for
+	targets = scanTargets(targets, scan)
+	if len(targets) == 0 {
+		if err := p.fail(scan, errNoMatchingTargets); err != nil {
+			return err
+		}
+
+		p.counts.add(ScanCounts{Failed: 1})
+		p.record(scan, strings.Join(scan.Targets, ", "), "failed", retries, 0, errNoMatchingTargets)
+		log.Warn().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Strs("targets", scan.Targets).
+			Msg("No targets match the scan, moved to failed scans")
+		return nil
+	}
+
+	dispatched := scan
+	dispatched.Targets = targetNames(targets)
+
+	// The targets are sent the scan by the workers of their queues
+	if p.targetQueues {
+		if err := p.enqueueTargets(targets, scan, enqueued); err != nil {
+			return err
+		}
+
+		log.Debug().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Strs("targets", dispatched.Targets).
+			Msg("Added scan to the queues of the targets")
+
+		p.event(eventDispatched, dispatched, retries, 0, nil)
+		return nil
+	}
+
+	log.Info().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("reason", scan.Reason).
+		Int("files", scan.Files).
+		Strs("targets", dispatched.Targets).
+		Msg("Sending scan to targets")
+
+	p.event(eventDispatched, dispatched, retries, 0, nil)
+
+	// No Library -> drop the scan and count it as a failure
 	// Fatal or Target Unavailable -> return original error
+	start := time.Now()
 	err = p.callTargets(targets, scan)
-	if err != nil {
+	duration := time.Since(start)
+	deferred := errors.Is(err, autoscan.ErrScanDeferred)
+	switch {
+	case errors.Is(err, autoscan.ErrNoLibrary):
+		if failErr := p.fail(scan, err); failErr != nil {
+			return failErr
+		}
+
+		p.counts.add(ScanCounts{Failed: 1})
+		p.record(scan, strings.Join(dispatched.Targets, ", "), "failed", retries, duration, err)
+		return err
+	case deferred:
+		// a target sends the scan later, e.g. once the cooldown of the library has elapsed
+	case err != nil:
+		// the scan is kept in the queue and retried later
+		if incErr := p.store.IncrementRetries(scan); incErr != nil {
+			return incErr
+		}
+
+		p.record(scan, strings.Join(dispatched.Targets, ", "), "failed", retries, duration, err)
 		return err
 	}
 
@@ -108,10 +615,83 @@ func (p *Processor) Process(targets []autoscan.Target) error {
 		return err
 	}
 
-	atomic.AddInt64(&p.processed, 1)
+	// Defer the analysis until the processor is idle
+	if p.analyze && hasAnalyzer(targets) {
+		if err := p.store.UpsertAnalysis(scan); err != nil {
+			return err
+		}
+	}
+
+	p.latency.observe(queued)
+	if deferred {
+		p.record(scan, strings.Join(dispatched.Targets, ", "), "deferred", retries, duration, nil)
+		return nil
+	}
+
+	p.counts.add(ScanCounts{Processed: 1})
+	p.record(scan, strings.Join(dispatched.Targets, ", "), "success", retries, duration, nil)
+	if retries > 0 {
+		log.Info().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Int("retries", retries).
+			Msgf("Scan succeeded after %s", formatRetries(retries))
+	}
+
 	return nil
 }
 
+// Analyze processes a single deferred analysis.
+// It should only be called when no scans are available.
+func (p *Processor) Analyze(targets []autoscan.Target) error {
+	scan, err := p.store.GetAvailableAnalysis()
+	if err != nil {
+		return err
+	}
+
+	// Check whether all anchors are present
+	for _, anchor := range p.anchors {
+		if !fileExists(anchor) {
+			return fmt.Errorf("%s: %w", anchor, autoscan.ErrAnchorUnavailable)
+		}
+	}
+
+	g := new(errgroup.Group)
+
+	for _, target := range targets {
+		analyzer, ok := target.(autoscan.Analyzer)
+		if !ok {
+			continue
+		}
+
+		g.Go(func() error {
+			return analyzer.Analyze(scan)
+		})
+	}
+
+	// Target Unavailable -> keep the analysis for a later attempt
+	err = g.Wait()
+	if errors.Is(err, autoscan.ErrTargetUnavailable) {
+		return err
+	}
+
+	if delErr := p.store.DeleteAnalysis(scan); delErr != nil {
+		return delErr
+	}
+
+	return err
+}
+
+func hasAnalyzer(targets []autoscan.Target) bool {
+	for _, target := range targets {
+		if _, ok := target.(autoscan.Analyzer); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
 var fileExists = func(fileName string) bool {
 	info, err := os.Stat(fileName)
 	if err != nil {
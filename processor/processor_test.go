@@ -0,0 +1,459 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+func getMockTarget(t *testing.T, c mock.Config) *mock.Target {
+	target, err := mock.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+func TestProcess(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t)}
+
+	target := getMockTarget(t, mock.Config{
+		Rewrite: []autoscan.Rewrite{{
+			From: "/mnt/unionfs/Media/",
+			To:   "/data/",
+		}},
+	})
+
+	scans := []autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Priority: 1, Time: time.Now().UTC().Add(-2 * time.Minute)},
+		{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Priority: 5, Time: time.Now().UTC().Add(-1 * time.Minute)},
+	}
+
+	if err := proc.Add(scans...); err != nil {
+		t.Fatal(err)
+	}
+
+	for range scans {
+		if err := proc.Process([]autoscan.Target{target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := proc.Process([]autoscan.Target{target}); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatalf("Expected ErrNoScans, got: %v", err)
+	}
+
+	recorded := target.Recorded()
+	if len(recorded) != len(scans) {
+		t.Fatalf("Expected %d scans, got: %d", len(scans), len(recorded))
+	}
+
+	// highest priority first
+	wantFolders := []string{"/data/Movies/Parasite (2019)", "/data/Movies/Interstellar (2014)"}
+	for i, want := range wantFolders {
+		if recorded[i].Folder != want {
+			t.Errorf("Folders do not match: %s vs %s", recorded[i].Folder, want)
+		}
+
+		if recorded[i].ID == "" {
+			t.Errorf("Expected scan %s to have an ID", recorded[i].Folder)
+		}
+	}
+
+	if proc.ScansProcessed() != int64(len(scans)) {
+		t.Errorf("Expected %d processed scans, got: %d", len(scans), proc.ScansProcessed())
+	}
+}
+
+func TestProcessTargets(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t)}
+
+	plex := getMockTarget(t, mock.Config{Name: "plex"})
+	plex4k := getMockTarget(t, mock.Config{Name: "plex-4k"})
+	targets := []autoscan.Target{plex, plex4k}
+
+	scans := []autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies 4K/Interstellar (2014)", Priority: 2, Time: time.Now().UTC().Add(-1 * time.Minute), Targets: []string{"plex-4k"}},
+		{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Priority: 1, Time: time.Now().UTC().Add(-1 * time.Minute)},
+		{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", Time: time.Now().UTC().Add(-1 * time.Minute), Targets: []string{"emby"}},
+	}
+
+	if err := proc.Add(scans...); err != nil {
+		t.Fatal(err)
+	}
+
+	for range scans {
+		if err := proc.Process(targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(plex.Recorded()) != 1 || plex.Recorded()[0].Folder != scans[1].Folder {
+		t.Errorf("Expected plex to only receive the untargeted scan, got: %v", plex.Recorded())
+	}
+
+	if len(plex4k.Recorded()) != 2 {
+		t.Errorf("Expected plex-4k to receive 2 scans, got: %v", plex4k.Recorded())
+	}
+
+	if proc.ScansFailed() != 1 {
+		t.Errorf("Expected the scan without matching targets to fail, got: %d", proc.ScansFailed())
+	}
+}
+
+func TestDispatchOrder(t *testing.T) {
+	proc := &Processor{}
+
+	unordered := getMockTarget(t, mock.Config{Name: "emby"})
+	primary := getMockTarget(t, mock.Config{Name: "plex", DispatchOrder: 1})
+	secondary := getMockTarget(t, mock.Config{Name: "plex-2", DispatchOrder: 2})
+	secondary4k := getMockTarget(t, mock.Config{Name: "plex-4k", DispatchOrder: 2})
+	targets := []autoscan.Target{secondary, unordered, secondary4k, primary}
+
+	gotUnordered, gotOrdered := dispatchGroups(targets)
+	if !reflect.DeepEqual(targetNames(gotUnordered), []string{"emby"}) {
+		t.Errorf("Unordered targets do not match: %v vs [emby]", targetNames(gotUnordered))
+	}
+
+	wantOrdered := [][]string{{"plex"}, {"plex-2", "plex-4k"}}
+	if len(gotOrdered) != len(wantOrdered) {
+		t.Fatalf("Dispatch groups do not match: %v vs %v", gotOrdered, wantOrdered)
+	}
+
+	for i, group := range gotOrdered {
+		if !reflect.DeepEqual(targetNames(group), wantOrdered[i]) {
+			t.Errorf("Dispatch groups do not match: %v vs %v", targetNames(group), wantOrdered[i])
+		}
+	}
+
+	// the secondary targets only receive the scan once the primary accepted it
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)"}
+	primary.SetScanError(autoscan.ErrTargetUnavailable)
+
+	if err := proc.callTargets(targets, scan); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Expected the error of the primary, got: %v", err)
+	}
+
+	if len(secondary.Recorded()) != 0 || len(secondary4k.Recorded()) != 0 {
+		t.Errorf("Expected the secondary targets to be skipped, got: %v and %v", secondary.Recorded(), secondary4k.Recorded())
+	}
+
+	if len(unordered.Recorded()) != 1 {
+		t.Errorf("Expected the unordered target to receive the scan, got: %v", unordered.Recorded())
+	}
+
+	primary.SetScanError(nil)
+	if err := proc.callTargets(targets, scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secondary.Recorded()) != 1 || len(secondary4k.Recorded()) != 1 {
+		t.Errorf("Expected the secondary targets to receive the scan, got: %v and %v", secondary.Recorded(), secondary4k.Recorded())
+	}
+}
+
+func TestProcessUnavailable(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t), history: newHistory(historySize)}
+
+	target := getMockTarget(t, mock.Config{
+		ScanError: fmt.Errorf("connection refused: %w", autoscan.ErrTargetUnavailable),
+	})
+
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Time: time.Now().UTC().Add(-1 * time.Minute)}
+	if err := proc.Add(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process([]autoscan.Target{target}); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Expected ErrTargetUnavailable, got: %v", err)
+	}
+
+	remaining, err := proc.ScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 1 {
+		t.Errorf("Expected the scan to be kept, remaining: %d", remaining)
+	}
+
+	// retry once the target is back
+	target.SetScanError(nil)
+	if err := proc.Process([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.Recorded()) != 2 {
+		t.Errorf("Expected the scan to be sent twice, got: %d", len(target.Recorded()))
+	}
+
+	history := proc.History()
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 history entries, got: %v", history)
+	}
+
+	if history[0].Retries != 1 || history[0].StatusText() != "success after 1 retry" {
+		t.Errorf("Expected the success after 1 retry, got: %s", history[0].StatusText())
+	}
+
+	if history[1].Retries != 0 || history[1].StatusText() != "failed" {
+		t.Errorf("Expected the first attempt to fail without retries, got: %s", history[1].StatusText())
+	}
+}
+
+func TestProcessDeferred(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t), history: newHistory(historySize)}
+
+	target := getMockTarget(t, mock.Config{
+		ScanError: autoscan.ErrScanDeferred,
+	})
+
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1", Time: time.Now().UTC().Add(-1 * time.Minute)}
+	if err := proc.Add(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, err := proc.ScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 0 {
+		t.Errorf("Expected the scan to be removed from the queue, remaining: %d", remaining)
+	}
+
+	if processed := proc.ScansProcessed(); processed != 0 {
+		t.Errorf("Expected the deferred scan not to be counted as processed, got: %d", processed)
+	}
+
+	history := proc.History()
+	if len(history) != 1 || history[0].Status != "deferred" {
+		t.Errorf("Expected the scan to be recorded as deferred, got: %v", history)
+	}
+}
+
+func TestProcessNoLibrary(t *testing.T) {
+	type Test struct {
+		Name          string
+		Errors        []error
+		WantErr       error
+		WantRemaining int
+		WantFailed    int64
+	}
+
+	noLibrary := fmt.Errorf("no library: %w", autoscan.ErrNoLibrary)
+	unavailable := fmt.Errorf("connection refused: %w", autoscan.ErrTargetUnavailable)
+	unexpected := errors.New("unexpected")
+
+	var testCases = []Test{
+		{
+			Name:       "No library",
+			Errors:     []error{noLibrary},
+			WantErr:    autoscan.ErrNoLibrary,
+			WantFailed: 1,
+		},
+		{
+			Name:       "No library of one target",
+			Errors:     []error{noLibrary, nil},
+			WantErr:    autoscan.ErrNoLibrary,
+			WantFailed: 1,
+		},
+		{
+			Name:          "No library and an unavailable target",
+			Errors:        []error{noLibrary, unavailable},
+			WantErr:       autoscan.ErrTargetUnavailable,
+			WantRemaining: 1,
+		},
+		{
+			Name:          "Unavailable target and no library",
+			Errors:        []error{unavailable, noLibrary},
+			WantErr:       autoscan.ErrTargetUnavailable,
+			WantRemaining: 1,
+		},
+		{
+			Name:          "No library and an unexpected error",
+			Errors:        []error{noLibrary, unexpected},
+			WantErr:       unexpected,
+			WantRemaining: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			now = time.Now
+			proc := &Processor{store: getDatastore(t), history: newHistory(historySize)}
+
+			targets := make([]autoscan.Target, 0, len(tc.Errors))
+			for i, err := range tc.Errors {
+				targets = append(targets, getMockTarget(t, mock.Config{Name: fmt.Sprintf("target-%d", i), ScanError: err}))
+			}
+
+			scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", Time: time.Now().UTC().Add(-1 * time.Minute)}
+			if err := proc.Add(scan); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := proc.Process(targets); !errors.Is(err, tc.WantErr) {
+				t.Fatalf("Errors do not match: %v vs %v", err, tc.WantErr)
+			}
+
+			remaining, err := proc.ScansRemaining()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if remaining != tc.WantRemaining {
+				t.Errorf("Remaining scans do not match: %d vs %d", remaining, tc.WantRemaining)
+			}
+
+			if proc.ScansFailed() != tc.WantFailed {
+				t.Errorf("Failed scans do not match: %d vs %d", proc.ScansFailed(), tc.WantFailed)
+			}
+		})
+	}
+}
+
+func TestCheckAvailability(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t)}
+
+	target := getMockTarget(t, mock.Config{
+		Available: fmt.Errorf("offline: %w", autoscan.ErrTargetUnavailable),
+	})
+
+	if err := proc.CheckAvailability([]autoscan.Target{target}); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Expected ErrTargetUnavailable, got: %v", err)
+	}
+
+	target.SetAvailable(nil)
+	if err := proc.CheckAvailability([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastError(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t), targetErrors: newTargetErrors()}
+
+	target := getMockTarget(t, mock.Config{
+		Available: fmt.Errorf("offline: %w", autoscan.ErrTargetUnavailable),
+	})
+
+	if _, ok := proc.LastError(target); ok {
+		t.Fatal("Expected no error before the target was called")
+	}
+
+	_ = proc.CheckAvailability([]autoscan.Target{target})
+
+	lastErr, ok := proc.LastError(target)
+	if !ok || lastErr.Error != "offline: target unavailable" {
+		t.Fatalf("Expected the availability error, got: %v", lastErr)
+	}
+
+	target.SetAvailable(nil)
+	if err := proc.CheckAvailability([]autoscan.Target{target}); err != nil {
+		t.Fatal(err)
+	}
+
+	if lastErr, ok := proc.LastError(target); ok {
+		t.Errorf("Expected the error to be cleared, got: %v", lastErr)
+	}
+}
+
+func TestFailedScans(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t)}
+	targets := []autoscan.Target{getMockTarget(t, mock.Config{Name: "plex"})}
+
+	scan := autoscan.Scan{
+		Folder:  "/mnt/unionfs/Media/Movies/Tenet (2020)",
+		Time:    time.Now().UTC().Add(-1 * time.Minute),
+		Targets: []string{"emby"},
+		Reason:  "manual",
+		ID:      "scan-id",
+	}
+
+	if err := proc.Add(scan, autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: scan.Time, Targets: scan.Targets}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := proc.Process(targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := proc.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 2 {
+		t.Fatalf("Expected 2 failed scans, got: %v", failed)
+	}
+
+	var tenet FailedScan
+	for _, f := range failed {
+		if f.Folder == scan.Folder {
+			tenet = f
+		}
+	}
+
+	if tenet.ScanID != "scan-id" || tenet.Reason != "manual" || tenet.Error != errNoMatchingTargets.Error() {
+		t.Errorf("Failed scan does not match: %+v", tenet)
+	}
+
+	retried, err := proc.RetryFailed(tenet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retried.Folder != scan.Folder || retried.ID != "scan-id" || len(retried.Targets) != 1 {
+		t.Errorf("Retried scan does not match: %+v", retried)
+	}
+
+	queued, err := proc.Queue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queued) != 1 || queued[0].Folder != scan.Folder {
+		t.Errorf("Expected the retried scan to be queued, got: %v", queued)
+	}
+
+	for _, f := range failed {
+		if f.ID == tenet.ID {
+			continue
+		}
+
+		if err := proc.DiscardFailed(f.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if failed, _ := proc.Failed(); len(failed) != 0 {
+		t.Errorf("Expected no failed scans, got: %v", failed)
+	}
+
+	if _, err := proc.RetryFailed(tenet.ID); !errors.Is(err, ErrFailedScanNotFound) {
+		t.Errorf("Expected ErrFailedScanNotFound, got: %v", err)
+	}
+
+	if err := proc.DiscardFailed(tenet.ID); !errors.Is(err, ErrFailedScanNotFound) {
+		t.Errorf("Expected ErrFailedScanNotFound, got: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// A TargetError describes the most recent error returned by a target.
+type TargetError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// targetErrors keeps the most recent error of every target by name,
+// until the target succeeds again.
+type targetErrors struct {
+	mu     sync.Mutex
+	errors map[string]TargetError
+}
+
+func newTargetErrors() *targetErrors {
+	return &targetErrors{
+		errors: make(map[string]TargetError),
+	}
+}
+
+func (e *targetErrors) set(target autoscan.Target, err error) {
+	if e == nil {
+		return
+	}
+
+	name := autoscan.TargetName(target)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err == nil {
+		delete(e.errors, name)
+		return
+	}
+
+	e.errors[name] = TargetError{
+		Error: err.Error(),
+		Time:  time.Now(),
+	}
+}
+
+func (e *targetErrors) get(target autoscan.Target) (TargetError, bool) {
+	if e == nil {
+		return TargetError{}, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	lastErr, ok := e.errors[autoscan.TargetName(target)]
+	return lastErr, ok
+}
+
+// LastError returns the most recent scan or availability error of the target.
+// The error is cleared once the target succeeds again.
+func (p *Processor) LastError(target autoscan.Target) (TargetError, bool) {
+	return p.targetErrors.get(target)
+}
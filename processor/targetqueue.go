@@ -0,0 +1,387 @@
+package processor
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// targetWake wakes the workers of the target queues once scans are added to their queue.
+type targetWake struct {
+	mu    sync.Mutex
+	chans map[string]chan struct{}
+}
+
+func (w *targetWake) get(name string) chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.chans == nil {
+		w.chans = make(map[string]chan struct{})
+	}
+
+	ch, ok := w.chans[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		w.chans[name] = ch
+	}
+
+	return ch
+}
+
+func (w *targetWake) wake(name string) {
+	select {
+	case w.get(name) <- struct{}{}:
+	default:
+	}
+}
+
+// TargetQueues returns whether every target has a queue of its own,
+// which is processed with ProcessTarget.
+func (p *Processor) TargetQueues() bool {
+	return p.targetQueues
+}
+
+// TargetQueued returns the number of scans in the queue of every target, by target name.
+func (p *Processor) TargetQueued() (map[string]int, error) {
+	return p.store.GetTargetScansRemaining()
+}
+
+// SleepTarget pauses for the given duration, or until a scan is added to the queue of the target.
+func (p *Processor) SleepTarget(target autoscan.Target, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-p.targetWake.get(autoscan.TargetName(target)):
+	}
+}
+
+// enqueueTargets moves the scan from the queue to the queues of the targets.
+func (p *Processor) enqueueTargets(targets []autoscan.Target, scan autoscan.Scan, enqueued time.Time) error {
+	names := targetNames(targets)
+	if err := p.store.FanOut(scan, names, enqueued); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		p.targetWake.wake(name)
+	}
+
+	return nil
+}
+
+// ProcessTarget sends the next scan in the queue of the target to the target.
+// Scans are added to the queue of the target by Process once their minimum age has passed.
+func (p *Processor) ProcessTarget(target autoscan.Target) error {
+	name := autoscan.TargetName(target)
+	if err := p.expireTarget(name); err != nil {
+		return err
+	}
+
+	scan, enqueued, retries, err := p.store.GetAvailableTargetScan(name, p.store.lifo)
+	if err != nil {
+		return err
+	}
+
+	// Check whether all anchors are present
+	for _, anchor := range p.anchors {
+		if !fileExists(anchor) {
+			return fmt.Errorf("%s: %w", anchor, autoscan.ErrAnchorUnavailable)
+		}
+	}
+
+	queued := now().Sub(enqueued)
+
+	log.Info().
+		Str("id", scan.ID).
+		Str("path", scan.Folder).
+		Str("reason", scan.Reason).
+		Int("files", scan.Files).
+		Str("target", name).
+		Msg("Sending scan to target")
+
+	start := time.Now()
+	err = p.callTarget(target, scan)
+	duration := time.Since(start)
+	switch {
+	case errors.Is(err, autoscan.ErrNoLibrary):
+		if failErr := p.store.FailTarget(name, scan, autoscan.NewScanID(), err); failErr != nil {
+			return failErr
+		}
+
+		p.counts.add(ScanCounts{Failed: 1})
+		p.record(scan, name, "failed", retries, duration, err)
+		return err
+	case errors.Is(err, autoscan.ErrScanDeferred):
+		// the target sends the scan later, e.g. once the cooldown of the library has elapsed
+	case err != nil:
+		// the scan is kept in the queue of the target and retried later
+		if incErr := p.store.IncrementTargetRetries(name, scan); incErr != nil {
+			return incErr
+		}
+
+		p.record(scan, name, "failed", retries, duration, err)
+		return err
+	}
+
+	if err := p.store.DeleteTargetScan(name, scan); err != nil {
+		return err
+	}
+
+	if _, ok := target.(autoscan.Analyzer); ok && p.analyze {
+		if err := p.store.UpsertAnalysis(scan); err != nil {
+			return err
+		}
+	}
+
+	p.latency.observe(queued)
+	if errors.Is(err, autoscan.ErrScanDeferred) {
+		p.record(scan, name, "deferred", retries, duration, nil)
+		return nil
+	}
+
+	p.counts.add(ScanCounts{Processed: 1})
+	p.record(scan, name, "success", retries, duration, nil)
+	if retries > 0 {
+		log.Info().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Str("target", name).
+			Int("retries", retries).
+			Msgf("Scan succeeded after %s", formatRetries(retries))
+	}
+
+	return nil
+}
+
+// expireTarget drops the scans which have been in the queue of the target for longer than the scan TTL.
+func (p *Processor) expireTarget(name string) error {
+	if p.scanTTL <= 0 {
+		return nil
+	}
+
+	scans, err := p.store.GetExpiredTarget(name, p.scanTTL)
+	if err != nil {
+		return err
+	}
+
+	for _, scan := range scans {
+		if err := p.store.FailTarget(name, scan, autoscan.NewScanID(), errScanExpired); err != nil {
+			return err
+		}
+
+		p.counts.add(ScanCounts{Expired: 1})
+		p.record(scan, name, "expired", 0, 0, nil)
+		log.Warn().
+			Str("id", scan.ID).
+			Str("path", scan.Folder).
+			Str("target", name).
+			Time("time", scan.Time).
+			Stringer("ttl", p.scanTTL).
+			Msg("Scan expired, moved to failed scans")
+	}
+
+	return nil
+}
+
+const sqlUpsertTargetScan = `
+INSERT INTO target_scan (target, folder, priority, time, deep, immediate, deleted, id, reason, source, media_type, files, enqueued, libraries)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (target, folder) DO UPDATE SET
+	priority = MAX(excluded.priority, target_scan.priority),
+	time = excluded.time,
+	deep = MAX(excluded.deep, target_scan.deep),
+	immediate = MAX(excluded.immediate, target_scan.immediate),
+	deleted = MAX(excluded.deleted, target_scan.deleted),
+	reason = CASE WHEN excluded.reason = '' THEN target_scan.reason ELSE excluded.reason END,
+	source = CASE WHEN excluded.source = '' THEN target_scan.source ELSE excluded.source END,
+	media_type = CASE WHEN excluded.media_type = '' THEN target_scan.media_type ELSE excluded.media_type END,
+	files = target_scan.files + excluded.files,
+	libraries = excluded.libraries
+`
+
+// FanOut moves the scan from the queue to the queues of the targets with the given names.
+// Scans of a folder which is still queued for a target are merged.
+func (store *datastore) FanOut(scan autoscan.Scan, targets []string, enqueued time.Time) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return fmt.Errorf("fan out: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	for _, target := range targets {
+		_, err = tx.Exec(sqlUpsertTargetScan, target, scan.Folder, scan.Priority, scan.Time, scan.Deep, scan.Immediate, scan.Deleted,
+			scan.ID, scan.Reason, scan.Source, scan.MediaType, scan.Files, enqueued, encodeNames(scan.Libraries))
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		_, err = tx.Exec(sqlDelete, scan.Folder)
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		return fmt.Errorf("fan out: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return tx.Commit()
+}
+
+const sqlGetAvailableTargetScan = `
+SELECT folder, priority, time, deep, immediate, deleted, id, reason, source, media_type, files, libraries, enqueued, retries FROM target_scan
+WHERE target = ?
+ORDER BY immediate DESC, priority DESC, time ASC
+LIMIT 1
+`
+
+const sqlGetAvailableTargetScanLIFO = `
+SELECT folder, priority, time, deep, immediate, deleted, id, reason, source, media_type, files, libraries, enqueued, retries FROM target_scan
+WHERE target = ?
+ORDER BY immediate DESC, priority DESC, time DESC
+LIMIT 1
+`
+
+// GetAvailableTargetScan returns the next scan in the queue of the target,
+// along with the time it was first added to the queue and the number of failed attempts.
+func (store *datastore) GetAvailableTargetScan(target string, lifo bool) (autoscan.Scan, time.Time, int, error) {
+	query := sqlGetAvailableTargetScan
+	if lifo {
+		query = sqlGetAvailableTargetScanLIFO
+	}
+
+	scan := autoscan.Scan{}
+	var libraries string
+	var enqueued time.Time
+	var retries int
+	err := store.QueryRow(query, target).Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted,
+		&scan.ID, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries, &enqueued, &retries)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return scan, enqueued, retries, autoscan.ErrNoScans
+	case err != nil:
+		return scan, enqueued, retries, fmt.Errorf("get target scan: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	scan.Libraries = decodeNames(libraries)
+	return scan, enqueued, retries, nil
+}
+
+const sqlGetExpiredTarget = `
+SELECT folder, priority, time, deep, immediate, deleted, id, reason, source, media_type, files, libraries FROM target_scan
+WHERE target = ? AND time < ?
+`
+
+func (store *datastore) GetExpiredTarget(target string, ttl time.Duration) (scans []autoscan.Scan, err error) {
+	rows, err := store.Query(sqlGetExpiredTarget, target, now().Add(-1*ttl))
+	if err != nil {
+		return scans, fmt.Errorf("get expired target scans: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		scan := autoscan.Scan{}
+		var libraries string
+		err = rows.Scan(&scan.Folder, &scan.Priority, &scan.Time, &scan.Deep, &scan.Immediate, &scan.Deleted, &scan.ID, &scan.Reason, &scan.Source, &scan.MediaType, &scan.Files, &libraries)
+		if err != nil {
+			return scans, fmt.Errorf("get expired target scans: %s: %w", err, autoscan.ErrFatal)
+		}
+
+		scan.Libraries = decodeNames(libraries)
+		scans = append(scans, scan)
+	}
+
+	return scans, rows.Err()
+}
+
+const sqlGetTargetScansRemaining = `
+SELECT target, COUNT(folder) FROM target_scan
+GROUP BY target
+`
+
+// GetTargetScansRemaining returns the number of scans in the queue of every target.
+func (store *datastore) GetTargetScansRemaining() (map[string]int, error) {
+	rows, err := store.Query(sqlGetTargetScansRemaining)
+	if err != nil {
+		return nil, fmt.Errorf("get remaining target scans: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	defer rows.Close()
+	remaining := make(map[string]int)
+	for rows.Next() {
+		var target string
+		var n int
+		if err := rows.Scan(&target, &n); err != nil {
+			return nil, fmt.Errorf("get remaining target scans: %v: %w", err, autoscan.ErrFatal)
+		}
+
+		remaining[target] = n
+	}
+
+	return remaining, rows.Err()
+}
+
+const sqlIncrementTargetRetries = `
+UPDATE target_scan SET retries = retries + 1
+WHERE target = ? AND folder = ?
+`
+
+// IncrementTargetRetries counts a failed attempt of the scan of the target, which is retried later.
+func (store *datastore) IncrementTargetRetries(target string, scan autoscan.Scan) error {
+	if _, err := store.Exec(sqlIncrementTargetRetries, target, scan.Folder); err != nil {
+		return fmt.Errorf("increment target retries: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+const sqlDeleteTargetScan = `
+DELETE FROM target_scan WHERE target = ? AND folder = ?
+`
+
+func (store *datastore) DeleteTargetScan(target string, scan autoscan.Scan) error {
+	if _, err := store.Exec(sqlDeleteTargetScan, target, scan.Folder); err != nil {
+		return fmt.Errorf("delete target scan: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return nil
+}
+
+// FailTarget moves the scan from the queue of the target to the failed scans.
+// The failed scan is restricted to the target, so a retry only sends it to the target.
+func (store *datastore) FailTarget(target string, scan autoscan.Scan, id string, scanErr error) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return fmt.Errorf("fail target: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	if _, err = tx.Exec(sqlDeleteTargetScan, target, scan.Folder); err == nil {
+		_, err = tx.Exec(sqlInsertFailed, id, scan.ID, scan.Folder, scan.Priority, scan.Deep, scan.Immediate, scan.Deleted,
+			encodeNames([]string{target}), scan.Reason, scan.Source, scan.MediaType, scan.Files, scanErr.Error(), now())
+	}
+
+	if err == nil {
+		_, err = tx.Exec(sqlPruneFailed, maxFailedScans)
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		return fmt.Errorf("fail target: %s: %w", err, autoscan.ErrFatal)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/targets/mock"
+)
+
+func TestTargetQueues(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t), history: newHistory(historySize), targetQueues: true}
+
+	plex := getMockTarget(t, mock.Config{Name: "plex", ScanError: fmt.Errorf("timeout: %w", autoscan.ErrTargetUnavailable)})
+	emby := getMockTarget(t, mock.Config{Name: "emby"})
+	targets := []autoscan.Target{plex, emby}
+
+	scans := []autoscan.Scan{
+		{Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)", Time: time.Now().UTC().Add(-2 * time.Minute)},
+		{Folder: "/mnt/unionfs/Media/Movies/Parasite (2019)", Time: time.Now().UTC().Add(-1 * time.Minute)},
+	}
+
+	if err := proc.Add(scans...); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scans are moved to the queues of the targets
+	for range scans {
+		if err := proc.Process(targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(plex.Recorded()) != 0 || len(emby.Recorded()) != 0 {
+		t.Fatalf("Expected no scans to be sent by Process, got: %d, %d", len(plex.Recorded()), len(emby.Recorded()))
+	}
+
+	queued, err := proc.TargetQueued()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]int{"plex": 2, "emby": 2}; !reflect.DeepEqual(queued, want) {
+		t.Errorf("Queued scans do not match: %v vs %v", queued, want)
+	}
+
+	// the unavailable plex does not hold up emby
+	if err := proc.ProcessTarget(plex); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Expected ErrTargetUnavailable, got: %v", err)
+	}
+
+	for range scans {
+		if err := proc.ProcessTarget(emby); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := proc.ProcessTarget(emby); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Fatalf("Expected ErrNoScans, got: %v", err)
+	}
+
+	remaining, err := proc.ScansRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining != 2 {
+		t.Errorf("Expected the scans of plex to remain, remaining: %d", remaining)
+	}
+
+	// plex catches up once it is back
+	plex.SetScanError(nil)
+	for range scans {
+		if err := proc.ProcessTarget(plex); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := proc.History()[1]; got.Folder != scans[0].Folder || got.StatusText() != "success after 1 retry" {
+		t.Errorf("Expected the oldest scan to succeed after 1 retry, got: %s %s", got.Folder, got.StatusText())
+	}
+
+	if got := proc.History()[1]; got.Target != "plex" {
+		t.Errorf("Targets do not match: %v vs %v", got.Target, "plex")
+	}
+
+	if proc.ScansProcessed() != 4 {
+		t.Errorf("Expected 4 processed scans, got: %d", proc.ScansProcessed())
+	}
+}
+
+func TestTargetQueuesNoLibrary(t *testing.T) {
+	now = time.Now
+	proc := &Processor{store: getDatastore(t), targetQueues: true}
+
+	plex := getMockTarget(t, mock.Config{Name: "plex", ScanError: autoscan.ErrNoLibrary})
+	emby := getMockTarget(t, mock.Config{Name: "emby"})
+
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Books/Dune", Time: time.Now().UTC().Add(-time.Minute)}
+	if err := proc.Add(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Process([]autoscan.Target{plex, emby}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.ProcessTarget(plex); !errors.Is(err, autoscan.ErrNoLibrary) {
+		t.Fatalf("Expected ErrNoLibrary, got: %v", err)
+	}
+
+	failed, err := proc.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a retry of the failed scan is only sent to plex
+	if len(failed) != 1 || !reflect.DeepEqual(failed[0].Targets, []string{"plex"}) {
+		t.Errorf("Expected a failed scan of plex, got: %+v", failed)
+	}
+
+	queued, err := proc.TargetQueued()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]int{"emby": 1}; !reflect.DeepEqual(queued, want) {
+		t.Errorf("Queued scans do not match: %v vs %v", queued, want)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	now = time.Now
+	store := getDatastore(t)
+
+	scan := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", Time: time.Now().UTC(), Reason: "first", Files: 1}
+	for _, s := range []autoscan.Scan{scan, {Folder: scan.Folder, Time: time.Now().UTC(), Priority: 2, Files: 2}} {
+		if err := store.FanOut(s, []string{"plex"}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, _, _, err := store.GetAvailableTargetScan("plex", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the scans of the same folder are merged
+	if got.Priority != 2 || got.Reason != "first" || got.Files != 3 {
+		t.Errorf("Expected the scans to be merged, got: %+v", got)
+	}
+
+	if _, _, _, err := store.GetAvailableTargetScan("emby", false); !errors.Is(err, autoscan.ErrNoScans) {
+		t.Errorf("Expected ErrNoScans for another target, got: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package autoscan
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Redacted replaces the value of secret config fields.
+const Redacted = "REDACTED"
+
+// The modes in which secret strings are redacted.
+const (
+	// RedactFull replaces secret strings by Redacted.
+	RedactFull = "full"
+
+	// RedactPartial reveals the last characters of long secret strings,
+	// e.g. ****abcd, to tell which credential is in use.
+	RedactPartial = "partial"
+)
+
+// partialMinLength is the minimum length of a secret string to be partially revealed.
+// Shorter secrets are fully redacted.
+const partialMinLength = 9
+
+// partialReveal is the number of characters partially revealed.
+const partialReveal = 4
+
+// Redact returns a copy of the config in which all secret fields are redacted.
+// The value itself is left untouched.
+//
+// Secret fields are marked with the `autoscan:"secret"` struct tag.
+// Secret strings are replaced by Redacted, the values of secret maps by Redacted,
+// and any other secret field is reset to its zero value.
+// Empty secret fields are left empty, so it remains visible whether they were set.
+func Redact(v any) any {
+	return RedactWith(v, RedactFull)
+}
+
+// RedactWith returns a copy of the config like Redact,
+// with the secret strings redacted in the given mode.
+// An empty mode is RedactFull.
+func RedactWith(v any, mode string) any {
+	if v == nil {
+		return nil
+	}
+
+	mask := maskFull
+	if mode == RedactPartial {
+		mask = maskPartial
+	}
+
+	return redact(reflect.ValueOf(v), mask).Interface()
+}
+
+// ValidRedactMode returns an error when the mode is not a mode of RedactWith.
+func ValidRedactMode(mode string) error {
+	switch mode {
+	case "", RedactFull, RedactPartial:
+		return nil
+	default:
+		return fmt.Errorf("invalid redact mode %q: must be %s or %s", mode, RedactFull, RedactPartial)
+	}
+}
+
+func maskFull(string) string {
+	return Redacted
+}
+
+// maskPartial reveals the last characters of the secret,
+// unless the secret is too short to reveal any of it safely.
+func maskPartial(s string) string {
+	r := []rune(s)
+	if len(r) < partialMinLength {
+		return Redacted
+	}
+
+	return "****" + string(r[len(r)-partialReveal:])
+}
+
+var rawConfigType = reflect.TypeOf(RawConfig{})
+
+func redact(v reflect.Value, mask func(string) string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(redact(v.Elem(), mask))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.New(v.Type()).Elem()
+		out.Set(redact(v.Elem(), mask))
+		return out
+
+	case reflect.Struct:
+		if v.Type() == rawConfigType {
+			return reflect.ValueOf(redactRawConfig(v.Interface().(RawConfig), mask))
+		}
+
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			if field.Tag.Get("autoscan") == "secret" {
+				out.Field(i).Set(redactSecret(v.Field(i), mask))
+				continue
+			}
+
+			out.Field(i).Set(redact(v.Field(i), mask))
+		}
+
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redact(v.Index(i), mask))
+		}
+
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), redact(iter.Value(), mask))
+		}
+
+		return out
+
+	default:
+		return v
+	}
+}
+
+func redactSecret(v reflect.Value, mask func(string) string) reflect.Value {
+	if v.IsZero() {
+		return v
+	}
+
+	switch {
+	case v.Kind() == reflect.String:
+		return reflect.ValueOf(mask(v.String())).Convert(v.Type())
+
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String:
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), reflect.ValueOf(mask(iter.Value().String())).Convert(v.Type().Elem()))
+		}
+
+		return out
+
+	default:
+		return reflect.Zero(v.Type())
+	}
+}
+
+// redactRawConfig redacts the decoded config of a RawConfig.
+// The secret fields of an undecoded config are unknown, so its value is dropped.
+func redactRawConfig(r RawConfig, mask func(string) string) RawConfig {
+	if r.decoded == nil {
+		return RawConfig{}
+	}
+
+	return RawConfig{decoded: redact(reflect.ValueOf(r.decoded), mask).Interface()}
+}
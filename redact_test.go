@@ -0,0 +1,94 @@
+package autoscan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	type Target struct {
+		URL     string            `yaml:"url"`
+		Token   string            `yaml:"token" autoscan:"secret"`
+		Cookies map[string]string `yaml:"cookies" autoscan:"secret"`
+		Unset   string            `yaml:"unset" autoscan:"secret"`
+	}
+
+	type Config struct {
+		Password string    `yaml:"password" autoscan:"secret"`
+		Targets  []Target  `yaml:"targets"`
+		Named    *Target   `yaml:"named"`
+		Raw      RawConfig `yaml:"raw"`
+		Any      any       `yaml:"any"`
+		Nested   struct {
+			Secret int `yaml:"secret" autoscan:"secret"`
+		} `yaml:"nested"`
+	}
+
+	target := Target{
+		URL:     "http://plex:32400",
+		Token:   "t0k3n",
+		Cookies: map[string]string{"session": "s3ss10n"},
+	}
+
+	c := Config{
+		Password: "p4ssw0rd",
+		Targets:  []Target{target},
+		Named:    &target,
+		Raw:      RawConfig{decoded: &target},
+		Any:      target,
+	}
+	c.Nested.Secret = 42
+
+	redacted := Redact(c).(Config)
+
+	want := Target{
+		URL:     "http://plex:32400",
+		Token:   Redacted,
+		Cookies: map[string]string{"session": Redacted},
+	}
+
+	if redacted.Password != Redacted {
+		t.Errorf("Expected the password to be redacted, got: %s", redacted.Password)
+	}
+
+	if !reflect.DeepEqual(redacted.Targets, []Target{want}) {
+		t.Errorf("Targets do not match:\n%+v\n%+v", redacted.Targets, want)
+	}
+
+	if !reflect.DeepEqual(*redacted.Named, want) {
+		t.Errorf("Pointers do not match:\n%+v\n%+v", *redacted.Named, want)
+	}
+
+	if !reflect.DeepEqual(redacted.Raw.decoded, &want) {
+		t.Errorf("Raw configs do not match:\n%+v\n%+v", redacted.Raw.decoded, want)
+	}
+
+	if !reflect.DeepEqual(redacted.Any, want) {
+		t.Errorf("Interfaces do not match:\n%+v\n%+v", redacted.Any, want)
+	}
+
+	if redacted.Nested.Secret != 0 {
+		t.Errorf("Expected non-string secrets to be reset, got: %d", redacted.Nested.Secret)
+	}
+
+	partial := RedactWith(Config{
+		Password: "p4ssw0rd",
+		Targets: []Target{{
+			Token:   "abcdefgh1234",
+			Cookies: map[string]string{"session": "s3ss10nabcd"},
+		}},
+	}, RedactPartial).(Config)
+
+	if partial.Password != Redacted {
+		t.Errorf("Expected a short secret to be fully redacted, got: %s", partial.Password)
+	}
+
+	if partial.Targets[0].Token != "****1234" || partial.Targets[0].Cookies["session"] != "****abcd" {
+		t.Errorf("Expected long secrets to be partially revealed, got: %+v", partial.Targets[0])
+	}
+
+	// the original config is left untouched
+	if c.Password != "p4ssw0rd" || c.Targets[0].Token != "t0k3n" || target.Cookies["session"] != "s3ss10n" {
+		t.Errorf("Expected the original config to be untouched, got: %+v", c)
+	}
+}
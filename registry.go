@@ -0,0 +1,171 @@
+package autoscan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A TargetFactory creates a Target from its config.
+// The decode function decodes the config of the target into the given value,
+// the defaults apply to the options the config of the target leaves unset.
+type TargetFactory func(decode func(any) error, defaults TargetDefaults) (Target, error)
+
+// TargetDefaults are the global defaults of the options of Targets.
+type TargetDefaults struct {
+	// Timeout of the requests of Targets which do not configure a timeout of their own,
+	// requests have no timeout when it is zero.
+	Timeout time.Duration
+
+	// StateDir is the directory in which Targets persist their state across restarts,
+	// state is not persisted when it is empty.
+	StateDir string
+}
+
+var (
+	factories   = make(map[string]TargetFactory)
+	factoriesMu = &sync.RWMutex{}
+)
+
+// RegisterTarget makes a Target available under the given name.
+// Targets should register themselves from an init function.
+//
+// RegisterTarget panics when a Target is registered twice.
+func RegisterTarget(name string, factory TargetFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("autoscan: register target factory is nil")
+	}
+
+	if _, exists := factories[name]; exists {
+		panic("autoscan: register target called twice for " + name)
+	}
+
+	factories[name] = factory
+}
+
+// IsRegisteredTarget returns whether a Target has been registered under the given name.
+func IsRegisteredTarget(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	_, exists := factories[name]
+	return exists
+}
+
+// RegisteredTargets returns the sorted names of all registered Targets.
+func RegisteredTargets() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// NewTarget creates a registered Target from its config.
+func NewTarget(name string, decode func(any) error, defaults TargetDefaults) (Target, error) {
+	factoriesMu.RLock()
+	factory, exists := factories[name]
+	factoriesMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown target: %s", name)
+	}
+
+	return factory(decode, defaults)
+}
+
+// A RawConfig holds the undecoded config of a registered Target.
+//
+// Once decoded, the RawConfig marshals the decoded value
+// so the config is presented exactly as the Target sees it.
+type RawConfig struct {
+	value   any
+	decoded any
+}
+
+func (r *RawConfig) UnmarshalYAML(unmarshal func(any) error) error {
+	return unmarshal(&r.value)
+}
+
+func (r RawConfig) MarshalYAML() (any, error) {
+	if r.decoded != nil {
+		return r.decoded, nil
+	}
+
+	return r.value, nil
+}
+
+// Name returns the name given to the Target in its config,
+// or an empty string when the Target has no name.
+func (r RawConfig) Name() string {
+	m, ok := r.value.(map[any]any)
+	if !ok {
+		return ""
+	}
+
+	name, _ := m["name"].(string)
+	return name
+}
+
+// SetName sets the name of the Target in its config.
+// Configs which are not a map are left as is, to fail once decoded.
+func (r *RawConfig) SetName(name string) {
+	if r.value == nil {
+		r.value = make(map[any]any)
+	}
+
+	if m, ok := r.value.(map[any]any); ok {
+		m["name"] = name
+	}
+}
+
+// Decode strictly decodes the config into the given value.
+func (r *RawConfig) Decode(v any) error {
+	b, err := yaml.Marshal(r.value)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(b, v); err != nil {
+		return err
+	}
+
+	r.decoded = v
+	return nil
+}
+
+// errConfigCaptured stops a TargetFactory once its config has been captured.
+var errConfigCaptured = errors.New("config captured")
+
+// TargetConfig returns a pointer to the zero config of a registered Target,
+// i.e. the value its factory decodes the config into.
+// It returns nil when the Target is not registered or does not decode a config.
+func TargetConfig(name string) any {
+	factoriesMu.RLock()
+	factory, exists := factories[name]
+	factoriesMu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+
+	var config any
+	_, _ = factory(func(v any) error {
+		config = v
+		return errConfigCaptured
+	}, TargetDefaults{})
+
+	return config
+}
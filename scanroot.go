@@ -0,0 +1,35 @@
+package autoscan
+
+import (
+	"path"
+	"strings"
+)
+
+// A ScanRoot restricts the paths received by a trigger to a root folder.
+// An empty ScanRoot accepts every path.
+type ScanRoot string
+
+// Resolve cleans the path and returns whether it falls under the root.
+// Relative paths are resolved against the root, empty paths are left untouched.
+func (root ScanRoot) Resolve(p string) (string, bool) {
+	if root == "" || p == "" {
+		return p, true
+	}
+
+	base := path.Clean(string(root))
+	if !path.IsAbs(p) && !hasDriveLetter(p) {
+		p = path.Join(base, p)
+	}
+
+	p = path.Clean(p)
+	if p == base || base == "/" || strings.HasPrefix(p, base+"/") {
+		return p, true
+	}
+
+	return p, false
+}
+
+// hasDriveLetter returns whether the path is a normalised Windows path, e.g. D:/Media.
+func hasDriveLetter(p string) bool {
+	return len(p) >= 3 && p[1] == ':' && p[2] == '/' && isLetter(p[0])
+}
@@ -0,0 +1,81 @@
+package autoscan
+
+import (
+	"testing"
+)
+
+func TestScanRoot(t *testing.T) {
+	type Test struct {
+		Name     string
+		Root     ScanRoot
+		Input    string
+		Expected string
+		Allowed  bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Empty root accepts every path",
+			Input:    "/mnt/media/Movies/",
+			Expected: "/mnt/media/Movies/",
+			Allowed:  true,
+		},
+		{
+			Name:    "Empty path",
+			Root:    "/local/media",
+			Allowed: true,
+		},
+		{
+			Name:     "Path within the root",
+			Root:     "/local/media/",
+			Input:    "/local/media/Movies/../TV/Westworld",
+			Expected: "/local/media/TV/Westworld",
+			Allowed:  true,
+		},
+		{
+			Name:     "Relative path",
+			Root:     "/local/media",
+			Input:    "Movies/Tenet (2020)",
+			Expected: "/local/media/Movies/Tenet (2020)",
+			Allowed:  true,
+		},
+		{
+			Name:     "Path outside of the root",
+			Root:     "/local/media",
+			Input:    "/local/media-old/Movies",
+			Expected: "/local/media-old/Movies",
+		},
+		{
+			Name:     "Relative path escaping the root",
+			Root:     "/local/media",
+			Input:    "../downloads",
+			Expected: "/local/downloads",
+		},
+		{
+			Name:     "Windows path within a drive-letter root",
+			Root:     "D:/Media",
+			Input:    "D:/Media/Movies/Tenet (2020)",
+			Expected: "D:/Media/Movies/Tenet (2020)",
+			Allowed:  true,
+		},
+		{
+			Name:     "Windows path outside of a drive-letter root",
+			Root:     "D:/Media",
+			Input:    "E:/Media/Movies",
+			Expected: "E:/Media/Movies",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			result, allowed := tc.Root.Resolve(tc.Input)
+			if result != tc.Expected {
+				t.Errorf("Paths do not match: %s vs %s", result, tc.Expected)
+			}
+
+			if allowed != tc.Allowed {
+				t.Errorf("Expected allowed: %v, got: %v", tc.Allowed, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package autoscan
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var stateMu = &sync.Mutex{}
+
+// LoadOrStoreState returns the state with the given name persisted in the state directory,
+// in which Targets persist their state across restarts.
+// When no state has been persisted yet, the value returned by create is persisted and returned.
+func LoadOrStoreState(dir string, name string, create func() string) (string, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if dir == "" {
+		return "", errors.New("state directory not set")
+	}
+
+	file := filepath.Join(dir, name)
+
+	b, err := os.ReadFile(file)
+	switch {
+	case err == nil && strings.TrimSpace(string(b)) != "":
+		return strings.TrimSpace(string(b)), nil
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("reading state %s: %w", file, err)
+	}
+
+	value := create()
+	if err := os.WriteFile(file, []byte(value+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("writing state %s: %w", file, err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,31 @@
+package autoscan
+
+import (
+	"testing"
+)
+
+func TestLoadOrStoreState(t *testing.T) {
+	if _, err := LoadOrStoreState("", "test", func() string { return "value" }); err == nil {
+		t.Fatal("Expected an error without a state directory")
+	}
+
+	dir := t.TempDir()
+
+	value, err := LoadOrStoreState(dir, "test", func() string { return "first" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "first" {
+		t.Errorf("Expected the created value, got: %s", value)
+	}
+
+	value, err = LoadOrStoreState(dir, "test", func() string { return "second" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "first" {
+		t.Errorf("Expected the persisted value, got: %s", value)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -18,9 +19,9 @@ type apiClient struct {
 	pass    string
 }
 
-func newAPIClient(baseURL string, user string, pass string, log zerolog.Logger) apiClient {
+func newAPIClient(baseURL string, user string, pass string, timeout time.Duration, log zerolog.Logger) apiClient {
 	return apiClient{
-		client:  &http.Client{},
+		client:  &http.Client{Timeout: timeout},
 		log:     log,
 		baseURL: baseURL,
 		user:    user,
@@ -1,47 +1,82 @@
 package autoscan
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/rs/zerolog"
 
 	"github.com/cloudbox/autoscan"
 )
 
 type Config struct {
+	Name string `yaml:"name"`
+
 	URL       string             `yaml:"url"`
 	User      string             `yaml:"username"`
-	Pass      string             `yaml:"password"`
+	Pass      string             `yaml:"password" autoscan:"secret"`
 	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
 	Verbosity string             `yaml:"verbosity"`
+
+	DispatchOrder int `yaml:"dispatch-order"`
+
+	// RewriteChain rewrites the output of Rewrite in stages, in order.
+	RewriteChain []autoscan.RewriteStage `yaml:"rewrite-chain"`
+
+	// TrimPrefix removes the first matching prefix from the folder before Rewrite.
+	TrimPrefix []string `yaml:"trim-prefix"`
+
+	// DefaultTimeout is the timeout of the requests, set to the global default-timeout.
+	DefaultTimeout time.Duration `yaml:"-"`
 }
 
 type target struct {
+	name string
+
 	url  string
 	user string
 	pass string
 
+	dispatchOrder int
+
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
 	api     apiClient
 }
 
 func New(c Config) (autoscan.Target, error) {
+	name := c.Name
+	if name == "" {
+		name = "autoscan"
+	}
+
 	l := autoscan.GetLogger(c.Verbosity).With().
-		Str("target", "autoscan").
+		Str("target", name).
 		Str("url", c.URL).Logger()
 
-	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	rewriter, err := autoscan.NewRewriteChain(c.Rewrite, c.RewriteChain)
 	if err != nil {
 		return nil, err
 	}
 
+	rewriter = autoscan.TrimPrefix(c.TrimPrefix, rewriter)
+
+	if c.DispatchOrder < 0 {
+		return nil, fmt.Errorf("invalid autoscan dispatch-order %d: must not be negative", c.DispatchOrder)
+	}
+
 	return &target{
+		name: name,
+
 		url:  c.URL,
 		user: c.User,
 		pass: c.Pass,
 
+		dispatchOrder: c.DispatchOrder,
+
 		log:     l,
 		rewrite: rewriter,
-		api:     newAPIClient(c.URL, c.User, c.Pass, l),
+		api:     newAPIClient(c.URL, c.User, c.Pass, c.DefaultTimeout, l),
 	}, nil
 }
 
@@ -50,6 +85,7 @@ func (t target) Scan(scan autoscan.Scan) error {
 
 	// send scan request
 	l := t.log.With().
+		Str("id", scan.ID).
 		Str("path", scanFolder).
 		Logger()
 
@@ -66,3 +102,11 @@ func (t target) Scan(scan autoscan.Scan) error {
 func (t target) Available() error {
 	return t.api.Available()
 }
+
+func (t target) String() string {
+	return t.name
+}
+
+func (t target) DispatchOrder() int {
+	return t.dispatchOrder
+}
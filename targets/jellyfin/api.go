@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -18,9 +19,9 @@ type apiClient struct {
 	token   string
 }
 
-func newAPIClient(baseURL string, token string, log zerolog.Logger) apiClient {
+func newAPIClient(baseURL string, token string, timeout time.Duration, log zerolog.Logger) apiClient {
 	return apiClient{
-		client:  &http.Client{},
+		client:  &http.Client{Timeout: timeout},
 		log:     log,
 		baseURL: baseURL,
 		token:   token,
@@ -3,6 +3,7 @@ package jellyfin
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -10,34 +11,63 @@ import (
 )
 
 type Config struct {
-	URL       string             `yaml:"url"`
-	Token     string             `yaml:"token"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name string `yaml:"name"`
+
+	URL             string             `yaml:"url"`
+	Token           string             `yaml:"token" autoscan:"secret"`
+	Rewrite         []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity       string             `yaml:"verbosity"`
+	FailOnNoLibrary bool               `yaml:"fail-on-no-library"`
+	DispatchOrder   int                `yaml:"dispatch-order"`
+
+	// RewriteChain rewrites the output of Rewrite in stages, in order.
+	RewriteChain []autoscan.RewriteStage `yaml:"rewrite-chain"`
+
+	// TrimPrefix removes the first matching prefix from the folder before Rewrite.
+	TrimPrefix []string `yaml:"trim-prefix"`
+
+	// DefaultTimeout is the timeout of the requests, set to the global default-timeout.
+	DefaultTimeout time.Duration `yaml:"-"`
 }
 
 type target struct {
+	name string
+
 	url       string
 	token     string
 	libraries []library
 
+	failOnNoLibrary bool
+	dispatchOrder   int
+
 	log     zerolog.Logger
 	rewrite autoscan.Rewriter
 	api     apiClient
 }
 
 func New(c Config) (autoscan.Target, error) {
+	name := c.Name
+	if name == "" {
+		name = "jellyfin"
+	}
+
 	l := autoscan.GetLogger(c.Verbosity).With().
-		Str("target", "jellyfin").
+		Str("target", name).
 		Str("url", c.URL).
 		Logger()
 
-	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	rewriter, err := autoscan.NewRewriteChain(c.Rewrite, c.RewriteChain)
 	if err != nil {
 		return nil, err
 	}
 
-	api := newAPIClient(c.URL, c.Token, l)
+	rewriter = autoscan.TrimPrefix(c.TrimPrefix, rewriter)
+
+	if c.DispatchOrder < 0 {
+		return nil, fmt.Errorf("invalid jellyfin dispatch-order %d: must not be negative", c.DispatchOrder)
+	}
+
+	api := newAPIClient(c.URL, c.Token, c.DefaultTimeout, l)
 
 	libraries, err := api.Libraries()
 	if err != nil {
@@ -49,10 +79,15 @@ func New(c Config) (autoscan.Target, error) {
 		Msg("Retrieved libraries")
 
 	return &target{
+		name: name,
+
 		url:       c.URL,
 		token:     c.Token,
 		libraries: libraries,
 
+		failOnNoLibrary: c.FailOnNoLibrary,
+		dispatchOrder:   c.DispatchOrder,
+
 		log:     l,
 		rewrite: rewriter,
 		api:     api,
@@ -63,20 +98,34 @@ func (t target) Available() error {
 	return t.api.Available()
 }
 
+func (t target) String() string {
+	return t.name
+}
+
+func (t target) DispatchOrder() int {
+	return t.dispatchOrder
+}
+
 func (t target) Scan(scan autoscan.Scan) error {
 	// determine library for this scan
 	scanFolder := t.rewrite(scan.Folder)
 
 	lib, err := t.getScanLibrary(scanFolder)
 	if err != nil {
+		if t.failOnNoLibrary {
+			return fmt.Errorf("%v: %w", err, autoscan.ErrNoLibrary)
+		}
+
 		t.log.Warn().
 			Err(err).
+			Str("id", scan.ID).
 			Msg("No target libraries found")
 
 		return nil
 	}
 
 	l := t.log.With().
+		Str("id", scan.ID).
 		Str("path", scanFolder).
 		Str("library", lib.Name).
 		Logger()
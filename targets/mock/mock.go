@@ -0,0 +1,124 @@
+// Package mock provides a Target which records its scans instead of
+// sending them to a media server.
+//
+// The mock target is intended for testing the flow from triggers
+// through the processor to the targets.
+package mock
+
+import (
+	"sync"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	// Name is returned by String, "mock" when empty.
+	Name string `yaml:"name"`
+
+	Rewrite []autoscan.Rewrite `yaml:"rewrite"`
+
+	// DispatchOrder is returned by DispatchOrder.
+	DispatchOrder int `yaml:"dispatch-order"`
+
+	// Available is returned by every call to Available.
+	Available error `yaml:"-"`
+
+	// ScanError is returned by every call to Scan.
+	// Failed scans are recorded as well.
+	ScanError error `yaml:"-"`
+}
+
+// Target records every scan it receives.
+type Target struct {
+	// Scans holds every scan received by the target, in order.
+	// The folders of the scans are rewritten.
+	// Use Recorded to access the scans while the target is in use.
+	Scans []autoscan.Scan
+
+	mu        sync.Mutex
+	name      string
+	available error
+	scanError error
+	order     int
+	rewrite   autoscan.Rewriter
+}
+
+func New(c Config) (*Target, error) {
+	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = "mock"
+	}
+
+	return &Target{
+		Scans: make([]autoscan.Scan, 0),
+
+		name:      name,
+		available: c.Available,
+		scanError: c.ScanError,
+		order:     c.DispatchOrder,
+		rewrite:   rewriter,
+	}, nil
+}
+
+func (t *Target) Scan(scan autoscan.Scan) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scan.Folder = t.rewrite(scan.Folder)
+	t.Scans = append(t.Scans, scan)
+	return t.scanError
+}
+
+func (t *Target) Available() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.available
+}
+
+// SetAvailable changes the error returned by Available.
+func (t *Target) SetAvailable(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.available = err
+}
+
+// SetScanError changes the error returned by Scan.
+func (t *Target) SetScanError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.scanError = err
+}
+
+// Recorded returns a copy of the scans received by the target.
+func (t *Target) Recorded() []autoscan.Scan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scans := make([]autoscan.Scan, len(t.Scans))
+	copy(scans, t.Scans)
+	return scans
+}
+
+// Reset clears the recorded scans.
+func (t *Target) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Scans = t.Scans[:0]
+}
+
+func (t *Target) String() string {
+	return t.name
+}
+
+func (t *Target) DispatchOrder() int {
+	return t.order
+}
@@ -20,10 +20,32 @@ type apiClient struct {
 	token            string
 	product          string
 	clientIdentifier string
+	auth             gatewayAuth
+	scanRequester    scanRequester
 }
 
-func newAPIClient(baseURL string, token string, log zerolog.Logger, timeout time.Duration, product string, clientIdentifier string) *apiClient {
-	client := &http.Client{}
+// gatewayAuth holds the credentials of an authentication gateway in front of Plex.
+type gatewayAuth struct {
+	cookies     []*http.Cookie
+	headerName  string
+	headerValue string
+}
+
+func (a gatewayAuth) apply(req *http.Request) {
+	for _, cookie := range a.cookies {
+		req.AddCookie(cookie)
+	}
+
+	if a.headerName != "" {
+		req.Header.Set(a.headerName, a.headerValue)
+	}
+}
+
+func newAPIClient(baseURL string, token string, log zerolog.Logger, timeout time.Duration, product string, clientIdentifier string, auth gatewayAuth, scanRequester scanRequester) *apiClient {
+	// every client has its own connections, so they are closed when the client is reset
+	client := &http.Client{
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
 	if timeout > 0 {
 		client.Timeout = timeout
 	}
@@ -35,6 +57,8 @@ func newAPIClient(baseURL string, token string, log zerolog.Logger, timeout time
 		token:            token,
 		product:          product,
 		clientIdentifier: clientIdentifier,
+		auth:             auth,
+		scanRequester:    scanRequester,
 	}
 }
 
@@ -43,6 +67,7 @@ func (c apiClient) do(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Accept", "application/json") // Force JSON Response.
 	req.Header.Set("X-Plex-Product", c.product)
 	req.Header.Set("X-Plex-Client-Identifier", c.clientIdentifier)
+	c.auth.apply(req)
 
 	res, err := c.client.Do(req)
 	if err != nil {
@@ -99,10 +124,33 @@ func (c apiClient) Version() (string, error) {
 	return resp.MediaContainer.Version, nil
 }
 
+// A library is a folder of a Plex library section.
+//
+// The type of the library is movie, show, artist or photo.
+// "Other Videos" libraries are movie libraries without an agent.
+// Plex scans the folders of every library type with the same refresh request.
 type library struct {
-	ID   int
-	Name string
+	ID      int
+	Name    string
+	Type    string
+	Scanner string
+	Agent   string
+
+	// Path is the location of the library a folder matched,
+	// the first location when the library was not matched.
 	Path string
+
+	// Paths are all locations of the library.
+	Paths []string
+}
+
+// locations returns all locations of the library.
+func (l library) locations() []string {
+	if len(l.Paths) == 0 {
+		return []string{l.Path}
+	}
+
+	return l.Paths
 }
 
 func (c apiClient) Libraries() ([]library, error) {
@@ -119,18 +167,24 @@ func (c apiClient) Libraries() ([]library, error) {
 
 	defer res.Body.Close()
 
+	// the sections are decoded one by one, so a malformed section does not fail the others
 	type Response struct {
 		MediaContainer struct {
-			Libraries []struct {
-				ID       int    `json:"key,string"`
-				Name     string `json:"title"`
-				Sections []struct {
-					Path string `json:"path"`
-				} `json:"Location"`
-			} `json:"Directory"`
+			Libraries []json.RawMessage `json:"Directory"`
 		} `json:"MediaContainer"`
 	}
 
+	type Section struct {
+		ID       int    `json:"key,string"`
+		Name     string `json:"title"`
+		Type     string `json:"type"`
+		Scanner  string `json:"scanner"`
+		Agent    string `json:"agent"`
+		Sections []struct {
+			Path string `json:"path"`
+		} `json:"Location"`
+	}
+
 	resp := new(Response)
 	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
 		return nil, fmt.Errorf("failed decoding libraries response: %v: %w", err, autoscan.ErrFatal)
@@ -138,7 +192,19 @@ func (c apiClient) Libraries() ([]library, error) {
 
 	// process response
 	libraries := make([]library, 0)
-	for _, lib := range resp.MediaContainer.Libraries {
+	failed := 0
+	for _, raw := range resp.MediaContainer.Libraries {
+		var lib Section
+		if err := json.Unmarshal(raw, &lib); err != nil {
+			failed++
+			c.log.Warn().
+				Err(err).
+				Str("section", sectionTitle(raw)).
+				Msg("Failed decoding library section, ignoring the section")
+			continue
+		}
+
+		paths := make([]string, 0, len(lib.Sections))
 		for _, folder := range lib.Sections {
 			libPath := folder.Path
 
@@ -147,31 +213,234 @@ func (c apiClient) Libraries() ([]library, error) {
 				libPath += "/"
 			}
 
-			libraries = append(libraries, library{
-				Name: lib.Name,
-				ID:   lib.ID,
-				Path: libPath,
-			})
+			paths = append(paths, libPath)
+		}
+
+		// libraries without locations cannot be scanned
+		if len(paths) == 0 {
+			continue
 		}
+
+		libraries = append(libraries, library{
+			Name:    lib.Name,
+			ID:      lib.ID,
+			Type:    lib.Type,
+			Scanner: lib.Scanner,
+			Agent:   lib.Agent,
+			Path:    paths[0],
+			Paths:   paths,
+		})
+	}
+
+	if len(libraries) == 0 && failed > 0 {
+		return nil, fmt.Errorf("failed decoding all %d library sections: %w", failed, autoscan.ErrFatal)
 	}
 
 	return libraries, nil
 }
 
+// sectionTitle returns the title of a library section which could not be decoded,
+// or its key when it has no title.
+func sectionTitle(raw json.RawMessage) string {
+	var section map[string]any
+	if err := json.Unmarshal(raw, &section); err != nil {
+		return "unknown"
+	}
+
+	for _, field := range []string{"title", "key"} {
+		if v, ok := section[field]; ok {
+			return fmt.Sprint(v)
+		}
+	}
+
+	return "unknown"
+}
+
 func (c apiClient) Scan(path string, libraryID int) error {
-	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(libraryID), "refresh")
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := c.scanRequester.scanRequest(c.baseURL, path, libraryID)
 	if err != nil {
 		return fmt.Errorf("failed creating scan request: %v: %w", err, autoscan.ErrFatal)
 	}
 
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// RefreshItem refreshes the metadata item with the given rating key.
+func (c apiClient) RefreshItem(ratingKey int) error {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "metadata", strconv.Itoa(ratingKey), "refresh")
+	req, err := http.NewRequest("PUT", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating refresh item request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("refresh item: %w", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// A libraryStatus is the scan status of a library.
+type libraryStatus struct {
+	// Refreshing is whether Plex is scanning the library.
+	Refreshing bool `json:"refreshing"`
+
+	// ScannedAt and UpdatedAt are the unix times of the last scan and change of the library,
+	// which change once a scan completed, even when Plex was never seen refreshing the library.
+	ScannedAt int64 `json:"scannedAt"`
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
+// scannedSince returns whether the library was scanned or changed since the earlier status.
+func (s libraryStatus) scannedSince(earlier libraryStatus) bool {
+	return s.ScannedAt != earlier.ScannedAt || s.UpdatedAt != earlier.UpdatedAt
+}
+
+// LibraryStatus returns the scan status of the library.
+func (c apiClient) LibraryStatus(libraryID int) (libraryStatus, error) {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections")
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return libraryStatus{}, fmt.Errorf("failed creating library status request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return libraryStatus{}, fmt.Errorf("library status: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	type Response struct {
+		MediaContainer struct {
+			Libraries []struct {
+				ID string `json:"key"`
+				libraryStatus
+			} `json:"Directory"`
+		} `json:"MediaContainer"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return libraryStatus{}, fmt.Errorf("failed decoding library status response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	for _, lib := range resp.MediaContainer.Libraries {
+		if lib.ID == strconv.Itoa(libraryID) {
+			return lib.libraryStatus, nil
+		}
+	}
+
+	return libraryStatus{}, fmt.Errorf("library %d not found: %w", libraryID, autoscan.ErrNoLibrary)
+}
+
+// EmptyTrash removes the items of the library whose files no longer exist.
+func (c apiClient) EmptyTrash(libraryID int) error {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(libraryID), "emptyTrash")
+	req, err := http.NewRequest("PUT", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating empty trash request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("empty trash: %w", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// itemTypes are the types of the items holding the media files of the library types.
+var itemTypes = map[string]int{
+	"movie":  1,
+	"show":   4,
+	"artist": 10,
+	"photo":  13,
+}
+
+// An item is an item of a library, such as a movie or an episode.
+type item struct {
+	RatingKey int
+	Files     []string
+}
+
+// Items returns the items holding the media files of the library.
+func (c apiClient) Items(lib library) ([]item, error) {
+	itemType, ok := itemTypes[lib.Type]
+	if !ok {
+		return nil, fmt.Errorf("library type %q has no items: %w", lib.Type, autoscan.ErrFatal)
+	}
+
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "sections", strconv.Itoa(lib.ID), "all")
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating items request: %v: %w", err, autoscan.ErrFatal)
+	}
+
 	q := url.Values{}
-	q.Add("path", path)
+	q.Add("type", strconv.Itoa(itemType))
 	req.URL.RawQuery = q.Encode()
 
 	res, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("scan: %w", err)
+		return nil, fmt.Errorf("items: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	type Response struct {
+		MediaContainer struct {
+			Metadata []struct {
+				RatingKey int `json:"ratingKey,string"`
+				Media     []struct {
+					Part []struct {
+						File string `json:"file"`
+					} `json:"Part"`
+				} `json:"Media"`
+			} `json:"Metadata"`
+		} `json:"MediaContainer"`
+	}
+
+	resp := new(Response)
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, fmt.Errorf("failed decoding items response: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	items := make([]item, 0, len(resp.MediaContainer.Metadata))
+	for _, metadata := range resp.MediaContainer.Metadata {
+		files := make([]string, 0)
+		for _, media := range metadata.Media {
+			for _, part := range media.Part {
+				files = append(files, part.File)
+			}
+		}
+
+		items = append(items, item{RatingKey: metadata.RatingKey, Files: files})
+	}
+
+	return items, nil
+}
+
+// Analyze analyzes the media of the item with the given rating key.
+func (c apiClient) Analyze(ratingKey int) error {
+	reqURL := autoscan.JoinURL(c.baseURL, "library", "metadata", strconv.Itoa(ratingKey), "analyze")
+	req, err := http.NewRequest("PUT", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating analyze request: %v: %w", err, autoscan.ErrFatal)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("analyze: %w", err)
 	}
 
 	res.Body.Close()
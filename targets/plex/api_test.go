@@ -0,0 +1,304 @@
+package plex
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestGatewayAuth(t *testing.T) {
+	auth, err := parseGatewayAuth(map[string]string{
+		"authelia_session": "s3cr3t",
+	}, "Remote-User: autoscan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+
+		cookie, err := r.Cookie("authelia_session")
+		if err != nil || cookie.Value != "s3cr3t" {
+			t.Errorf("%s: expected session cookie, got: %v", r.URL.Path, cookie)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if got := r.Header.Get("Remote-User"); got != "autoscan" {
+			t.Errorf("%s: expected auth header, got: %q", r.URL.Path, got)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			rw.Write([]byte(`{"MediaContainer": {"version": "1.32.0"}}`))
+		case "/library/sections":
+			rw.Write([]byte(`{"MediaContainer": {"Directory": [{"key": "1", "title": "Movies", "Location": [{"path": "/data/Movies"}]}]}}`))
+		case "/library/sections/1/refresh":
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", auth, scanRequestV1{})
+
+	if _, err := api.Version(); err != nil {
+		t.Errorf("Version: %v", err)
+	}
+
+	if _, err := api.Libraries(); err != nil {
+		t.Errorf("Libraries: %v", err)
+	}
+
+	if err := api.Scan("/data/Movies/Interstellar (2014)", 1); err != nil {
+		t.Errorf("Scan: %v", err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got: %d", requests)
+	}
+}
+
+func TestParseGatewayAuth(t *testing.T) {
+	type Test struct {
+		Name       string
+		Cookies    map[string]string
+		AuthHeader string
+		WantErr    bool
+	}
+
+	var testCases = []Test{
+		{
+			Name: "Empty",
+		},
+		{
+			Name:       "Valid",
+			Cookies:    map[string]string{"session": "abc"},
+			AuthHeader: "Proxy-Authorization: Basic YWJjOmRlZg==",
+		},
+		{
+			Name:       "Missing header value separator",
+			AuthHeader: "Proxy-Authorization",
+			WantErr:    true,
+		},
+		{
+			Name:    "Invalid cookie name",
+			Cookies: map[string]string{"in valid": "abc"},
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := parseGatewayAuth(tc.Cookies, tc.AuthHeader)
+			if (err != nil) != tc.WantErr {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConnect(t *testing.T) {
+	connectRetryInterval = 10 * time.Millisecond
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// plex is starting up
+		if requests <= 2 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			rw.Write([]byte(`{"MediaContainer": {"version": "1.32.0"}}`))
+		case "/library/sections":
+			rw.Write([]byte(`{"MediaContainer": {"Directory": []}}`))
+		}
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+
+	if _, _, err := connect(api, zerolog.Nop(), 0, 0); err == nil {
+		t.Fatal("Expected an error without waiting for plex")
+	}
+
+	version, _, err := connect(api, zerolog.Nop(), time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "1.32.0" {
+		t.Errorf("Versions do not match: %s vs 1.32.0", version)
+	}
+
+	if requests != 4 {
+		t.Errorf("Expected 4 requests, got: %d", requests)
+	}
+}
+
+func TestGetLibraries(t *testing.T) {
+	libraryRetryBackoff = time.Millisecond
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// plex fails to list its libraries right after starting
+		if requests <= 2 {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Write([]byte(`{"MediaContainer": {"Directory": [{"key": "1", "title": "Movies", "Location": [{"path": "/data/Movies"}]}]}}`))
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+
+	if _, err := getLibraries(api, zerolog.Nop(), 1); err == nil {
+		t.Fatal("Expected an error once the retries are exhausted")
+	}
+
+	libraries, err := getLibraries(api, zerolog.Nop(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(libraries) != 1 || libraries[0].Path != "/data/Movies/" {
+		t.Errorf("Unexpected libraries: %v", libraries)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got: %d", requests)
+	}
+}
+
+func TestGetLibrariesFatal(t *testing.T) {
+	libraryRetryBackoff = time.Millisecond
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		rw.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+
+	if _, err := getLibraries(api, zerolog.Nop(), 3); !errors.Is(err, autoscan.ErrFatal) {
+		t.Fatalf("Expected ErrFatal, got: %v", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected 1 request, got: %d", requests)
+	}
+}
+
+func TestLibrariesLocations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`{"MediaContainer": {"Directory": [
+			{"key": "1", "title": "Movies", "Location": [{"path": "/mnt/disk1/Movies"}, {"path": "/mnt/disk2/Movies/"}]},
+			{"key": "2", "title": "Empty", "Location": []}
+		]}}`))
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+
+	libraries, err := api.Libraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []library{{
+		ID:    1,
+		Name:  "Movies",
+		Path:  "/mnt/disk1/Movies/",
+		Paths: []string{"/mnt/disk1/Movies/", "/mnt/disk2/Movies/"},
+	}}
+
+	if !reflect.DeepEqual(libraries, want) {
+		t.Errorf("Libraries do not match\n%+v\nvs\n%+v", libraries, want)
+	}
+}
+
+func TestRefreshItem(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+	if err := api.RefreshItem(12345); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != "PUT" || path != "/library/metadata/12345/refresh" {
+		t.Errorf("Unexpected request: %s %s", method, path)
+	}
+}
+
+func TestLibrariesMalformedSection(t *testing.T) {
+	body := `{"MediaContainer": {"Directory": [
+		{"key": "1", "title": "Movies", "Location": [{"path": "/data/Movies"}]},
+		{"key": "two", "title": "Broken", "Location": [{"path": "/data/Broken"}]},
+		{"key": "3", "title": "TV", "Location": "/data/TV"}
+	]}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+
+	libraries, err := api.Libraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(libraries) != 1 || libraries[0].Name != "Movies" {
+		t.Errorf("Expected only the valid section, got: %+v", libraries)
+	}
+
+	// every section is malformed
+	body = `{"MediaContainer": {"Directory": [{"key": "two", "title": "Broken"}]}}`
+	if _, err := api.Libraries(); !errors.Is(err, autoscan.ErrFatal) {
+		t.Errorf("Expected ErrFatal when no section could be decoded, got: %v", err)
+	}
+}
+
+func TestSectionTitle(t *testing.T) {
+	type Test struct {
+		Raw  string
+		Want string
+	}
+
+	var testCases = []Test{
+		{Raw: `{"key": "two", "title": "Broken"}`, Want: "Broken"},
+		{Raw: `{"key": "two"}`, Want: "two"},
+		{Raw: `[]`, Want: "unknown"},
+	}
+
+	for _, tc := range testCases {
+		if got := sectionTitle(json.RawMessage(tc.Raw)); got != tc.Want {
+			t.Errorf("Titles do not match: %s vs %s", got, tc.Want)
+		}
+	}
+}
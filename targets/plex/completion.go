@@ -0,0 +1,135 @@
+package plex
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// completionInterval is the time between the polls of a library which is being scanned.
+var completionInterval = time.Second
+
+// completionStart is the time Plex is given to start scanning the library after a scan request.
+var completionStart = 5 * time.Second
+
+// completionTimeout is the time Plex is given to complete the scan of a library.
+var completionTimeout = 10 * time.Minute
+
+var errCompletionTimeout = errors.New("library still scanning")
+
+// scanFolder sends the scan request of the path within the library, an empty path refreshes the entire library.
+// When waiting for the completion of scans, the entire library is refreshed once Plex neither started scanning
+// the path nor completed a scan of the library, as some Plex versions ignore the path of a scan request.
+func (t target) scanFolder(lib library, path string, l zerolog.Logger) error {
+	if t.waitForCompletion <= 0 {
+		return t.scan(path, lib.ID)
+	}
+
+	before, err := t.api.LibraryStatus(lib.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := t.scan(path, lib.ID); err != nil {
+		return err
+	}
+
+	started, err := t.waitForScan(lib, &before, t.waitForCompletion, l)
+	switch {
+	case errors.Is(err, errCompletionTimeout):
+		l.Warn().
+			Err(err).
+			Dur("wait_for_completion", t.waitForCompletion).
+			Msg("Library did not finish scanning in time")
+		return nil
+	case err != nil:
+		return err
+	case started || path == "":
+		return nil
+	}
+
+	l.Warn().Msg("Plex did not scan the folder, refreshing the entire library")
+	return t.scanFolder(lib, "", l)
+}
+
+// waitForScan waits until Plex has completed scanning the library after a scan request,
+// by polling the status of the library. It returns whether Plex scanned the library,
+// which is false when Plex ignored the scan request.
+// A scan which completed before the first poll is detected by comparing the status with
+// the status before the scan request, which is nil when unknown.
+func (t target) waitForScan(lib library, before *libraryStatus, timeout time.Duration, l zerolog.Logger) (bool, error) {
+	start := time.Now()
+	started := false
+
+	for {
+		status, err := t.api.LibraryStatus(lib.ID)
+		if err != nil {
+			return started, err
+		}
+
+		elapsed := time.Since(start)
+		switch {
+		case status.Refreshing:
+			started = true
+		case started, before != nil && status.scannedSince(*before):
+			l.Debug().
+				Dur("duration", elapsed).
+				Msg("Library finished scanning")
+			return true, nil
+		case elapsed >= completionStart:
+			return false, nil
+		}
+
+		if elapsed >= timeout {
+			return started, errCompletionTimeout
+		}
+
+		time.Sleep(completionInterval)
+	}
+}
+
+// trash tracks the libraries whose trash is about to be emptied in the background,
+// so a single empty trash request is pending for every library.
+type trash struct {
+	mu sync.Mutex
+
+	// pending holds the libraries whose trash is about to be emptied,
+	// true when another deletion was scanned while waiting for the library.
+	pending map[int]bool
+}
+
+func newTrash() *trash {
+	return &trash{pending: make(map[int]bool)}
+}
+
+// schedule returns whether the trash of the library should be emptied in the background,
+// which is false when it is already about to be emptied.
+func (t *trash) schedule(libraryID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.pending[libraryID]; ok {
+		t.pending[libraryID] = true
+		return false
+	}
+
+	t.pending[libraryID] = false
+	return true
+}
+
+// done returns whether the trash of the library should be emptied once more,
+// as another deletion was scanned while it was emptied.
+func (t *trash) done(libraryID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending[libraryID] {
+		t.pending[libraryID] = false
+		return true
+	}
+
+	delete(t.pending, libraryID)
+	return false
+}
@@ -0,0 +1,180 @@
+package plex
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// cooldown holds back scans of libraries which have been scanned recently.
+// The held back scans of a library are coalesced into a single scan
+// once the cooldown of the library has elapsed.
+type cooldown struct {
+	mu       sync.Mutex
+	duration time.Duration
+	last     map[int]time.Time
+	pending  map[int][]string
+	scans    map[int][]autoscan.Scan
+	timers   map[int]*time.Timer
+	libs     map[int]library
+
+	// add requeues the held back scans which could not be sent once the cooldown elapsed.
+	add autoscan.ProcessorFunc
+}
+
+// heldScans are the scans held back during the cooldown of a library.
+type heldScans struct {
+	lib   library
+	paths []string
+	scans []autoscan.Scan
+}
+
+func newCooldown(duration time.Duration) *cooldown {
+	if duration <= 0 {
+		return nil
+	}
+
+	return &cooldown{
+		duration: duration,
+		last:     make(map[int]time.Time),
+		pending:  make(map[int][]string),
+		scans:    make(map[int][]autoscan.Scan),
+		timers:   make(map[int]*time.Timer),
+		libs:     make(map[int]library),
+	}
+}
+
+// hold returns whether the scan of the path has been held back.
+// The flush function is called once the cooldown of the library has elapsed.
+func (c *cooldown) hold(lib library, path string, scan autoscan.Scan, flush func(heldScans)) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.libs[lib.ID] = lib
+
+	remaining := c.duration - time.Since(c.last[lib.ID])
+	if remaining <= 0 && len(c.pending[lib.ID]) == 0 {
+		c.last[lib.ID] = time.Now()
+		return false
+	}
+
+	paths, scheduled := c.pending[lib.ID]
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+
+	c.pending[lib.ID] = append(paths, path)
+	c.scans[lib.ID] = append(c.scans[lib.ID], scan)
+
+	if !scheduled {
+		c.timers[lib.ID] = time.AfterFunc(remaining, func() {
+			flush(c.take(lib.ID))
+		})
+	}
+
+	return true
+}
+
+// take removes the held back scans of the library and restarts its cooldown.
+func (c *cooldown) take(libraryID int) heldScans {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	held := heldScans{
+		lib:   c.libs[libraryID],
+		paths: c.pending[libraryID],
+		scans: c.scans[libraryID],
+	}
+
+	delete(c.pending, libraryID)
+	delete(c.scans, libraryID)
+	delete(c.timers, libraryID)
+	c.last[libraryID] = time.Now()
+	return held
+}
+
+// setRequeue sets the function requeueing the held back scans which could not be sent.
+func (c *cooldown) setRequeue(add autoscan.ProcessorFunc) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add = add
+}
+
+// requeue adds the held back scans to the queue again.
+func (c *cooldown) requeue(scans []autoscan.Scan) error {
+	c.mu.Lock()
+	add := c.add
+	c.mu.Unlock()
+
+	if add == nil {
+		return errors.New("no queue to requeue the scans")
+	}
+
+	return add(scans...)
+}
+
+// drain stops the cooldowns of all libraries and returns their held back scans.
+func (c *cooldown) drain() []heldScans {
+	held := make([]heldScans, 0)
+	if c == nil {
+		return held
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, paths := range c.pending {
+		if timer, ok := c.timers[id]; ok {
+			timer.Stop()
+		}
+
+		held = append(held, heldScans{
+			lib:   c.libs[id],
+			paths: paths,
+			scans: c.scans[id],
+		})
+	}
+
+	c.pending = make(map[int][]string)
+	c.scans = make(map[int][]autoscan.Scan)
+	c.timers = make(map[int]*time.Timer)
+
+	sort.Slice(held, func(i, j int) bool { return held[i].lib.ID < held[j].lib.ID })
+	return held
+}
+
+func (c *cooldown) list() []autoscan.Cooldown {
+	cooldowns := make([]autoscan.Cooldown, 0)
+	if c == nil {
+		return cooldowns
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, last := range c.last {
+		remaining := c.duration - time.Since(last)
+		if remaining <= 0 {
+			continue
+		}
+
+		cooldowns = append(cooldowns, autoscan.Cooldown{
+			Library:   c.libs[id].Name,
+			Remaining: remaining,
+			Pending:   len(c.pending[id]),
+		})
+	}
+
+	sort.Slice(cooldowns, func(i, j int) bool { return cooldowns[i].Library < cooldowns[j].Library })
+	return cooldowns
+}
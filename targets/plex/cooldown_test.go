@@ -0,0 +1,105 @@
+package plex
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestCooldown(t *testing.T) {
+	c := newCooldown(50 * time.Millisecond)
+	lib := library{ID: 1, Name: "Movies", Path: "/data/Movies/"}
+
+	flushed := make(chan []string, 1)
+	flush := func(h heldScans) {
+		flushed <- h.paths
+	}
+
+	if c.hold(lib, "/data/Movies/Interstellar (2014)", autoscan.Scan{}, flush) {
+		t.Fatal("Expected the first scan to be sent")
+	}
+
+	for _, path := range []string{"/data/Movies/Parasite (2019)", "/data/Movies/Tenet (2020)", "/data/Movies/Tenet (2020)"} {
+		if !c.hold(lib, path, autoscan.Scan{Folder: path}, flush) {
+			t.Fatalf("Expected scan of %s to be held back", path)
+		}
+	}
+
+	cooldowns := c.list()
+	if len(cooldowns) != 1 || cooldowns[0].Library != "Movies" || cooldowns[0].Pending != 2 {
+		t.Errorf("Unexpected cooldowns: %v", cooldowns)
+	}
+
+	select {
+	case paths := <-flushed:
+		want := []string{"/data/Movies/Parasite (2019)", "/data/Movies/Tenet (2020)"}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("Flushed paths do not match: %v vs %v", paths, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Held back scans were not flushed")
+	}
+
+	// the flush restarts the cooldown
+	if !c.hold(lib, "/data/Movies/Interstellar (2014)", autoscan.Scan{}, func(heldScans) {}) {
+		t.Error("Expected the scan to be held back after the flush")
+	}
+}
+
+func TestCooldownDrain(t *testing.T) {
+	c := newCooldown(time.Hour)
+	movies := library{ID: 1, Name: "Movies", Path: "/data/Movies/"}
+	tv := library{ID: 2, Name: "TV", Path: "/data/TV/"}
+
+	flush := func(heldScans) {
+		t.Error("Expected the drained scans not to be flushed by the timer")
+	}
+
+	holds := []struct {
+		lib  library
+		path string
+	}{
+		{movies, "/data/Movies/Interstellar (2014)"},
+		{movies, "/data/Movies/Tenet (2020)"},
+		{tv, "/data/TV/Westworld"},
+		{tv, "/data/TV/Chernobyl"},
+	}
+
+	for _, h := range holds {
+		c.hold(h.lib, h.path, autoscan.Scan{Folder: h.path}, flush)
+	}
+
+	want := []heldScans{
+		{
+			lib:   movies,
+			paths: []string{"/data/Movies/Tenet (2020)"},
+			scans: []autoscan.Scan{{Folder: "/data/Movies/Tenet (2020)"}},
+		},
+		{
+			lib:   tv,
+			paths: []string{"/data/TV/Chernobyl"},
+			scans: []autoscan.Scan{{Folder: "/data/TV/Chernobyl"}},
+		},
+	}
+
+	if held := c.drain(); !reflect.DeepEqual(held, want) {
+		t.Errorf("Held scans do not match\n%+v\nvs\n%+v", held, want)
+	}
+
+	if held := c.drain(); len(held) != 0 {
+		t.Errorf("Expected no held scans after draining, got: %+v", held)
+	}
+
+	var disabled *cooldown
+	if held := disabled.drain(); len(held) != 0 {
+		t.Errorf("Expected no held scans without a cooldown, got: %+v", held)
+	}
+}
+
+func TestCooldownDisabled(t *testing.T) {
+	if c := newCooldown(0); c != nil {
+		t.Errorf("Expected no cooldown, got: %v", c)
+	}
+}
@@ -0,0 +1,259 @@
+package plex
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakePlexToken is the token accepted by a fakePlex.
+const fakePlexToken = "token"
+
+// A fakeLibrary is a library section served by a fakePlex.
+type fakeLibrary struct {
+	ID      int
+	Title   string
+	Type    string
+	Scanner string
+	Paths   []string
+
+	// Items maps the rating keys of the items of the library to their files.
+	Items map[int][]string
+}
+
+// A fakeRequest is a request received by a fakePlex.
+type fakeRequest struct {
+	Method string
+	Path   string
+
+	// Folder is the folder of a scan request, empty for a refresh of the entire library.
+	Folder string
+}
+
+// fakePlex is a fake Plex server, which serves the version, the libraries and the scans
+// from fixtures. Responses of an endpoint can be replaced by an error status, e.g. 401 or 429.
+type fakePlex struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	version   string
+	libraries []fakeLibrary
+	status    map[string]int
+	requests  []fakeRequest
+
+	// scanPolls is the number of polls of the libraries during which a scanned library is refreshing,
+	// refreshing counts down the remaining polls of every library.
+	// scannedAt counts the completed scans of every library.
+	scanPolls  int
+	refreshing map[string]int
+	scannedAt  map[string]int64
+
+	// ignoreFolders ignores the folder of scan requests, like some Plex versions do,
+	// so only refreshes of the entire library are scanned.
+	ignoreFolders bool
+}
+
+func newFakePlex(t *testing.T, version string, libraries ...fakeLibrary) *fakePlex {
+	f := &fakePlex{
+		version:    version,
+		libraries:  libraries,
+		status:     make(map[string]int),
+		refreshing: make(map[string]int),
+		scannedAt:  make(map[string]int64),
+	}
+
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// setStatus responds to the requests of the path with the status, 0 restores the fixtures.
+func (f *fakePlex) setStatus(path string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if status == 0 {
+		delete(f.status, path)
+		return
+	}
+
+	f.status[path] = status
+}
+
+// setScanPolls makes scanned libraries refresh for the number of polls of the libraries.
+func (f *fakePlex) setScanPolls(polls int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.scanPolls = polls
+}
+
+// setIgnoreFolders makes the scan requests of a folder do nothing.
+func (f *fakePlex) setIgnoreFolders(ignore bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ignoreFolders = ignore
+}
+
+// received returns the requests received so far.
+func (f *fakePlex) received() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]fakeRequest{}, f.requests...)
+}
+
+// scans returns the scan requests received so far as library ID and folder, e.g. "1:/data/Movies/Tenet (2020)".
+func (f *fakePlex) scans() []string {
+	scans := make([]string, 0)
+	for _, req := range f.received() {
+		if id, ok := scanLibraryID(req.Path); ok {
+			scans = append(scans, id+":"+req.Folder)
+		}
+	}
+
+	return scans
+}
+
+// scanLibraryID returns the library ID of the path of a scan request.
+func scanLibraryID(path string) (string, bool) {
+	id := strings.TrimPrefix(path, "/library/sections/")
+	if id == path || !strings.HasSuffix(id, "/refresh") {
+		return "", false
+	}
+
+	return strings.TrimSuffix(id, "/refresh"), true
+}
+
+func (f *fakePlex) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Folder: r.Form.Get("path")})
+
+	if r.Header.Get("X-Plex-Token") != fakePlexToken {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if status, ok := f.status[r.URL.Path]; ok {
+		if status == http.StatusTooManyRequests {
+			rw.Header().Set("Retry-After", "1")
+		}
+
+		rw.WriteHeader(status)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		f.writeJSON(rw, map[string]any{"MediaContainer": map[string]any{"version": f.version}})
+	case r.URL.Path == "/library/sections":
+		f.writeJSON(rw, map[string]any{"MediaContainer": map[string]any{"Directory": f.directories()}})
+	case strings.HasPrefix(r.URL.Path, "/library/sections/") && strings.HasSuffix(r.URL.Path, "/all"):
+		lib, ok := f.library(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/library/sections/"), "/all"))
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		f.writeJSON(rw, map[string]any{"MediaContainer": map[string]any{"Metadata": lib.metadata()}})
+	case strings.HasPrefix(r.URL.Path, "/library/sections/") || strings.HasPrefix(r.URL.Path, "/library/metadata/"):
+		id, ok := scanLibraryID(r.URL.Path)
+		switch {
+		case ok && !f.hasLibrary(id):
+			rw.WriteHeader(http.StatusNotFound)
+		case ok && (r.Form.Get("path") == "" || !f.ignoreFolders) && f.scanPolls > 0:
+			f.refreshing[id] = f.scanPolls
+		case ok && (r.Form.Get("path") == "" || !f.ignoreFolders):
+			f.scannedAt[id]++
+		}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakePlex) writeJSON(rw http.ResponseWriter, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+// directories returns the libraries in the format of the library sections of Plex.
+func (f *fakePlex) directories() []map[string]any {
+	directories := make([]map[string]any, 0, len(f.libraries))
+	for _, lib := range f.libraries {
+		locations := make([]map[string]string, 0, len(lib.Paths))
+		for _, p := range lib.Paths {
+			locations = append(locations, map[string]string{"path": p})
+		}
+
+		libType := lib.Type
+		if libType == "" {
+			libType = "movie"
+		}
+
+		id := strconv.Itoa(lib.ID)
+		refreshing := f.refreshing[id] > 0
+		if refreshing {
+			f.refreshing[id]--
+			if f.refreshing[id] == 0 {
+				f.scannedAt[id]++
+			}
+		}
+
+		directories = append(directories, map[string]any{
+			"key":        id,
+			"title":      lib.Title,
+			"type":       libType,
+			"scanner":    lib.Scanner,
+			"refreshing": refreshing,
+			"scannedAt":  f.scannedAt[id],
+			"Location":   locations,
+		})
+	}
+
+	return directories
+}
+
+func (f *fakePlex) hasLibrary(id string) bool {
+	_, ok := f.library(id)
+	return ok
+}
+
+func (f *fakePlex) library(id string) (fakeLibrary, bool) {
+	for _, lib := range f.libraries {
+		if strconv.Itoa(lib.ID) == id {
+			return lib, true
+		}
+	}
+
+	return fakeLibrary{}, false
+}
+
+// metadata returns the items in the format of the metadata of Plex.
+func (lib fakeLibrary) metadata() []map[string]any {
+	metadata := make([]map[string]any, 0, len(lib.Items))
+	for key, files := range lib.Items {
+		parts := make([]map[string]string, 0, len(files))
+		for _, file := range files {
+			parts = append(parts, map[string]string{"file": file})
+		}
+
+		metadata = append(metadata, map[string]any{
+			"ratingKey": strconv.Itoa(key),
+			"Media":     []map[string]any{{"Part": parts}},
+		})
+	}
+
+	return metadata
+}
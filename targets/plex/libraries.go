@@ -0,0 +1,86 @@
+package plex
+
+import (
+	"sync"
+	"time"
+)
+
+// libraryRefreshInterval is the minimum time between two refreshes of the libraries,
+// so folders outside of all libraries do not request the libraries on every scan.
+var libraryRefreshInterval = time.Minute
+
+// libraryList holds the libraries of Plex,
+// which are refreshed when a folder matches none of them.
+type libraryList struct {
+	mu        sync.RWMutex
+	libraries []library
+	refreshed time.Time
+}
+
+func newLibraryList(libraries []library) *libraryList {
+	return &libraryList{libraries: libraries, refreshed: time.Now()}
+}
+
+func (ll *libraryList) get() []library {
+	ll.mu.RLock()
+	defer ll.mu.RUnlock()
+
+	return ll.libraries
+}
+
+// refresh replaces the libraries with the libraries returned by fetch,
+// unless they have been refreshed within the libraryRefreshInterval.
+// It returns whether the libraries have been refreshed.
+func (ll *libraryList) refresh(fetch func() ([]library, error)) (bool, error) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	if time.Since(ll.refreshed) < libraryRefreshInterval {
+		return false, nil
+	}
+
+	ll.refreshed = time.Now()
+
+	libraries, err := fetch()
+	if err != nil {
+		return false, err
+	}
+
+	ll.libraries = libraries
+	return true, nil
+}
+
+// currentLibraries returns the most recently retrieved libraries.
+func (t target) currentLibraries() []library {
+	if t.refreshable == nil {
+		return t.libraries
+	}
+
+	return t.refreshable.get()
+}
+
+// refreshLibraries retrieves the libraries of Plex again, for folders which match no library.
+// A library or a location may have been added since the libraries were retrieved.
+// It returns whether the libraries have been refreshed.
+func (t target) refreshLibraries(folder string) bool {
+	if t.refreshable == nil {
+		return false
+	}
+
+	refreshed, err := t.refreshable.refresh(t.api.Libraries)
+	if err != nil {
+		t.log.Warn().
+			Err(err).
+			Str("path", folder).
+			Msg("Failed refreshing libraries")
+		return false
+	}
+
+	if refreshed {
+		t.log.Info().
+			Str("path", folder).
+			Msg("Folder matched no library, refreshed libraries and retrying")
+	}
+
+	return refreshed
+}
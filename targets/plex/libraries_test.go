@@ -0,0 +1,85 @@
+package plex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestRefreshLibraries(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path == "/library/sections" {
+			rw.Write([]byte(`{"MediaContainer": {"Directory": [
+				{"key": "1", "title": "Movies", "Location": [{"path": "/data/Movies"}]},
+				{"key": "2", "title": "Anime", "Location": [{"path": "/data/Anime"}]}
+			]}}`))
+		}
+	}))
+	defer server.Close()
+
+	defer func(interval time.Duration) { libraryRefreshInterval = interval }(libraryRefreshInterval)
+	libraryRefreshInterval = 0
+
+	var inFlight int64
+	tg := target{
+		refreshable: newLibraryList([]library{{ID: 1, Name: "Movies", Path: "/data/Movies/"}}),
+		inFlight:    &inFlight,
+		log:         zerolog.Nop(),
+		rewrite:     func(s string) string { return s },
+		api: newWatchdog(0, func() *apiClient {
+			return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+		}, zerolog.Nop()),
+	}
+
+	// the library of the folder has been added after the libraries were retrieved
+	if err := tg.Scan(autoscan.Scan{Folder: "/data/Anime/Akira (1988)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the folder is not within any library, even after refreshing
+	if err := tg.Scan(autoscan.Scan{Folder: "/data/Books/Dune"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"/library/sections",
+		"/library/sections/2/refresh",
+		"/library/sections",
+	}
+
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Requests do not match:\n%v\n%v", requests, want)
+	}
+}
+
+func TestRefreshLibrariesInterval(t *testing.T) {
+	ll := newLibraryList(nil)
+
+	fetched := 0
+	fetch := func() ([]library, error) {
+		fetched++
+		return []library{{ID: 1, Name: "Movies", Path: "/data/Movies/"}}, nil
+	}
+
+	// the libraries were retrieved just now
+	if refreshed, err := ll.refresh(fetch); err != nil || refreshed || fetched != 0 {
+		t.Errorf("Expected no refresh within the interval, got: %v, %v", refreshed, err)
+	}
+
+	ll.refreshed = time.Now().Add(-libraryRefreshInterval)
+	if refreshed, err := ll.refresh(fetch); err != nil || !refreshed || fetched != 1 {
+		t.Errorf("Expected a refresh after the interval, got: %v, %v", refreshed, err)
+	}
+
+	if len(ll.get()) != 1 {
+		t.Errorf("Expected the refreshed libraries, got: %v", ll.get())
+	}
+}
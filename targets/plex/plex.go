@@ -1,48 +1,205 @@
 package plex
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/rs/xid"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/cloudbox/autoscan"
 )
 
 type Config struct {
+	Name string `yaml:"name"`
+
 	URL              string             `yaml:"url"`
-	Token            string             `yaml:"token"`
+	Token            string             `yaml:"token" autoscan:"secret"`
+	TokenFile        string             `yaml:"token-file"`
 	Rewrite          []autoscan.Rewrite `yaml:"rewrite"`
+	Variants         []autoscan.Rewrite `yaml:"variants"`
 	Verbosity        string             `yaml:"verbosity"`
 	Timeout          string             `yaml:"timeout"`
 	Product          string             `yaml:"product"`
 	ClientIdentifier string             `yaml:"client-identifier"`
+	APIMode          string             `yaml:"api-mode"`
+	PathEncoding     string             `yaml:"path-encoding"`
+	ScanParam        string             `yaml:"scan-param"`
+	MinimumVersion   string             `yaml:"minimum-version"`
+	FailOnNoLibrary  bool               `yaml:"fail-on-no-library"`
+	ResolveSymlinks  bool               `yaml:"resolve-symlinks"`
+	SelfTest         bool               `yaml:"self-test"`
+	DefaultLibrary   string             `yaml:"default-library"`
+	FallbackLibrary  string             `yaml:"fallback-library"`
+	Scanners         []string           `yaml:"scanners"`
+	Agents           []string           `yaml:"agents"`
+	WaitForTarget    time.Duration      `yaml:"wait-for-target"`
+	LibraryRetries   int                `yaml:"library-retries"`
+	Cooldown         time.Duration      `yaml:"cooldown"`
+	DispatchOrder    int                `yaml:"dispatch-order"`
+
+	// PartialScan scans the folder only instead of the entire library, true when unset.
+	PartialScan *bool `yaml:"partial-scan"`
+
+	// WaitForCompletion waits at most this long for Plex to complete a scan,
+	// and refreshes the entire library when Plex ignored the scan of the folder.
+	WaitForCompletion time.Duration `yaml:"wait-for-completion"`
+
+	// ScanParams are extra query parameters added to the scan requests.
+	ScanParams map[string]string `yaml:"scan-params"`
+
+	MaxConcurrentScans int `yaml:"max-concurrent-scans"`
+	ResetClientAfter   int `yaml:"reset-client-after"`
+
+	// Credentials of an authentication gateway in front of Plex.
+	Cookies    map[string]string `yaml:"cookies" autoscan:"secret"`
+	AuthHeader string            `yaml:"auth-header" autoscan:"secret"`
+
+	// RewriteChain rewrites the output of Rewrite in stages, in order.
+	RewriteChain []autoscan.RewriteStage `yaml:"rewrite-chain"`
+
+	// TrimPrefix removes the first matching prefix from the folder before Rewrite.
+	TrimPrefix []string `yaml:"trim-prefix"`
+
+	// RefreshLibraries retrieves the libraries again when a folder matches no library.
+	RefreshLibraries bool `yaml:"refresh-libraries"`
+
+	// RootScans handles scans of a folder which is the root of a library: warn, reject or allow.
+	RootScans string `yaml:"root-scans"`
+
+	// DefaultTimeout is the timeout of the requests when no Timeout is configured,
+	// set to the global default-timeout.
+	DefaultTimeout time.Duration `yaml:"-"`
+
+	// StateDir is the directory in which the generated client identifier is persisted.
+	StateDir string `yaml:"-"`
+}
+
+func init() {
+	autoscan.RegisterTarget("plex", func(decode func(any) error, defaults autoscan.TargetDefaults) (autoscan.Target, error) {
+		c := Config{}
+		if err := decode(&c); err != nil {
+			return nil, err
+		}
+
+		c.DefaultTimeout = defaults.Timeout
+		c.StateDir = defaults.StateDir
+		return New(c)
+	})
 }
 
 type target struct {
+	name string
+
 	url       string
 	token     string
 	libraries []library
 
-	log     zerolog.Logger
-	rewrite autoscan.Rewriter
-	api     *apiClient
+	// refreshable holds the libraries instead when they are refreshed
+	// for folders which match no library, it is nil otherwise.
+	refreshable *libraryList
+
+	failOnNoLibrary bool
+	resolveSymlinks bool
+	defaultLibrary  string
+
+	// fallbackLibrary is refreshed instead of dropping scans of folders which match no library,
+	// and by scans without a folder when no default library is configured.
+	fallbackLibrary string
+
+	// fullRefresh refreshes the entire library instead of the folder,
+	// for Plex versions which ignore the folder of a scan request.
+	fullRefresh bool
+
+	// waitForCompletion is the time to wait for Plex to complete a scan,
+	// scans are not waited for when it is 0.
+	waitForCompletion time.Duration
+
+	// rootScans handles scans of a folder which is the root of a library.
+	rootScans string
+
+	// only libraries using one of the scanners and agents are scanned,
+	// any scanner or agent is allowed when none are given.
+	scanners []string
+	agents   []string
+
+	// sem bounds the number of scan requests in flight,
+	// it is nil when the number of scan requests is unbounded.
+	sem      chan struct{}
+	inFlight *int64
+
+	// cooldown is nil when scans are never held back.
+	cooldown *cooldown
+
+	// trash tracks the libraries whose trash is emptied in the background.
+	trash *trash
+
+	dispatchOrder int
+
+	log      zerolog.Logger
+	rewrite  autoscan.Rewriter
+	variants variants
+	api      *watchdog
 }
 
 func New(c Config) (autoscan.Target, error) {
+	name := c.Name
+	if name == "" {
+		name = "plex"
+	}
+
 	l := autoscan.GetLogger(c.Verbosity).With().
-		Str("target", "plex").
+		Str("target", name).
 		Str("url", c.URL).Logger()
 
-	rewriter, err := autoscan.NewRewriter(c.Rewrite)
+	rewriter, err := autoscan.NewRewriteChain(c.Rewrite, c.RewriteChain)
+	if err != nil {
+		return nil, err
+	}
+
+	rewriter = autoscan.TrimPrefix(c.TrimPrefix, rewriter)
+
+	variants, err := newVariants(c.Variants)
 	if err != nil {
 		return nil, err
 	}
 
-	timeout, err := parseTimeout(c.Timeout)
+	if c.MaxConcurrentScans < 0 {
+		return nil, fmt.Errorf("invalid plex max-concurrent-scans %d: must not be negative", c.MaxConcurrentScans)
+	}
+
+	if c.DispatchOrder < 0 {
+		return nil, fmt.Errorf("invalid plex dispatch-order %d: must not be negative", c.DispatchOrder)
+	}
+
+	var sem chan struct{}
+	if c.MaxConcurrentScans > 0 {
+		sem = make(chan struct{}, c.MaxConcurrentScans)
+	}
+
+	timeout, err := parseTimeout(c.Timeout, c.DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(c.Timeout) == "" && timeout > 0 {
+		l.Info().
+			Stringer("timeout", timeout).
+			Msg("No timeout configured, using the default timeout")
+	}
+
+	token, err := readToken(c.Token, c.TokenFile)
 	if err != nil {
 		return nil, err
 	}
@@ -54,44 +211,245 @@ func New(c Config) (autoscan.Target, error) {
 
 	clientIdentifier := c.ClientIdentifier
 	if strings.TrimSpace(clientIdentifier) == "" {
-		clientIdentifier = defaultClientIdentifier(c.URL)
+		clientIdentifier, err = persistentClientIdentifier(c.StateDir)
+		if err != nil {
+			clientIdentifier = defaultClientIdentifier(c.URL)
+			l.Warn().
+				Err(err).
+				Str("client_identifier", clientIdentifier).
+				Msg("Failed persisting client identifier, falling back to URL-derived identifier")
+		}
+	}
+
+	auth, err := parseGatewayAuth(c.Cookies, c.AuthHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	scanParam, err := parseScanParam(c.ScanParam)
+	if err != nil {
+		return nil, err
+	}
+
+	minimumVersion, err := parseMinimumVersion(c.MinimumVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	newRequester := func(param string) (scanRequester, error) {
+		requester, err := newScanRequester(c.APIMode, c.PathEncoding, param)
+		if err != nil {
+			return nil, err
+		}
+
+		return withScanParams(requester, c.ScanParams)
+	}
+
+	// validate the scan requests before connecting, the parameter of auto is selected once connected
+	if _, err := newRequester(scanParam); err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(c.APIMode), "v2") {
+		l.Warn().Msg("Plex is not known to accept the scan requests of api-mode v2, use v1 unless scans are verified to work")
 	}
 
-	api := newAPIClient(c.URL, c.Token, l, timeout, product, clientIdentifier)
+	rootScans, err := parseRootScans(c.RootScans)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ResetClientAfter < 0 {
+		return nil, fmt.Errorf("invalid plex reset-client-after %d: must not be negative", c.ResetClientAfter)
+	}
+
+	libraryRetries := c.LibraryRetries
+	if libraryRetries == 0 {
+		libraryRetries = defaultLibraryRetries
+	}
 
-	version, err := api.Version()
+	// the scan requests depend on the version, so the version and libraries are retrieved with a client of its own
+	conn := newAPIClient(c.URL, token, l, timeout, product, clientIdentifier, auth, nil)
+	version, libraries, err := connect(conn, l, c.WaitForTarget, libraryRetries)
+	conn.client.CloseIdleConnections()
 	if err != nil {
 		return nil, err
 	}
 
 	l.Debug().Msgf("Plex version: %s", version)
-	if !isSupportedVersion(version) {
-		return nil, fmt.Errorf("plex running unsupported version %s: %w", version, autoscan.ErrFatal)
+	if !isSupportedVersion(version, minimumVersion) {
+		return nil, fmt.Errorf("plex running unsupported version %s, must be at least %s: %w", version, minimumVersion, autoscan.ErrFatal)
 	}
 
-	libraries, err := api.Libraries()
+	if scanParam == "" {
+		scanParam = scanParamOf(version)
+		l.Debug().
+			Str("version", version).
+			Str("scan_param", scanParam).
+			Msg("Selected scan parameter for the Plex version")
+	}
+
+	scanRequester, err := newRequester(scanParam)
 	if err != nil {
 		return nil, err
 	}
 
+	api := newWatchdog(c.ResetClientAfter, func() *apiClient {
+		return newAPIClient(c.URL, token, l, timeout, product, clientIdentifier, auth, scanRequester)
+	}, l)
+
 	l.Debug().
 		Interface("libraries", libraries).
 		Msg("Retrieved libraries")
 
+	if c.PartialScan != nil && !*c.PartialScan {
+		l.Info().Msg("Partial scans disabled, scans refresh the entire library")
+	}
+
+	if c.WaitForCompletion > 0 {
+		l.Info().
+			Dur("wait_for_completion", c.WaitForCompletion).
+			Msg("Waiting for scans to complete, ignored scans refresh the entire library")
+	}
+
+	if !hasScannerLibrary(libraries, c.Scanners, c.Agents) {
+		l.Warn().
+			Strs("scanners", c.Scanners).
+			Strs("agents", c.Agents).
+			Msg("No library uses the configured scanners and agents, scans are never routed")
+	}
+
+	for _, overlap := range overlappingLibraries(libraries, c.Scanners, c.Agents) {
+		l.Warn().
+			Str("library", overlap[0].Name).
+			Int("library_id", overlap[0].ID).
+			Str("library_path", overlap[0].Path).
+			Str("overlapping_library", overlap[1].Name).
+			Int("overlapping_library_id", overlap[1].ID).
+			Str("overlapping_library_path", overlap[1].Path).
+			Msg("Libraries have overlapping paths, scans of the overlapping folders are sent to both libraries")
+	}
+
+	if c.SelfTest {
+		unroutable, err := unroutableRewrites(c.Rewrite, c.RewriteChain, libraries)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range unroutable {
+			l.Warn().
+				Str("from", rule.From).
+				Str("to", rule.To).
+				Msg("Rewrite rule does not match any library, scans rewritten by this rule are never routed")
+		}
+	}
+
+	var refreshable *libraryList
+	if c.RefreshLibraries {
+		refreshable = newLibraryList(libraries)
+	}
+
 	return &target{
+		name: name,
+
 		url:       c.URL,
-		token:     c.Token,
+		token:     token,
 		libraries: libraries,
 
-		log:     l,
-		rewrite: rewriter,
-		api:     api,
+		failOnNoLibrary: c.FailOnNoLibrary,
+		resolveSymlinks: c.ResolveSymlinks,
+		defaultLibrary:  c.DefaultLibrary,
+		fallbackLibrary: c.FallbackLibrary,
+
+		fullRefresh:       c.PartialScan != nil && !*c.PartialScan,
+		waitForCompletion: c.WaitForCompletion,
+		rootScans:         rootScans,
+
+		refreshable: refreshable,
+
+		scanners: c.Scanners,
+		agents:   c.Agents,
+
+		sem:      sem,
+		inFlight: new(int64),
+		cooldown: newCooldown(c.Cooldown),
+		trash:    newTrash(),
+
+		dispatchOrder: c.DispatchOrder,
+
+		log:      l,
+		rewrite:  rewriter,
+		variants: variants,
+		api:      api,
 	}, nil
 }
 
-func parseTimeout(raw string) (time.Duration, error) {
+// connectRetryInterval is the time between attempts to reach Plex at startup.
+var connectRetryInterval = 5 * time.Second
+
+// defaultLibraryRetries is the number of retries of the initial library request.
+const defaultLibraryRetries = 3
+
+// libraryRetryBackoff is the time before the first retry of the initial library request,
+// it doubles with every retry.
+var libraryRetryBackoff = time.Second
+
+// connect retrieves the version and the libraries of Plex.
+// While Plex is unavailable, connect keeps retrying until the wait duration elapses.
+// Once Plex is online, only the retries of getLibraries apply to the libraries.
+func connect(api *apiClient, l zerolog.Logger, wait time.Duration, libraryRetries int) (string, []library, error) {
+	deadline := time.Now().Add(wait)
+
+	for attempt := 1; ; attempt++ {
+		version, err := api.Version()
+		if err == nil {
+			libraries, err := getLibraries(api, l, libraryRetries)
+			if err != nil {
+				return "", nil, err
+			}
+
+			return version, libraries, nil
+		}
+
+		if !errors.Is(err, autoscan.ErrTargetUnavailable) || time.Now().Add(connectRetryInterval).After(deadline) {
+			return "", nil, err
+		}
+
+		l.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Msgf("Plex is unavailable, retrying in %s", connectRetryInterval)
+
+		time.Sleep(connectRetryInterval)
+	}
+}
+
+// getLibraries retrieves the libraries of Plex.
+// Plex may fail to list its libraries right after it has started,
+// so the request is retried with backoff, unless the error is fatal.
+func getLibraries(api *apiClient, l zerolog.Logger, retries int) ([]library, error) {
+	backoff := libraryRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		libraries, err := api.Libraries()
+		if err == nil || attempt > retries || errors.Is(err, autoscan.ErrFatal) {
+			return libraries, err
+		}
+
+		l.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Msgf("Failed retrieving libraries, retrying in %s", backoff)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// parseTimeout returns the configured timeout, or the default timeout when none is configured.
+func parseTimeout(raw string, defaultTimeout time.Duration) (time.Duration, error) {
 	if strings.TrimSpace(raw) == "" {
-		return 0, nil
+		return defaultTimeout, nil
 	}
 
 	timeout, err := time.ParseDuration(raw)
@@ -106,6 +464,71 @@ func parseTimeout(raw string) (time.Duration, error) {
 	return timeout, nil
 }
 
+// readToken returns the token read from the token file when set,
+// the inline token otherwise.
+func readToken(token string, tokenFile string) (string, error) {
+	if tokenFile == "" {
+		return token, nil
+	}
+
+	b, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed reading plex token-file: %w", err)
+	}
+
+	token = strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("plex token-file %s is empty", tokenFile)
+	}
+
+	return token, nil
+}
+
+// parseGatewayAuth parses the cookies and the auth header, formatted as "Name: value".
+func parseGatewayAuth(cookies map[string]string, authHeader string) (gatewayAuth, error) {
+	auth := gatewayAuth{}
+
+	names := make([]string, 0, len(cookies))
+	for name := range cookies {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		cookie := &http.Cookie{Name: name, Value: cookies[name]}
+		if err := cookie.Valid(); err != nil {
+			return auth, fmt.Errorf("invalid plex cookie %q: %w", name, err)
+		}
+
+		auth.cookies = append(auth.cookies, cookie)
+	}
+
+	if strings.TrimSpace(authHeader) == "" {
+		return auth, nil
+	}
+
+	name, value, found := strings.Cut(authHeader, ":")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return auth, errors.New(`invalid plex auth-header: must be formatted as "Name: value"`)
+	}
+
+	auth.headerName = name
+	auth.headerValue = strings.TrimSpace(value)
+	return auth, nil
+}
+
+// clientIdentifierState is the name of the state holding the generated client identifier.
+const clientIdentifierState = "plex-client-identifier"
+
+// persistentClientIdentifier returns a random client identifier which is generated once,
+// so Plex recognises Autoscan as the same device across restarts.
+func persistentClientIdentifier(stateDir string) (string, error) {
+	return autoscan.LoadOrStoreState(stateDir, clientIdentifierState, func() string {
+		return "autoscan-" + xid.New().String()
+	})
+}
+
 func defaultClientIdentifier(rawURL string) string {
 	parsed, err := url.Parse(rawURL)
 	if err != nil || parsed.Host == "" {
@@ -125,44 +548,680 @@ func (t target) Available() error {
 	return err
 }
 
+func (t target) String() string {
+	return t.name
+}
+
 func (t target) Scan(scan autoscan.Scan) error {
-	// determine library for this scan
-	scanFolder := t.rewrite(scan.Folder)
+	if scan.Folder == "" {
+		libs, err := t.getDefaultLibraries()
+		if err != nil {
+			return t.noLibrary(scan, err)
+		}
+
+		return t.refresh(scan, libs)
+	}
+
+	// determine the scan requests of the folder and its variants
+	requests, err := t.getScanRequests(scan)
+	if err != nil && t.fallbackLibrary != "" {
+		libs, fallbackErr := t.getLibraries(t.fallbackLibrary, "fallback")
+		if fallbackErr != nil {
+			return t.noLibrary(scan, fmt.Errorf("%v, %v", err, fallbackErr))
+		}
+
+		t.log.Debug().
+			Err(err).
+			Str("id", scan.ID).
+			Msg("Folder matched no library, refreshing the fallback library")
+
+		return t.refresh(scan, libs)
+	}
+
+	if err != nil {
+		return t.noLibrary(scan, err)
+	}
+
+	// the scan requests are sent concurrently, at most max-concurrent-scans at once
+	g := new(errgroup.Group)
+	deferred := false
+	for _, req := range requests {
+		lib, path := req.lib, req.path
+
+		l := t.log.With().
+			Str("id", scan.ID).
+			Str("path", path).
+			Str("library", lib.Name).
+			Logger()
+
+		if scan.Deep {
+			l = l.With().Bool("deep", true).Logger()
+		}
+
+		// a scan of the library root scans the entire library,
+		// which is likely caused by a mistake in the rewrite rules unless a deep scan was requested.
+		if !scan.Deep && isLibraryRoot(lib, path) {
+			switch t.rootScans {
+			case rootScansReject:
+				l.Warn().Msg("Folder is the root of the library, scan rejected")
+				continue
+			case rootScansWarn:
+				l.Warn().Msg("Folder is the root of the library, scanning the entire library")
+			}
+		}
+
+		// deletions bypass the cooldown, so removed items are cleared promptly
+		if t.cooldown != nil && !scan.Deleted && t.cooldown.hold(lib, path, scan, t.flush) {
+			l.Debug().Msg("Library is cooling down, scan held back")
+			deferred = true
+			continue
+		}
+
+		g.Go(func() error {
+			l.Trace().Msg("Sending scan request")
+
+			if err := t.scanFolder(lib, path, l); err != nil {
+				return err
+			}
+
+			if scan.Deleted {
+				if err := t.emptyTrash(lib, l); err != nil {
+					return err
+				}
+			}
+
+			l.Info().Msg("Scan moved to target")
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	if deferred {
+		return autoscan.ErrScanDeferred
+	}
+
+	return nil
+}
+
+// A scanRequest is a scan of a path within a library.
+type scanRequest struct {
+	lib  library
+	path string
+}
+
+// scanKey identifies a scan request, as libraries cannot be compared.
+type scanKey struct {
+	libraryID int
+	path      string
+}
+
+// getScanRequests returns the scan requests of the folder and its variants.
+// When the folder matches no library, the libraries are refreshed and matched once more.
+func (t target) getScanRequests(scan autoscan.Scan) ([]scanRequest, error) {
+	requests, err := t.matchScanRequests(scan)
+	if err != nil && t.refreshLibraries(scan.Folder) {
+		return t.matchScanRequests(scan)
+	}
+
+	return requests, err
+}
+
+// matchScanRequests returns the scan requests of the folder and its variants.
+// Variants resolving to the same library and path are scanned once.
+func (t target) matchScanRequests(scan autoscan.Scan) ([]scanRequest, error) {
+	requests := make([]scanRequest, 0)
+	seen := make(map[scanKey]bool)
+
+	var err error
+	for _, folder := range t.variants.expand(scan.Folder) {
+		scanFolder := t.rewrite(t.resolve(folder))
+
+		var libs []library
+		libs, err = t.getScanLibrary(scanFolder)
+		if err != nil {
+			continue
+		}
+
+		for _, lib := range libs {
+			// a deep scan covers the entire library instead of the folder
+			req := scanRequest{lib: lib, path: canonicalPath(lib, scanFolder)}
+			switch {
+			case t.fullRefresh:
+				req.path = ""
+			case scan.Deep:
+				req.path = lib.Path
+			}
+
+			key := scanKey{libraryID: lib.ID, path: req.path}
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			requests = append(requests, req)
+		}
+	}
+
+	if len(requests) == 0 {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// The ways to handle scans of a folder which is the root of a library.
+const (
+	rootScansWarn   = "warn"
+	rootScansReject = "reject"
+	rootScansAllow  = "allow"
+)
+
+func parseRootScans(raw string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(raw)); mode {
+	case "":
+		return rootScansWarn, nil
+	case rootScansWarn, rootScansReject, rootScansAllow:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid plex root-scans %q: must be warn, reject or allow", raw)
+	}
+}
+
+// isLibraryRoot returns whether the path is the location of the library it is scanned in.
+func isLibraryRoot(lib library, p string) bool {
+	return p != "" && p == strings.TrimSuffix(lib.Path, "/")
+}
+
+// canonicalPath returns the folder as a canonical path within the library.
+func canonicalPath(lib library, folder string) string {
+	if p, ok := libraryPath(lib, folder, false); ok {
+		return p
+	}
+
+	p, _ := libraryPath(lib, folder, true)
+	return p
+}
+
+// emptyTrash removes the deleted items from the library once Plex has completed scanning it,
+// as the items are only marked as deleted by the scan, which runs in the background.
+// When scans are not waited for, the trash is emptied in the background,
+// so the scans of other folders are not held up while Plex is scanning.
+func (t target) emptyTrash(lib library, l zerolog.Logger) error {
+	if t.waitForCompletion <= 0 {
+		if t.trash.schedule(lib.ID) {
+			go t.emptyTrashWhenScanned(lib, l)
+		}
+
+		return nil
+	}
+
+	return t.sendEmptyTrash(lib, l)
+}
+
+// emptyTrashWhenScanned empties the trash of the library once Plex has completed scanning it,
+// once more for the deletions scanned in the meantime.
+func (t target) emptyTrashWhenScanned(lib library, l zerolog.Logger) {
+	for {
+		_, err := t.waitForScan(lib, nil, completionTimeout, l)
+		if errors.Is(err, errCompletionTimeout) {
+			l.Warn().
+				Err(err).
+				Msg("Library did not finish scanning in time, emptying trash anyway")
+		}
+
+		if err == nil || errors.Is(err, errCompletionTimeout) {
+			err = t.sendEmptyTrash(lib, l)
+		}
+
+		if err != nil {
+			l.Error().
+				Err(err).
+				Msg("Failed emptying trash of library")
+		}
+
+		if !t.trash.done(lib.ID) {
+			return
+		}
+	}
+}
+
+func (t target) sendEmptyTrash(lib library, l zerolog.Logger) error {
+	l.Trace().Msg("Sending empty trash request")
+
+	if err := t.api.EmptyTrash(lib.ID); err != nil {
+		return err
+	}
+
+	l.Debug().Msg("Emptied trash of library")
+	return nil
+}
+
+// flush sends the scans held back during the cooldown of the library.
+// Multiple held back paths are coalesced into a scan of the entire library.
+// When the scan request fails, the held back scans are added to the queue again,
+// as the processor removed them from the queue once they were held back.
+func (t target) flush(h heldScans) {
+	if len(h.paths) == 0 {
+		return
+	}
+
+	err := t.send(h.lib, h.paths)
+	if err == nil {
+		return
+	}
+
+	l := t.log.With().
+		Str("library", h.lib.Name).
+		Int("scans", len(h.scans)).
+		Logger()
+
+	if requeueErr := t.cooldown.requeue(h.scans); requeueErr != nil {
+		l.Error().
+			Err(err).
+			AnErr("requeue_error", requeueErr).
+			Msg("Failed sending scan request after cooldown, held back scans are lost")
+		return
+	}
+
+	l.Warn().
+		Err(err).
+		Msg("Failed sending scan request after cooldown, held back scans are queued again")
+}
+
+// SetRequeue sets the function adding the held back scans to the queue again,
+// when they could not be sent once the cooldown elapsed.
+func (t target) SetRequeue(add autoscan.ProcessorFunc) {
+	t.cooldown.setRequeue(add)
+}
+
+// send sends a single scan request of the held back paths of the library.
+func (t target) send(lib library, paths []string) error {
+	path := paths[0]
+	if len(paths) > 1 {
+		path = lib.Path
+	}
+
+	l := t.log.With().
+		Str("path", path).
+		Str("library", lib.Name).
+		Int("coalesced", len(paths)).
+		Logger()
+
+	l.Trace().Msg("Sending scan request")
+
+	if err := t.scanFolder(lib, path, l); err != nil {
+		return err
+	}
+
+	l.Info().Msg("Scan moved to target")
+	return nil
+}
+
+// Drain sends the scans held back during the cooldowns right away.
+// The scans of the libraries which could not be scanned are returned.
+func (t target) Drain() (int, []autoscan.Scan) {
+	sent := 0
+	unsent := make([]autoscan.Scan, 0)
+	for _, h := range t.cooldown.drain() {
+		if err := t.send(h.lib, h.paths); err != nil {
+			t.log.Warn().
+				Err(err).
+				Str("library", h.lib.Name).
+				Msg("Failed sending held back scans on shutdown")
+
+			unsent = append(unsent, h.scans...)
+			continue
+		}
+
+		sent += len(h.scans)
+	}
+
+	return sent, unsent
+}
+
+// MatchLibrary returns the key of the libraries the folder belongs to,
+// for the deduplication of scans by library.
+func (t target) MatchLibrary(folder string) (string, bool) {
+	libs, err := t.getScanLibrary(t.rewrite(t.resolve(folder)))
+	if err != nil {
+		return "", false
+	}
+
+	ids := make([]string, 0, len(libs))
+	for _, lib := range libs {
+		ids = append(ids, strconv.Itoa(lib.ID))
+	}
+
+	return t.name + "/" + strings.Join(ids, "+"), true
+}
+
+// LibraryNames returns the names of the libraries the folder belongs to,
+// or of the fallback libraries when the folder belongs to none of the libraries.
+// Without a folder, the names of the default libraries are returned.
+func (t target) LibraryNames(folder string) []string {
+	if folder == "" {
+		return libraryNames(t.getDefaultLibraries())
+	}
+
+	libs, err := t.getScanLibrary(t.rewrite(t.resolve(folder)))
+	if err != nil && t.fallbackLibrary != "" {
+		libs, err = t.getLibraries(t.fallbackLibrary, "fallback")
+	}
+
+	return libraryNames(libs, err)
+}
+
+// libraryNames returns the names of the libraries, none when the libraries could not be determined.
+func libraryNames(libs []library, err error) []string {
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(libs))
+	for _, lib := range libs {
+		names = append(names, lib.Name)
+	}
+
+	return names
+}
+
+// Cooldowns returns the libraries which are cooling down.
+func (t target) Cooldowns() []autoscan.Cooldown {
+	return t.cooldown.list()
+}
+
+// noLibrary drops the scan which could not be routed to a library,
+// unless the target fails on scans without a library.
+func (t target) noLibrary(scan autoscan.Scan, err error) error {
+	if t.failOnNoLibrary {
+		return fmt.Errorf("%v: %w", err, autoscan.ErrNoLibrary)
+	}
+
+	t.log.Warn().
+		Err(err).
+		Str("id", scan.ID).
+		Msg("No target libraries found")
+
+	return nil
+}
+
+// refresh refreshes the entire libraries, for scans without a folder
+// and scans routed to the fallback library.
+// Like the scan requests, the libraries are refreshed concurrently.
+func (t target) refresh(scan autoscan.Scan, libs []library) error {
+	g := new(errgroup.Group)
+	for _, lib := range libs {
+		lib := lib
+		l := t.log.With().
+			Str("id", scan.ID).
+			Str("library", lib.Name).
+			Logger()
+
+		g.Go(func() error {
+			l.Trace().Msg("Sending refresh request")
+
+			if err := t.scanFolder(lib, "", l); err != nil {
+				return err
+			}
+
+			if scan.Deleted {
+				if err := t.emptyTrash(lib, l); err != nil {
+					return err
+				}
+			}
+
+			l.Info().Msg("Library refresh moved to target")
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// getDefaultLibraries returns the libraries matching the default library,
+// or the fallback library when no default library is configured.
+func (t target) getDefaultLibraries() ([]library, error) {
+	switch {
+	case t.defaultLibrary != "":
+		return t.getLibraries(t.defaultLibrary, "default")
+	case t.fallbackLibrary != "":
+		return t.getLibraries(t.fallbackLibrary, "fallback")
+	default:
+		return nil, errors.New("scan without folder: no default-library configured")
+	}
+}
+
+// getLibraries returns the libraries matching the library,
+// either by name or by type (e.g. movie, show or artist).
+func (t target) getLibraries(name string, kind string) ([]library, error) {
+	libraries := make([]library, 0)
+	seen := make(map[int]bool)
+
+	for _, l := range t.currentLibraries() {
+		if seen[l.ID] || (l.Name != name && l.Type != name) || !t.usesScanner(l) {
+			continue
+		}
+
+		seen[l.ID] = true
+		libraries = append(libraries, l)
+	}
+
+	if len(libraries) == 0 {
+		return nil, fmt.Errorf("%v: failed determining %s libraries", name, kind)
+	}
+
+	return libraries, nil
+}
+
+// scan sends the scan request once a slot is available.
+func (t target) scan(path string, libraryID int) error {
+	if t.sem != nil {
+		t.sem <- struct{}{}
+		defer func() { <-t.sem }()
+	}
+
+	atomic.AddInt64(t.inFlight, 1)
+	defer atomic.AddInt64(t.inFlight, -1)
+
+	return t.api.Scan(path, libraryID)
+}
+
+// RefreshItem refreshes the item with the given rating key, once a slot is available.
+func (t target) RefreshItem(ratingKey int) error {
+	if t.sem != nil {
+		t.sem <- struct{}{}
+		defer func() { <-t.sem }()
+	}
+
+	atomic.AddInt64(t.inFlight, 1)
+	defer atomic.AddInt64(t.inFlight, -1)
+
+	if err := t.api.RefreshItem(ratingKey); err != nil {
+		return err
+	}
+
+	t.log.Info().
+		Int("rating_key", ratingKey).
+		Msg("Item refresh moved to target")
+
+	return nil
+}
+
+// ScansInFlight returns the number of scan requests currently sent to Plex.
+func (t target) ScansInFlight() int64 {
+	return atomic.LoadInt64(t.inFlight)
+}
+
+// DispatchOrder returns the order in which Plex receives scans relative to the other targets.
+func (t target) DispatchOrder() int {
+	return t.dispatchOrder
+}
+
+func (t target) Analyze(scan autoscan.Scan) error {
+	// determine library for this analysis
+	scanFolder := t.rewrite(t.resolve(scan.Folder))
 
 	libs, err := t.getScanLibrary(scanFolder)
 	if err != nil {
 		t.log.Warn().
 			Err(err).
+			Str("id", scan.ID).
 			Msg("No target libraries found")
 
 		return nil
 	}
 
-	// send scan request
+	// only the items of the folder are analyzed, not the entire library
 	for _, lib := range libs {
 		l := t.log.With().
 			Str("path", scanFolder).
 			Str("library", lib.Name).
 			Logger()
 
-		l.Trace().Msg("Sending scan request")
+		if _, ok := itemTypes[lib.Type]; !ok {
+			l.Debug().
+				Str("type", lib.Type).
+				Msg("Library type cannot be analyzed, skipping analysis")
+			continue
+		}
 
-		if err := t.api.Scan(scanFolder, lib.ID); err != nil {
+		items, err := t.api.Items(lib)
+		if err != nil {
 			return err
 		}
 
-		l.Info().Msg("Scan moved to target")
+		keys := itemsInFolder(items, scanFolder)
+		if len(keys) == 0 {
+			l.Debug().Msg("No items found in folder, skipping analysis")
+			continue
+		}
+
+		for _, key := range keys {
+			l.Trace().
+				Int("rating_key", key).
+				Msg("Sending analyze request")
+
+			if err := t.api.Analyze(key); err != nil {
+				return err
+			}
+		}
+
+		l.Info().
+			Int("items", len(keys)).
+			Msg("Analysis moved to target")
 	}
 
 	return nil
 }
 
+// itemsInFolder returns the rating keys of the items with a file in the folder.
+func itemsInFolder(items []item, folder string) []int {
+	prefix := strings.TrimSuffix(folder, "/") + "/"
+
+	keys := make([]int, 0)
+	for _, it := range items {
+		for _, file := range it.Files {
+			if strings.HasPrefix(file, prefix) {
+				keys = append(keys, it.RatingKey)
+				break
+			}
+		}
+	}
+
+	return keys
+}
+
+// resolve evaluates the symlinks of the folder when enabled.
+// The original folder is returned when it cannot be resolved,
+// e.g. when the folder does not exist on the Autoscan host.
+func (t target) resolve(folder string) string {
+	if !t.resolveSymlinks {
+		return folder
+	}
+
+	resolved, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		t.log.Debug().
+			Err(err).
+			Str("path", folder).
+			Msg("Failed resolving symlinks, using original path")
+
+		return folder
+	}
+
+	return resolved
+}
+
+// unroutableRewrites returns the rewrite rules whose rewritten paths can never match a library.
+// The rules of the rewrite chain are checked as well, and the output of every rule
+// is rewritten by the stages of the chain following the rule before it is checked.
+//
+// This is a heuristic, only the literal prefix of the replacement
+// (up to the first capture group reference) is compared against the library paths.
+func unroutableRewrites(rules []autoscan.Rewrite, chain []autoscan.RewriteStage, libraries []library) ([]autoscan.Rewrite, error) {
+	unroutable := make([]autoscan.Rewrite, 0)
+
+	stages := append([]autoscan.RewriteStage{{Rewrite: rules}}, chain...)
+	for i, stage := range stages {
+		rest, err := autoscan.NewRewriteChain(nil, stages[i+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		unroutable = append(unroutable, unroutableRules(stage.Rewrite, rest, libraries)...)
+	}
+
+	return unroutable, nil
+}
+
+// unroutableRules returns the rules whose rewritten paths can never match a library,
+// once rewritten by the rest of the rewrite chain.
+func unroutableRules(rules []autoscan.Rewrite, rest autoscan.Rewriter, libraries []library) []autoscan.Rewrite {
+	unroutable := make([]autoscan.Rewrite, 0)
+
+	for _, rule := range rules {
+		prefix, _, _ := strings.Cut(rule.To, "$")
+		prefix = rest(prefix)
+
+		routable := false
+		for _, lib := range libraries {
+			for _, loc := range lib.locations() {
+				// a prefix shorter than the library path may still be completed by the captured path
+				if strings.HasPrefix(prefix, loc) || strings.HasPrefix(loc, prefix) {
+					routable = true
+					break
+				}
+			}
+		}
+
+		if !routable {
+			unroutable = append(unroutable, rule)
+		}
+	}
+
+	return unroutable
+}
+
+// getScanLibrary returns the libraries containing the folder,
+// with the Path of every library set to the location containing the folder.
+// The roots of the libraries are only compared ignoring case
+// when the folder is not within any of the roots as given.
 func (t target) getScanLibrary(folder string) ([]library, error) {
 	libraries := make([]library, 0)
 
-	for _, l := range t.libraries {
-		if strings.HasPrefix(folder, l.Path) {
-			libraries = append(libraries, l)
+	for _, foldCase := range []bool{false, true} {
+		for _, l := range t.currentLibraries() {
+			if loc, _, ok := matchLocation(l, folder, foldCase); ok && t.usesScanner(l) {
+				l.Path = loc
+				libraries = append(libraries, l)
+			}
+		}
+
+		if len(libraries) > 0 {
+			break
 		}
 	}
 
@@ -173,18 +1232,144 @@ func (t target) getScanLibrary(folder string) ([]library, error) {
 	return libraries, nil
 }
 
-func isSupportedVersion(version string) bool {
-	parts := strings.Split(version, ".")
-	if len(parts) < 2 {
-		return false
+// libraryPath returns the folder within the library as a canonical path:
+// cleaned, without trailing slash and starting with the root of the library as known by Plex.
+// False is returned when the folder is not a root of the library or a path within one.
+func libraryPath(lib library, folder string, foldCase bool) (string, bool) {
+	_, p, ok := matchLocation(lib, folder, foldCase)
+	return p, ok
+}
+
+// matchLocation returns the first location of the library containing the folder,
+// along with the folder as a canonical path within the location.
+func matchLocation(lib library, folder string, foldCase bool) (string, string, bool) {
+	for _, loc := range lib.locations() {
+		if p, ok := locationPath(loc, folder, foldCase); ok {
+			return loc, p, true
+		}
+	}
+
+	return "", "", false
+}
+
+// locationPath returns the folder as a canonical path within the location,
+// false when the folder is not the location or a path within it.
+func locationPath(location string, folder string, foldCase bool) (string, bool) {
+	folder = path.Clean(folder)
+	root := strings.TrimSuffix(location, "/")
+
+	if len(folder) < len(root) {
+		return "", false
+	}
+
+	prefix, rest := folder[:len(root)], folder[len(root):]
+	if prefix != root && !(foldCase && strings.EqualFold(prefix, root)) {
+		return "", false
+	}
+
+	// the root must end at a path separator, e.g. /data/Movies does not contain /data/Movies 4K
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+
+	return root + rest, true
+}
+
+// usesScanner returns whether the library uses one of the configured scanners and agents.
+func (t target) usesScanner(l library) bool {
+	return usesScanner(l, t.scanners, t.agents)
+}
+
+func usesScanner(l library, scanners []string, agents []string) bool {
+	return matchesName(scanners, l.Scanner) && matchesName(agents, l.Agent)
+}
+
+// hasScannerLibrary returns whether any of the libraries uses one of the scanners and agents.
+func hasScannerLibrary(libraries []library, scanners []string, agents []string) bool {
+	for _, l := range libraries {
+		if usesScanner(l, scanners, agents) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overlappingLibraries returns the pairs of distinct libraries using the scanners and agents
+// of which a location of one library equals or contains a location of the other.
+// The Path of both libraries is set to the overlapping location.
+func overlappingLibraries(libraries []library, scanners []string, agents []string) [][2]library {
+	overlaps := make([][2]library, 0)
+
+	for i, a := range libraries {
+		if !usesScanner(a, scanners, agents) {
+			continue
+		}
+
+		for _, b := range libraries[i+1:] {
+			if a.ID == b.ID || !usesScanner(b, scanners, agents) {
+				continue
+			}
+
+			for _, aLoc := range a.locations() {
+				for _, bLoc := range b.locations() {
+					_, aInB := locationPath(bLoc, aLoc, false)
+					_, bInA := locationPath(aLoc, bLoc, false)
+					if aInB || bInA {
+						overlap := [2]library{a, b}
+						overlap[0].Path, overlap[1].Path = aLoc, bLoc
+						overlaps = append(overlaps, overlap)
+					}
+				}
+			}
+		}
 	}
 
-	major, _ := strconv.Atoi(parts[0])
-	minor, _ := strconv.Atoi(parts[1])
+	return overlaps
+}
 
-	if major >= 2 || (major == 1 && minor >= 20) {
+// matchesName returns whether the name is one of the names, ignoring case.
+// Every name matches when no names are given.
+func matchesName(names []string, name string) bool {
+	if len(names) == 0 {
 		return true
 	}
 
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
 	return false
 }
+
+// defaultMinimumVersion is the oldest supported Plex version, unless overridden by minimum-version.
+const defaultMinimumVersion = "1.20"
+
+// parseMinimumVersion validates the minimum-version config option,
+// which must be dot separated numbers with an optional build suffix, e.g. 1.19.5.3112-b23ab3896.
+func parseMinimumVersion(version string) (string, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return defaultMinimumVersion, nil
+	}
+
+	for _, part := range strings.Split(strings.SplitN(version, "-", 2)[0], ".") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return "", fmt.Errorf("invalid plex minimum-version %q: must be a version such as %s", version, defaultMinimumVersion)
+		}
+	}
+
+	return version, nil
+}
+
+// isSupportedVersion returns whether the Plex version is at least the minimum version.
+func isSupportedVersion(version string, minimum string) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return false
+	}
+
+	return compareVersions(version, minimum) >= 0
+}
@@ -0,0 +1,1392 @@
+package plex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestUnroutableRewrites(t *testing.T) {
+	libraries := []library{
+		{ID: 1, Name: "Movies", Path: "/data/Movies/"},
+		{ID: 2, Name: "TV", Path: "/data/TV/"},
+	}
+
+	rules := []autoscan.Rewrite{
+		{From: "^/mnt/unionfs/Media/", To: "/data/"},
+		{From: "^/mnt/unionfs/Media/Movies/", To: "/data/Movies/"},
+		{From: "^/mnt/unionfs/Media/Music/", To: "/data/Music/"},
+		{From: "^/mnt/unionfs/(.*)", To: "/media/$1"},
+	}
+
+	want := []autoscan.Rewrite{
+		{From: "^/mnt/unionfs/Media/Music/", To: "/data/Music/"},
+		{From: "^/mnt/unionfs/(.*)", To: "/media/$1"},
+	}
+
+	got, err := unroutableRewrites(rules, nil, libraries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroutable rewrites do not match: %v vs %v", got, want)
+	}
+}
+
+func TestUnroutableRewriteChain(t *testing.T) {
+	libraries := []library{
+		{ID: 1, Name: "Movies", Path: "/data/Movies/"},
+		{ID: 2, Name: "TV", Path: "/data/Series/"},
+	}
+
+	// only the output of the chain matches the libraries
+	rules := []autoscan.Rewrite{
+		{From: "^/mnt/unionfs/Media/Movies/", To: "/media/Movies/"},
+		{From: "^/mnt/unionfs/Media/TV/", To: "/media/TV/"},
+		{From: "^/mnt/unionfs/Media/Music/", To: "/media/Music/"},
+	}
+
+	chain := []autoscan.RewriteStage{
+		{
+			Name:    "mount",
+			Rewrite: []autoscan.Rewrite{{From: "^/media/", To: "/data/"}},
+		},
+		{
+			Name: "rename",
+			Rewrite: []autoscan.Rewrite{
+				{From: "^/data/TV/", To: "/data/Series/"},
+				{From: "^/data/Books/", To: "/data/Audiobooks/"},
+			},
+		},
+	}
+
+	want := []autoscan.Rewrite{
+		{From: "^/mnt/unionfs/Media/Music/", To: "/media/Music/"},
+		{From: "^/data/Books/", To: "/data/Audiobooks/"},
+	}
+
+	got, err := unroutableRewrites(rules, chain, libraries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unroutable rewrites do not match: %v vs %v", got, want)
+	}
+}
+
+func TestOverlappingLibraries(t *testing.T) {
+	libraries := []library{
+		{ID: 1, Name: "Movies", Path: "/data/Movies/", Scanner: "Plex Movie"},
+		{ID: 1, Name: "Movies", Path: "/data/Movies 4K/", Scanner: "Plex Movie"},
+		{ID: 2, Name: "Movies (Foreign)", Path: "/data/Movies/", Scanner: "Plex Movie"},
+		{ID: 3, Name: "Media", Path: "/data/", Scanner: "Plex Video Files Scanner"},
+		{ID: 4, Name: "TV", Path: "/tv/", Scanner: "Plex TV Series"},
+		{ID: 5, Name: "TV (Data)", Path: "/data/TV", Scanner: "Plex TV Series"},
+		{ID: 6, Name: "TV (4K)", Path: "/data/TV4K", Scanner: "Plex TV Series"},
+	}
+
+	type Test struct {
+		Name     string
+		Scanners []string
+		Want     [][2]int
+	}
+
+	var testCases = []Test{
+		{
+			Name: "All libraries",
+			Want: [][2]int{{1, 2}, {1, 3}, {1, 3}, {2, 3}, {3, 5}, {3, 6}},
+		},
+		{
+			Name:     "Filtered by scanner",
+			Scanners: []string{"Plex Movie"},
+			Want:     [][2]int{{1, 2}},
+		},
+		{
+			Name:     "Sibling with common prefix",
+			Scanners: []string{"Plex TV Series"},
+			Want:     [][2]int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got := make([][2]int, 0)
+			for _, overlap := range overlappingLibraries(libraries, tc.Scanners, nil) {
+				got = append(got, [2]int{overlap[0].ID, overlap[1].ID})
+			}
+
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("Overlapping libraries do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestLibraryPath(t *testing.T) {
+	lib := library{ID: 1, Name: "Movies", Path: "/data/Movies/"}
+
+	type Test struct {
+		Name     string
+		Folder   string
+		FoldCase bool
+		Path     string
+		Ok       bool
+	}
+
+	var testCases = []Test{
+		{"Nested path", "/data/Movies/Interstellar (2014)/Extras", false, "/data/Movies/Interstellar (2014)/Extras", true},
+		{"Trailing slash", "/data/Movies/Interstellar (2014)/", false, "/data/Movies/Interstellar (2014)", true},
+		{"Duplicate slashes", "/data//Movies/Interstellar (2014)", false, "/data/Movies/Interstellar (2014)", true},
+		{"Root", "/data/Movies", false, "/data/Movies", true},
+		{"Root with trailing slash", "/data/Movies/", false, "/data/Movies", true},
+		{"Sibling with common prefix", "/data/Movies 4K/Interstellar (2014)", false, "", false},
+		{"Parent", "/data", false, "", false},
+		{"Different casing", "/data/movies/Interstellar (2014)", false, "", false},
+		{"Different casing folded", "/data/movies/Interstellar (2014)/", true, "/data/Movies/Interstellar (2014)", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path, ok := libraryPath(lib, tc.Folder, tc.FoldCase)
+			if path != tc.Path || ok != tc.Ok {
+				t.Errorf("Library paths do not match: %q, %v vs %q, %v", path, ok, tc.Path, tc.Ok)
+			}
+		})
+	}
+}
+
+func TestGetScanLibraryCasing(t *testing.T) {
+	tg := target{
+		libraries: []library{
+			{ID: 1, Name: "Movies", Path: "/data/Movies/"},
+			{ID: 2, Name: "movies", Path: "/data/movies/"},
+			{ID: 3, Name: "TV", Path: "/data/TV/"},
+		},
+	}
+
+	type Test struct {
+		Name   string
+		Folder string
+		IDs    []int
+	}
+
+	var testCases = []Test{
+		{"Exact casing is preferred", "/data/movies/Interstellar (2014)", []int{2}},
+		{"Casing is folded without exact match", "/data/tv/Westworld", []int{3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			libs, err := tg.getScanLibrary(tc.Folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]int, 0)
+			for _, lib := range libs {
+				ids = append(ids, lib.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tc.IDs) {
+				t.Errorf("Libraries do not match: %v vs %v", ids, tc.IDs)
+			}
+		})
+	}
+}
+
+func TestGetScanLibraryLocations(t *testing.T) {
+	tg := target{
+		libraries: []library{
+			{ID: 1, Name: "Movies", Path: "/mnt/disk1/Movies/", Paths: []string{"/mnt/disk1/Movies/", "/mnt/disk2/Movies/"}},
+			{ID: 2, Name: "TV", Path: "/mnt/disk1/TV/", Paths: []string{"/mnt/disk1/TV/"}},
+		},
+	}
+
+	type Test struct {
+		Name     string
+		Folder   string
+		ID       int
+		Location string
+		Path     string
+	}
+
+	var testCases = []Test{
+		{"First location", "/mnt/disk1/Movies/Interstellar (2014)", 1, "/mnt/disk1/Movies/", "/mnt/disk1/Movies/Interstellar (2014)"},
+		{"Secondary location", "/mnt/disk2/Movies/Tenet (2020)", 1, "/mnt/disk2/Movies/", "/mnt/disk2/Movies/Tenet (2020)"},
+		{"Secondary location root", "/mnt/disk2/Movies", 1, "/mnt/disk2/Movies/", "/mnt/disk2/Movies"},
+		{"Casing of a secondary location", "/mnt/disk2/movies/Tenet (2020)", 1, "/mnt/disk2/Movies/", "/mnt/disk2/Movies/Tenet (2020)"},
+		{"Single location", "/mnt/disk1/TV/Westworld", 2, "/mnt/disk1/TV/", "/mnt/disk1/TV/Westworld"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			libs, err := tg.getScanLibrary(tc.Folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(libs) != 1 || libs[0].ID != tc.ID || libs[0].Path != tc.Location {
+				t.Fatalf("Libraries do not match: %+v vs %d at %s", libs, tc.ID, tc.Location)
+			}
+
+			if path := canonicalPath(libs[0], tc.Folder); path != tc.Path {
+				t.Errorf("Paths do not match: %s vs %s", path, tc.Path)
+			}
+		})
+	}
+
+	if _, err := tg.getScanLibrary("/mnt/disk2/TV/Westworld"); err == nil {
+		t.Error("Expected no library outside of the locations")
+	}
+
+	// overlapping locations are reported with the overlapping location
+	overlaps := overlappingLibraries(append(tg.libraries, library{ID: 3, Name: "Disk 2", Path: "/mnt/disk2/"}), nil, nil)
+	if len(overlaps) != 1 || overlaps[0][0].Path != "/mnt/disk2/Movies/" || overlaps[0][1].Path != "/mnt/disk2/" {
+		t.Errorf("Unexpected overlaps: %+v", overlaps)
+	}
+}
+
+func TestMatchLibrary(t *testing.T) {
+	rewrite, err := autoscan.NewRewriter([]autoscan.Rewrite{{From: "^/mnt/unionfs/Media/", To: "/data/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tg := target{
+		name:    "plex",
+		rewrite: rewrite,
+		libraries: []library{
+			{ID: 1, Name: "Movies", Path: "/data/Movies/"},
+			{ID: 2, Name: "TV", Path: "/data/TV/"},
+			{ID: 3, Name: "TV (Kids)", Path: "/data/TV/"},
+		},
+	}
+
+	type Test struct {
+		Name   string
+		Folder string
+		Key    string
+		Match  bool
+	}
+
+	var testCases = []Test{
+		{"Library", "/mnt/unionfs/Media/Movies/Interstellar (2014)", "plex/1", true},
+		{"Libraries sharing a path", "/mnt/unionfs/Media/TV/Westworld", "plex/2+3", true},
+		{"No library", "/mnt/unionfs/Media/Music/Marshmello", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			key, ok := tg.MatchLibrary(tc.Folder)
+			if key != tc.Key || ok != tc.Match {
+				t.Errorf("Keys do not match: %q, %v vs %q, %v", key, ok, tc.Key, tc.Match)
+			}
+		})
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	dir := t.TempDir()
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("  file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name      string
+		Token     string
+		TokenFile string
+		Want      string
+		WantErr   bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:  "Inline token",
+			Token: "inline-token",
+			Want:  "inline-token",
+		},
+		{
+			Name:      "Token file takes precedence",
+			Token:     "inline-token",
+			TokenFile: tokenFile,
+			Want:      "file-token",
+		},
+		{
+			Name:      "Missing token file",
+			TokenFile: filepath.Join(dir, "missing"),
+			WantErr:   true,
+		},
+		{
+			Name:      "Empty token file",
+			TokenFile: emptyFile,
+			WantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := readToken(tc.Token, tc.TokenFile)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tc.Want {
+				t.Errorf("Tokens do not match: %s vs %s", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	type Test struct {
+		Name    string
+		Raw     string
+		Want    time.Duration
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{Name: "Default timeout", Raw: "", Want: time.Minute},
+		{Name: "Blank timeout", Raw: " ", Want: time.Minute},
+		{Name: "Own timeout", Raw: "10s", Want: 10 * time.Second},
+		{Name: "Invalid timeout", Raw: "ten", WantErr: true},
+		{Name: "Zero timeout", Raw: "0s", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := parseTimeout(tc.Raw, time.Minute)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tc.Want {
+				t.Errorf("Timeouts do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+	)
+
+	type Test struct {
+		Name    string
+		Timeout string
+		Want    time.Duration
+	}
+
+	var testCases = []Test{
+		{Name: "Default timeout", Want: 30 * time.Second},
+		{Name: "Own timeout", Timeout: "5s", Want: 5 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			decode := func(v any) error {
+				c := v.(*Config)
+				*c = fakePlexConfig(f)
+				c.Timeout = tc.Timeout
+				return nil
+			}
+
+			tg, err := autoscan.NewTarget("plex", decode, autoscan.TargetDefaults{Timeout: 30 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tg.(*target).api.client().client.Timeout; got != tc.Want {
+				t.Errorf("Timeouts do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	type Test struct {
+		Name    string
+		Minimum string
+		Version string
+		Want    bool
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{Name: "Default", Version: "1.20.0.3125-e4ba4fd0c", Want: true},
+		{Name: "Default unsupported", Version: "1.19.5.3112-b23ab3896", Want: false},
+		{Name: "Default major", Version: "2.0.0", Want: true},
+		{Name: "Malformed version", Version: "unknown", Want: false},
+		{Name: "Older override", Minimum: "1.19.5", Version: "1.19.5.3112-b23ab3896", Want: true},
+		{Name: "Newer override", Minimum: "1.32", Version: "1.30.2.6563-3d4dc0cce", Want: false},
+		{Name: "Override with build", Minimum: "1.32.5.7349-8f4248874", Version: "1.32.5.7349-8f4248874", Want: true},
+		{Name: "Invalid override", Minimum: "latest", WantErr: true},
+		{Name: "Empty part", Minimum: "1..20", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			minimum, err := parseMinimumVersion(tc.Minimum)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got := isSupportedVersion(tc.Version, minimum); got != tc.Want {
+				t.Errorf("Supported versions do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestGetDefaultLibraries(t *testing.T) {
+	libraries := []library{
+		{ID: 1, Name: "Movies", Type: "movie", Path: "/data/Movies/"},
+		{ID: 1, Name: "Movies", Type: "movie", Path: "/data/Movies-4K/"},
+		{ID: 2, Name: "Documentaries", Type: "movie", Path: "/data/Documentaries/"},
+		{ID: 3, Name: "TV", Type: "show", Path: "/data/TV/"},
+	}
+
+	type Test struct {
+		Name           string
+		DefaultLibrary string
+		WantIDs        []int
+		WantErr        bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:           "Matches libraries by type once",
+			DefaultLibrary: "movie",
+			WantIDs:        []int{1, 2},
+		},
+		{
+			Name:           "Matches libraries by name",
+			DefaultLibrary: "TV",
+			WantIDs:        []int{3},
+		},
+		{
+			Name:    "Fails without default library",
+			WantErr: true,
+		},
+		{
+			Name:           "Fails without matching library",
+			DefaultLibrary: "artist",
+			WantErr:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tg := target{libraries: libraries, defaultLibrary: tc.DefaultLibrary}
+
+			libs, err := tg.getDefaultLibraries()
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var ids []int
+			for _, lib := range libs {
+				ids = append(ids, lib.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tc.WantIDs) {
+				t.Errorf("Library IDs do not match: %v vs %v", ids, tc.WantIDs)
+			}
+		})
+	}
+}
+
+// setCompletion shortens the polls of libraries which are being scanned for the test.
+func setCompletion(t *testing.T, interval time.Duration, start time.Duration) {
+	defaultInterval, defaultStart := completionInterval, completionStart
+	t.Cleanup(func() {
+		completionInterval, completionStart = defaultInterval, defaultStart
+	})
+
+	completionInterval = interval
+	completionStart = start
+}
+
+func TestScanDeleted(t *testing.T) {
+	setCompletion(t, time.Millisecond, 50*time.Millisecond)
+
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+	)
+
+	tg, err := New(fakePlexConfig(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the trash is emptied once the library finished scanning
+	f.setScanPolls(2)
+	before := len(f.received())
+
+	if err := tg.Scan(autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tg.Scan(autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)", Deleted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the trash is emptied in the background
+	requests := make([]string, 0)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		requests = requests[:0]
+		for _, req := range f.received()[before:] {
+			requests = append(requests, req.Method+" "+req.Path)
+		}
+
+		if requests[len(requests)-1] == "PUT /library/sections/1/emptyTrash" {
+			break
+		}
+	}
+
+	want := []string{
+		"GET /library/sections/1/refresh",
+		"GET /library/sections/1/refresh",
+		"GET /library/sections",
+		"GET /library/sections",
+		"GET /library/sections",
+		"PUT /library/sections/1/emptyTrash",
+	}
+
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Requests do not match:\n%v\n%v", requests, want)
+	}
+}
+
+func TestRootScans(t *testing.T) {
+	type Test struct {
+		Name      string
+		RootScans string
+		Scan      autoscan.Scan
+		Want      []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Folder within the library",
+			RootScans: rootScansReject,
+			Scan:      autoscan.Scan{Folder: "/data/Movies/Tenet (2020)"},
+			Want:      []string{"/data/Movies/Tenet (2020)"},
+		},
+		{
+			Name:      "Warn about the library root",
+			RootScans: rootScansWarn,
+			Scan:      autoscan.Scan{Folder: "/data/Movies/"},
+			Want:      []string{"/data/Movies"},
+		},
+		{
+			Name:      "Reject the library root",
+			RootScans: rootScansReject,
+			Scan:      autoscan.Scan{Folder: "/data/Movies"},
+		},
+		{
+			Name:      "Allow the library root",
+			RootScans: rootScansAllow,
+			Scan:      autoscan.Scan{Folder: "/data/Movies"},
+			Want:      []string{"/data/Movies"},
+		},
+		{
+			Name:      "Deep scans are never rejected",
+			RootScans: rootScansReject,
+			Scan:      autoscan.Scan{Folder: "/data/Movies", Deep: true},
+			Want:      []string{"/data/Movies/"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var paths []string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Query().Get("path"))
+			}))
+			defer server.Close()
+
+			var inFlight int64
+			tg := target{
+				libraries: []library{{ID: 1, Name: "Movies", Path: "/data/Movies/"}},
+				rootScans: tc.RootScans,
+				inFlight:  &inFlight,
+				log:       zerolog.Nop(),
+				rewrite:   func(s string) string { return s },
+				api: newWatchdog(0, func() *apiClient {
+					return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+				}, zerolog.Nop()),
+			}
+
+			if err := tg.Scan(tc.Scan); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(paths, tc.Want) {
+				t.Errorf("Scanned paths do not match: %v vs %v", paths, tc.Want)
+			}
+		})
+	}
+}
+
+func TestResolveSymlinkCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+
+	if err := os.Symlink(b, a); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	tg := target{resolveSymlinks: true, log: zerolog.Nop()}
+
+	folder := filepath.Join(a, "Interstellar (2014)")
+	if resolved := tg.resolve(folder); resolved != folder {
+		t.Errorf("Expected the original path of a symlink cycle, got: %s", resolved)
+	}
+}
+
+func TestScanLibraryTypes(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/library/sections" {
+			rw.Write([]byte(`{"MediaContainer": {"Directory": [
+				{"key": "1", "title": "Movies", "type": "movie", "agent": "tv.plex.agents.movie", "Location": [{"path": "/data/Movies"}]},
+				{"key": "2", "title": "TV", "type": "show", "agent": "tv.plex.agents.series", "scanner": "Plex TV Series", "Location": [{"path": "/data/TV"}]},
+				{"key": "3", "title": "Music", "type": "artist", "agent": "tv.plex.agents.music", "Location": [{"path": "/data/Music"}]},
+				{"key": "4", "title": "Photos", "type": "photo", "agent": "com.plexapp.agents.none", "Location": [{"path": "/data/Photos"}]},
+				{"key": "5", "title": "Home Videos", "type": "movie", "agent": "com.plexapp.agents.none", "Location": [{"path": "/data/Home Videos"}]}
+			]}}`))
+			return
+		}
+
+		requests = append(requests, r.Method+" "+r.URL.String())
+	}))
+	defer server.Close()
+
+	newAPI := func() *apiClient {
+		return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+	}
+
+	libraries, err := newAPI().Libraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if libraries[1].Scanner != "Plex TV Series" || libraries[1].Agent != "tv.plex.agents.series" {
+		t.Errorf("Expected the scanner and agent of the library, got: %+v", libraries[1])
+	}
+
+	var inFlight int64
+	tg := target{
+		libraries: libraries,
+		inFlight:  &inFlight,
+		log:       zerolog.Nop(),
+		rewrite:   func(s string) string { return s },
+		api:       newWatchdog(0, newAPI, zerolog.Nop()),
+	}
+
+	type Test struct {
+		Name    string
+		Folder  string
+		Type    string
+		Request string
+	}
+
+	var testCases = []Test{
+		{"Movie", "/data/Movies/Interstellar (2014)", "movie", "GET /library/sections/1/refresh?path=%2Fdata%2FMovies%2FInterstellar+%282014%29"},
+		{"Show", "/data/TV/Westworld/Season 1", "show", "GET /library/sections/2/refresh?path=%2Fdata%2FTV%2FWestworld%2FSeason+1"},
+		{"Artist", "/data/Music/Marshmello/Joytime III (2019)", "artist", "GET /library/sections/3/refresh?path=%2Fdata%2FMusic%2FMarshmello%2FJoytime+III+%282019%29"},
+		{"Photo", "/data/Photos/2021/Holiday", "photo", "GET /library/sections/4/refresh?path=%2Fdata%2FPhotos%2F2021%2FHoliday"},
+		{"Other Videos", "/data/Home Videos/Birthday", "movie", "GET /library/sections/5/refresh?path=%2Fdata%2FHome+Videos%2FBirthday"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			requests = nil
+
+			libs, err := tg.getScanLibrary(tc.Folder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(libs) != 1 || libs[0].Type != tc.Type {
+				t.Errorf("Library types do not match: %v vs %s", libs, tc.Type)
+			}
+
+			if err := tg.Scan(autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(requests) != 1 || requests[0] != tc.Request {
+				t.Errorf("Requests do not match:\n%v\n%s", requests, tc.Request)
+			}
+		})
+	}
+}
+
+func TestFullRefresh(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+	}))
+	defer server.Close()
+
+	newAPI := func() *apiClient {
+		return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+	}
+
+	var inFlight int64
+	tg := target{
+		libraries: []library{
+			{ID: 1, Name: "Movies", Type: "movie", Path: "/data/Movies/"},
+		},
+		fullRefresh: true,
+		inFlight:    &inFlight,
+		log:         zerolog.Nop(),
+		rewrite:     func(s string) string { return s },
+		api:         newWatchdog(0, newAPI, zerolog.Nop()),
+	}
+
+	for _, scan := range []autoscan.Scan{
+		{Folder: "/data/Movies/Interstellar (2014)"},
+		{Folder: "/data/Movies/Tenet (2020)", Deep: true},
+	} {
+		if err := tg.Scan(scan); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"GET /library/sections/1/refresh", "GET /library/sections/1/refresh"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Requests do not match: %v vs %v", requests, want)
+	}
+}
+
+func TestWaitForCompletion(t *testing.T) {
+	setCompletion(t, time.Millisecond, 50*time.Millisecond)
+
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+	)
+
+	c := fakePlexConfig(f)
+	c.WaitForCompletion = time.Second
+
+	tg, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name      string
+		Polls     int
+		Ignore    bool
+		WantScans []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Scanned",
+			Polls:     2,
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+		},
+		{
+			Name:      "Ignored",
+			Polls:     2,
+			Ignore:    true,
+			WantScans: []string{"1:/data/Movies/Tenet (2020)", "1:"},
+		},
+		{
+			Name:      "Completed before the first poll",
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+		},
+		{
+			Name:      "Ignored without refreshing",
+			Ignore:    true,
+			WantScans: []string{"1:/data/Movies/Tenet (2020)", "1:"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			f.setScanPolls(tc.Polls)
+			f.setIgnoreFolders(tc.Ignore)
+			before := len(f.scans())
+
+			if err := tg.Scan(autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if scans := f.scans()[before:]; !reflect.DeepEqual(scans, tc.WantScans) {
+				t.Errorf("Scans do not match: %v vs %v", scans, tc.WantScans)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentScans(t *testing.T) {
+	type Test struct {
+		Name  string
+		Limit int
+		Want  int64
+	}
+
+	var testCases = []Test{
+		{Name: "One at a time", Limit: 1, Want: 1},
+		{Name: "Limited", Limit: 3, Want: 3},
+		{Name: "Unlimited", Limit: 0, Want: 6},
+	}
+
+	// the folder is in all six libraries, so a scan sends six scan requests
+	libraries := make([]library, 0)
+	for id := 1; id <= 6; id++ {
+		libraries = append(libraries, library{ID: id, Name: fmt.Sprintf("Movies %d", id), Path: "/data/Movies/"})
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var current, max int64
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt64(&current, 1)
+				defer atomic.AddInt64(&current, -1)
+
+				for {
+					m := atomic.LoadInt64(&max)
+					if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+						break
+					}
+				}
+
+				time.Sleep(50 * time.Millisecond)
+			}))
+			defer server.Close()
+
+			var sem chan struct{}
+			if tc.Limit > 0 {
+				sem = make(chan struct{}, tc.Limit)
+			}
+
+			var inFlight int64
+			tg := target{
+				libraries: libraries,
+				sem:       sem,
+				inFlight:  &inFlight,
+				log:       zerolog.Nop(),
+				rewrite:   func(s string) string { return s },
+				api: newWatchdog(0, func() *apiClient {
+					return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+				}, zerolog.Nop()),
+			}
+
+			if err := tg.Scan(autoscan.Scan{Folder: "/data/Movies/Tenet (2020)"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := atomic.LoadInt64(&max); got != tc.Want {
+				t.Errorf("Concurrent scans do not match: %d vs %d", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestScannerFilter(t *testing.T) {
+	libraries := []library{
+		{ID: 1, Name: "TV", Type: "show", Scanner: "Plex Series Scanner", Agent: "com.plexapp.agents.thetvdb", Path: "/data/TV/"},
+		{ID: 2, Name: "TV (new agent)", Type: "show", Scanner: "Plex TV Series", Agent: "tv.plex.agents.series", Path: "/data/TV/"},
+	}
+
+	type Test struct {
+		Name     string
+		Scanners []string
+		Agents   []string
+		WantIDs  []int
+	}
+
+	var testCases = []Test{
+		{"No filter", nil, nil, []int{1, 2}},
+		{"Scanner", []string{"plex tv series"}, nil, []int{2}},
+		{"Agent", nil, []string{"com.plexapp.agents.thetvdb"}, []int{1}},
+		{"Scanner and agent", []string{"Plex TV Series"}, []string{"com.plexapp.agents.thetvdb"}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tg := target{
+				libraries:      libraries,
+				defaultLibrary: "show",
+				scanners:       tc.Scanners,
+				agents:         tc.Agents,
+			}
+
+			if got := hasScannerLibrary(libraries, tc.Scanners, tc.Agents); got != (len(tc.WantIDs) > 0) {
+				t.Errorf("Expected a matching library: %v, got: %v", len(tc.WantIDs) > 0, got)
+			}
+
+			libs, _ := tg.getScanLibrary("/data/TV/Westworld/Season 1")
+			defaults, _ := tg.getDefaultLibraries()
+			for _, got := range [][]library{libs, defaults} {
+				var ids []int
+				for _, lib := range got {
+					ids = append(ids, lib.ID)
+				}
+
+				if !reflect.DeepEqual(ids, tc.WantIDs) {
+					t.Errorf("Library IDs do not match: %v vs %v", ids, tc.WantIDs)
+				}
+			}
+		})
+	}
+}
+
+// fakePlexConfig returns the config of a target of the fake Plex server.
+func fakePlexConfig(f *fakePlex) Config {
+	return Config{
+		URL:              f.URL,
+		Token:            fakePlexToken,
+		Timeout:          "5s",
+		ClientIdentifier: "autoscan-test",
+		Verbosity:        "disabled",
+		Rewrite:          []autoscan.Rewrite{{From: "/mnt/unionfs/Media/", To: "/data/"}},
+	}
+}
+
+func TestNew(t *testing.T) {
+	libraries := []fakeLibrary{
+		{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+		{ID: 2, Title: "TV", Type: "show", Paths: []string{"/data/TV"}},
+	}
+
+	type Test struct {
+		Name       string
+		Version    string
+		Minimum    string
+		Token      string
+		Status     map[string]int
+		WantErr    error
+		WantFailed bool
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Supported version",
+			Version: "1.32.5.7349-8f4248874",
+		},
+		{
+			Name:    "Unsupported version",
+			Version: "1.19.5.3112-b23ab3896",
+			WantErr: autoscan.ErrFatal,
+		},
+		{
+			Name:    "Minimum version override",
+			Version: "1.19.5.3112-b23ab3896",
+			Minimum: "1.19",
+		},
+		{
+			Name:    "Invalid token",
+			Version: "1.32.5.7349-8f4248874",
+			Token:   "expired",
+			WantErr: autoscan.ErrFatal,
+		},
+		{
+			Name:    "Unavailable",
+			Version: "1.32.5.7349-8f4248874",
+			Status:  map[string]int{"/": http.StatusServiceUnavailable},
+			WantErr: autoscan.ErrTargetUnavailable,
+		},
+		{
+			Name:       "Rate limited",
+			Version:    "1.32.5.7349-8f4248874",
+			Status:     map[string]int{"/library/sections": http.StatusTooManyRequests},
+			WantFailed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			f := newFakePlex(t, tc.Version, libraries...)
+			for path, status := range tc.Status {
+				f.setStatus(path, status)
+			}
+
+			c := fakePlexConfig(f)
+			c.MinimumVersion = tc.Minimum
+			if tc.Token != "" {
+				c.Token = tc.Token
+			}
+
+			tg, err := New(c)
+			switch {
+			case tc.WantErr != nil:
+				if !errors.Is(err, tc.WantErr) {
+					t.Fatalf("Expected %v, got: %v", tc.WantErr, err)
+				}
+				return
+			case tc.WantFailed:
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if got := tg.(*target).libraries; len(got) != len(libraries) || got[1].Path != "/data/TV/" || got[1].Type != "show" {
+				t.Errorf("Unexpected libraries: %+v", got)
+			}
+		})
+	}
+}
+
+func TestTargetScan(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+		fakeLibrary{ID: 2, Title: "TV", Type: "show", Paths: []string{"/data/TV"}},
+	)
+
+	tg, err := New(fakePlexConfig(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name      string
+		Folder    string
+		Status    int
+		WantErr   error
+		WantFail  bool
+		WantScans []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Movie",
+			Folder:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+		},
+		{
+			Name:      "Episode",
+			Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 1",
+			WantScans: []string{"2:/data/TV/Westworld/Season 1"},
+		},
+		{
+			Name:      "No library",
+			Folder:    "/mnt/unionfs/Media/Books/Dune",
+			WantScans: []string{},
+		},
+		{
+			Name:      "Unavailable",
+			Folder:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			Status:    http.StatusServiceUnavailable,
+			WantErr:   autoscan.ErrTargetUnavailable,
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+		},
+		{
+			Name:      "Rate limited",
+			Folder:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			Status:    http.StatusTooManyRequests,
+			WantFail:  true,
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			f.setStatus("/library/sections/1/refresh", tc.Status)
+			before := len(f.scans())
+
+			err := tg.Scan(autoscan.Scan{Folder: tc.Folder})
+			switch {
+			case tc.WantErr != nil:
+				if !errors.Is(err, tc.WantErr) {
+					t.Fatalf("Expected %v, got: %v", tc.WantErr, err)
+				}
+			case tc.WantFail:
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if scans := f.scans()[before:]; !reflect.DeepEqual(scans, tc.WantScans) {
+				t.Errorf("Scans do not match: %v vs %v", scans, tc.WantScans)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}, Items: map[int][]string{
+			10: {"/data/Movies/Tenet (2020)/Tenet (2020).mkv"},
+			11: {"/data/Movies/Tenet (2020) Extended/Tenet (2020).mkv"},
+			12: {"/data/Movies/Dune (2021)/Dune (2021).mkv"},
+		}},
+		fakeLibrary{ID: 2, Title: "TV", Type: "show", Paths: []string{"/data/TV"}, Items: map[int][]string{
+			20: {"/data/TV/Westworld/Season 1/Westworld - S01E01.mkv"},
+			21: {"/data/TV/Westworld/Season 1/Westworld - S01E02.mkv"},
+			22: {"/data/TV/Westworld/Season 2/Westworld - S02E01.mkv"},
+		}},
+	)
+
+	tg, err := New(fakePlexConfig(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Name   string
+		Folder string
+		Want   []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Movie",
+			Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			Want:   []string{"/library/metadata/10/analyze"},
+		},
+		{
+			Name:   "Season",
+			Folder: "/mnt/unionfs/Media/TV/Westworld/Season 1",
+			Want:   []string{"/library/metadata/20/analyze", "/library/metadata/21/analyze"},
+		},
+		{
+			Name:   "Not scanned yet",
+			Folder: "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+			Want:   []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			before := len(f.received())
+			if err := tg.(autoscan.Analyzer).Analyze(autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatal(err)
+			}
+
+			analyzed := make([]string, 0)
+			for _, req := range f.received()[before:] {
+				if strings.HasSuffix(req.Path, "/analyze") {
+					analyzed = append(analyzed, req.Path)
+				}
+			}
+
+			sort.Strings(analyzed)
+			if !reflect.DeepEqual(analyzed, tc.Want) {
+				t.Errorf("Analyzed items do not match: %v vs %v", analyzed, tc.Want)
+			}
+		})
+	}
+}
+
+func TestCooldownFlushFailed(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+	)
+
+	c := fakePlexConfig(f)
+	c.Cooldown = 50 * time.Millisecond
+
+	tg, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requeued := make(chan []autoscan.Scan, 1)
+	tg.(autoscan.Requeuer).SetRequeue(func(scans ...autoscan.Scan) error {
+		requeued <- scans
+		return nil
+	})
+
+	if err := tg.Scan(autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Tenet (2020)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scan is held back during the cooldown, and its scan request fails once the cooldown elapsed
+	f.setStatus("/library/sections/1/refresh", http.StatusServiceUnavailable)
+	held := autoscan.Scan{Folder: "/mnt/unionfs/Media/Movies/Dune (2021)", ID: "dune"}
+	if err := tg.Scan(held); !errors.Is(err, autoscan.ErrScanDeferred) {
+		t.Fatalf("Expected the scan to be deferred, got: %v", err)
+	}
+
+	select {
+	case scans := <-requeued:
+		if !reflect.DeepEqual(scans, []autoscan.Scan{held}) {
+			t.Errorf("Requeued scans do not match: %v vs %v", scans, []autoscan.Scan{held})
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Held back scan was not requeued")
+	}
+
+	want := []string{"1:/data/Movies/Tenet (2020)", "1:/data/Movies/Dune (2021)"}
+	if scans := f.scans(); !reflect.DeepEqual(scans, want) {
+		t.Errorf("Scans do not match: %v vs %v", scans, want)
+	}
+}
+
+func TestFallbackLibrary(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies"}},
+		fakeLibrary{ID: 2, Title: "TV", Type: "show", Paths: []string{"/data/TV"}},
+		fakeLibrary{ID: 3, Title: "Other", Paths: []string{"/data/Other"}},
+	)
+
+	type Test struct {
+		Name      string
+		Default   string
+		Fallback  string
+		Folder    string
+		WantErr   bool
+		WantScans []string
+		WantNames []string
+	}
+
+	var testCases = []Test{
+		{
+			Name:      "Matched folders ignore the fallback library",
+			Fallback:  "Other",
+			Folder:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+			WantScans: []string{"1:/data/Movies/Tenet (2020)"},
+			WantNames: []string{"Movies"},
+		},
+		{
+			Name:      "Unmatched folders refresh the fallback library",
+			Fallback:  "Other",
+			Folder:    "/mnt/unionfs/Media/Books/Dune",
+			WantScans: []string{"3:"},
+			WantNames: []string{"Other"},
+		},
+		{
+			Name:      "Unmatched folders are dropped without a fallback library",
+			Folder:    "/mnt/unionfs/Media/Books/Dune",
+			WantScans: []string{},
+		},
+		{
+			Name:      "Unmatched folders are dropped when the fallback library does not exist",
+			Fallback:  "Books",
+			Folder:    "/mnt/unionfs/Media/Books/Dune",
+			WantScans: []string{},
+		},
+		{
+			Name:      "Scans without a folder refresh the fallback library",
+			Fallback:  "Other",
+			WantScans: []string{"3:"},
+			WantNames: []string{"Other"},
+		},
+		{
+			Name:      "Scans without a folder prefer the default library",
+			Default:   "show",
+			Fallback:  "Other",
+			WantScans: []string{"2:"},
+			WantNames: []string{"TV"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := fakePlexConfig(f)
+			c.DefaultLibrary = tc.Default
+			c.FallbackLibrary = tc.Fallback
+
+			tg, err := New(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before := len(f.scans())
+			if err := tg.Scan(autoscan.Scan{Folder: tc.Folder}); err != nil {
+				t.Fatal(err)
+			}
+
+			if scans := f.scans()[before:]; !reflect.DeepEqual(scans, tc.WantScans) {
+				t.Errorf("Scans do not match: %v vs %v", scans, tc.WantScans)
+			}
+
+			names := tg.(autoscan.LibraryNamer).LibraryNames(tc.Folder)
+			if len(names) != 0 || len(tc.WantNames) != 0 {
+				if !reflect.DeepEqual(names, tc.WantNames) {
+					t.Errorf("Library names do not match: %v vs %v", names, tc.WantNames)
+				}
+			}
+		})
+	}
+}
+
+func TestGetScanLibrary(t *testing.T) {
+	f := newFakePlex(t, "1.32.5.7349-8f4248874",
+		fakeLibrary{ID: 1, Title: "Movies", Paths: []string{"/data/Movies", "/data2/Movies"}},
+		fakeLibrary{ID: 2, Title: "Movies 4K", Paths: []string{"/data/Movies 4K"}},
+		fakeLibrary{ID: 3, Title: "Kids", Paths: []string{"/data/Movies/Kids"}},
+	)
+
+	tg, err := New(fakePlexConfig(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		Folder  string
+		Want    []string
+		WantErr bool
+	}
+
+	var testCases = []Test{
+		{Folder: "/data/Movies/Tenet (2020)", Want: []string{"Movies:/data/Movies/"}},
+		{Folder: "/data2/Movies/Tenet (2020)", Want: []string{"Movies:/data2/Movies/"}},
+		{Folder: "/data/Movies 4K/Tenet (2020)", Want: []string{"Movies 4K:/data/Movies 4K/"}},
+		{Folder: "/data/Movies/Kids/Up (2009)", Want: []string{"Movies:/data/Movies/", "Kids:/data/Movies/Kids/"}},
+		{Folder: "/data/movies/Tenet (2020)", Want: []string{"Movies:/data/Movies/"}},
+		{Folder: "/data/Books/Dune", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Folder, func(t *testing.T) {
+			libs, err := tg.(*target).getScanLibrary(tc.Folder)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, lib := range libs {
+				got = append(got, lib.Name+":"+lib.Path)
+			}
+
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("Libraries do not match: %v vs %v", got, tc.Want)
+			}
+		})
+	}
+}
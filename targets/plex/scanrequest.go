@@ -0,0 +1,212 @@
+package plex
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// A scanRequester builds the request which asks Plex to scan a library.
+// An empty path refreshes the entire library.
+type scanRequester interface {
+	scanRequest(baseURL string, path string, libraryID int) (*http.Request, error)
+}
+
+func newScanRequester(mode string, encoding string, param string) (scanRequester, error) {
+	var percent bool
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "query":
+	case "percent":
+		percent = true
+	default:
+		return nil, fmt.Errorf("invalid plex path-encoding %q: must be query or percent", encoding)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "v1":
+		return scanRequestV1{param: param, percent: percent}, nil
+	case "v2":
+		return scanRequestV2{param: param, percent: percent}, nil
+	default:
+		return nil, fmt.Errorf("invalid plex api-mode %q: must be v1 or v2", mode)
+	}
+}
+
+// The names of the parameter holding the path of a scan request.
+const (
+	scanParamPath      = "path"
+	scanParamDirectory = "directory"
+	scanParamFile      = "file"
+)
+
+// A scanParamVersion is the name of the path parameter of the scan requests
+// of the Plex versions starting at version.
+type scanParamVersion struct {
+	version string
+	param   string
+}
+
+// scanParamVersions maps Plex versions to the name of the path parameter
+// of their scan requests, ordered by the minimum version, newest first.
+var scanParamVersions = []scanParamVersion{
+	{version: "1.20", param: scanParamPath},
+}
+
+// parseScanParam validates the scan-param config option.
+// An empty string is returned for auto, which selects the parameter by the Plex version.
+func parseScanParam(param string) (string, error) {
+	switch p := strings.ToLower(strings.TrimSpace(param)); p {
+	case "", "auto":
+		return "", nil
+	case scanParamPath, scanParamDirectory, scanParamFile:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid plex scan-param %q: must be auto, path, directory or file", param)
+	}
+}
+
+// scanParamOf returns the name of the path parameter of the scan requests of the Plex version.
+// Versions which are not mapped use path.
+func scanParamOf(version string) string {
+	for _, v := range scanParamVersions {
+		if compareVersions(version, v.version) >= 0 {
+			return v.param
+		}
+	}
+
+	return scanParamPath
+}
+
+// compareVersions compares the dot separated numbers of two Plex versions,
+// ignoring any build suffix such as -8f4248874.
+func compareVersions(a string, b string) int {
+	as := strings.Split(strings.SplitN(a, "-", 2)[0], ".")
+	bs := strings.Split(strings.SplitN(b, "-", 2)[0], ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// encodePath encodes the path parameter of a scan request, named path when param is empty.
+// All reserved characters, such as # and &, are escaped.
+// Spaces are encoded as + by default, or as %20 when percent is set.
+func encodePath(param string, path string, percent bool) string {
+	if path == "" {
+		return ""
+	}
+
+	if param == "" {
+		param = scanParamPath
+	}
+
+	encoded := url.QueryEscape(path)
+	if percent {
+		encoded = strings.ReplaceAll(encoded, "+", "%20")
+	}
+
+	return param + "=" + encoded
+}
+
+// scanRequestV1 passes the path as a query parameter of a GET request.
+type scanRequestV1 struct {
+	param   string
+	percent bool
+}
+
+func (r scanRequestV1) scanRequest(baseURL string, path string, libraryID int) (*http.Request, error) {
+	reqURL := autoscan.JoinURL(baseURL, "library", "sections", strconv.Itoa(libraryID), "refresh")
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.RawQuery = encodePath(r.param, path, r.percent)
+	return req, nil
+}
+
+// scanRequestV2 passes the path as a form encoded body of a POST request.
+// Plex is not known to accept this request, it is only sent when api-mode is explicitly set to v2.
+type scanRequestV2 struct {
+	param   string
+	percent bool
+}
+
+func (r scanRequestV2) scanRequest(baseURL string, path string, libraryID int) (*http.Request, error) {
+	reqURL := autoscan.JoinURL(baseURL, "library", "sections", strconv.Itoa(libraryID), "refresh")
+	req, err := http.NewRequest("POST", reqURL, strings.NewReader(encodePath(r.param, path, r.percent)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// reservedScanParams are the parameters set by autoscan itself,
+// which cannot be given as extra scan parameters.
+var reservedScanParams = []string{scanParamPath, scanParamDirectory, scanParamFile, "X-Plex-Token", "X-Plex-Product", "X-Plex-Client-Identifier"}
+
+// withScanParams returns a scanRequester which adds the extra query parameters to the scan requests.
+func withScanParams(requester scanRequester, params map[string]string) (scanRequester, error) {
+	if len(params) == 0 {
+		return requester, nil
+	}
+
+	values := make(url.Values, len(params))
+	for key, value := range params {
+		if strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid plex scan-params: empty parameter name")
+		}
+
+		for _, reserved := range reservedScanParams {
+			if strings.EqualFold(key, reserved) {
+				return nil, fmt.Errorf("invalid plex scan-params: %s is set by autoscan", key)
+			}
+		}
+
+		values.Set(key, value)
+	}
+
+	return scanParams{requester: requester, params: values.Encode()}, nil
+}
+
+// scanParams appends extra query parameters to the requests of a scanRequester.
+type scanParams struct {
+	requester scanRequester
+	params    string
+}
+
+func (r scanParams) scanRequest(baseURL string, path string, libraryID int) (*http.Request, error) {
+	req, err := r.requester.scanRequest(baseURL, path, libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.RawQuery == "" {
+		req.URL.RawQuery = r.params
+	} else {
+		req.URL.RawQuery += "&" + r.params
+	}
+
+	return req, nil
+}
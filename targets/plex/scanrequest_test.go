@@ -0,0 +1,308 @@
+package plex
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestScanRequest(t *testing.T) {
+	type Test struct {
+		Name        string
+		Mode        string
+		Path        string
+		Method      string
+		URL         string
+		Body        string
+		ContentType string
+	}
+
+	var testCases = []Test{
+		{
+			Name:   "Default",
+			Path:   "/data/Movies/Interstellar (2014)",
+			Method: "GET",
+			URL:    "http://plex:32400/library/sections/1/refresh?path=%2Fdata%2FMovies%2FInterstellar+%282014%29",
+		},
+		{
+			Name:   "V1 without path",
+			Mode:   "v1",
+			Method: "GET",
+			URL:    "http://plex:32400/library/sections/1/refresh",
+		},
+		{
+			Name:        "V2",
+			Mode:        "v2",
+			Path:        "/data/Movies/Interstellar (2014)",
+			Method:      "POST",
+			URL:         "http://plex:32400/library/sections/1/refresh",
+			Body:        "path=%2Fdata%2FMovies%2FInterstellar+%282014%29",
+			ContentType: "application/x-www-form-urlencoded",
+		},
+		{
+			Name:        "V2 without path",
+			Mode:        "V2",
+			Method:      "POST",
+			URL:         "http://plex:32400/library/sections/1/refresh",
+			ContentType: "application/x-www-form-urlencoded",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			requester, err := newScanRequester(tc.Mode, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := requester.scanRequest("http://plex:32400", tc.Path, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.Method != tc.Method {
+				t.Errorf("Methods do not match: %s vs %s", req.Method, tc.Method)
+			}
+
+			if req.URL.String() != tc.URL {
+				t.Errorf("URLs do not match:\n%s\n%s", req.URL, tc.URL)
+			}
+
+			var body []byte
+			if req.Body != nil {
+				body, err = io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if string(body) != tc.Body {
+				t.Errorf("Bodies do not match: %q vs %q", body, tc.Body)
+			}
+
+			if req.Header.Get("Content-Type") != tc.ContentType {
+				t.Errorf("Content types do not match: %s vs %s", req.Header.Get("Content-Type"), tc.ContentType)
+			}
+		})
+	}
+
+	if _, err := newScanRequester("v3", "", ""); err == nil {
+		t.Error("Expected an error for an unknown api-mode")
+	}
+
+	if _, err := newScanRequester("v1", "base64", ""); err == nil {
+		t.Error("Expected an error for an unknown path-encoding")
+	}
+}
+
+func TestEncodePath(t *testing.T) {
+	paths := []string{
+		"/data/Movies/Movie (2020) [1080p]/",
+		"/data/Movies/Fast & Furious (2009)",
+		"/data/TV/Show #1/Season 01",
+		"/data/Music/AC+DC/100% Hits",
+		"/data/Movies/Amélie (2001)",
+		"/data/Anime/千と千尋の神隠し (2001)",
+		"/data/Movies/What?; Really=Yes",
+	}
+
+	for _, percent := range []bool{false, true} {
+		for _, p := range paths {
+			encoded := encodePath("", p, percent)
+
+			if percent && strings.Contains(encoded, "+") {
+				t.Errorf("Expected spaces to be percent-encoded, got: %s", encoded)
+			}
+
+			q, err := url.ParseQuery(encoded)
+			if err != nil {
+				t.Fatalf("%s: %v", encoded, err)
+			}
+
+			if len(q) != 1 || q.Get("path") != p {
+				t.Errorf("Paths do not match after decoding:\n%s\n%s (%s)", q.Get("path"), p, encoded)
+			}
+		}
+	}
+}
+
+func TestScanRequestServer(t *testing.T) {
+	path := "/data/Movies/Movie (2020) [1080p] #1 & Amélie/"
+
+	for _, mode := range []string{"v1", "v2"} {
+		for _, encoding := range []string{"query", "percent"} {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+
+				received = r.Form.Get("path")
+			}))
+
+			requester, err := newScanRequester(mode, encoding, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			api := newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, requester)
+			if err := api.Scan(path, 1); err != nil {
+				t.Fatal(err)
+			}
+
+			server.Close()
+
+			if received != path {
+				t.Errorf("%s/%s: Paths do not match:\n%s\n%s", mode, encoding, received, path)
+			}
+		}
+	}
+}
+
+func TestScanParams(t *testing.T) {
+	for _, mode := range []string{"v1", "v2"} {
+		requester, err := newScanRequester(mode, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requester, err = withScanParams(requester, map[string]string{"force": "1", "extra": "a b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := requester.scanRequest("http://plex:32400", "/data/Movies/Tenet (2020)", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		if req.Form.Get("force") != "1" || req.Form.Get("extra") != "a b" || req.Form.Get("path") != "/data/Movies/Tenet (2020)" {
+			t.Errorf("%s: Unexpected parameters: %v", mode, req.Form)
+		}
+	}
+
+	// the refresh of an entire library has no path
+	requester, err := withScanParams(scanRequestV1{}, map[string]string{"force": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := requester.scanRequest("http://plex:32400", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL.RawQuery != "force=1" {
+		t.Errorf("Queries do not match: %s vs force=1", req.URL.RawQuery)
+	}
+
+	for _, key := range []string{"path", "directory", "x-plex-token", " "} {
+		if _, err := withScanParams(scanRequestV1{}, map[string]string{key: "1"}); err == nil {
+			t.Errorf("Expected an error for parameter %q", key)
+		}
+	}
+}
+
+func TestScanParam(t *testing.T) {
+	type Test struct {
+		Name    string
+		Param   string
+		Version string
+		Want    string
+	}
+
+	var testCases = []Test{
+		{
+			Name:    "Auto on a current version",
+			Version: "1.32.5.7349-8f4248874",
+			Want:    "path=%2Fdata%2FMovies%2FTenet+%282020%29",
+		},
+		{
+			Name:    "Auto on the oldest supported version",
+			Param:   "auto",
+			Version: "1.20.0.3125-e4ba4fd0c",
+			Want:    "path=%2Fdata%2FMovies%2FTenet+%282020%29",
+		},
+		{
+			Name:    "Directory",
+			Param:   "Directory",
+			Version: "1.32.5.7349-8f4248874",
+			Want:    "directory=%2Fdata%2FMovies%2FTenet+%282020%29",
+		},
+		{
+			Name:    "File",
+			Param:   "file",
+			Version: "1.32.5.7349-8f4248874",
+			Want:    "file=%2Fdata%2FMovies%2FTenet+%282020%29",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			param, err := parseScanParam(tc.Param)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if param == "" {
+				param = scanParamOf(tc.Version)
+			}
+
+			requester, err := newScanRequester("v1", "", param)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := requester.scanRequest("http://plex:32400", "/data/Movies/Tenet (2020)", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.URL.RawQuery != tc.Want {
+				t.Errorf("Queries do not match: %s vs %s", req.URL.RawQuery, tc.Want)
+			}
+		})
+	}
+
+	if _, err := parseScanParam("folder"); err == nil {
+		t.Error("Expected an error for an unknown scan-param")
+	}
+}
+
+func TestScanParamVersions(t *testing.T) {
+	defer func(versions []scanParamVersion) { scanParamVersions = versions }(scanParamVersions)
+
+	scanParamVersions = []scanParamVersion{
+		{version: "1.40.1", param: scanParamDirectory},
+		{version: "1.20", param: scanParamPath},
+	}
+
+	type Test struct {
+		Version string
+		Want    string
+	}
+
+	var testCases = []Test{
+		{Version: "1.41.0.8992-8463ad060", Want: scanParamDirectory},
+		{Version: "1.40.1", Want: scanParamDirectory},
+		{Version: "1.40.0.7998-c29d4c0c8", Want: scanParamPath},
+		{Version: "1.20.0.3125-e4ba4fd0c", Want: scanParamPath},
+		{Version: "1.19.5", Want: scanParamPath},
+		{Version: "2.0.0", Want: scanParamDirectory},
+	}
+
+	for _, tc := range testCases {
+		if param := scanParamOf(tc.Version); param != tc.Want {
+			t.Errorf("%s: Parameters do not match: %s vs %s", tc.Version, param, tc.Want)
+		}
+	}
+}
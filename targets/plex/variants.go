@@ -0,0 +1,47 @@
+package plex
+
+import (
+	"os"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// variants expand a folder into its alternate paths,
+// such as the branches of a mergerfs pool.
+type variants []autoscan.Rewriter
+
+func newVariants(rules []autoscan.Rewrite) (variants, error) {
+	v := make(variants, 0, len(rules))
+	for _, rule := range rules {
+		rewriter, err := autoscan.NewRewriter([]autoscan.Rewrite{rule})
+		if err != nil {
+			return nil, err
+		}
+
+		v = append(v, rewriter)
+	}
+
+	return v, nil
+}
+
+// expand returns the folder followed by its variants which exist on the Autoscan host.
+func (v variants) expand(folder string) []string {
+	folders := []string{folder}
+	seen := map[string]bool{folder: true}
+
+	for _, rewrite := range v {
+		variant := rewrite(folder)
+		if seen[variant] {
+			continue
+		}
+
+		seen[variant] = true
+		if _, err := os.Stat(variant); err != nil {
+			continue
+		}
+
+		folders = append(folders, variant)
+	}
+
+	return folders
+}
@@ -0,0 +1,64 @@
+package plex
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestScanVariants(t *testing.T) {
+	dir := t.TempDir()
+	for _, branch := range []string{"unionfs", "disk1", "disk2"} {
+		if err := os.MkdirAll(filepath.Join(dir, branch, "Movies", "Tenet (2020)"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	variants, err := newVariants([]autoscan.Rewrite{
+		{From: "^" + dir + "/unionfs/", To: dir + "/disk1/"},
+		{From: "^" + dir + "/unionfs/", To: dir + "/disk2/"},
+		{From: "^" + dir + "/unionfs/", To: dir + "/disk3/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrite, err := autoscan.NewRewriter([]autoscan.Rewrite{
+		{From: "^" + dir + "/(unionfs|disk1)/", To: "/data/"},
+		{From: "^" + dir + "/disk2/", To: "/disk2/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movies := library{ID: 1, Name: "Movies", Path: "/data/Movies/"}
+	disk2 := library{ID: 2, Name: "Disk 2", Path: "/disk2/Movies/"}
+
+	tg := target{
+		libraries: []library{movies, disk2},
+		rewrite:   rewrite,
+		variants:  variants,
+	}
+
+	requests, err := tg.getScanRequests(autoscan.Scan{Folder: dir + "/unionfs/Movies/Tenet (2020)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// disk1 resolves to the same scan as unionfs, disk3 does not exist
+	want := []scanRequest{
+		{lib: movies, path: "/data/Movies/Tenet (2020)"},
+		{lib: disk2, path: "/disk2/Movies/Tenet (2020)"},
+	}
+
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Scan requests do not match:\n%v\n%v", requests, want)
+	}
+
+	if _, err := tg.getScanRequests(autoscan.Scan{Folder: "/mnt/other/Movies"}); err == nil {
+		t.Error("Expected an error when no library matches")
+	}
+}
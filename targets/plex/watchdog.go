@@ -0,0 +1,153 @@
+package plex
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+// watchdog recreates the API client once Plex could not be reached
+// for a number of consecutive requests, which resets the connections to Plex.
+// Requests which trigger a reset are retried once with the new client.
+type watchdog struct {
+	mu       sync.Mutex
+	api      *apiClient
+	failures int
+
+	// limit is the number of consecutive failures before the client is reset,
+	// the client is never reset when the limit is 0.
+	limit  int
+	newAPI func() *apiClient
+	log    zerolog.Logger
+}
+
+func newWatchdog(limit int, newAPI func() *apiClient, log zerolog.Logger) *watchdog {
+	return &watchdog{
+		api:    newAPI(),
+		limit:  limit,
+		newAPI: newAPI,
+		log:    log,
+	}
+}
+
+// client returns the current API client.
+func (w *watchdog) client() *apiClient {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.api
+}
+
+// observe records the result of a request sent with the given client,
+// and returns whether the client has been reset.
+func (w *watchdog) observe(api *apiClient, err error) bool {
+	if w.limit <= 0 {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// the client has been reset since the request was sent
+	if api != w.api {
+		return errors.Is(err, autoscan.ErrTargetUnavailable)
+	}
+
+	if !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		w.failures = 0
+		return false
+	}
+
+	w.failures++
+	if w.failures < w.limit {
+		return false
+	}
+
+	w.log.Warn().
+		Err(err).
+		Int("failures", w.failures).
+		Msg("Plex could not be reached repeatedly, resetting client")
+
+	w.api.client.CloseIdleConnections()
+	w.api = w.newAPI()
+	w.failures = 0
+	return true
+}
+
+// do sends a request with the current client,
+// and retries it once when the client has been reset.
+func (w *watchdog) do(request func(api *apiClient) error) error {
+	api := w.client()
+	err := request(api)
+	if !w.observe(api, err) {
+		return err
+	}
+
+	api = w.client()
+	err = request(api)
+	w.observe(api, err)
+	return err
+}
+
+func (w *watchdog) Version() (version string, err error) {
+	err = w.do(func(api *apiClient) error {
+		version, err = api.Version()
+		return err
+	})
+
+	return version, err
+}
+
+func (w *watchdog) Libraries() (libraries []library, err error) {
+	err = w.do(func(api *apiClient) error {
+		libraries, err = api.Libraries()
+		return err
+	})
+
+	return libraries, err
+}
+
+func (w *watchdog) Scan(path string, libraryID int) error {
+	return w.do(func(api *apiClient) error {
+		return api.Scan(path, libraryID)
+	})
+}
+
+func (w *watchdog) RefreshItem(ratingKey int) error {
+	return w.do(func(api *apiClient) error {
+		return api.RefreshItem(ratingKey)
+	})
+}
+
+func (w *watchdog) LibraryStatus(libraryID int) (status libraryStatus, err error) {
+	err = w.do(func(api *apiClient) error {
+		status, err = api.LibraryStatus(libraryID)
+		return err
+	})
+
+	return status, err
+}
+
+func (w *watchdog) EmptyTrash(libraryID int) error {
+	return w.do(func(api *apiClient) error {
+		return api.EmptyTrash(libraryID)
+	})
+}
+
+func (w *watchdog) Items(lib library) (items []item, err error) {
+	err = w.do(func(api *apiClient) error {
+		items, err = api.Items(lib)
+		return err
+	})
+
+	return items, err
+}
+
+func (w *watchdog) Analyze(ratingKey int) error {
+	return w.do(func(api *apiClient) error {
+		return api.Analyze(ratingKey)
+	})
+}
@@ -0,0 +1,77 @@
+package plex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestWatchdog(t *testing.T) {
+	// the connections of the first client are wedged
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Client-Identifier") == "client-1" {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		rw.Write([]byte(`{"MediaContainer": {"version": "1.32.0"}}`))
+	}))
+	defer server.Close()
+
+	var clients int
+	w := newWatchdog(2, func() *apiClient {
+		clients++
+		return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", fmt.Sprintf("client-%d", clients), gatewayAuth{}, scanRequestV1{})
+	}, zerolog.Nop())
+
+	if _, err := w.Version(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+		t.Fatalf("Expected ErrTargetUnavailable, got: %v", err)
+	}
+
+	if clients != 1 {
+		t.Fatalf("Expected the client to be kept after a single failure, got: %d clients", clients)
+	}
+
+	// the second failure resets the client and retries the request
+	version, err := w.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "1.32.0" {
+		t.Errorf("Versions do not match: %s vs 1.32.0", version)
+	}
+
+	if clients != 2 {
+		t.Errorf("Expected the client to be reset once, got: %d clients", clients)
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var clients int
+	w := newWatchdog(0, func() *apiClient {
+		clients++
+		return newAPIClient(server.URL, "token", zerolog.Nop(), 0, "autoscan", "autoscan", gatewayAuth{}, scanRequestV1{})
+	}, zerolog.Nop())
+
+	for i := 0; i < 5; i++ {
+		if _, err := w.Version(); !errors.Is(err, autoscan.ErrTargetUnavailable) {
+			t.Fatalf("Expected ErrTargetUnavailable, got: %v", err)
+		}
+	}
+
+	if clients != 1 {
+		t.Errorf("Expected the client to never be reset, got: %d clients", clients)
+	}
+}
@@ -1,7 +1,6 @@
 package a_train
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
@@ -17,10 +16,11 @@ type Drive struct {
 }
 
 type Config struct {
-	Drives    []Drive            `yaml:"drives"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Drives     []Drive            `yaml:"drives"`
+	Priority   int                `yaml:"priority"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
 }
 
 type ATrainRewriter = func(drive string, input string) string
@@ -80,10 +80,10 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	drive := chi.URLParam(r, "drive")
 
 	event := new(atrainEvent)
-	err = json.NewDecoder(r.Body).Decode(event)
+	err = autoscan.DecodeWebhook(rw, r, event)
 	if err != nil {
 		rlog.Error().Err(err).Msg("Failed decoding request")
-		rw.WriteHeader(http.StatusBadRequest)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -96,6 +96,9 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			Folder:   h.rewrite(drive, path),
 			Priority: h.priority,
 			Time:     now(),
+			ID:       autoscan.RequestScanID(r),
+			Reason:   "A-Train created",
+			Source:   "a-train",
 		})
 	}
 
@@ -104,6 +107,9 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			Folder:   h.rewrite(drive, path),
 			Priority: h.priority,
 			Time:     now(),
+			ID:       autoscan.RequestScanID(r),
+			Reason:   "A-Train deleted",
+			Source:   "a-train",
 		})
 	}
 
@@ -68,21 +68,29 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train created",
+						Source:   "a-train",
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/TV/Legion/Season 1",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train created",
+						Source:   "a-train",
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/Movies/Wonder Woman 1984 (2020)",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train deleted",
+						Source:   "a-train",
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/Movies/Mortal Kombat (2021)",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train deleted",
+						Source:   "a-train",
 					},
 				},
 			},
@@ -101,11 +109,15 @@ func TestHandler(t *testing.T) {
 						Folder:   "/TV/Legion/Season 1",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train created",
+						Source:   "a-train",
 					},
 					{
 						Folder:   "/TV/Legion/Season 1",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "A-Train deleted",
+						Source:   "a-train",
 					},
 				},
 			},
@@ -339,6 +339,8 @@ func (d daemon) getScanTask(drive *drive, paths *Paths) *scanTask {
 			Folder:   filepath.Clean(rewritten),
 			Priority: d.priority,
 			Time:     drive.ScanTime(),
+			Reason:   "Bernard folder created",
+			Source:   "bernard",
 		})
 
 		task.added++
@@ -366,6 +368,8 @@ func (d daemon) getScanTask(drive *drive, paths *Paths) *scanTask {
 			Folder:   filepath.Clean(rewritten),
 			Priority: d.priority,
 			Time:     drive.ScanTime(),
+			Reason:   "Bernard folder changed",
+			Source:   "bernard",
 		})
 
 		task.removed++
@@ -18,6 +18,8 @@ type Config struct {
 	Priority  int                `yaml:"priority"`
 	Verbosity string             `yaml:"verbosity"`
 	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	ScanRoot  autoscan.ScanRoot  `yaml:"scan-root"`
+	MaxDepth  int                `yaml:"max-depth"`
 	Include   []string           `yaml:"include"`
 	Exclude   []string           `yaml:"exclude"`
 	Paths     []struct {
@@ -31,6 +33,8 @@ type Config struct {
 type daemon struct {
 	callback autoscan.ProcessorFunc
 	paths    []path
+	root     autoscan.ScanRoot
+	maxDepth int
 	watcher  *fsnotify.Watcher
 	queue    *queue
 	log      zerolog.Logger
@@ -47,6 +51,15 @@ func New(c Config) (autoscan.Trigger, error) {
 		Str("trigger", "inotify").
 		Logger()
 
+	if c.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid inotify max-depth %d: must not be negative", c.MaxDepth)
+	}
+
+	maxDepth := c.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = autoscan.DefaultMaxDepth
+	}
+
 	var paths []path
 	for _, p := range c.Paths {
 		p := p
@@ -73,6 +86,8 @@ func New(c Config) (autoscan.Trigger, error) {
 			log:      l,
 			callback: callback,
 			paths:    paths,
+			root:     c.ScanRoot,
+			maxDepth: maxDepth,
 			queue:    newQueue(callback, l, c.Priority),
 		}
 
@@ -98,7 +113,7 @@ func (d *daemon) startMonitoring() error {
 
 	// setup watcher
 	for _, p := range d.paths {
-		if err := filepath.Walk(p.Path, d.walkFunc); err != nil {
+		if err := autoscan.WalkDirs(p.Path, d.maxDepth, d.watch); err != nil {
 			_ = d.watcher.Close()
 			return err
 		}
@@ -110,17 +125,7 @@ func (d *daemon) startMonitoring() error {
 	return nil
 }
 
-func (d *daemon) walkFunc(path string, fi os.FileInfo, err error) error {
-	// handle error
-	if err != nil {
-		return fmt.Errorf("walk func: %v: %w", path, err)
-	}
-
-	// ignore non-directory
-	if !fi.Mode().IsDir() {
-		return nil
-	}
-
+func (d *daemon) watch(path string) error {
 	if err := d.watcher.Add(path); err != nil {
 		return fmt.Errorf("watch directory: %v: %w", path, err)
 	}
@@ -132,6 +137,25 @@ func (d *daemon) walkFunc(path string, fi os.FileInfo, err error) error {
 	return nil
 }
 
+// watchNew watches a new directory and the directories below it.
+func (d *daemon) watchNew(dir string) error {
+	p, err := d.getPathObject(dir)
+	if err != nil {
+		return err
+	}
+
+	depth := autoscan.DirDepth(p.Path, dir)
+	if depth > d.maxDepth {
+		d.log.Debug().
+			Str("path", dir).
+			Int("max_depth", d.maxDepth).
+			Msg("Directory exceeds max depth, not watching")
+		return nil
+	}
+
+	return autoscan.WalkDirs(dir, d.maxDepth-depth, d.watch)
+}
+
 func (d *daemon) getPathObject(path string) (*path, error) {
 	for _, p := range d.paths {
 		if strings.HasPrefix(path, p.Path) {
@@ -167,9 +191,9 @@ func (d *daemon) worker() {
 					continue
 				}
 
-				// watch new directories
+				// watch new directories, up to the max depth below the monitored path
 				if fi.IsDir() {
-					if err := filepath.Walk(event.Name, d.walkFunc); err != nil {
+					if err := d.watchNew(event.Name); err != nil {
 						d.log.Error().
 							Err(err).
 							Str("path", event.Name).
@@ -186,18 +210,28 @@ func (d *daemon) worker() {
 				continue
 			}
 
+			// check scan root
+			name, ok := d.root.Resolve(event.Name)
+			if !ok {
+				d.log.Debug().
+					Str("path", event.Name).
+					Str("scan_root", string(d.root)).
+					Msg("Path outside of scan root, ignoring event")
+				continue
+			}
+
 			// get path object
-			p, err := d.getPathObject(event.Name)
+			p, err := d.getPathObject(name)
 			if err != nil {
 				d.log.Error().
 					Err(err).
-					Str("path", event.Name).
+					Str("path", name).
 					Msg("Failed determining path object")
 				continue
 			}
 
 			// rewrite
-			rewritten := p.Rewriter(event.Name)
+			rewritten := p.Rewriter(name)
 
 			// filter
 			if !p.Allowed(rewritten) {
@@ -296,6 +330,8 @@ func (q *queue) process() {
 			Folder:   filepath.Clean(p),
 			Priority: q.priority,
 			Time:     time.Now(),
+			Reason:   "inotify change",
+			Source:   "inotify",
 		})
 
 		if err != nil {
@@ -1,7 +1,6 @@
 package lidarr
 
 import (
-	"encoding/json"
 	"net/http"
 	"path"
 	"strings"
@@ -13,10 +12,20 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name       string             `yaml:"name"`
+	Priority   int                `yaml:"priority"`
+	Deep       bool               `yaml:"deep"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	ScanRoot   autoscan.ScanRoot  `yaml:"scan-root"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
+
+	// NormalizeSeparators converts Windows paths before they are resolved and rewritten.
+	NormalizeSeparators bool `yaml:"normalize-separators"`
+
+	// Targets restricts the scans of the trigger to the named targets, all targets when empty.
+	// The targets are bound by cmd/autoscan, as they are not known by the trigger.
+	Targets []string `yaml:"targets"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Lidarr webhooks.
@@ -28,9 +37,13 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
 		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
+			name:      c.Name,
+			callback:  callback,
+			priority:  c.Priority,
+			deep:      c.Deep,
+			root:      c.ScanRoot,
+			rewrite:   rewriter,
+			normalize: c.NormalizeSeparators,
 		}
 	}
 
@@ -38,9 +51,15 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 }
 
 type handler struct {
+	name     string
 	priority int
+	deep     bool
+	root     autoscan.ScanRoot
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+
+	// normalize converts Windows paths of events, e.g. D:\Media into D:/Media
+	normalize bool
 }
 
 type lidarrEvent struct {
@@ -50,6 +69,20 @@ type lidarrEvent struct {
 	Files []struct {
 		Path string
 	} `json:"trackFiles"`
+
+	RenamedFiles []struct {
+		PreviousPath string
+		Path         string
+	} `json:"renamedTrackFiles"`
+
+	Artist struct {
+		Name string
+		Path string
+	} `json:"artist"`
+
+	Album struct {
+		Title string
+	} `json:"album"`
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -57,45 +90,118 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	l := hlog.FromRequest(r)
 
 	event := new(lidarrEvent)
-	err = json.NewDecoder(r.Body).Decode(event)
+	err = autoscan.DecodeWebhook(rw, r, event)
 	if err != nil {
 		l.Error().Err(err).Msg("Failed decoding request")
-		rw.WriteHeader(http.StatusBadRequest)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	l.Trace().Interface("event", event).Msg("Received JSON body")
 
+	if h.normalize {
+		event.normalizeSeparators()
+	}
+
 	if strings.EqualFold(event.Type, "Test") {
 		l.Info().Msg("Received test event")
 		rw.WriteHeader(http.StatusOK)
 		return
 	}
 
-	if !strings.EqualFold(event.Type, "Download") || len(event.Files) == 0 {
+	// the changed files, of which the folders are scanned
+	var filePaths []string
+
+	// the changed folders, of which the number of files is unknown
+	var folderPaths []string
+
+	switch {
+	case strings.EqualFold(event.Type, "Download") && len(event.Files) > 0:
+		for _, f := range event.Files {
+			filePaths = append(filePaths, f.Path)
+		}
+
+	case strings.EqualFold(event.Type, "Rename") && len(event.RenamedFiles) > 0:
+		for _, f := range event.RenamedFiles {
+			// count a file renamed within its folder once
+			filePaths = append(filePaths, f.PreviousPath)
+			if path.Dir(f.Path) != path.Dir(f.PreviousPath) {
+				filePaths = append(filePaths, f.Path)
+			}
+		}
+
+	case strings.EqualFold(event.Type, "AlbumDelete") && event.Artist.Path != "":
+		// the folder of the album is not part of the event
+		folderPaths = append(folderPaths, event.Artist.Path)
+
+	default:
 		l.Error().Msg("Required fields are missing")
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	unique := make(map[string]bool)
+	// index of the scan of every folder
+	unique := make(map[string]int)
 	scans := make([]autoscan.Scan, 0)
 
-	for _, f := range event.Files {
-		folderPath := path.Dir(h.rewrite(f.Path))
-		if _, ok := unique[folderPath]; ok {
-			continue
+	add := func(p string, file bool) {
+		if p == "" {
+			return
+		}
+
+		resolved, ok := h.root.Resolve(p)
+		if !ok {
+			l.Debug().
+				Str("path", p).
+				Str("scan_root", string(h.root)).
+				Msg("Path outside of scan root, ignoring path")
+			return
+		}
+
+		folderPath := h.rewrite(resolved)
+		files := 0
+		if file {
+			folderPath = path.Dir(folderPath)
+			files = 1
+		}
+
+		if i, ok := unique[folderPath]; ok {
+			scans[i].Files += files
+			return
 		}
 
 		// add scan
-		unique[folderPath] = true
+		unique[folderPath] = len(scans)
 		scans = append(scans, autoscan.Scan{
 			Folder:   folderPath,
 			Priority: h.priority,
+			Deep:     h.deep,
 			Time:     now(),
+			ID:       autoscan.RequestScanID(r),
+			Reason:   event.reason(),
+			Files:    files,
+
+			Source:    h.name,
+			MediaType: "track",
+
+			// removed albums should be cleared from the targets
+			Deleted: strings.EqualFold(event.Type, "AlbumDelete"),
 		})
 	}
 
+	for _, p := range filePaths {
+		add(p, true)
+	}
+
+	for _, p := range folderPaths {
+		add(p, false)
+	}
+
+	if len(scans) == 0 {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	err = h.callback(scans...)
 	if err != nil {
 		l.Error().Err(err).Msg("Processor could not process scans")
@@ -110,4 +216,40 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		Msg("Scan moved to processor")
 }
 
+// normalizeSeparators converts the paths of the event into paths with forward slashes.
+func (e *lidarrEvent) normalizeSeparators() {
+	e.Artist.Path = autoscan.NormalizeSeparators(e.Artist.Path)
+
+	for i := range e.Files {
+		e.Files[i].Path = autoscan.NormalizeSeparators(e.Files[i].Path)
+	}
+
+	for i := range e.RenamedFiles {
+		e.RenamedFiles[i].PreviousPath = autoscan.NormalizeSeparators(e.RenamedFiles[i].PreviousPath)
+		e.RenamedFiles[i].Path = autoscan.NormalizeSeparators(e.RenamedFiles[i].Path)
+	}
+}
+
+// reason describes the event, e.g. "Lidarr import: Marshmello - Joytime III".
+func (e lidarrEvent) reason() string {
+	reason := "Lidarr import"
+	switch {
+	case strings.EqualFold(e.Type, "Rename"):
+		reason = "Lidarr rename"
+	case strings.EqualFold(e.Type, "AlbumDelete"):
+		reason = "Lidarr album deleted"
+	case e.Upgrade:
+		reason = "Lidarr upgrade"
+	}
+
+	switch {
+	case e.Artist.Name != "" && e.Album.Title != "":
+		return reason + ": " + e.Artist.Name + " - " + e.Album.Title
+	case e.Artist.Name != "":
+		return reason + ": " + e.Artist.Name
+	default:
+		return reason
+	}
+}
+
 var now = time.Now
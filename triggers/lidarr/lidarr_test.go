@@ -30,7 +30,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	standardConfig := Config{
-		Name:     "lidarr",
+		Name:     "lidarr-music",
 		Priority: 5,
 		Rewrite: []autoscan.Rewrite{{
 			From: "/Music/*",
@@ -53,9 +53,13 @@ func TestHandler(t *testing.T) {
 			Expected{
 				StatusCode: 200,
 				Scans: []autoscan.Scan{{
-					Folder:   "/mnt/unionfs/Media/Music/Marshmello/Joytime III (2019)",
-					Priority: 5,
-					Time:     currentTime,
+					Folder:    "/mnt/unionfs/Media/Music/Marshmello/Joytime III (2019)",
+					Priority:  5,
+					Time:      currentTime,
+					Reason:    "Lidarr import: Marshmello - Joytime III",
+					Source:    "lidarr-music",
+					MediaType: "track",
+					Files:     4,
 				}},
 			},
 		},
@@ -69,17 +73,73 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 01",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 01",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Lidarr import: blink-182",
+						Source:    "lidarr-music",
+						MediaType: "track",
+						Files:     2,
 					},
 					{
-						Folder:   "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 02",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Music/blink‐182/California (2016)/CD 02",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Lidarr import: blink-182",
+						Source:    "lidarr-music",
+						MediaType: "track",
+						Files:     2,
 					}},
 			},
 		},
+		{
+			"Rename Event",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/rename.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:    "/mnt/unionfs/Media/Music/Marshmello/Joytime III",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Lidarr rename: Marshmello",
+						Source:    "lidarr-music",
+						MediaType: "track",
+						Files:     2,
+					},
+					{
+						Folder:    "/mnt/unionfs/Media/Music/Marshmello/Joytime III (2019)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Lidarr rename: Marshmello",
+						Source:    "lidarr-music",
+						MediaType: "track",
+						Files:     2,
+					}},
+			},
+		},
+		{
+			"AlbumDelete Event",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/album_delete.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{{
+					Folder:    "/mnt/unionfs/Media/Music/Marshmello",
+					Priority:  5,
+					Time:      currentTime,
+					Reason:    "Lidarr album deleted: Marshmello - Joytime III",
+					Source:    "lidarr-music",
+					MediaType: "track",
+					Deleted:   true,
+				}},
+			},
+		},
 		{
 			"Returns bad request on invalid JSON",
 			Given{
@@ -2,8 +2,11 @@ package manual
 
 import (
 	_ "embed"
+	"errors"
+	"fmt"
 	"net/http"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog/hlog"
@@ -12,11 +15,24 @@ import (
 )
 
 type Config struct {
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Priority  int                `yaml:"priority"`
-	Verbosity string             `yaml:"verbosity"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	Priority   int                `yaml:"priority"`
+	Deep       bool               `yaml:"deep"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
+	MaxDirs    int                `yaml:"max-dirs"`
+
+	// NormalizeSeparators converts Windows directories before they are rewritten.
+	NormalizeSeparators bool `yaml:"normalize-separators"`
+
+	// AllowedLibraries restricts the libraries manual scans may affect, any library when empty.
+	// The libraries are checked by cmd/autoscan, as they are known by the targets.
+	AllowedLibraries []string `yaml:"allowed-libraries"`
 }
 
+// defaultMaxDirs is the maximum number of directories per request when none is configured.
+const defaultMaxDirs = 100
+
 var (
 	//go:embed "template.html"
 	template []byte
@@ -29,11 +45,23 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 		return nil, err
 	}
 
+	if c.MaxDirs < 0 {
+		return nil, fmt.Errorf("invalid manual max-dirs %d: must not be negative", c.MaxDirs)
+	}
+
+	maxDirs := c.MaxDirs
+	if maxDirs == 0 {
+		maxDirs = defaultMaxDirs
+	}
+
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
 		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
+			callback:  callback,
+			priority:  c.Priority,
+			deep:      c.Deep,
+			maxDirs:   maxDirs,
+			rewrite:   rewriter,
+			normalize: c.NormalizeSeparators,
 		}
 	}
 
@@ -42,8 +70,13 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 
 type handler struct {
 	priority int
+	deep     bool
+	maxDirs  int
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+
+	// normalize converts Windows directories, e.g. D:\Media into D:/Media
+	normalize bool
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -51,7 +84,6 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rlog := hlog.FromRequest(r)
 
 	query := r.URL.Query()
-	directories := query["dir"]
 
 	switch r.Method {
 	case "GET":
@@ -63,28 +95,93 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Directories can be given as query parameters and as form values
+	if err := r.ParseForm(); err != nil {
+		rlog.Error().Err(err).Msg("Invalid form")
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	directories := r.Form["dir"]
 	if len(directories) == 0 {
 		rlog.Error().Msg("Manual webhook should receive at least one directory")
 		rw.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	if len(directories) > h.maxDirs {
+		rlog.Error().
+			Int("dirs", len(directories)).
+			Int("max_dirs", h.maxDirs).
+			Msg("Manual webhook received too many directories")
+
+		http.Error(rw, fmt.Sprintf("too many directories: %d given, at most %d allowed", len(directories), h.maxDirs), http.StatusBadRequest)
+		return
+	}
+
 	rlog.Trace().Interface("dirs", directories).Msg("Received directories")
 
+	// A deep scan can be requested per request, or enabled for all requests
+	deep := h.deep
+	if v := query.Get("deep"); v != "" {
+		deep, err = strconv.ParseBool(v)
+		if err != nil {
+			rlog.Error().Err(err).Msg("Invalid deep parameter")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Immediate scans bypass the minimum age and scan delay
+	immediate := false
+	if v := query.Get("immediate"); v != "" {
+		immediate, err = strconv.ParseBool(v)
+		if err != nil {
+			rlog.Error().Err(err).Msg("Invalid immediate parameter")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The reason defaults to "manual", but can be given to describe the request
+	reason := query.Get("reason")
+	if reason == "" {
+		reason = "manual"
+	}
+
 	scans := make([]autoscan.Scan, 0)
 
 	for _, dir := range directories {
-		// Rewrite the path based on the provided rewriter.
-		folderPath := h.rewrite(path.Clean(dir))
+		// An empty directory requests a refresh of the default libraries,
+		// otherwise rewrite the path based on the provided rewriter.
+		folderPath := ""
+		if h.normalize {
+			dir = autoscan.NormalizeSeparators(dir)
+		}
+
+		if dir != "" {
+			folderPath = h.rewrite(path.Clean(dir))
+		}
 
 		scans = append(scans, autoscan.Scan{
-			Folder:   folderPath,
-			Priority: h.priority,
-			Time:     now(),
+			Folder:    folderPath,
+			Priority:  h.priority,
+			Time:      now(),
+			ID:        autoscan.RequestScanID(r),
+			Deep:      deep,
+			Immediate: immediate,
+			Reason:    reason,
+			Source:    "manual",
 		})
 	}
 
 	err = h.callback(scans...)
+	if errors.Is(err, autoscan.ErrScanForbidden) {
+		rlog.Warn().Err(err).Msg("Manual webhook requested a scan of a library which is not allowed")
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if err != nil {
 		rlog.Error().Err(err).Msg("Processor could not process scans")
 		rw.WriteHeader(http.StatusInternalServerError)
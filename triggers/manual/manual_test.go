@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ func TestHandler(t *testing.T) {
 	type Given struct {
 		Config Config
 		Query  url.Values
+		Form   url.Values
 	}
 
 	type Expected struct {
@@ -73,15 +75,134 @@ func TestHandler(t *testing.T) {
 						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "manual",
+						Source:   "manual",
 					},
 					{
 						Folder:   "/mnt/unionfs/Media/Movies/Parasite (2019)",
 						Priority: 5,
 						Time:     currentTime,
+						Reason:   "manual",
+						Source:   "manual",
 					},
 				},
 			},
 		},
+		{
+			"Marks scans as immediate",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":       []string{"/Movies/Interstellar (2014)"},
+					"immediate": []string{"true"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:    "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority:  5,
+						Time:      currentTime,
+						Immediate: true,
+						Reason:    "manual",
+						Source:    "manual",
+					},
+				},
+			},
+		},
+		{
+			"Sends a scan without folder for an empty directory",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir": []string{""},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "",
+						Priority: 5,
+						Time:     currentTime,
+						Reason:   "manual",
+						Source:   "manual",
+					},
+				},
+			},
+		},
+		{
+			"Uses the given reason",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":    []string{"/Movies/Interstellar (2014)"},
+					"reason": []string{"missing subtitles"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+						Reason:   "missing subtitles",
+						Source:   "manual",
+					},
+				},
+			},
+		},
+		{
+			"Returns 200 when given directories as form values",
+			Given{
+				Config: standardConfig,
+				Form: url.Values{
+					"dir": []string{"/Movies/Interstellar (2014)"},
+				},
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority: 5,
+						Time:     currentTime,
+						Reason:   "manual",
+						Source:   "manual",
+					},
+				},
+			},
+		},
+		{
+			"Returns bad request when given too many directories",
+			Given{
+				Config: Config{MaxDirs: 2},
+				Query: url.Values{
+					"dir": []string{"/Movies/Interstellar (2014)", "/Movies/Parasite (2019)"},
+				},
+				Form: url.Values{
+					"dir": []string{"/Movies/Tenet (2020)"},
+				},
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
+		{
+			"Returns bad request on invalid immediate parameter",
+			Given{
+				Config: standardConfig,
+				Query: url.Values{
+					"dir":       []string{"/Movies/Interstellar (2014)"},
+					"immediate": []string{"soon"},
+				},
+			},
+			Expected{
+				StatusCode: 400,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -105,11 +226,13 @@ func TestHandler(t *testing.T) {
 			server := httptest.NewServer(trigger(callback))
 			defer server.Close()
 
-			req, err := http.NewRequest("POST", server.URL, nil)
+			req, err := http.NewRequest("POST", server.URL, strings.NewReader(tc.Given.Form.Encode()))
 			if err != nil {
 				t.Fatalf("Failed creating request: %v", err)
 			}
 
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
 			req.URL.RawQuery = tc.Given.Query.Encode()
 
 			res, err := http.DefaultClient.Do(req)
@@ -0,0 +1,99 @@
+package poll
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/cloudbox/autoscan/migrate"
+)
+
+type datastore struct {
+	*sql.DB
+}
+
+var (
+	//go:embed migrations
+	migrations embed.FS
+)
+
+func newDatastore(db *sql.DB, mg *migrate.Migrator) (*datastore, error) {
+	// migrations
+	if err := mg.Migrate(&migrations, "poll"); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	return &datastore{DB: db}, nil
+}
+
+const sqlGetDirectories = `
+SELECT path, mtime FROM poll_directory
+WHERE root = ?
+`
+
+// Directories returns the directories seen below the root, along with their modification times.
+func (store *datastore) Directories(root string) (map[string]time.Time, error) {
+	rows, err := store.Query(sqlGetDirectories, root)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dirs := make(map[string]time.Time)
+	for rows.Next() {
+		var path string
+		var mtime time.Time
+		if err := rows.Scan(&path, &mtime); err != nil {
+			return nil, err
+		}
+
+		dirs[path] = mtime
+	}
+
+	return dirs, rows.Err()
+}
+
+const sqlUpsertDirectory = `
+INSERT INTO poll_directory (root, path, mtime)
+VALUES (?, ?, ?)
+ON CONFLICT (root, path) DO UPDATE SET mtime = excluded.mtime
+`
+
+const sqlDeleteDirectory = `
+DELETE FROM poll_directory
+WHERE root = ? AND path = ?
+`
+
+// Save persists the changes to the directories below the root.
+func (store *datastore) Save(root string, changed map[string]time.Time, removed []string) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	for path, mtime := range changed {
+		if _, err = tx.Exec(sqlUpsertDirectory, root, path, mtime); err != nil {
+			break
+		}
+	}
+
+	for _, path := range removed {
+		if err != nil {
+			break
+		}
+
+		_, err = tx.Exec(sqlDeleteDirectory, root, path)
+	}
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,69 @@
+package poll
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan/migrate"
+
+	// sqlite3 driver
+	_ "modernc.org/sqlite"
+)
+
+func getDatastore(t *testing.T) *datastore {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mg, err := migrate.New(db, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := newDatastore(db, mg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds
+}
+
+func TestSaveDirectories(t *testing.T) {
+	store := getDatastore(t)
+	mtime := time.Now().Truncate(time.Second)
+
+	err := store.Save("/mnt/local/Media", map[string]time.Time{
+		"/mnt/local/Media":        mtime,
+		"/mnt/local/Media/Movies": mtime,
+		"/mnt/local/Media/TV":     mtime,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Save("/mnt/local/Media", map[string]time.Time{
+		"/mnt/local/Media/Movies": mtime.Add(time.Minute),
+	}, []string{"/mnt/local/Media/TV"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := store.Directories("/mnt/local/Media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dirs) != 2 {
+		t.Fatalf("Expected 2 directories, got: %v", dirs)
+	}
+
+	if !dirs["/mnt/local/Media/Movies"].Equal(mtime.Add(time.Minute)) {
+		t.Errorf("Modification times do not match: %v vs %v", dirs["/mnt/local/Media/Movies"], mtime.Add(time.Minute))
+	}
+
+	if other, err := store.Directories("/mnt/remote"); err != nil || len(other) != 0 {
+		t.Errorf("Expected no directories of another root, got: %v (%v)", other, err)
+	}
+}
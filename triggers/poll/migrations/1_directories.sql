@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS poll_directory (
+    "root" TEXT NOT NULL,
+    "path" TEXT NOT NULL,
+    "mtime" DATETIME NOT NULL,
+    PRIMARY KEY(root, path)
+)
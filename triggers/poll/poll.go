@@ -0,0 +1,214 @@
+// Package poll provides a Trigger which periodically walks directories
+// and scans the directories which appeared since the previous walk.
+//
+// The poll trigger is intended for file systems which do not emit
+// inotify events, such as some network mounts.
+package poll
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+	"github.com/cloudbox/autoscan/migrate"
+)
+
+// defaultInterval is the time between polls when no interval is configured.
+const defaultInterval = 5 * time.Minute
+
+type Config struct {
+	Priority  int                `yaml:"priority"`
+	Interval  time.Duration      `yaml:"interval"`
+	MaxDepth  int                `yaml:"max-depth"`
+	Verbosity string             `yaml:"verbosity"`
+	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
+	Include   []string           `yaml:"include"`
+	Exclude   []string           `yaml:"exclude"`
+	Paths     []struct {
+		Path    string             `yaml:"path"`
+		Rewrite []autoscan.Rewrite `yaml:"rewrite"`
+		Include []string           `yaml:"include"`
+		Exclude []string           `yaml:"exclude"`
+	} `yaml:"paths"`
+}
+
+type daemon struct {
+	callback autoscan.ProcessorFunc
+	paths    []path
+	priority int
+	interval time.Duration
+	store    *datastore
+	log      zerolog.Logger
+}
+
+type path struct {
+	Tree     *tree
+	Rewriter autoscan.Rewriter
+	Allowed  autoscan.Filterer
+}
+
+func New(c Config, db *sql.DB, mg *migrate.Migrator) (autoscan.Trigger, error) {
+	l := autoscan.GetLogger(c.Verbosity).With().
+		Str("trigger", "poll").
+		Logger()
+
+	if c.Interval < 0 {
+		return nil, fmt.Errorf("invalid poll interval %s: must not be negative", c.Interval)
+	}
+
+	interval := c.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+
+	if c.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid poll max-depth %d: must not be negative", c.MaxDepth)
+	}
+
+	maxDepth := c.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = autoscan.DefaultMaxDepth
+	}
+
+	store, err := newDatastore(db, mg)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []path
+	for _, p := range c.Paths {
+		p := p
+
+		rewriter, err := autoscan.NewRewriter(append(p.Rewrite, c.Rewrite...))
+		if err != nil {
+			return nil, err
+		}
+
+		filterer, err := autoscan.NewFilterer(append(p.Include, c.Include...), append(p.Exclude, c.Exclude...))
+		if err != nil {
+			return nil, err
+		}
+
+		root := filepath.Clean(p.Path)
+		dirs, err := store.Directories(root)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", root, err)
+		}
+
+		paths = append(paths, path{
+			Tree:     newTree(root, maxDepth, dirs, l),
+			Rewriter: rewriter,
+			Allowed:  filterer,
+		})
+	}
+
+	trigger := func(callback autoscan.ProcessorFunc) {
+		d := daemon{
+			log:      l,
+			callback: callback,
+			paths:    paths,
+			priority: c.Priority,
+			interval: interval,
+			store:    store,
+		}
+
+		go d.worker()
+	}
+
+	return trigger, nil
+}
+
+func (d *daemon) worker() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, p := range d.paths {
+			d.poll(p)
+		}
+
+		<-ticker.C
+	}
+}
+
+func (d *daemon) poll(p path) {
+	l := d.log.With().
+		Str("path", p.Tree.root).
+		Logger()
+
+	start := time.Now()
+	created := p.Tree.poll()
+
+	scans := make([]autoscan.Scan, 0, len(created))
+	for _, dir := range created {
+		// rewrite
+		rewritten := p.Rewriter(dir)
+
+		// filter
+		if !p.Allowed(rewritten) {
+			continue
+		}
+
+		scans = append(scans, autoscan.Scan{
+			Folder:   filepath.Clean(rewritten),
+			Priority: d.priority,
+			Time:     time.Now(),
+			Reason:   "Poll directory created",
+			Source:   "poll",
+		})
+	}
+
+	if len(scans) > 0 {
+		if err := d.callback(scans...); err != nil {
+			l.Error().
+				Err(err).
+				Msg("Failed moving scans to processor")
+
+			// forget the changes, so the new directories are found again by the next poll
+			d.reload(p)
+			return
+		}
+
+		for _, scan := range scans {
+			l.Info().
+				Str("path", scan.Folder).
+				Msg("Scan moved to processor")
+		}
+	}
+
+	if err := d.store.Save(p.Tree.root, p.Tree.changed, p.Tree.removed); err != nil {
+		l.Error().
+			Err(err).
+			Msg("Failed saving directories")
+
+		d.reload(p)
+		return
+	}
+
+	p.Tree.saved()
+
+	l.Debug().
+		Int("directories", len(p.Tree.dirs)).
+		Int("created", len(created)).
+		Stringer("duration", time.Since(start)).
+		Msg("Polled directories")
+}
+
+// reload restores the directories of the tree from the datastore.
+func (d *daemon) reload(p path) {
+	dirs, err := d.store.Directories(p.Tree.root)
+	if err != nil {
+		d.log.Error().
+			Err(err).
+			Str("path", p.Tree.root).
+			Msg("Failed loading directories")
+		return
+	}
+
+	p.Tree.dirs = dirs
+	p.Tree.saved()
+}
@@ -0,0 +1,157 @@
+package poll
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// A tree keeps the directories below a root along with their modification times.
+//
+// The modification time of a directory changes when entries are added to or removed from it,
+// so only the modified directories have to be read to find new directories.
+// Unmodified directories are only checked for modifications.
+type tree struct {
+	root     string
+	maxDepth int
+	dirs     map[string]time.Time
+	log      zerolog.Logger
+
+	// the changes since the previous save
+	changed map[string]time.Time
+	removed []string
+}
+
+func newTree(root string, maxDepth int, dirs map[string]time.Time, log zerolog.Logger) *tree {
+	return &tree{
+		root:     root,
+		maxDepth: maxDepth,
+		dirs:     dirs,
+		log:      log,
+		changed:  make(map[string]time.Time),
+	}
+}
+
+// poll walks the tree and returns the directories which appeared since the previous poll.
+// Directories within a new directory are not returned separately.
+//
+// The first poll of a root only records its directories.
+func (t *tree) poll() []string {
+	created := make([]string, 0)
+	t.walk(t.root, 0, t.children(), len(t.dirs) > 0, &created)
+	return created
+}
+
+// children returns the sorted known subdirectories of every directory.
+func (t *tree) children() map[string][]string {
+	children := make(map[string][]string, len(t.dirs))
+	for dir := range t.dirs {
+		if dir == t.root {
+			continue
+		}
+
+		parent := filepath.Dir(dir)
+		children[parent] = append(children[parent], dir)
+	}
+
+	for _, dirs := range children {
+		sort.Strings(dirs)
+	}
+
+	return children
+}
+
+func (t *tree) walk(dir string, depth int, children map[string][]string, report bool, created *[]string) {
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		t.remove(dir, children)
+		return
+	}
+
+	// directories below the max depth are not walked
+	if depth >= t.maxDepth {
+		for _, child := range children[dir] {
+			t.remove(child, children)
+		}
+
+		if mtime, known := t.dirs[dir]; !known || !mtime.Equal(fi.ModTime()) {
+			t.dirs[dir] = fi.ModTime()
+			t.changed[dir] = fi.ModTime()
+		}
+
+		return
+	}
+
+	mtime, known := t.dirs[dir]
+	if known && mtime.Equal(fi.ModTime()) {
+		for _, child := range children[dir] {
+			t.walk(child, depth+1, children, report, created)
+		}
+
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.log.Error().
+			Err(err).
+			Str("path", dir).
+			Msg("Failed reading directory")
+		return
+	}
+
+	t.dirs[dir] = fi.ModTime()
+	t.changed[dir] = fi.ModTime()
+
+	// symlinks are not followed, as they could point back up the tree
+	current := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		child := filepath.Join(dir, entry.Name())
+		current[child] = true
+
+		if _, seen := t.dirs[child]; seen {
+			t.walk(child, depth+1, children, report, created)
+			continue
+		}
+
+		if report {
+			*created = append(*created, child)
+		}
+
+		t.walk(child, depth+1, children, false, created)
+	}
+
+	for _, child := range children[dir] {
+		if !current[child] {
+			t.remove(child, children)
+		}
+	}
+}
+
+// remove forgets the directory and all directories below it.
+func (t *tree) remove(dir string, children map[string][]string) {
+	if _, ok := t.dirs[dir]; !ok {
+		return
+	}
+
+	delete(t.dirs, dir)
+	delete(t.changed, dir)
+	t.removed = append(t.removed, dir)
+
+	for _, child := range children[dir] {
+		t.remove(child, children)
+	}
+}
+
+// saved clears the changes once they have been persisted.
+func (t *tree) saved() {
+	t.changed = make(map[string]time.Time)
+	t.removed = nil
+}
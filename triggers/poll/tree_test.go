@@ -0,0 +1,115 @@
+package poll
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestTreePoll(t *testing.T) {
+	root := t.TempDir()
+
+	mkdir := func(dirs ...string) {
+		for _, dir := range dirs {
+			if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// touch sets a distinct modification time, as directories can be
+	// modified within the timestamp granularity of the file system.
+	modified := time.Now().Add(-time.Hour)
+	touch := func(dirs ...string) {
+		for _, dir := range dirs {
+			modified = modified.Add(time.Second)
+			if err := os.Chtimes(filepath.Join(root, dir), modified, modified); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	mkdir("Movies/Interstellar (2014)", "TV/Westworld/Season 1")
+
+	tr := newTree(root, autoscan.DefaultMaxDepth, make(map[string]time.Time), zerolog.Nop())
+	if created := tr.poll(); len(created) != 0 {
+		t.Fatalf("Expected the first poll to only record directories, got: %v", created)
+	}
+
+	if len(tr.dirs) != 6 {
+		t.Fatalf("Expected 6 directories, got: %v", tr.dirs)
+	}
+
+	mkdir("Movies/Parasite (2019)/Subs", "TV/Westworld/Season 2")
+	touch("Movies", "TV/Westworld")
+
+	want := []string{
+		filepath.Join(root, "Movies/Parasite (2019)"),
+		filepath.Join(root, "TV/Westworld/Season 2"),
+	}
+
+	if created := tr.poll(); !reflect.DeepEqual(created, want) {
+		t.Errorf("Created directories do not match: %v vs %v", created, want)
+	}
+
+	if created := tr.poll(); len(created) != 0 {
+		t.Errorf("Expected no new directories, got: %v", created)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "TV/Westworld")); err != nil {
+		t.Fatal(err)
+	}
+
+	touch("TV")
+	tr.saved()
+	tr.poll()
+
+	if len(tr.dirs) != 6 || len(tr.removed) != 3 {
+		t.Errorf("Expected the removed directories to be forgotten, got: %v", tr.dirs)
+	}
+}
+
+func TestTreeSymlinkCycle(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Movies"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(root, filepath.Join(root, "Movies", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := newTree(root, autoscan.DefaultMaxDepth, make(map[string]time.Time), zerolog.Nop())
+	tr.poll()
+
+	if len(tr.dirs) != 2 {
+		t.Errorf("Expected symlinks not to be followed, got: %v", tr.dirs)
+	}
+}
+
+func TestTreeMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a/b/c/d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := newTree(root, 2, make(map[string]time.Time), zerolog.Nop())
+	tr.poll()
+
+	want := []string{root, filepath.Join(root, "a"), filepath.Join(root, "a/b")}
+	if len(tr.dirs) != len(want) {
+		t.Fatalf("Expected %d directories, got: %v", len(want), tr.dirs)
+	}
+
+	for _, dir := range want {
+		if _, ok := tr.dirs[dir]; !ok {
+			t.Errorf("Expected directory %s to be walked", dir)
+		}
+	}
+}
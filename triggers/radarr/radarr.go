@@ -1,7 +1,7 @@
 package radarr
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
 	"strings"
@@ -13,10 +13,20 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name       string             `yaml:"name"`
+	Priority   int                `yaml:"priority"`
+	Deep       bool               `yaml:"deep"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	ScanRoot   autoscan.ScanRoot  `yaml:"scan-root"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
+
+	// NormalizeSeparators converts Windows paths before they are resolved and rewritten.
+	NormalizeSeparators bool `yaml:"normalize-separators"`
+
+	// Targets restricts the scans of the trigger to the named targets, all targets when empty.
+	// The targets are bound by cmd/autoscan, as they are not known by the trigger.
+	Targets []string `yaml:"targets"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Radarr webhooks.
@@ -28,9 +38,13 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
 		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
+			name:      c.Name,
+			callback:  callback,
+			priority:  c.Priority,
+			deep:      c.Deep,
+			root:      c.ScanRoot,
+			rewrite:   rewriter,
+			normalize: c.NormalizeSeparators,
 		}
 	}
 
@@ -38,9 +52,15 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 }
 
 type handler struct {
+	name     string
 	priority int
+	deep     bool
+	root     autoscan.ScanRoot
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+
+	// normalize converts Windows paths of events, e.g. D:\Media into D:/Media
+	normalize bool
 }
 
 type radarrEvent struct {
@@ -51,6 +71,8 @@ type radarrEvent struct {
 	} `json:"movieFile"`
 
 	Movie struct {
+		Title      string
+		Year       int
 		FolderPath string
 	} `json:"movie"`
 }
@@ -60,15 +82,19 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rlog := hlog.FromRequest(r)
 
 	event := new(radarrEvent)
-	err = json.NewDecoder(r.Body).Decode(event)
+	err = autoscan.DecodeWebhook(rw, r, event)
 	if err != nil {
 		rlog.Error().Err(err).Msg("Failed decoding request")
-		rw.WriteHeader(http.StatusBadRequest)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	rlog.Trace().Interface("event", event).Msg("Received JSON body")
 
+	if h.normalize {
+		event.normalizeSeparators()
+	}
+
 	if strings.EqualFold(event.Type, "Test") {
 		rlog.Info().Msg("Received test event")
 		rw.WriteHeader(http.StatusOK)
@@ -77,6 +103,9 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	var folderPath string
 
+	// the number of files is unknown when the entire folder changed
+	files := 0
+
 	if strings.EqualFold(event.Type, "Download") || strings.EqualFold(event.Type, "MovieFileDelete") {
 		if event.File.RelativePath == "" || event.Movie.FolderPath == "" {
 			rlog.Error().Msg("Required fields are missing")
@@ -85,6 +114,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 
 		folderPath = path.Dir(path.Join(event.Movie.FolderPath, event.File.RelativePath))
+		files = 1
 	}
 
 	if strings.EqualFold(event.Type, "MovieDelete") || strings.EqualFold(event.Type, "Rename") {
@@ -97,10 +127,30 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		folderPath = event.Movie.FolderPath
 	}
 
+	folderPath, ok := h.root.Resolve(folderPath)
+	if !ok {
+		rlog.Debug().
+			Str("path", folderPath).
+			Str("scan_root", string(h.root)).
+			Msg("Path outside of scan root, ignoring event")
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	scan := autoscan.Scan{
 		Folder:   h.rewrite(folderPath),
 		Priority: h.priority,
+		Deep:     h.deep,
 		Time:     now(),
+		ID:       autoscan.RequestScanID(r),
+		Reason:   event.reason(),
+		Files:    files,
+
+		Source:    h.name,
+		MediaType: "movie",
+
+		// removed movies should be cleared from the targets
+		Deleted: strings.EqualFold(event.Type, "MovieFileDelete") || strings.EqualFold(event.Type, "MovieDelete"),
 	}
 
 	err = h.callback(scan)
@@ -113,9 +163,38 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rlog.Info().
 		Str("path", folderPath).
 		Str("event", event.Type).
+		Bool("deleted", scan.Deleted).
 		Msg("Scan moved to processor")
 
 	rw.WriteHeader(http.StatusOK)
 }
 
+// normalizeSeparators converts the paths of the event into paths with forward slashes.
+func (e *radarrEvent) normalizeSeparators() {
+	e.File.RelativePath = autoscan.NormalizeSeparators(e.File.RelativePath)
+	e.Movie.FolderPath = autoscan.NormalizeSeparators(e.Movie.FolderPath)
+}
+
+// reason describes the event, e.g. "Radarr import: Interstellar (2014)".
+func (e radarrEvent) reason() string {
+	title := path.Base(e.Movie.FolderPath)
+	if e.Movie.Title != "" {
+		title = e.Movie.Title
+		if e.Movie.Year > 0 {
+			title += fmt.Sprintf(" (%d)", e.Movie.Year)
+		}
+	}
+
+	switch {
+	case strings.EqualFold(e.Type, "Download"):
+		return "Radarr import: " + title
+	case strings.EqualFold(e.Type, "MovieFileDelete"):
+		return "Radarr movie file deleted: " + title
+	case strings.EqualFold(e.Type, "MovieDelete"):
+		return "Radarr movie deleted: " + title
+	default:
+		return "Radarr " + strings.ToLower(e.Type) + ": " + title
+	}
+}
+
 var now = time.Now
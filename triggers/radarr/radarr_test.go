@@ -30,7 +30,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	standardConfig := Config{
-		Name:     "radarr",
+		Name:     "radarr-movies",
 		Priority: 5,
 		Rewrite: []autoscan.Rewrite{{
 			From: "/Movies/*",
@@ -38,6 +38,20 @@ func TestHandler(t *testing.T) {
 		}},
 	}
 
+	rootConfig := standardConfig
+	rootConfig.ScanRoot = "/Movies"
+
+	otherRootConfig := standardConfig
+	otherRootConfig.ScanRoot = "/TV"
+
+	windowsConfig := standardConfig
+	windowsConfig.NormalizeSeparators = true
+	windowsConfig.ScanRoot = "D:/Media"
+	windowsConfig.Rewrite = []autoscan.Rewrite{{
+		From: "^D:/Media/Movies/",
+		To:   "/mnt/unionfs/Media/Movies/",
+	}}
+
 	currentTime := time.Now()
 	now = func() time.Time {
 		return currentTime
@@ -54,9 +68,13 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/Movies/Interstellar (2014)",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr import: Interstellar (2014)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
+						Files:     1,
 					},
 				},
 			},
@@ -71,9 +89,14 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/Movies/Tenet (2020)",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Movies/Tenet (2020)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr movie file deleted: Tenet (2020)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
+						Files:     1,
+						Deleted:   true,
 					},
 				},
 			},
@@ -88,9 +111,13 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/Movies/Wonder Woman 1984 (2020)",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Movies/Wonder Woman 1984 (2020)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr movie deleted: Wonder Woman 1984 (2020)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
+						Deleted:   true,
 					},
 				},
 			},
@@ -105,9 +132,12 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/Movies/Deadpool (2016)",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/Movies/Deadpool (2016)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr rename: Deadpool (2016)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
 					},
 				},
 			},
@@ -122,6 +152,58 @@ func TestHandler(t *testing.T) {
 				StatusCode: 400,
 			},
 		},
+		{
+			"Download Event within the scan root",
+			Given{
+				Config:  rootConfig,
+				Fixture: "testdata/interstellar.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:    "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr import: Interstellar (2014)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
+						Files:     1,
+					},
+				},
+			},
+		},
+		{
+			"Ignores Download Event outside of the scan root",
+			Given{
+				Config:  otherRootConfig,
+				Fixture: "testdata/interstellar.json",
+			},
+			Expected{
+				StatusCode: 200,
+			},
+		},
+		{
+			"Download Event with a Windows path",
+			Given{
+				Config:  windowsConfig,
+				Fixture: "testdata/windows.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:    "/mnt/unionfs/Media/Movies/Interstellar (2014)",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Radarr import: Interstellar (2014)",
+						Source:    "radarr-movies",
+						MediaType: "movie",
+						Files:     1,
+					},
+				},
+			},
+		},
 		{
 			"Returns 200 on Test event without emitting a scan",
 			Given{
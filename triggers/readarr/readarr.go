@@ -1,7 +1,6 @@
 package readarr
 
 import (
-	"encoding/json"
 	"net/http"
 	"path"
 	"strings"
@@ -13,10 +12,20 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name       string             `yaml:"name"`
+	Priority   int                `yaml:"priority"`
+	Deep       bool               `yaml:"deep"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	ScanRoot   autoscan.ScanRoot  `yaml:"scan-root"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
+
+	// NormalizeSeparators converts Windows paths before they are resolved and rewritten.
+	NormalizeSeparators bool `yaml:"normalize-separators"`
+
+	// Targets restricts the scans of the trigger to the named targets, all targets when empty.
+	// The targets are bound by cmd/autoscan, as they are not known by the trigger.
+	Targets []string `yaml:"targets"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Readarr webhooks.
@@ -28,9 +37,13 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
 		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
+			name:      c.Name,
+			callback:  callback,
+			priority:  c.Priority,
+			deep:      c.Deep,
+			root:      c.ScanRoot,
+			rewrite:   rewriter,
+			normalize: c.NormalizeSeparators,
 		}
 	}
 
@@ -38,9 +51,15 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 }
 
 type handler struct {
+	name     string
 	priority int
+	deep     bool
+	root     autoscan.ScanRoot
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+
+	// normalize converts Windows paths of events, e.g. D:\Media into D:/Media
+	normalize bool
 }
 
 type readarrEvent struct {
@@ -50,6 +69,14 @@ type readarrEvent struct {
 	Files []struct {
 		Path string
 	} `json:"bookFiles"`
+
+	Author struct {
+		Name string
+	} `json:"author"`
+
+	Book struct {
+		Title string
+	} `json:"book"`
 }
 
 func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -57,15 +84,19 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	l := hlog.FromRequest(r)
 
 	event := new(readarrEvent)
-	err = json.NewDecoder(r.Body).Decode(event)
+	err = autoscan.DecodeWebhook(rw, r, event)
 	if err != nil {
 		l.Error().Err(err).Msg("Failed decoding request")
-		rw.WriteHeader(http.StatusBadRequest)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	l.Trace().Interface("event", event).Msg("Received JSON body")
 
+	if h.normalize {
+		event.normalizeSeparators()
+	}
+
 	if strings.EqualFold(event.Type, "Test") {
 		l.Info().Msg("Received test event")
 		rw.WriteHeader(http.StatusOK)
@@ -79,24 +110,47 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	unique := make(map[string]bool)
+	// index of the scan of every folder
+	unique := make(map[string]int)
 	scans := make([]autoscan.Scan, 0)
 
 	for _, f := range event.Files {
-		folderPath := path.Dir(h.rewrite(f.Path))
-		if _, ok := unique[folderPath]; ok {
+		filePath, ok := h.root.Resolve(f.Path)
+		if !ok {
+			l.Debug().
+				Str("path", f.Path).
+				Str("scan_root", string(h.root)).
+				Msg("Path outside of scan root, ignoring file")
+			continue
+		}
+
+		folderPath := path.Dir(h.rewrite(filePath))
+		if i, ok := unique[folderPath]; ok {
+			scans[i].Files++
 			continue
 		}
 
 		// add scan
-		unique[folderPath] = true
+		unique[folderPath] = len(scans)
 		scans = append(scans, autoscan.Scan{
 			Folder:   folderPath,
 			Priority: h.priority,
+			Deep:     h.deep,
 			Time:     now(),
+			ID:       autoscan.RequestScanID(r),
+			Reason:   event.reason(),
+			Files:    1,
+
+			Source:    h.name,
+			MediaType: "book",
 		})
 	}
 
+	if len(scans) == 0 {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
 	err = h.callback(scans...)
 	if err != nil {
 		l.Error().Err(err).Msg("Processor could not process scans")
@@ -111,4 +165,28 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		Msg("Scan moved to processor")
 }
 
+// normalizeSeparators converts the paths of the event into paths with forward slashes.
+func (e *readarrEvent) normalizeSeparators() {
+	for i := range e.Files {
+		e.Files[i].Path = autoscan.NormalizeSeparators(e.Files[i].Path)
+	}
+}
+
+// reason describes the event, e.g. "Readarr import: Brandon Sanderson - The Way of Kings".
+func (e readarrEvent) reason() string {
+	reason := "Readarr import"
+	if e.Upgrade {
+		reason = "Readarr upgrade"
+	}
+
+	switch {
+	case e.Author.Name != "" && e.Book.Title != "":
+		return reason + ": " + e.Author.Name + " - " + e.Book.Title
+	case e.Author.Name != "":
+		return reason + ": " + e.Author.Name
+	default:
+		return reason
+	}
+}
+
 var now = time.Now
@@ -30,7 +30,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	standardConfig := Config{
-		Name:     "readarr",
+		Name:     "readarr-books",
 		Priority: 5,
 		Rewrite: []autoscan.Rewrite{{
 			From: "/Books/*",
@@ -53,9 +53,13 @@ func TestHandler(t *testing.T) {
 			Expected{
 				StatusCode: 200,
 				Scans: []autoscan.Scan{{
-					Folder:   "/mnt/unionfs/Media/Books/Brandon Sanderson/The Way of Kings (2010)",
-					Priority: 5,
-					Time:     currentTime,
+					Folder:    "/mnt/unionfs/Media/Books/Brandon Sanderson/The Way of Kings (2010)",
+					Priority:  5,
+					Time:      currentTime,
+					Reason:    "Readarr import: Brandon Sanderson - The Way of Kings",
+					Source:    "readarr-books",
+					MediaType: "book",
+					Files:     1,
 				}},
 			},
 		},
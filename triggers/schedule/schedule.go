@@ -0,0 +1,152 @@
+// Package schedule provides a Trigger which scans folders at scheduled times,
+// to catch any changes missed by the other triggers.
+package schedule
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudbox/autoscan"
+)
+
+type Config struct {
+	Name      string   `yaml:"name"`
+	Cron      string   `yaml:"cron"`
+	Paths     []string `yaml:"paths"`
+	Deep      bool     `yaml:"deep"`
+	Priority  int      `yaml:"priority"`
+	Verbosity string   `yaml:"verbosity"`
+}
+
+// A Run describes the next run of a schedule.
+// Next is zero until the scheduler has started.
+type Run struct {
+	Name string    `json:"name"`
+	Cron string    `json:"cron"`
+	Next time.Time `json:"next"`
+}
+
+// A Scheduler adds the scans of every schedule to the processor at the scheduled times.
+type Scheduler struct {
+	cron     *cron.Cron
+	jobs     []job
+	callback autoscan.ProcessorFunc
+}
+
+type job struct {
+	id   cron.EntryID
+	name string
+	spec string
+}
+
+// New creates a Scheduler for the schedules.
+// A schedule without paths refreshes the default libraries of the targets.
+func New(configs []Config) (*Scheduler, error) {
+	s := &Scheduler{
+		cron: cron.New(),
+		jobs: make([]job, 0, len(configs)),
+	}
+
+	for _, c := range configs {
+		c := c
+
+		if c.Cron == "" {
+			return nil, fmt.Errorf("schedule %s: cron is required", c.Name)
+		}
+
+		schedule, err := cron.ParseStandard(c.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid cron %q: %w", c.Name, c.Cron, err)
+		}
+
+		name := c.Name
+		if name == "" {
+			name = c.Cron
+		}
+
+		l := autoscan.GetLogger(c.Verbosity).With().
+			Str("trigger", "schedule").
+			Str("schedule", name).
+			Logger()
+
+		id := s.cron.Schedule(schedule, cron.FuncJob(func() {
+			s.run(c, name, l)
+		}))
+
+		s.jobs = append(s.jobs, job{id: id, name: name, spec: c.Cron})
+	}
+
+	return s, nil
+}
+
+// Start adds the scans of the schedules to the processor from now on.
+func (s *Scheduler) Start(callback autoscan.ProcessorFunc) {
+	s.callback = callback
+	s.cron.Start()
+}
+
+// Runs returns the next run of every schedule.
+func (s *Scheduler) Runs() []Run {
+	runs := make([]Run, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		runs = append(runs, Run{
+			Name: j.name,
+			Cron: j.spec,
+			Next: s.cron.Entry(j.id).Next,
+		})
+	}
+
+	return runs
+}
+
+func (s *Scheduler) run(c Config, name string, l zerolog.Logger) {
+	scans := scheduledScans(c, name)
+
+	if err := s.callback(scans...); err != nil {
+		l.Error().
+			Err(err).
+			Msg("Processor could not process scans")
+		return
+	}
+
+	for _, scan := range scans {
+		l.Info().
+			Str("path", scan.Folder).
+			Msg("Scan moved to processor")
+	}
+}
+
+// scheduledScans returns the scans of a single run of the schedule.
+func scheduledScans(c Config, name string) []autoscan.Scan {
+	folders := make([]string, 0, len(c.Paths))
+	for _, p := range c.Paths {
+		folders = append(folders, filepath.Clean(p))
+	}
+
+	// an empty folder refreshes the default libraries
+	if len(folders) == 0 {
+		folders = append(folders, "")
+	}
+
+	id := autoscan.NewScanID()
+	scans := make([]autoscan.Scan, 0, len(folders))
+	for _, folder := range folders {
+		scans = append(scans, autoscan.Scan{
+			Folder:   folder,
+			Priority: c.Priority,
+			Time:     now(),
+			ID:       id,
+			Deep:     c.Deep,
+			Reason:   "Scheduled scan: " + name,
+			Source:   name,
+		})
+	}
+
+	return scans
+}
+
+var now = time.Now
@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudbox/autoscan"
+)
+
+func TestNew(t *testing.T) {
+	type Test struct {
+		Name    string
+		Configs []Config
+		Err     bool
+	}
+
+	var testCases = []Test{
+		{"Valid", []Config{{Name: "nightly", Cron: "0 3 * * *"}}, false},
+		{"Descriptor", []Config{{Cron: "@daily"}}, false},
+		{"Missing cron", []Config{{Name: "nightly"}}, true},
+		{"Invalid cron", []Config{{Name: "nightly", Cron: "0 3 * *"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := New(tc.Configs)
+			if (err != nil) != tc.Err {
+				t.Errorf("Errors do not match: %v vs %v", err, tc.Err)
+			}
+		})
+	}
+}
+
+func TestScheduledScans(t *testing.T) {
+	currentTime := time.Now()
+	now = func() time.Time {
+		return currentTime
+	}
+
+	type Test struct {
+		Name   string
+		Config Config
+		Want   []autoscan.Scan
+	}
+
+	var testCases = []Test{
+		{
+			"Paths",
+			Config{Paths: []string{"/mnt/unionfs/Media/Movies/", "/mnt/unionfs/Media/TV"}, Deep: true, Priority: 2},
+			[]autoscan.Scan{
+				{Folder: "/mnt/unionfs/Media/Movies", Priority: 2, Time: currentTime, Deep: true, Reason: "Scheduled scan: nightly", Source: "nightly"},
+				{Folder: "/mnt/unionfs/Media/TV", Priority: 2, Time: currentTime, Deep: true, Reason: "Scheduled scan: nightly", Source: "nightly"},
+			},
+		},
+		{
+			"Default libraries",
+			Config{},
+			[]autoscan.Scan{
+				{Folder: "", Time: currentTime, Reason: "Scheduled scan: nightly", Source: "nightly"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			scans := scheduledScans(tc.Config, "nightly")
+			id := scans[0].ID
+			for i := range scans {
+				if scans[i].ID == "" || scans[i].ID != id {
+					t.Errorf("Expected all scans to share an ID, got: %v", scans)
+				}
+
+				scans[i].ID = ""
+			}
+
+			if !reflect.DeepEqual(scans, tc.Want) {
+				t.Errorf("Scans do not match:\n%v\n%v", scans, tc.Want)
+			}
+		})
+	}
+}
+
+func TestRuns(t *testing.T) {
+	s, err := New([]Config{{Name: "nightly", Cron: "0 3 * * *"}, {Cron: "@hourly"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := s.Runs()
+	if len(runs) != 2 || runs[0].Name != "nightly" || runs[1].Name != "@hourly" {
+		t.Fatalf("Runs do not match: %v", runs)
+	}
+
+	if !runs[0].Next.IsZero() {
+		t.Errorf("Expected no next run before the scheduler started, got: %v", runs[0].Next)
+	}
+
+	s.Start(func(scans ...autoscan.Scan) error { return nil })
+	defer s.cron.Stop()
+
+	for _, run := range s.Runs() {
+		if run.Next.IsZero() || run.Next.Before(time.Now()) {
+			t.Errorf("Expected a next run in the future, got: %v", run)
+		}
+	}
+}
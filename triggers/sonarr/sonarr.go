@@ -1,7 +1,7 @@
 package sonarr
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
 	"strings"
@@ -13,10 +13,20 @@ import (
 )
 
 type Config struct {
-	Name      string             `yaml:"name"`
-	Priority  int                `yaml:"priority"`
-	Rewrite   []autoscan.Rewrite `yaml:"rewrite"`
-	Verbosity string             `yaml:"verbosity"`
+	Name       string             `yaml:"name"`
+	Priority   int                `yaml:"priority"`
+	Deep       bool               `yaml:"deep"`
+	Rewrite    []autoscan.Rewrite `yaml:"rewrite"`
+	ScanRoot   autoscan.ScanRoot  `yaml:"scan-root"`
+	Verbosity  string             `yaml:"verbosity"`
+	AllowedIPs []string           `yaml:"allowed-ips"`
+
+	// NormalizeSeparators converts Windows paths before they are resolved and rewritten.
+	NormalizeSeparators bool `yaml:"normalize-separators"`
+
+	// Targets restricts the scans of the trigger to the named targets, all targets when empty.
+	// The targets are bound by cmd/autoscan, as they are not known by the trigger.
+	Targets []string `yaml:"targets"`
 }
 
 // New creates an autoscan-compatible HTTP Trigger for Sonarr webhooks.
@@ -28,9 +38,13 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 
 	trigger := func(callback autoscan.ProcessorFunc) http.Handler {
 		return handler{
-			callback: callback,
-			priority: c.Priority,
-			rewrite:  rewriter,
+			name:      c.Name,
+			callback:  callback,
+			priority:  c.Priority,
+			deep:      c.Deep,
+			root:      c.ScanRoot,
+			rewrite:   rewriter,
+			normalize: c.NormalizeSeparators,
 		}
 	}
 
@@ -38,9 +52,15 @@ func New(c Config) (autoscan.HTTPTrigger, error) {
 }
 
 type handler struct {
+	name     string
 	priority int
+	deep     bool
+	root     autoscan.ScanRoot
 	rewrite  autoscan.Rewriter
 	callback autoscan.ProcessorFunc
+
+	// normalize converts Windows paths of events, e.g. D:\Media into D:/Media
+	normalize bool
 }
 
 type sonarrEvent struct {
@@ -50,10 +70,22 @@ type sonarrEvent struct {
 		RelativePath string
 	} `json:"episodeFile"`
 
+	// Files are sent instead of File when multiple episodes are imported at once,
+	// e.g. a full season.
+	Files []struct {
+		RelativePath string
+	} `json:"episodeFiles"`
+
 	Series struct {
-		Path string
+		Title string
+		Path  string
 	} `json:"series"`
 
+	Episodes []struct {
+		SeasonNumber  int
+		EpisodeNumber int
+	} `json:"episodes"`
+
 	RenamedFiles []struct {
 		// use PreviousPath as the Series.Path might have changed.
 		PreviousPath string
@@ -66,15 +98,19 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	rlog := hlog.FromRequest(r)
 
 	event := new(sonarrEvent)
-	err = json.NewDecoder(r.Body).Decode(event)
+	err = autoscan.DecodeWebhook(rw, r, event)
 	if err != nil {
 		rlog.Error().Err(err).Msg("Failed decoding request")
-		rw.WriteHeader(http.StatusBadRequest)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	rlog.Trace().Interface("event", event).Msg("Received JSON body")
 
+	if h.normalize {
+		event.normalizeSeparators()
+	}
+
 	if strings.EqualFold(event.Type, "Test") {
 		rlog.Info().Msg("Received test event")
 		rw.WriteHeader(http.StatusOK)
@@ -83,18 +119,29 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	var paths []string
 
+	// the number of files of every path, unknown when the entire folder changed
+	files := make(map[string]int)
+
 	// a Download event is either an upgrade or a new file.
 	// the EpisodeFileDelete event shares the same request format as Download.
 	if strings.EqualFold(event.Type, "Download") || strings.EqualFold(event.Type, "EpisodeFileDelete") {
-		if event.File.RelativePath == "" || event.Series.Path == "" {
+		relativePaths := event.relativePaths()
+		if len(relativePaths) == 0 || event.Series.Path == "" {
 			rlog.Error().Msg("Required fields are missing")
 			rw.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		// Use path.Dir to get the directory in which the file is located
-		folderPath := path.Dir(path.Join(event.Series.Path, event.File.RelativePath))
-		paths = append(paths, folderPath)
+		// Scan every folder once, e.g. the season folder of a full season import
+		for _, relativePath := range relativePaths {
+			// Use path.Dir to get the directory in which the file is located
+			folderPath := path.Dir(path.Join(event.Series.Path, relativePath))
+			if files[folderPath] == 0 {
+				paths = append(paths, folderPath)
+			}
+
+			files[folderPath]++
+		}
 	}
 
 	// An entire show has been deleted
@@ -122,6 +169,10 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		for _, renamedFile := range event.RenamedFiles {
 			previousPath := path.Dir(renamedFile.PreviousPath)
 			currentPath := path.Dir(path.Join(event.Series.Path, renamedFile.RelativePath))
+			files[previousPath]++
+			if currentPath != previousPath {
+				files[currentPath]++
+			}
 
 			// if previousPath not in paths, then add it.
 			if _, ok := encountered[previousPath]; !ok {
@@ -137,15 +188,35 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// removed episodes should be cleared from the targets
+	deleted := strings.EqualFold(event.Type, "EpisodeFileDelete") || strings.EqualFold(event.Type, "SeriesDelete")
+
 	var scans []autoscan.Scan
 
-	for _, folderPath := range paths {
-		folderPath := h.rewrite(folderPath)
+	for _, p := range paths {
+		folderPath, ok := h.root.Resolve(p)
+		if !ok {
+			rlog.Debug().
+				Str("path", folderPath).
+				Str("scan_root", string(h.root)).
+				Msg("Path outside of scan root, ignoring folder")
+			continue
+		}
+
+		folderPath = h.rewrite(folderPath)
 
 		scan := autoscan.Scan{
 			Folder:   folderPath,
 			Priority: h.priority,
+			Deep:     h.deep,
 			Time:     now(),
+			ID:       autoscan.RequestScanID(r),
+			Deleted:  deleted,
+			Reason:   event.reason(),
+			Files:    files[p],
+
+			Source:    h.name,
+			MediaType: "episode",
 		}
 
 		scans = append(scans, scan)
@@ -162,10 +233,65 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		rlog.Info().
 			Str("path", scan.Folder).
 			Str("event", event.Type).
+			Bool("deleted", scan.Deleted).
 			Msg("Scan moved to processor")
 	}
 
 	rw.WriteHeader(http.StatusOK)
 }
 
+// relativePaths returns the relative paths of the episode files of the event.
+func (e sonarrEvent) relativePaths() []string {
+	var paths []string
+	if e.File.RelativePath != "" {
+		paths = append(paths, e.File.RelativePath)
+	}
+
+	for _, f := range e.Files {
+		if f.RelativePath != "" {
+			paths = append(paths, f.RelativePath)
+		}
+	}
+
+	return paths
+}
+
+// normalizeSeparators converts the paths of the event into paths with forward slashes.
+func (e *sonarrEvent) normalizeSeparators() {
+	e.File.RelativePath = autoscan.NormalizeSeparators(e.File.RelativePath)
+	e.Series.Path = autoscan.NormalizeSeparators(e.Series.Path)
+
+	for i := range e.Files {
+		e.Files[i].RelativePath = autoscan.NormalizeSeparators(e.Files[i].RelativePath)
+	}
+
+	for i := range e.RenamedFiles {
+		e.RenamedFiles[i].PreviousPath = autoscan.NormalizeSeparators(e.RenamedFiles[i].PreviousPath)
+		e.RenamedFiles[i].RelativePath = autoscan.NormalizeSeparators(e.RenamedFiles[i].RelativePath)
+	}
+}
+
+// reason describes the event, e.g. "Sonarr import: Westworld S01E01".
+func (e sonarrEvent) reason() string {
+	title := e.Series.Title
+	if title == "" {
+		title = path.Base(e.Series.Path)
+	}
+
+	for _, episode := range e.Episodes {
+		title += fmt.Sprintf(" S%02dE%02d", episode.SeasonNumber, episode.EpisodeNumber)
+	}
+
+	switch {
+	case strings.EqualFold(e.Type, "Download"):
+		return "Sonarr import: " + title
+	case strings.EqualFold(e.Type, "EpisodeFileDelete"):
+		return "Sonarr episode deleted: " + title
+	case strings.EqualFold(e.Type, "SeriesDelete"):
+		return "Sonarr series deleted: " + title
+	default:
+		return "Sonarr " + strings.ToLower(e.Type) + ": " + title
+	}
+}
+
 var now = time.Now
@@ -30,7 +30,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	standardConfig := Config{
-		Name:     "sonarr",
+		Name:     "sonarr-tv",
 		Priority: 5,
 		Rewrite: []autoscan.Rewrite{{
 			From: "/TV/*",
@@ -54,9 +54,13 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr import: Westworld S01E01",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     1,
 					},
 				},
 			},
@@ -71,9 +75,14 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr episode deleted: Westworld S02E01",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     1,
+						Deleted:   true,
 					},
 				},
 			},
@@ -88,24 +97,40 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 1",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr rename: Westworld [imdb:tt0475784]",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     2,
 					},
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 1",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 1",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr rename: Westworld [imdb:tt0475784]",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     2,
 					},
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld/Season 2",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr rename: Westworld [imdb:tt0475784]",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     1,
 					},
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 2",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld [imdb:tt0475784]/Season 2",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr rename: Westworld [imdb:tt0475784]",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     1,
 					},
 				},
 			},
@@ -120,9 +145,43 @@ func TestHandler(t *testing.T) {
 				StatusCode: 200,
 				Scans: []autoscan.Scan{
 					{
-						Folder:   "/mnt/unionfs/Media/TV/Westworld",
-						Priority: 5,
-						Time:     currentTime,
+						Folder:    "/mnt/unionfs/Media/TV/Westworld",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr series deleted: Westworld",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Deleted:   true,
+					},
+				},
+			},
+		},
+		{
+			"Scans every folder once on a Download event with multiple files",
+			Given{
+				Config:  standardConfig,
+				Fixture: "testdata/season_import.json",
+			},
+			Expected{
+				StatusCode: 200,
+				Scans: []autoscan.Scan{
+					{
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 1",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr import: Westworld",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     3,
+					},
+					{
+						Folder:    "/mnt/unionfs/Media/TV/Westworld/Season 2",
+						Priority:  5,
+						Time:      currentTime,
+						Reason:    "Sonarr import: Westworld",
+						Source:    "sonarr-tv",
+						MediaType: "episode",
+						Files:     1,
 					},
 				},
 			},
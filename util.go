@@ -23,3 +23,19 @@ func DSN(path string, q url.Values) string {
 
 	return u.String()
 }
+
+// NormalizeSeparators converts a Windows path into a path with forward slashes,
+// e.g. D:\Media\Movies into D:/Media/Movies, so it can be rewritten and matched like other paths.
+// The drive letter is upper-cased, as Windows paths are matched regardless of its case.
+func NormalizeSeparators(p string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+	if len(p) >= 2 && p[1] == ':' && isLetter(p[0]) {
+		p = strings.ToUpper(p[:1]) + p[1:]
+	}
+
+	return p
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
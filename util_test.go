@@ -57,3 +57,26 @@ func TestDSN(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeSeparators(t *testing.T) {
+	type Test struct {
+		Path string
+		Want string
+	}
+
+	var testCases = []Test{
+		{Path: `D:\Media\Movies\Tenet (2020)`, Want: "D:/Media/Movies/Tenet (2020)"},
+		{Path: `d:\Media\Movies`, Want: "D:/Media/Movies"},
+		{Path: `\\nas\Media\TV`, Want: "//nas/Media/TV"},
+		{Path: "/mnt/unionfs/Media/TV", Want: "/mnt/unionfs/Media/TV"},
+		{Path: "", Want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Path, func(t *testing.T) {
+			if got := NormalizeSeparators(tc.Path); got != tc.Want {
+				t.Errorf("Paths do not match: %s vs %s", got, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package autoscan
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxDepth is the number of directory levels below a root
+// which are walked when no max-depth is configured.
+const DefaultMaxDepth = 20
+
+// WalkDirs calls fn for the root and every directory below it,
+// up to maxDepth levels below the root.
+//
+// Symlinks are not followed, so a symlink pointing back up the tree
+// cannot cause an endless walk.
+func WalkDirs(root string, maxDepth int, fn func(dir string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if err := fn(path); err != nil {
+			return err
+		}
+
+		if DirDepth(root, path) >= maxDepth {
+			return fs.SkipDir
+		}
+
+		return nil
+	})
+}
+
+// DirDepth returns the number of directory levels between root and dir,
+// e.g. 2 for /mnt/Media/Movies/Interstellar (2014) below /mnt/Media.
+func DirDepth(root string, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
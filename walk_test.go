@@ -0,0 +1,87 @@
+package autoscan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkDirs(t *testing.T) {
+	type Test struct {
+		Name     string
+		MaxDepth int
+		Want     []string
+	}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Movies", "Interstellar (2014)", "Subs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "Movies", "movies.nfo"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a symlink pointing back up the tree
+	if err := os.Symlink(root, filepath.Join(root, "Movies", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []Test{
+		{
+			Name:     "Root only",
+			MaxDepth: 0,
+			Want:     []string{"."},
+		},
+		{
+			Name:     "Limited depth",
+			MaxDepth: 2,
+			Want:     []string{".", "Movies", "Movies/Interstellar (2014)"},
+		},
+		{
+			Name:     "Does not follow symlinks",
+			MaxDepth: DefaultMaxDepth,
+			Want:     []string{".", "Movies", "Movies/Interstellar (2014)", "Movies/Interstellar (2014)/Subs"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var dirs []string
+			err := WalkDirs(root, tc.MaxDepth, func(dir string) error {
+				rel, err := filepath.Rel(root, dir)
+				dirs = append(dirs, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dirs, tc.Want) {
+				t.Errorf("Directories do not match: %v vs %v", dirs, tc.Want)
+			}
+		})
+	}
+}
+
+func TestDirDepth(t *testing.T) {
+	type Test struct {
+		Dir  string
+		Want int
+	}
+
+	var testCases = []Test{
+		{Dir: "/mnt/Media", Want: 0},
+		{Dir: "/mnt/Media/Movies", Want: 1},
+		{Dir: "/mnt/Media/Movies/Interstellar (2014)", Want: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Dir, func(t *testing.T) {
+			if got := DirDepth("/mnt/Media", tc.Dir); got != tc.Want {
+				t.Errorf("Depths do not match: %d vs %d", got, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package autoscan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// MaxWebhookSize is the maximum size in bytes of the body of a webhook request.
+const MaxWebhookSize = 1 << 20
+
+// DecodeWebhook decodes the JSON body of a webhook request into v.
+//
+// The request must have a JSON Content-Type and a body of at most MaxWebhookSize bytes.
+// The raw body is logged at the trace level.
+// The returned error is short enough to be sent back to the client.
+func DecodeWebhook(rw http.ResponseWriter, r *http.Request, v any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("unsupported content type %q: must be application/json", r.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, MaxWebhookSize))
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return fmt.Errorf("request body too large: must be at most %d bytes", MaxWebhookSize)
+	case err != nil:
+		return fmt.Errorf("failed reading request body: %w", err)
+	}
+
+	hlog.FromRequest(r).Trace().
+		Bytes("body", body).
+		Msg("Received request body")
+
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	return nil
+}
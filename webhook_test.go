@@ -0,0 +1,75 @@
+package autoscan
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeWebhook(t *testing.T) {
+	type Test struct {
+		Name        string
+		ContentType string
+		Body        string
+		WantErr     string
+	}
+
+	var testCases = []Test{
+		{
+			Name:        "Valid",
+			ContentType: "application/json",
+			Body:        `{"eventType": "Test"}`,
+		},
+		{
+			Name:        "Valid with charset",
+			ContentType: "application/json; charset=utf-8",
+			Body:        `{"eventType": "Test"}`,
+		},
+		{
+			Name:    "Missing content type",
+			Body:    `{"eventType": "Test"}`,
+			WantErr: "unsupported content type",
+		},
+		{
+			Name:        "Form content type",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        `eventType=Test`,
+			WantErr:     "unsupported content type",
+		},
+		{
+			Name:        "Malformed JSON",
+			ContentType: "application/json",
+			Body:        `{"eventType": `,
+			WantErr:     "invalid JSON body",
+		},
+		{
+			Name:        "Body too large",
+			ContentType: "application/json",
+			Body:        `{"eventType": "` + strings.Repeat("a", MaxWebhookSize) + `"}`,
+			WantErr:     "request body too large",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/triggers/sonarr", strings.NewReader(tc.Body))
+			if tc.ContentType != "" {
+				req.Header.Set("Content-Type", tc.ContentType)
+			}
+
+			var event struct {
+				Type string `json:"eventType"`
+			}
+
+			err := DecodeWebhook(httptest.NewRecorder(), req, &event)
+			switch {
+			case tc.WantErr == "" && err != nil:
+				t.Fatalf("Unexpected error: %v", err)
+			case tc.WantErr == "" && event.Type != "Test":
+				t.Errorf("Event types do not match: %s vs Test", event.Type)
+			case tc.WantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.WantErr)):
+				t.Errorf("Expected error %q, got: %v", tc.WantErr, err)
+			}
+		})
+	}
+}